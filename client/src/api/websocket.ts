@@ -0,0 +1,13 @@
+import { WSTicketResponse } from "@/utils/types";
+import axiosInstance from "./axiosInstance";
+
+const WS_URL = "ws://localhost:8080/api/v1/ws";
+
+// Opens the WebSocket with a single-use ticket, so the access token never
+// ends up in a URL.
+export const openWebSocket = async (): Promise<WebSocket> => {
+  const response = await axiosInstance.post<WSTicketResponse>("/ws/ticket");
+  return new WebSocket(
+    `${WS_URL}?ticket=${encodeURIComponent(response.data.ticket)}`
+  );
+};
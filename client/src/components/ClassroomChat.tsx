@@ -9,6 +9,7 @@ import { Avatar, AvatarFallback, AvatarImage } from "./ui/avatar";
 import { toast } from "sonner";
 import { jwtDecode } from "jwt-decode";
 import { refreshAccessToken } from "@/api/api";
+import { openWebSocket } from "@/api/websocket";
 import { useGetMessage } from "@/hooks/useCourse";
 
 type ConnectionStatus = "connecting" | "connected" | "disconnected" | "error";
@@ -69,8 +70,7 @@ const ClassroomChat: React.FC<{ course: Course }> = ({ course }) => {
   };
 
   const initializeWebSocket = async () => {
-    let token = localStorage.getItem("access_token");
-    if (!token) {
+    if (!localStorage.getItem("access_token")) {
       setConnectionStatus("error");
       setErrorMessage("Authentication required");
       return;
@@ -79,7 +79,6 @@ const ClassroomChat: React.FC<{ course: Course }> = ({ course }) => {
     if (isTokenExpiringSoon()) {
       const success = await handleTokenRefresh();
       if (!success) return;
-      token = localStorage.getItem("access_token")!;
     }
 
     if (socketRef.current) {
@@ -89,8 +88,15 @@ const ClassroomChat: React.FC<{ course: Course }> = ({ course }) => {
 
     setConnectionStatus("connecting");
 
-    const wsUrl = `ws://localhost:8080/api/v1/ws?token=${token}`;
-    const socket = new WebSocket(wsUrl);
+    let socket: WebSocket;
+    try {
+      socket = await openWebSocket();
+    } catch (error) {
+      console.error("Failed to get a WebSocket ticket:", error);
+      setConnectionStatus("error");
+      setErrorMessage("Failed to connect to chat");
+      return;
+    }
     socketRef.current = socket;
 
     socket.onopen = () => {
@@ -18,6 +18,7 @@ import { useLogout } from "@/hooks/useAuth";
 import { Link, useLocation, useNavigate } from "react-router-dom";
 import { Notification } from "@/utils/types";
 import { useNotificationStore } from "@/store/notificationStore";
+import { openWebSocket } from "@/api/websocket";
 
 interface HeaderProps {
   toggleSidebar: () => void;
@@ -39,50 +40,57 @@ const Header: React.FC<HeaderProps> = ({ toggleSidebar, pagePath = "" }) => {
   const [ws, setWs] = useState<WebSocket | null>(null);
 
   useEffect(() => {
-    // Get the access token from localStorage
-    const token = localStorage.getItem("access_token");
-    if (!token) {
+    if (!localStorage.getItem("access_token")) {
       console.error("No access token found in localStorage");
       return;
     }
 
-    // Create WebSocket connection
-    const websocket = new WebSocket(
-      `ws://localhost:8080/api/v1/ws?token=${token}`
-    );
-
-    // Set the Authorization header (Note: WebSocket in browsers doesn't support headers directly,
-    // so we may need to pass the token in a different way depending on the backend setup.
-    // For now, we'll assume the backend extracts it from a query param or handles it via the initial connection.)
-    websocket.onopen = () => {
-      console.log("WebSocket connection established");
-    };
-
-    websocket.onmessage = (event) => {
-      console.log("Received WebSocket message:", event.data);
-      const data = JSON.parse(event.data) as Notification;
-      console.log(data);
-      if ("data" in data) addNotification(data);
-      if (data.type === "post_created") {
-        setCurrentPostNotification(data);
-      } else if (data.type === "comment_added") {
-        setCurrentCommentNotification(data);
-      }
-    };
-
-    websocket.onerror = (error) => {
-      console.error("WebSocket error:", error);
-    };
-
-    websocket.onclose = () => {
-      console.log("WebSocket connection closed");
-    };
-
-    // Store the WebSocket instance in state
-    setWs(websocket);
+    let websocket: WebSocket | null = null;
+    let cancelled = false;
+
+    // Create WebSocket connection with a single-use ticket
+    openWebSocket()
+      .then((socket) => {
+        if (cancelled) {
+          socket.close();
+          return;
+        }
+        websocket = socket;
+
+        socket.onopen = () => {
+          console.log("WebSocket connection established");
+        };
+
+        socket.onmessage = (event) => {
+          console.log("Received WebSocket message:", event.data);
+          const data = JSON.parse(event.data) as Notification;
+          console.log(data);
+          if ("data" in data) addNotification(data);
+          if (data.type === "post_created") {
+            setCurrentPostNotification(data);
+          } else if (data.type === "comment_added") {
+            setCurrentCommentNotification(data);
+          }
+        };
+
+        socket.onerror = (error) => {
+          console.error("WebSocket error:", error);
+        };
+
+        socket.onclose = () => {
+          console.log("WebSocket connection closed");
+        };
+
+        // Store the WebSocket instance in state
+        setWs(socket);
+      })
+      .catch((error) => {
+        console.error("Failed to get a WebSocket ticket:", error);
+      });
 
     // Cleanup on component unmount
     return () => {
+      cancelled = true;
       if (websocket) {
         websocket.close();
       }
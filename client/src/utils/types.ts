@@ -90,6 +90,11 @@ export interface RefreshTokenResponse {
   refresh_token: string;
 }
 
+export interface WSTicketResponse {
+  ticket: string;
+  expires_at: string;
+}
+
 export interface CoursePreview extends Course {
   admin: User;
   total_members: number;
@@ -0,0 +1,89 @@
+// Command pushstub is a local Web Push service for development. It prints a
+// subscription to register with POST /api/v1/push/subscriptions, then logs
+// the decrypted messages the server pushes to it.
+//
+// Run the server with PUSH_ALLOW_INSECURE_ENDPOINTS=true so it accepts the
+// plain http endpoint. Messages to an endpoint ending in /gone are answered
+// with 410 Gone, which makes the server prune the subscription.
+package main
+
+import (
+	"course-flow/internal/push"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8090", "address to listen on")
+	flag.Parse()
+
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		log.Fatalf("Failed to generate subscription key: %v", err)
+	}
+	auth := make([]byte, 16)
+	if _, err := rand.Read(auth); err != nil {
+		log.Fatalf("Failed to generate auth secret: %v", err)
+	}
+
+	subscription := map[string]interface{}{
+		"endpoint": "http://" + *addr + "/push/stub",
+		"keys": map[string]string{
+			"p256dh": base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+			"auth":   base64.RawURLEncoding.EncodeToString(auth),
+		},
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	fmt.Println("Register this subscription (use an endpoint ending in /gone to test pruning):")
+	encoder.Encode(subscription)
+
+	http.HandleFunc("/push/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "vapid t=") {
+			http.Error(w, "Missing VAPID authorization", http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Content-Encoding") != "aes128gcm" {
+			http.Error(w, "Unsupported content encoding", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, 8192))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/gone") {
+			log.Printf("Answering %s with 410 Gone", r.URL.Path)
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+
+		payload, err := push.Decrypt(body, key, auth)
+		if err != nil {
+			log.Printf("Failed to decrypt message: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("TTL=%s Urgency=%s %s", r.Header.Get("TTL"), r.Header.Get("Urgency"), payload)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	log.Printf("Push stub listening on http://%s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
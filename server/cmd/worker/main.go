@@ -0,0 +1,42 @@
+// Command worker runs background jobs outside the server process. Start the
+// server with JOBS_IN_PROCESS=false and run as many workers as needed; they
+// share the jobs table and each job is run by one of them.
+//
+// On SIGINT or SIGTERM the worker stops claiming jobs and waits for the ones
+// it is running to finish.
+package main
+
+import (
+	"context"
+	"course-flow/internal/jobs"
+	"course-flow/internal/mailer"
+	"course-flow/pkg/database"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	db, err := database.InitDB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	mail, err := mailer.NewMailerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to create mailer: %v", err)
+	}
+
+	runner, err := jobs.NewAppRunner(db, mail)
+	if err != nil {
+		log.Fatalf("Failed to create job runner: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	runner.Run(ctx)
+	log.Println("Worker stopped")
+}
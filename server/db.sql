@@ -8,6 +8,7 @@ CREATE TABLE users (
     avatar VARCHAR(255),
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    is_admin BOOLEAN NOT NULL DEFAULT FALSE -- Operators of the instance, granted by hand
 );
 
 CREATE TABLE refresh_tokens (
@@ -68,6 +69,8 @@ CREATE TABLE documents (
     created_at timestamp without time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at timestamp without time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
     file_name character varying(100) NOT NULL,
+    file_size bigint NOT NULL DEFAULT 0,
+    thumbnail_path text, -- Server generated preview for images
     CONSTRAINT documents_pkey PRIMARY KEY (id),
     CONSTRAINT documents_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
@@ -89,21 +92,574 @@ CREATE TABLE notifications (
     data JSONB, -- For storing the additional data
     timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     is_read BOOLEAN DEFAULT FALSE,
-    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+    delivery VARCHAR(20) NOT NULL DEFAULT 'in_app', -- in_app or email (held for the digest)
+    count INT NOT NULL DEFAULT 1, -- Events grouped into this notification
+    open_group BOOLEAN NOT NULL DEFAULT FALSE, -- Further events of its type and course are counted into it
+    event_id UUID, -- Outbox event that caused it, NULL for direct notifications
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (event_id, recipient_id)
 );
 
 CREATE INDEX idx_notifications_recipient_id ON notifications(recipient_id);
 CREATE INDEX idx_notifications_class_id ON notifications(class_id);
+-- A recipient has one open group per type, course and delivery, so concurrent
+-- sends are counted into the same notification
+CREATE UNIQUE INDEX idx_notifications_open_group ON notifications(recipient_id, type, class_id, delivery) WHERE is_read = FALSE AND open_group;
+
+-- Private one-to-one and small group conversations between members of a course
+CREATE TABLE conversations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    course_id UUID NOT NULL REFERENCES courses(id) ON DELETE CASCADE, -- Course shared by the participants
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    is_group BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE conversation_participants (
+    conversation_id UUID REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    last_read_at TIMESTAMP, -- Read watermark for the conversation
+    joined_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (conversation_id, user_id)
+);
+
+CREATE INDEX idx_conversation_participants_user_id ON conversation_participants(user_id);
+
+CREATE TABLE chat_settings (
+    course_id UUID PRIMARY KEY REFERENCES courses(id) ON DELETE CASCADE,
+    allow_student_dms BOOLEAN NOT NULL DEFAULT TRUE,
+    slow_mode_seconds INT NOT NULL DEFAULT 0 CHECK (slow_mode_seconds >= 0), -- Minimum delay between messages of a member
+    staff_only BOOLEAN NOT NULL DEFAULT FALSE, -- Only moderators and above can post
+    blocked_words TEXT[] NOT NULL DEFAULT '{}',
+    filter_mode VARCHAR(10) NOT NULL DEFAULT 'reject' CHECK (filter_mode IN ('reject', 'mask')),
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Members temporarily muted in a course chat
+CREATE TABLE chat_mutes (
+    course_id UUID REFERENCES courses(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    muted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    muted_until TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (course_id, user_id)
+);
 
 CREATE TABLE messages (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    course_id UUID NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    course_id UUID REFERENCES courses(id) ON DELETE CASCADE, -- Set for course chat
+    conversation_id UUID REFERENCES conversations(id) ON DELETE CASCADE, -- Set for direct messages
     from_id UUID REFERENCES users(id) ON DELETE SET NULL,
     content TEXT NOT NULL,
-    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+    parent_id UUID REFERENCES messages(id) ON DELETE SET NULL, -- Message being replied to
+    edited_at TIMESTAMP,
+    deleted_at TIMESTAMP, -- Soft delete so replies can still quote the parent
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT messages_scope_check CHECK ((course_id IS NULL) <> (conversation_id IS NULL))
+);
+
+-- Uploaded documents attached to chat messages
+CREATE TABLE message_attachments (
+    message_id UUID REFERENCES messages(id) ON DELETE CASCADE,
+    document_id UUID UNIQUE REFERENCES documents(id) ON DELETE CASCADE, -- A document belongs to one message
+    PRIMARY KEY (message_id, document_id)
 );
 
 -- Indexes for performance
 CREATE INDEX idx_messages_course_id ON messages(course_id);
+CREATE INDEX idx_messages_conversation_id ON messages(conversation_id);
 CREATE INDEX idx_messages_from_id ON messages(from_id);
-CREATE INDEX idx_messages_created_at ON messages(created_at);
\ No newline at end of file
+CREATE INDEX idx_messages_created_at ON messages(created_at);
+
+-- Per-user read watermark for each course chat
+CREATE TABLE message_reads (
+    course_id UUID REFERENCES courses(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    last_read_message_id UUID REFERENCES messages(id) ON DELETE SET NULL,
+    last_read_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (course_id, user_id)
+);
+
+-- Hub broker events too large for a single NOTIFY payload
+CREATE TABLE hub_broker_payloads (
+    id BIGSERIAL PRIMARY KEY,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Outbound WebSocket frames kept for replay after a reconnect. The ID is the
+-- event ID clients acknowledge and resume from.
+CREATE TABLE hub_events (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(20) NOT NULL,
+    course_id UUID REFERENCES courses(id) ON DELETE CASCADE, -- Audience: members of the course
+    recipient_ids UUID[], -- Audience: these users
+    sender_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_hub_events_course_id ON hub_events(course_id, id);
+CREATE INDEX idx_hub_events_recipient_ids ON hub_events USING GIN (recipient_ids);
+CREATE INDEX idx_hub_events_created_at ON hub_events(created_at);
+
+CREATE TABLE hub_event_acks (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    last_event_id BIGINT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE presence_settings (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    appear_offline BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Short-lived, single-use tickets to open WebSocket and event stream
+-- connections, so access tokens stay out of URLs
+CREATE TABLE ws_tickets (
+    ticket_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_expires_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_ws_tickets_expires_at ON ws_tickets(expires_at);
+
+-- How a user receives each type of notification, for all courses (course_id
+-- NULL) or overridden for one course. Missing rows mean in_app.
+CREATE TABLE notification_preferences (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    course_id UUID REFERENCES courses(id) ON DELETE CASCADE,
+    channel VARCHAR(20) NOT NULL CHECK (channel IN ('in_app', 'email', 'off')),
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_notification_preferences_global ON notification_preferences(user_id, type) WHERE course_id IS NULL;
+CREATE UNIQUE INDEX idx_notification_preferences_course ON notification_preferences(user_id, type, course_id) WHERE course_id IS NOT NULL;
+
+-- Courses a user silenced, indefinitely when muted_until is NULL
+CREATE TABLE notification_course_mutes (
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    course_id UUID REFERENCES courses(id) ON DELETE CASCADE,
+    muted_until TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, course_id)
+);
+
+-- How often a user gets an email digest of unread notifications, and when
+-- the last one was sent. Missing rows mean off, digests are opt-in.
+CREATE TABLE digest_settings (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    frequency VARCHAR(10) NOT NULL DEFAULT 'off' CHECK (frequency IN ('daily', 'weekly', 'off')),
+    last_sent_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The server's VAPID key pair for Web Push, generated on first start. There
+-- is a single row.
+CREATE TABLE vapid_keys (
+    id INT PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    private_key TEXT NOT NULL,
+    public_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Web Push subscriptions registered by a user's browsers
+CREATE TABLE push_subscriptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    endpoint TEXT NOT NULL UNIQUE,
+    p256dh TEXT NOT NULL,
+    auth TEXT NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_push_subscriptions_user_id ON push_subscriptions(user_id);
+
+-- Endpoints course admins registered to receive course events
+CREATE TABLE webhooks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    course_id UUID NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    event_types TEXT[] NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_webhooks_course_id ON webhooks(course_id);
+
+-- One event sent to one webhook. Pending deliveries are retried with
+-- exponential backoff until next_attempt_at is cleared.
+CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_id UUID NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    response_status INT,
+    next_attempt_at TIMESTAMP,
+    replay_of UUID REFERENCES webhook_deliveries(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at DESC);
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+-- An event is delivered once per webhook, replays aside
+CREATE UNIQUE INDEX idx_webhook_deliveries_event ON webhook_deliveries(webhook_id, event_id) WHERE replay_of IS NULL;
+
+-- Every request made for a delivery, with the response status received. Bodies
+-- are not kept, receivers could otherwise be used to read internal hosts.
+CREATE TABLE webhook_delivery_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id UUID NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+    attempt INT NOT NULL,
+    response_status INT,
+    error TEXT NOT NULL DEFAULT '',
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    attempted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_webhook_delivery_attempts_delivery ON webhook_delivery_attempts(delivery_id, attempt);
+
+-- Domain events written in the same transaction as the change that caused
+-- them, and dispatched to their consumers at least once
+CREATE TABLE outbox_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    type VARCHAR(50) NOT NULL,
+    course_id UUID,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'dispatched', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    available_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    dispatched_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_outbox_events_due ON outbox_events(available_at) WHERE status = 'pending';
+CREATE INDEX idx_outbox_events_dispatched ON outbox_events(dispatched_at) WHERE status = 'dispatched';
+
+-- Consumers that already handled an event, so retries skip them
+CREATE TABLE outbox_consumers (
+    event_id UUID REFERENCES outbox_events(id) ON DELETE CASCADE,
+    consumer VARCHAR(50) NOT NULL,
+    consumed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, consumer)
+);
+
+-- Background jobs, claimed by workers with SKIP LOCKED. Jobs that keep
+-- failing end up dead until an admin retries them.
+CREATE TABLE jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    type VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'succeeded', 'dead')),
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP,
+    finished_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_jobs_due ON jobs(type, run_at) WHERE status = 'pending';
+CREATE INDEX idx_jobs_running ON jobs(type, locked_until) WHERE status = 'running';
+CREATE INDEX idx_jobs_created ON jobs(created_at DESC, id DESC);
+
+-- Recurring jobs. Whichever worker moves next_run_at forward enqueues the run.
+CREATE TABLE job_schedules (
+    name VARCHAR(100) PRIMARY KEY,
+    spec VARCHAR(100) NOT NULL,
+    next_run_at TIMESTAMP NOT NULL,
+    last_run_at TIMESTAMP
+);
+
+-- Dated course events. Times are UTC; recurring events repeat at the same
+-- wall clock time in their time zone.
+CREATE TABLE course_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    course_id UUID NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    uid VARCHAR(255) NOT NULL, -- iCalendar UID, matches events on re-import
+    title VARCHAR(200) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    location VARCHAR(255) NOT NULL DEFAULT '',
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('lecture', 'exam', 'office_hours', 'due_date', 'other')),
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    all_day BOOLEAN NOT NULL DEFAULT FALSE,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    rrule TEXT NOT NULL DEFAULT '',
+    exdates TIMESTAMP[] NOT NULL DEFAULT '{}',
+    last_ends_at TIMESTAMP, -- End of the last occurrence, NULL when it repeats forever
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (course_id, uid)
+);
+
+CREATE INDEX idx_course_events_course ON course_events(course_id, starts_at);
+
+-- Private tokens of the iCalendar subscription URLs
+CREATE TABLE calendar_feed_tokens (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Class meetings attendance is taken for. Check-in is open while
+-- checkin_closes_at is in the future; codes are derived from checkin_secret.
+CREATE TABLE class_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    course_id UUID NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    title VARCHAR(200) NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    late_after TIMESTAMP NOT NULL,
+    checkin_secret VARCHAR(64) NOT NULL,
+    checkin_closes_at TIMESTAMP,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_class_sessions_course ON class_sessions(course_id, starts_at);
+CREATE INDEX idx_class_sessions_checkin ON class_sessions(checkin_closes_at) WHERE checkin_closes_at IS NOT NULL;
+
+-- Students without a record were absent
+CREATE TABLE attendance_records (
+    session_id UUID REFERENCES class_sessions(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('present', 'late', 'excused', 'absent')),
+    checked_in_at TIMESTAMP,
+    marked_by UUID REFERENCES users(id) ON DELETE SET NULL, -- Staff member who set the status by hand
+    note TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (session_id, user_id)
+);
+
+CREATE INDEX idx_attendance_records_user ON attendance_records(user_id);
+
+-- Office hours of a staff member. Booking windows are split into slots of
+-- slot_minutes for up to capacity students each; queue windows take drop-ins.
+CREATE TABLE office_hours (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    course_id UUID NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    host_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_id UUID REFERENCES course_events(id) ON DELETE SET NULL, -- Entry in the course calendar
+    title VARCHAR(200) NOT NULL,
+    location VARCHAR(255) NOT NULL DEFAULT '',
+    mode VARCHAR(10) NOT NULL CHECK (mode IN ('booking', 'queue')),
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    slot_minutes INT NOT NULL DEFAULT 0,
+    capacity INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_office_hours_course ON office_hours(course_id, starts_at);
+CREATE INDEX idx_office_hours_host ON office_hours(host_id, starts_at);
+
+CREATE TABLE office_hour_bookings (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    office_hour_id UUID NOT NULL REFERENCES office_hours(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    reminded_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (office_hour_id, user_id)
+);
+
+CREATE INDEX idx_office_hour_bookings_slot ON office_hour_bookings(office_hour_id, starts_at);
+CREATE INDEX idx_office_hour_bookings_user ON office_hour_bookings(user_id, starts_at);
+
+-- Drop-in queue of queue windows. A student has at most one active entry.
+CREATE TABLE office_hour_queue (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    office_hour_id UUID NOT NULL REFERENCES office_hours(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('waiting', 'serving', 'done', 'left')),
+    note TEXT NOT NULL DEFAULT '',
+    joined_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_office_hour_queue_active ON office_hour_queue(office_hour_id, user_id) WHERE status IN ('waiting', 'serving');
+CREATE INDEX idx_office_hour_queue_order ON office_hour_queue(office_hour_id, joined_at) WHERE status IN ('waiting', 'serving');
+
+-- Reusable grading rubrics of a course: criteria with performance levels
+-- worth points. Rubrics used for grading cannot change.
+CREATE TABLE rubrics (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    course_id UUID NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    title VARCHAR(200) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_rubrics_course ON rubrics(course_id);
+
+CREATE TABLE rubric_criteria (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    rubric_id UUID NOT NULL REFERENCES rubrics(id) ON DELETE CASCADE,
+    title VARCHAR(200) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    position INT NOT NULL
+);
+
+CREATE INDEX idx_rubric_criteria_rubric ON rubric_criteria(rubric_id, position);
+
+CREATE TABLE rubric_levels (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    criterion_id UUID NOT NULL REFERENCES rubric_criteria(id) ON DELETE CASCADE,
+    title VARCHAR(200) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    points NUMERIC(8, 2) NOT NULL CHECK (points >= 0),
+    position INT NOT NULL
+);
+
+CREATE INDEX idx_rubric_levels_criterion ON rubric_levels(criterion_id, position);
+
+-- Ordered units of course material. Students can open a module once it is
+-- released and every item of its prerequisite modules is complete.
+CREATE TABLE course_modules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    course_id UUID NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    title VARCHAR(200) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    position INT NOT NULL,
+    release_at TIMESTAMP,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_course_modules_course ON course_modules(course_id, position);
+
+CREATE TABLE course_module_prerequisites (
+    module_id UUID REFERENCES course_modules(id) ON DELETE CASCADE,
+    prerequisite_id UUID REFERENCES course_modules(id) ON DELETE CASCADE,
+    PRIMARY KEY (module_id, prerequisite_id),
+    CHECK (module_id <> prerequisite_id)
+);
+
+CREATE TABLE module_items (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    module_id UUID NOT NULL REFERENCES course_modules(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('page', 'attachment', 'link', 'assignment', 'quiz')),
+    title VARCHAR(200) NOT NULL,
+    body TEXT NOT NULL DEFAULT '', -- Page content or instructions
+    url TEXT NOT NULL DEFAULT '',
+    document_id UUID REFERENCES documents(id) ON DELETE CASCADE, -- File of attachment items
+    due_at TIMESTAMP,
+    points INT CHECK (points >= 0),
+    rubric_id UUID REFERENCES rubrics(id) ON DELETE SET NULL, -- Rubric assignments are graded with
+    position INT NOT NULL,
+    release_at TIMESTAMP,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_module_items_module ON module_items(module_id, position);
+
+CREATE TABLE module_item_completions (
+    item_id UUID REFERENCES module_items(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    completed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (item_id, user_id)
+);
+
+CREATE INDEX idx_module_item_completions_user ON module_item_completions(user_id);
+
+-- Work students hand in for assignment items. Resubmitting replaces it.
+CREATE TABLE submissions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    item_id UUID NOT NULL REFERENCES module_items(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body TEXT NOT NULL DEFAULT '',
+    submitted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (item_id, user_id)
+);
+
+CREATE INDEX idx_submissions_user ON submissions(user_id);
+
+CREATE TABLE submission_files (
+    submission_id UUID REFERENCES submissions(id) ON DELETE CASCADE,
+    document_id UUID REFERENCES documents(id) ON DELETE CASCADE,
+    PRIMARY KEY (submission_id, document_id)
+);
+
+-- Grade of a submission. Students see it once it is returned.
+CREATE TABLE submission_grades (
+    submission_id UUID PRIMARY KEY REFERENCES submissions(id) ON DELETE CASCADE,
+    rubric_id UUID NOT NULL REFERENCES rubrics(id),
+    grader_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    score NUMERIC(8, 2) NOT NULL,
+    max_score NUMERIC(8, 2) NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    returned_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE submission_grade_criteria (
+    submission_id UUID REFERENCES submission_grades(submission_id) ON DELETE CASCADE,
+    criterion_id UUID REFERENCES rubric_criteria(id),
+    level_id UUID REFERENCES rubric_levels(id),
+    points NUMERIC(8, 2) NOT NULL CHECK (points >= 0),
+    comment TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (submission_id, criterion_id)
+);
+
+-- Peer review of the submissions for an assignment, opened by an instructor
+-- after its due date. Every submission goes to reviewers_per_submission other
+-- authors.
+CREATE TABLE peer_review_phases (
+    item_id UUID PRIMARY KEY REFERENCES module_items(id) ON DELETE CASCADE,
+    rubric_id UUID NOT NULL REFERENCES rubrics(id),
+    reviewers_per_submission INT NOT NULL CHECK (reviewers_per_submission > 0),
+    anonymous BOOLEAN NOT NULL DEFAULT FALSE,
+    due_at TIMESTAMP,
+    opened_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    opened_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    closed_at TIMESTAMP
+);
+
+CREATE TABLE peer_reviews (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    item_id UUID NOT NULL REFERENCES peer_review_phases(item_id) ON DELETE CASCADE,
+    submission_id UUID NOT NULL REFERENCES submissions(id) ON DELETE CASCADE,
+    reviewer_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    score NUMERIC(8, 2),
+    max_score NUMERIC(8, 2),
+    comment TEXT NOT NULL DEFAULT '',
+    assigned_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    submitted_at TIMESTAMP,
+    UNIQUE (submission_id, reviewer_id)
+);
+
+CREATE INDEX idx_peer_reviews_item ON peer_reviews(item_id);
+CREATE INDEX idx_peer_reviews_reviewer ON peer_reviews(reviewer_id);
+
+CREATE TABLE peer_review_criteria (
+    review_id UUID REFERENCES peer_reviews(id) ON DELETE CASCADE,
+    criterion_id UUID REFERENCES rubric_criteria(id),
+    level_id UUID REFERENCES rubric_levels(id),
+    points NUMERIC(8, 2) NOT NULL CHECK (points >= 0),
+    comment TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (review_id, criterion_id)
+);
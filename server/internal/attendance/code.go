@@ -0,0 +1,72 @@
+// Package attendance derives the rotating check-in codes of class sessions.
+//
+// A code is the HMAC of the current time window keyed with the session's
+// secret, so every instance computes the same code without coordination and
+// nothing has to be stored when it rotates.
+package attendance
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+	"time"
+)
+
+// CodeInterval is how long a code is shown before it rotates.
+const CodeInterval = 10 * time.Second
+
+// codeLength characters from codeAlphabet give about 10^9 codes. Only the
+// current and the previous code are accepted, which leaves no time to guess.
+const codeLength = 6
+
+// codeAlphabet leaves out characters that are easily confused, like O and 0.
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// Code returns the code of the window t falls in.
+func Code(secret string, t time.Time) string {
+	return code(secret, window(t))
+}
+
+// ExpiresAt returns when the code of the window t falls in rotates.
+func ExpiresAt(t time.Time) time.Time {
+	return time.Unix(0, (window(t)+1)*int64(CodeInterval)).UTC()
+}
+
+// Verify reports whether code is the current or the previous code, giving
+// students one rotation to type it in.
+func Verify(secret, submitted string, now time.Time) bool {
+	submitted = strings.ToUpper(strings.TrimSpace(submitted))
+	if len(submitted) != codeLength {
+		return false
+	}
+
+	current := window(now)
+	valid := false
+	for _, w := range []int64{current, current - 1} {
+		if hmac.Equal([]byte(submitted), []byte(code(secret, w))) {
+			valid = true
+		}
+	}
+	return valid
+}
+
+func window(t time.Time) int64 {
+	return t.UnixNano() / int64(CodeInterval)
+}
+
+func code(secret string, w int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(w))
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// 256 is a multiple of the alphabet size, so every character is equally
+	// likely
+	b := make([]byte, codeLength)
+	for i := range b {
+		b[i] = codeAlphabet[int(sum[i])%len(codeAlphabet)]
+	}
+	return string(b)
+}
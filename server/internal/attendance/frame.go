@@ -0,0 +1,25 @@
+package attendance
+
+import (
+	"course-flow/internal/types"
+	"encoding/json"
+	"time"
+)
+
+// CurrentCode returns the code of the open check-in at now, as sent to the
+// course staff.
+func CurrentCode(checkIn types.OpenCheckIn, now time.Time) types.CheckInCode {
+	code := Code(checkIn.Secret, now)
+	// The QR code holds the request the scanning client submits
+	qrPayload, _ := json.Marshal(types.CheckInRequest{SessionID: checkIn.SessionID, Code: code})
+
+	return types.CheckInCode{
+		Type:      types.FrameCheckInCode,
+		SessionID: checkIn.SessionID,
+		CourseID:  checkIn.CourseID,
+		Code:      code,
+		QRPayload: string(qrPayload),
+		ExpiresAt: ExpiresAt(now),
+		CheckedIn: checkIn.CheckedIn,
+	}
+}
@@ -0,0 +1,102 @@
+package calendar
+
+import (
+	"course-flow/internal/types"
+	"fmt"
+	"time"
+)
+
+// Normalize checks the time zone and recurrence rule of an event, formats
+// the rule the way it is stored and works out when the last occurrence ends.
+func Normalize(event *types.CourseEvent) error {
+	if event.Timezone == "" {
+		event.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(event.Timezone)
+	if err != nil {
+		return fmt.Errorf("unknown time zone %q", event.Timezone)
+	}
+	if event.EndsAt.Before(event.StartsAt) {
+		return fmt.Errorf("event ends before it starts")
+	}
+
+	event.LastEndsAt = nil
+	if event.RRule == "" {
+		endsAt := event.EndsAt
+		event.LastEndsAt = &endsAt
+		return nil
+	}
+
+	rule, err := ParseRRule(event.RRule, loc)
+	if err != nil {
+		return fmt.Errorf("invalid recurrence rule: %v", err)
+	}
+	event.RRule = rule.String()
+
+	if last, ok := rule.Last(event.StartsAt.In(loc)); ok {
+		endsAt := last.Add(event.EndsAt.Sub(event.StartsAt)).UTC()
+		event.LastEndsAt = &endsAt
+	}
+	return nil
+}
+
+// Expand returns up to limit occurrences of the event that overlap the range
+// from - to, in order.
+func Expand(event types.CourseEvent, from, to time.Time, limit int) ([]types.EventOccurrence, error) {
+	loc, err := time.LoadLocation(event.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q of event %s", event.Timezone, event.ID)
+	}
+	duration := event.EndsAt.Sub(event.StartsAt)
+
+	var occurrences []types.EventOccurrence
+	add := func(start time.Time) bool {
+		if !start.Before(to) {
+			return false
+		}
+		end := start.Add(duration)
+		if end.After(from) || (duration == 0 && !start.Before(from)) {
+			if !cancelled(event.ExDates, start) {
+				occurrences = append(occurrences, occurrence(event, start.UTC(), end.UTC()))
+			}
+		}
+		return len(occurrences) < limit
+	}
+
+	if event.RRule == "" {
+		add(event.StartsAt)
+		return occurrences, nil
+	}
+
+	rule, err := ParseRRule(event.RRule, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recurrence rule of event %s: %v", event.ID, err)
+	}
+	rule.each(event.StartsAt.In(loc), add)
+	return occurrences, nil
+}
+
+func cancelled(exDates []time.Time, start time.Time) bool {
+	for _, exDate := range exDates {
+		if exDate.Equal(start) {
+			return true
+		}
+	}
+	return false
+}
+
+func occurrence(event types.CourseEvent, start, end time.Time) types.EventOccurrence {
+	return types.EventOccurrence{
+		EventID:    event.ID,
+		CourseID:   event.CourseID,
+		CourseName: event.CourseName,
+		Title:      event.Title,
+		Location:   event.Location,
+		Kind:       event.Kind,
+		StartsAt:   start,
+		EndsAt:     end,
+		AllDay:     event.AllDay,
+		Timezone:   event.Timezone,
+		Recurring:  event.RRule != "",
+	}
+}
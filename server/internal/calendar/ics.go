@@ -0,0 +1,441 @@
+package calendar
+
+import (
+	"bufio"
+	"bytes"
+	"course-flow/internal/types"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405"
+	utcLayout      = "20060102T150405Z"
+	// maxLineLength is the longest content line, in octets, before it is
+	// folded.
+	maxLineLength = 75
+)
+
+var categoryNames = map[string]string{
+	types.CalendarLecture:     "Lecture",
+	types.CalendarExam:        "Exam",
+	types.CalendarOfficeHours: "Office hours",
+	types.CalendarDueDate:     "Due date",
+	types.CalendarOther:       "Other",
+}
+
+// WriteCalendar writes the events as an iCalendar feed named name.
+// Recurring events keep their rule and calendar apps expand them.
+func WriteCalendar(w io.Writer, name string, events []types.CourseEvent) error {
+	bw := bufio.NewWriter(w)
+	line := func(s string) {
+		writeFolded(bw, s)
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Course Flow//Course Calendar//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + escapeText(name))
+	line("REFRESH-INTERVAL;VALUE=DURATION:PT1H")
+	line("X-PUBLISHED-TTL:PT1H")
+
+	for _, event := range events {
+		loc, err := time.LoadLocation(event.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+
+		summary := event.Title
+		if event.CourseName != "" {
+			summary = event.CourseName + ": " + event.Title
+		}
+
+		line("BEGIN:VEVENT")
+		line("UID:" + escapeText(event.UID))
+		line("DTSTAMP:" + event.UpdatedAt.UTC().Format(utcLayout))
+		line("LAST-MODIFIED:" + event.UpdatedAt.UTC().Format(utcLayout))
+		line(formatTime("DTSTART", event.StartsAt, event.AllDay, loc))
+		line(formatTime("DTEND", event.EndsAt, event.AllDay, loc))
+		if event.RRule != "" {
+			line("RRULE:" + event.RRule)
+		}
+		for _, exDate := range event.ExDates {
+			line(formatTime("EXDATE", exDate, event.AllDay, loc))
+		}
+		line("SUMMARY:" + escapeText(summary))
+		if event.Description != "" {
+			line("DESCRIPTION:" + escapeText(event.Description))
+		}
+		if event.Location != "" {
+			line("LOCATION:" + escapeText(event.Location))
+		}
+		if category, ok := categoryNames[event.Kind]; ok {
+			line("CATEGORIES:" + escapeText(category))
+		}
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+	return bw.Flush()
+}
+
+func formatTime(name string, t time.Time, allDay bool, loc *time.Location) string {
+	local := t.In(loc)
+	switch {
+	case allDay:
+		return name + ";VALUE=DATE:" + local.Format(dateLayout)
+	case loc == time.UTC:
+		return name + ":" + t.UTC().Format(utcLayout)
+	default:
+		return name + ";TZID=" + loc.String() + ":" + local.Format(dateTimeLayout)
+	}
+}
+
+// writeFolded writes a content line, folding it at maxLineLength octets
+// without splitting UTF-8 sequences.
+func writeFolded(w *bufio.Writer, s string) {
+	limit := maxLineLength
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+		// The leading space of continuation lines counts
+		limit = maxLineLength - 1
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", "")
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func unescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// property is a parsed content line.
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+func (p *property) param(name string) string {
+	return p.params[name]
+}
+
+// ParseCalendar reads the VEVENTs of an iCalendar file. Times without a time
+// zone are read in defaultTimezone, unless the file names one with
+// X-WR-TIMEZONE. Events that cannot be imported are reported as skipped
+// rather than failing the whole file. The kind of an event is left empty
+// unless one of its categories names it.
+func ParseCalendar(data []byte, defaultTimezone string) ([]types.CourseEvent, []types.CalendarImportSkip, error) {
+	lines := unfold(data)
+	if len(lines) == 0 || !strings.EqualFold(strings.TrimSpace(lines[0]), "BEGIN:VCALENDAR") {
+		return nil, nil, fmt.Errorf("not an iCalendar file")
+	}
+
+	var events []types.CourseEvent
+	var skipped []types.CalendarImportSkip
+	var depth int
+	var current []property
+	inEvent := false
+
+	for _, raw := range lines {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		prop, err := parseLine(raw)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case prop.name == "BEGIN":
+			depth++
+			if strings.EqualFold(prop.value, "VEVENT") && !inEvent {
+				inEvent = true
+				current = nil
+			}
+		case prop.name == "END":
+			depth--
+			if strings.EqualFold(prop.value, "VEVENT") && inEvent {
+				inEvent = false
+				event, err := buildEvent(current, defaultTimezone)
+				if err != nil {
+					skipped = append(skipped, types.CalendarImportSkip{
+						UID:     findValue(current, "UID"),
+						Summary: unescapeText(findValue(current, "SUMMARY")),
+						Reason:  err.Error(),
+					})
+					continue
+				}
+				events = append(events, *event)
+			}
+		case inEvent:
+			current = append(current, prop)
+		case depth == 1 && prop.name == "X-WR-TIMEZONE":
+			defaultTimezone = prop.value
+		}
+	}
+
+	return events, skipped, nil
+}
+
+func unfold(data []byte) []string {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// parseLine splits a content line into its name, params and value. Colons
+// and semicolons inside quoted param values do not count.
+func parseLine(line string) (property, error) {
+	quoted := false
+	colon := -1
+	for i := 0; i < len(line); i++ {
+		if line[i] == '"' {
+			quoted = !quoted
+		} else if line[i] == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return property{}, fmt.Errorf("invalid content line")
+	}
+
+	prop := property{params: map[string]string{}, value: line[colon+1:]}
+	var parts []string
+	start := 0
+	quoted = false
+	for i := 0; i < colon; i++ {
+		if line[i] == '"' {
+			quoted = !quoted
+		} else if line[i] == ';' && !quoted {
+			parts = append(parts, line[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, line[start:colon])
+
+	prop.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		name, value, _ := strings.Cut(param, "=")
+		prop.params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+func findValue(props []property, name string) string {
+	for _, prop := range props {
+		if prop.name == name {
+			return prop.value
+		}
+	}
+	return ""
+}
+
+func buildEvent(props []property, defaultTimezone string) (*types.CourseEvent, error) {
+	event := &types.CourseEvent{Timezone: defaultTimezone}
+	var start, end *property
+	var duration string
+
+	for i := range props {
+		prop := &props[i]
+		switch prop.name {
+		case "UID":
+			event.UID = prop.value
+		case "SUMMARY":
+			event.Title = strings.TrimSpace(unescapeText(prop.value))
+		case "DESCRIPTION":
+			event.Description = unescapeText(prop.value)
+		case "LOCATION":
+			event.Location = unescapeText(prop.value)
+		case "DTSTART":
+			start = prop
+		case "DTEND":
+			end = prop
+		case "DURATION":
+			duration = prop.value
+		case "RRULE":
+			event.RRule = prop.value
+		case "CATEGORIES":
+			if event.Kind == "" {
+				event.Kind = kindFromCategories(unescapeText(prop.value))
+			}
+		case "STATUS":
+			if strings.EqualFold(prop.value, "CANCELLED") {
+				return nil, fmt.Errorf("event is cancelled")
+			}
+		}
+	}
+
+	if start == nil {
+		return nil, fmt.Errorf("event has no start")
+	}
+	if tzid := strings.TrimPrefix(start.param("TZID"), "/"); tzid != "" {
+		event.Timezone = tzid
+	} else if strings.HasSuffix(strings.TrimSpace(start.value), "Z") {
+		// UTC times are not floating, so the event repeats in UTC
+		event.Timezone = "UTC"
+	}
+	if event.Timezone == "" {
+		event.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(event.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", event.Timezone)
+	}
+
+	event.StartsAt, event.AllDay, err = parseTime(start, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case end != nil:
+		if event.EndsAt, _, err = parseTime(end, loc); err != nil {
+			return nil, err
+		}
+	case duration != "":
+		d, err := parseDuration(duration)
+		if err != nil {
+			return nil, err
+		}
+		event.EndsAt = event.StartsAt.Add(d)
+	case event.AllDay:
+		event.EndsAt = event.StartsAt.In(loc).AddDate(0, 0, 1).UTC()
+	default:
+		event.EndsAt = event.StartsAt
+	}
+
+	for i := range props {
+		if props[i].name != "EXDATE" {
+			continue
+		}
+		for _, value := range strings.Split(props[i].value, ",") {
+			exProp := props[i]
+			exProp.value = value
+			exLoc := loc
+			if tzid := strings.TrimPrefix(exProp.param("TZID"), "/"); tzid != "" {
+				if exLoc, err = time.LoadLocation(tzid); err != nil {
+					return nil, fmt.Errorf("unknown time zone %q", tzid)
+				}
+			}
+			exDate, _, err := parseTime(&exProp, exLoc)
+			if err != nil {
+				return nil, err
+			}
+			event.ExDates = append(event.ExDates, exDate)
+		}
+	}
+
+	if event.UID == "" {
+		// Derive a UID so importing the same file again updates the event
+		sum := sha256.Sum256([]byte(event.Title + "|" + event.StartsAt.Format(time.RFC3339)))
+		event.UID = "import-" + hex.EncodeToString(sum[:12])
+	}
+
+	if err := Normalize(event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// parseTime reads a DATE or DATE-TIME value, in UTC when it ends with Z and
+// in loc otherwise. It reports whether the value is a date.
+func parseTime(prop *property, loc *time.Location) (time.Time, bool, error) {
+	value := strings.TrimSpace(prop.value)
+	if strings.EqualFold(prop.param("VALUE"), "DATE") || len(value) == len(dateLayout) {
+		t, err := time.ParseInLocation(dateLayout, value, loc)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s %q", prop.name, value)
+		}
+		return t.UTC(), true, nil
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(utcLayout, value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s %q", prop.name, value)
+		}
+		return t, false, nil
+	}
+	t, err := time.ParseInLocation(dateTimeLayout, value, loc)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid %s %q", prop.name, value)
+	}
+	return t.UTC(), false, nil
+}
+
+var durationPattern = regexp.MustCompile(`^\+?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseDuration reads a positive iCalendar duration such as PT1H30M or P1D.
+func parseDuration(value string) (time.Duration, error) {
+	match := durationPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil || value == "P" || value == "PT" {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if match[i+1] == "" {
+			continue
+		}
+		n, _ := strconv.Atoi(match[i+1])
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+// kindFromCategories returns the kind named by one of the categories, such
+// as "Exam" or "OFFICE HOURS", or "" when none does.
+func kindFromCategories(categories string) string {
+	for _, category := range strings.Split(categories, ",") {
+		name := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(category)), " ", "_")
+		if _, ok := categoryNames[name]; ok {
+			return name
+		}
+	}
+	return ""
+}
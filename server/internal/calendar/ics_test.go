@@ -0,0 +1,276 @@
+package calendar
+
+import (
+	"bytes"
+	"course-flow/internal/types"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendarRoundTrip(t *testing.T) {
+	berlin := mustLocation(t, "Europe/Berlin")
+	lectureStart := mustTime(t, "2026-10-19 16:00", berlin)
+	updatedAt := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+
+	newYork := mustLocation(t, "America/New_York")
+	examDay := mustTime(t, "2027-02-01 00:00", newYork)
+
+	events := []types.CourseEvent{
+		{
+			UID:         "lecture@course-flow",
+			Title:       "Algorithms; lecture, part 1",
+			Description: "Bring a laptop.\nSlides: https://example.com/slides\\week-1",
+			Location:    "Hörsaal 1, Gebäude A",
+			Kind:        types.CalendarLecture,
+			StartsAt:    lectureStart.UTC(),
+			EndsAt:      lectureStart.Add(90 * time.Minute).UTC(),
+			Timezone:    "Europe/Berlin",
+			RRule:       "FREQ=WEEKLY;UNTIL=20261214T225959Z;BYDAY=MO,TH",
+			ExDates:     []time.Time{mustTime(t, "2026-11-02 16:00", berlin).UTC()},
+		},
+		{
+			UID:   "exam@course-flow",
+			Title: "Final exam",
+			Kind:  types.CalendarExam,
+			// Dates are floating, so they are read in the importing course's
+			// time zone
+			StartsAt: examDay.UTC(),
+			EndsAt:   examDay.AddDate(0, 0, 1).UTC(),
+			AllDay:   true,
+			Timezone: "America/New_York",
+		},
+		{
+			UID:         "office-hours@course-flow",
+			Title:       "Office hours",
+			Description: strings.Repeat("Long descriptions are folded across several lines. ", 5),
+			Kind:        types.CalendarOfficeHours,
+			StartsAt:    time.Date(2026, 10, 21, 13, 0, 0, 0, time.UTC),
+			EndsAt:      time.Date(2026, 10, 21, 14, 0, 0, 0, time.UTC),
+			Timezone:    "UTC",
+			RRule:       "FREQ=WEEKLY;COUNT=10",
+		},
+	}
+	for i := range events {
+		events[i].UpdatedAt = updatedAt
+		if err := Normalize(&events[i]); err != nil {
+			t.Fatalf("Normalize(%s): %v", events[i].UID, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCalendar(&buf, "Algorithms, WS 2026", events); err != nil {
+		t.Fatalf("WriteCalendar: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > maxLineLength {
+			t.Errorf("line of %d octets is not folded: %q", len(line), line)
+		}
+	}
+
+	// UTC events keep repeating in UTC in a course with another time zone
+	parsed, skipped, err := ParseCalendar(buf.Bytes(), "America/New_York")
+	if err != nil {
+		t.Fatalf("ParseCalendar: %v", err)
+	}
+	if len(skipped) > 0 {
+		t.Fatalf("skipped = %+v, want none", skipped)
+	}
+	if len(parsed) != len(events) {
+		t.Fatalf("parsed %d events, want %d", len(parsed), len(events))
+	}
+
+	for i, want := range events {
+		got := parsed[i]
+		if got.UID != want.UID || got.Title != want.Title || got.Description != want.Description ||
+			got.Location != want.Location || got.Kind != want.Kind || got.AllDay != want.AllDay ||
+			got.Timezone != want.Timezone || got.RRule != want.RRule {
+			t.Errorf("event %d = %+v, want %+v", i, got, want)
+		}
+		if !got.StartsAt.Equal(want.StartsAt) || !got.EndsAt.Equal(want.EndsAt) {
+			t.Errorf("event %s runs %s - %s, want %s - %s", want.UID, got.StartsAt, got.EndsAt, want.StartsAt, want.EndsAt)
+		}
+		if !slices.EqualFunc(got.ExDates, want.ExDates, time.Time.Equal) {
+			t.Errorf("event %s exdates = %v, want %v", want.UID, got.ExDates, want.ExDates)
+		}
+		if (got.LastEndsAt == nil) != (want.LastEndsAt == nil) || (got.LastEndsAt != nil && !got.LastEndsAt.Equal(*want.LastEndsAt)) {
+			t.Errorf("event %s last ends at %v, want %v", want.UID, got.LastEndsAt, want.LastEndsAt)
+		}
+	}
+}
+
+func TestWriteCalendarTimes(t *testing.T) {
+	berlin := mustLocation(t, "Europe/Berlin")
+	start := mustTime(t, "2026-10-19 16:00", berlin)
+	events := []types.CourseEvent{
+		{UID: "local", Title: "Local", StartsAt: start.UTC(), EndsAt: start.Add(time.Hour).UTC(), Timezone: "Europe/Berlin"},
+		{UID: "utc", Title: "UTC", StartsAt: start.UTC(), EndsAt: start.Add(time.Hour).UTC(), Timezone: "UTC"},
+		{UID: "day", Title: "Day", StartsAt: time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), EndsAt: time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC), AllDay: true, Timezone: "UTC"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCalendar(&buf, "Times", events); err != nil {
+		t.Fatalf("WriteCalendar: %v", err)
+	}
+	for _, want := range []string{
+		"DTSTART;TZID=Europe/Berlin:20261019T160000\r\n",
+		"DTSTART:20261019T140000Z\r\n",
+		"DTSTART;VALUE=DATE:20261019\r\n",
+		"DTEND;VALUE=DATE:20261020\r\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("calendar does not contain %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestParseCalendar(t *testing.T) {
+	tests := []struct {
+		name        string
+		events      string
+		timezone    string
+		want        []types.CourseEvent
+		wantSkipped []string
+	}{
+		{
+			name: "floating times use X-WR-TIMEZONE",
+			events: "X-WR-TIMEZONE:Europe/Berlin\r\n" +
+				"BEGIN:VEVENT\r\nUID:a\r\nSUMMARY:Seminar\r\nDTSTART:20260105T100000\r\nDURATION:PT1H30M\r\nEND:VEVENT\r\n",
+			timezone: "UTC",
+			want: []types.CourseEvent{{
+				UID: "a", Title: "Seminar", Timezone: "Europe/Berlin",
+				StartsAt: time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC),
+				EndsAt:   time.Date(2026, 1, 5, 10, 30, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "folded lines, escapes and categories",
+			events: "BEGIN:VEVENT\r\nUID:b\r\nSUMMARY:Midterm\\, room\r\n  change\r\nCATEGORIES:Homework,EXAM\r\n" +
+				"DTSTART;TZID=\"America/New_York\":20260310T090000\r\nDTEND;TZID=America/New_York:20260310T110000\r\nEND:VEVENT\r\n",
+			timezone: "UTC",
+			want: []types.CourseEvent{{
+				UID: "b", Title: "Midterm, room change", Kind: types.CalendarExam, Timezone: "America/New_York",
+				StartsAt: time.Date(2026, 3, 10, 13, 0, 0, 0, time.UTC),
+				EndsAt:   time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name:     "all-day event without an end lasts a day",
+			events:   "BEGIN:VEVENT\nUID:c\nSUMMARY:Holiday\nDTSTART;VALUE=DATE:20261224\nEND:VEVENT\n",
+			timezone: "UTC",
+			want: []types.CourseEvent{{
+				UID: "c", Title: "Holiday", Timezone: "UTC", AllDay: true,
+				StartsAt: time.Date(2026, 12, 24, 0, 0, 0, 0, time.UTC),
+				EndsAt:   time.Date(2026, 12, 25, 0, 0, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "exdates in another time zone",
+			events: "BEGIN:VEVENT\r\nUID:d\r\nSUMMARY:Lab\r\nDTSTART:20260302T150000Z\r\nRRULE:FREQ=WEEKLY;COUNT=3\r\n" +
+				"EXDATE;TZID=America/New_York:20260309T110000,20260316T110000\r\nEND:VEVENT\r\n",
+			timezone: "UTC",
+			want: []types.CourseEvent{{
+				UID: "d", Title: "Lab", Timezone: "UTC", RRule: "FREQ=WEEKLY;COUNT=3",
+				StartsAt: time.Date(2026, 3, 2, 15, 0, 0, 0, time.UTC),
+				EndsAt:   time.Date(2026, 3, 2, 15, 0, 0, 0, time.UTC),
+				ExDates:  []time.Time{time.Date(2026, 3, 9, 15, 0, 0, 0, time.UTC), time.Date(2026, 3, 16, 15, 0, 0, 0, time.UTC)},
+			}},
+		},
+		{
+			name: "events that cannot be imported are skipped",
+			events: "BEGIN:VEVENT\r\nUID:cancelled\r\nSUMMARY:Cancelled\r\nDTSTART:20260101T100000Z\r\nSTATUS:CANCELLED\r\nEND:VEVENT\r\n" +
+				"BEGIN:VEVENT\r\nUID:no-start\r\nSUMMARY:No start\r\nEND:VEVENT\r\n" +
+				"BEGIN:VEVENT\r\nUID:zone\r\nSUMMARY:Zone\r\nDTSTART;TZID=Mars/Olympus:20260101T100000\r\nEND:VEVENT\r\n" +
+				"BEGIN:VEVENT\r\nUID:rule\r\nSUMMARY:Rule\r\nDTSTART:20260101T100000Z\r\nRRULE:FREQ=HOURLY\r\nEND:VEVENT\r\n" +
+				"BEGIN:VEVENT\r\nUID:backwards\r\nSUMMARY:Backwards\r\nDTSTART:20260101T100000Z\r\nDTEND:20260101T090000Z\r\nEND:VEVENT\r\n",
+			timezone:    "UTC",
+			wantSkipped: []string{"cancelled", "no-start", "zone", "rule", "backwards"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + tt.events + "END:VCALENDAR\r\n"
+			events, skipped, err := ParseCalendar([]byte(data), tt.timezone)
+			if err != nil {
+				t.Fatalf("ParseCalendar: %v", err)
+			}
+
+			var skippedUIDs []string
+			for _, skip := range skipped {
+				skippedUIDs = append(skippedUIDs, skip.UID)
+			}
+			if !slices.Equal(skippedUIDs, tt.wantSkipped) {
+				t.Errorf("skipped = %+v, want %q", skipped, tt.wantSkipped)
+			}
+
+			if len(events) != len(tt.want) {
+				t.Fatalf("parsed %d events, want %d", len(events), len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := events[i]
+				if got.UID != want.UID || got.Title != want.Title || got.Kind != want.Kind ||
+					got.Timezone != want.Timezone || got.AllDay != want.AllDay || got.RRule != want.RRule ||
+					!got.StartsAt.Equal(want.StartsAt) || !got.EndsAt.Equal(want.EndsAt) ||
+					!slices.EqualFunc(got.ExDates, want.ExDates, time.Time.Equal) {
+					t.Errorf("event %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCalendarDerivesStableUIDs(t *testing.T) {
+	data := []byte("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Review session\r\nDTSTART:20260101T100000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")
+
+	first, _, err := ParseCalendar(data, "UTC")
+	if err != nil || len(first) != 1 {
+		t.Fatalf("ParseCalendar = %d events, %v", len(first), err)
+	}
+	second, _, _ := ParseCalendar(data, "UTC")
+	if !strings.HasPrefix(first[0].UID, "import-") || first[0].UID != second[0].UID {
+		t.Errorf("UIDs = %q and %q, want the same derived UID", first[0].UID, second[0].UID)
+	}
+}
+
+func TestParseCalendarRejectsOtherFiles(t *testing.T) {
+	for _, data := range []string{"", "hello", "BEGIN:VCARD\r\nEND:VCARD\r\n"} {
+		if _, _, err := ParseCalendar([]byte(data), "UTC"); err == nil {
+			t.Errorf("ParseCalendar(%q) succeeded, want an error", data)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "PT1H30M", want: 90 * time.Minute},
+		{value: "P1D", want: 24 * time.Hour},
+		{value: "P1W", want: 7 * 24 * time.Hour},
+		{value: "+P1DT2H3M4S", want: 26*time.Hour + 3*time.Minute + 4*time.Second},
+		{value: "PT0S", want: 0},
+		{value: "P", wantErr: true},
+		{value: "PT", wantErr: true},
+		{value: "-PT1H", wantErr: true},
+		{value: "1H", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseDuration(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseDuration(%q) = %s, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parseDuration(%q) = %s, %v, want %s", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+// Package calendar expands recurring course events and reads and writes them
+// as iCalendar (RFC 5545).
+package calendar
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	// Time zones are loaded by name, so they must not depend on the host
+	_ "time/tzdata"
+)
+
+// maxIterations bounds the candidates looked at when expanding a rule, e.g.
+// a daily event over 50 years.
+const maxIterations = 20000
+
+// RRule is the subset of RFC 5545 recurrence rules course schedules need:
+// FREQ, INTERVAL, COUNT, UNTIL and, for weekly rules, BYDAY.
+type RRule struct {
+	Freq     string
+	Interval int
+	Count    int
+	Until    time.Time
+	ByDay    []time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// ParseRRule parses a rule such as "FREQ=WEEKLY;BYDAY=MO,WE;UNTIL=20261220T000000Z".
+// An UNTIL without a time is the end of that day in loc.
+func ParseRRule(rule string, loc *time.Location) (*RRule, error) {
+	r := &RRule{Interval: 1}
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+
+	for _, part := range strings.Split(rule, ";") {
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(value)
+			switch r.Freq {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+			default:
+				return nil, fmt.Errorf("unsupported frequency %q", value)
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 {
+				return nil, fmt.Errorf("invalid interval %q", value)
+			}
+			r.Interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return nil, fmt.Errorf("invalid count %q", value)
+			}
+			r.Count = count
+		case "UNTIL":
+			until, err := parseUntil(value, loc)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = until
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(value), ",") {
+				weekday, ok := weekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("unsupported day %q", day)
+				}
+				r.ByDay = append(r.ByDay, weekday)
+			}
+		case "WKST":
+			// Weeks start on Monday, which only matters for BYDAY with an
+			// interval
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", name)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, fmt.Errorf("rule has no frequency")
+	}
+	if len(r.ByDay) > 0 && r.Freq != "WEEKLY" {
+		return nil, fmt.Errorf("BYDAY is only supported for weekly rules")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, fmt.Errorf("rule cannot have both COUNT and UNTIL")
+	}
+	sort.Slice(r.ByDay, func(i, j int) bool {
+		return mondayIndex(r.ByDay[i]) < mondayIndex(r.ByDay[j])
+	})
+	return r, nil
+}
+
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102", value, loc); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid until %q", value)
+}
+
+// String formats the rule the way it is stored and published.
+func (r *RRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, weekday := range r.ByDay {
+			days[i] = strings.ToUpper(weekday.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// each calls fn with every start of the rule, in order, beginning with start
+// itself, until fn returns false or the rule ends. start must be in the
+// event's time zone so that occurrences keep their wall clock time across
+// daylight saving changes. It reports false when it gave up after
+// maxIterations.
+func (r *RRule) each(start time.Time, fn func(t time.Time) bool) bool {
+	count := 0
+	emit := func(t time.Time) bool {
+		if t.Before(start) {
+			return true
+		}
+		if !r.Until.IsZero() && t.After(r.Until) {
+			return false
+		}
+		count++
+		if !fn(t) {
+			return false
+		}
+		return r.Count == 0 || count < r.Count
+	}
+
+	year, month, day := start.Date()
+	hour, min, sec := start.Clock()
+	loc := start.Location()
+
+	for n := 0; n < maxIterations; n++ {
+		step := n * r.Interval
+		switch r.Freq {
+		case "DAILY":
+			if !emit(time.Date(year, month, day+step, hour, min, sec, 0, loc)) {
+				return true
+			}
+		case "WEEKLY":
+			if len(r.ByDay) == 0 {
+				if !emit(time.Date(year, month, day+7*step, hour, min, sec, 0, loc)) {
+					return true
+				}
+				continue
+			}
+			monday := day - mondayIndex(start.Weekday()) + 7*step
+			for _, weekday := range r.ByDay {
+				if !emit(time.Date(year, month, monday+mondayIndex(weekday), hour, min, sec, 0, loc)) {
+					return true
+				}
+			}
+		case "MONTHLY":
+			t := time.Date(year, month+time.Month(step), day, hour, min, sec, 0, loc)
+			// Months without the day are skipped, e.g. the 31st
+			if t.Day() == day && !emit(t) {
+				return true
+			}
+		case "YEARLY":
+			t := time.Date(year+step, month, day, hour, min, sec, 0, loc)
+			if t.Day() == day && !emit(t) {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// Last returns the start of the last occurrence, or false when the rule
+// repeats forever or for too long to tell.
+func (r *RRule) Last(start time.Time) (time.Time, bool) {
+	if r.Count == 0 && r.Until.IsZero() {
+		return time.Time{}, false
+	}
+	var last time.Time
+	done := r.each(start, func(t time.Time) bool {
+		last = t
+		return true
+	})
+	return last, done
+}
+
+func mondayIndex(weekday time.Weekday) int {
+	return (int(weekday) + 6) % 7
+}
@@ -0,0 +1,312 @@
+package calendar
+
+import (
+	"course-flow/internal/types"
+	"slices"
+	"testing"
+	"time"
+)
+
+const occurrenceLayout = "2006-01-02 15:04 MST"
+
+// mustLocation loads a time zone or fails the test.
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q): %v", name, err)
+	}
+	return loc
+}
+
+// mustTime parses a wall clock time such as "2026-03-02 10:00" in loc.
+func mustTime(t *testing.T, value string, loc *time.Location) time.Time {
+	t.Helper()
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+	if err != nil {
+		t.Fatalf("ParseInLocation(%q): %v", value, err)
+	}
+	return parsed
+}
+
+func TestRRuleStarts(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     string
+		timezone string
+		start    string
+		want     []string
+	}{
+		{
+			name:     "weekly by day across the start of daylight saving time",
+			rule:     "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=6",
+			timezone: "America/New_York",
+			start:    "2026-03-02 10:00",
+			want: []string{
+				"2026-03-02 10:00 EST",
+				"2026-03-04 10:00 EST",
+				"2026-03-09 10:00 EDT",
+				"2026-03-11 10:00 EDT",
+				"2026-03-16 10:00 EDT",
+				"2026-03-18 10:00 EDT",
+			},
+		},
+		{
+			name:     "weekly by day across the end of daylight saving time",
+			rule:     "FREQ=WEEKLY;BYDAY=FR,TU;COUNT=4",
+			timezone: "Europe/Berlin",
+			start:    "2026-10-20 09:15",
+			want: []string{
+				"2026-10-20 09:15 CEST",
+				"2026-10-23 09:15 CEST",
+				"2026-10-27 09:15 CET",
+				"2026-10-30 09:15 CET",
+			},
+		},
+		{
+			name:     "weekly by day skips the days before the start",
+			rule:     "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=3",
+			timezone: "UTC",
+			start:    "2026-03-03 08:00",
+			want:     []string{"2026-03-04 08:00 UTC", "2026-03-09 08:00 UTC", "2026-03-11 08:00 UTC"},
+		},
+		{
+			name:     "weekly by day every other week",
+			rule:     "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH;COUNT=4",
+			timezone: "UTC",
+			start:    "2026-09-01 14:00",
+			want:     []string{"2026-09-01 14:00 UTC", "2026-09-03 14:00 UTC", "2026-09-15 14:00 UTC", "2026-09-17 14:00 UTC"},
+		},
+		{
+			name:     "count",
+			rule:     "FREQ=DAILY;COUNT=3",
+			timezone: "UTC",
+			start:    "2026-03-03 18:00",
+			want:     []string{"2026-03-03 18:00 UTC", "2026-03-04 18:00 UTC", "2026-03-05 18:00 UTC"},
+		},
+		{
+			name:     "until date includes that whole day",
+			rule:     "FREQ=DAILY;UNTIL=20260305",
+			timezone: "America/New_York",
+			start:    "2026-03-03 23:30",
+			want:     []string{"2026-03-03 23:30 EST", "2026-03-04 23:30 EST", "2026-03-05 23:30 EST"},
+		},
+		{
+			name:     "until time is inclusive",
+			rule:     "FREQ=WEEKLY;UNTIL=20260316T140000Z",
+			timezone: "America/New_York",
+			start:    "2026-03-02 10:00",
+			want:     []string{"2026-03-02 10:00 EST", "2026-03-09 10:00 EDT", "2026-03-16 10:00 EDT"},
+		},
+		{
+			name:     "until before the next occurrence",
+			rule:     "FREQ=WEEKLY;UNTIL=20260316T135959Z",
+			timezone: "America/New_York",
+			start:    "2026-03-02 10:00",
+			want:     []string{"2026-03-02 10:00 EST", "2026-03-09 10:00 EDT"},
+		},
+		{
+			name:     "monthly skips months without the day",
+			rule:     "FREQ=MONTHLY;COUNT=3",
+			timezone: "UTC",
+			start:    "2026-01-31 12:00",
+			want:     []string{"2026-01-31 12:00 UTC", "2026-03-31 12:00 UTC", "2026-05-31 12:00 UTC"},
+		},
+		{
+			name:     "yearly on a leap day",
+			rule:     "FREQ=YEARLY;COUNT=2",
+			timezone: "UTC",
+			start:    "2028-02-29 09:00",
+			want:     []string{"2028-02-29 09:00 UTC", "2032-02-29 09:00 UTC"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := mustLocation(t, tt.timezone)
+			rule, err := ParseRRule(tt.rule, loc)
+			if err != nil {
+				t.Fatalf("ParseRRule(%q): %v", tt.rule, err)
+			}
+
+			var got []string
+			done := rule.each(mustTime(t, tt.start, loc), func(start time.Time) bool {
+				got = append(got, start.Format(occurrenceLayout))
+				return len(got) < 100
+			})
+			if !done {
+				t.Fatalf("rule gave up after %d iterations", maxIterations)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("starts = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    string
+		wantErr bool
+	}{
+		{rule: "FREQ=DAILY", want: "FREQ=DAILY"},
+		{rule: "RRULE:freq=weekly;byday=we,mo;interval=2;until=20261220", want: "FREQ=WEEKLY;INTERVAL=2;UNTIL=20261220T235959Z;BYDAY=MO,WE"},
+		{rule: "FREQ=WEEKLY;BYDAY=SU,MO;WKST=SU;COUNT=10", want: "FREQ=WEEKLY;COUNT=10;BYDAY=MO,SU"},
+		{rule: "FREQ=MONTHLY;INTERVAL=1;UNTIL=20270101T120000Z", want: "FREQ=MONTHLY;UNTIL=20270101T120000Z"},
+		{rule: "", wantErr: true},
+		{rule: "INTERVAL=2", wantErr: true},
+		{rule: "FREQ=HOURLY", wantErr: true},
+		{rule: "FREQ=DAILY;BYDAY=MO", wantErr: true},
+		{rule: "FREQ=WEEKLY;BYDAY=XX", wantErr: true},
+		{rule: "FREQ=DAILY;INTERVAL=0", wantErr: true},
+		{rule: "FREQ=DAILY;COUNT=-1", wantErr: true},
+		{rule: "FREQ=DAILY;COUNT=2;UNTIL=20260101", wantErr: true},
+		{rule: "FREQ=DAILY;UNTIL=tomorrow", wantErr: true},
+		{rule: "FREQ=DAILY;BYMONTH=1", wantErr: true},
+		{rule: "FREQ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			rule, err := ParseRRule(tt.rule, time.UTC)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRRule(%q) = %q, want an error", tt.rule, rule.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRRule(%q): %v", tt.rule, err)
+			}
+			if got := rule.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeLastEndsAt(t *testing.T) {
+	loc := mustLocation(t, "America/New_York")
+	start := mustTime(t, "2026-03-02 10:00", loc)
+
+	tests := []struct {
+		name string
+		rule string
+		want string // Empty when the event has no known end
+	}{
+		{name: "single", rule: "", want: "2026-03-02 11:30 EST"},
+		{name: "count", rule: "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=6", want: "2026-03-18 11:30 EDT"},
+		{name: "until", rule: "FREQ=DAILY;UNTIL=20260310", want: "2026-03-10 11:30 EDT"},
+		{name: "forever", rule: "FREQ=WEEKLY", want: ""},
+		{name: "longer than max iterations", rule: "FREQ=DAILY;UNTIL=21200101", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := types.CourseEvent{
+				StartsAt: start.UTC(),
+				EndsAt:   start.Add(90 * time.Minute).UTC(),
+				Timezone: "America/New_York",
+				RRule:    tt.rule,
+			}
+			if err := Normalize(&event); err != nil {
+				t.Fatalf("Normalize: %v", err)
+			}
+
+			got := ""
+			if event.LastEndsAt != nil {
+				got = event.LastEndsAt.In(loc).Format(occurrenceLayout)
+			}
+			if got != tt.want {
+				t.Errorf("LastEndsAt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	loc := mustLocation(t, "Europe/Berlin")
+	start := mustTime(t, "2026-10-19 16:00", loc)
+	weekly := types.CourseEvent{
+		ID:       "lecture",
+		StartsAt: start.UTC(),
+		EndsAt:   start.Add(2 * time.Hour).UTC(),
+		Timezone: "Europe/Berlin",
+		RRule:    "FREQ=WEEKLY;COUNT=5",
+	}
+
+	withExDate := weekly
+	// Cancelled occurrences are matched on their start instant, after DST ended
+	withExDate.ExDates = []time.Time{mustTime(t, "2026-11-02 16:00", loc).UTC()}
+
+	tests := []struct {
+		name  string
+		event types.CourseEvent
+		from  string
+		to    string
+		limit int
+		want  []string
+	}{
+		{
+			name:  "every occurrence",
+			event: weekly,
+			from:  "2026-10-01 00:00",
+			to:    "2027-01-01 00:00",
+			limit: 100,
+			want:  []string{"2026-10-19 16:00 CEST", "2026-10-26 16:00 CET", "2026-11-02 16:00 CET", "2026-11-09 16:00 CET", "2026-11-16 16:00 CET"},
+		},
+		{
+			name:  "exdate",
+			event: withExDate,
+			from:  "2026-10-01 00:00",
+			to:    "2027-01-01 00:00",
+			limit: 100,
+			want:  []string{"2026-10-19 16:00 CEST", "2026-10-26 16:00 CET", "2026-11-09 16:00 CET", "2026-11-16 16:00 CET"},
+		},
+		{
+			name:  "occurrence in progress at the start of the range",
+			event: weekly,
+			from:  "2026-10-26 17:00",
+			to:    "2026-11-03 00:00",
+			limit: 100,
+			want:  []string{"2026-10-26 16:00 CET", "2026-11-02 16:00 CET"},
+		},
+		{
+			name:  "range end is exclusive",
+			event: weekly,
+			from:  "2026-10-20 00:00",
+			to:    "2026-11-02 16:00",
+			limit: 100,
+			want:  []string{"2026-10-26 16:00 CET"},
+		},
+		{
+			name:  "limit",
+			event: weekly,
+			from:  "2026-10-01 00:00",
+			to:    "2027-01-01 00:00",
+			limit: 2,
+			want:  []string{"2026-10-19 16:00 CEST", "2026-10-26 16:00 CET"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			occurrences, err := Expand(tt.event, mustTime(t, tt.from, loc), mustTime(t, tt.to, loc), tt.limit)
+			if err != nil {
+				t.Fatalf("Expand: %v", err)
+			}
+
+			var got []string
+			for _, occurrence := range occurrences {
+				if d := occurrence.EndsAt.Sub(occurrence.StartsAt); d != 2*time.Hour {
+					t.Errorf("occurrence at %s lasts %s, want 2h", occurrence.StartsAt, d)
+				}
+				got = append(got, occurrence.StartsAt.In(loc).Format(occurrenceLayout))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("starts = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
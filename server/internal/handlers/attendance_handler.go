@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"course-flow/internal/services"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type AttendanceHandler struct {
+	service *services.AttendanceService
+}
+
+func NewAttendanceHandler(service *services.AttendanceService) *AttendanceHandler {
+	return &AttendanceHandler{
+		service: service,
+	}
+}
+
+func (h *AttendanceHandler) GetSessionsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	sessions, err := h.service.GetSessions(userID, mux.Vars(r)["course_id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, sessions)
+}
+
+func (h *AttendanceHandler) CreateSessionHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.ClassSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	session, err := h.service.CreateSession(userID, mux.Vars(r)["course_id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, session)
+}
+
+// GetSessionReportHandler returns the session with the attendance of every
+// student, or the attendance as CSV with ?format=csv.
+func (h *AttendanceHandler) GetSessionReportHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	sessionID := mux.Vars(r)["id"]
+	report, err := h.service.GetSessionReport(userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		return writeAttendanceCSV(w, "attendance-"+sessionID+".csv", report.Records)
+	}
+	return utils.WriteJSON(w, http.StatusOK, report)
+}
+
+func (h *AttendanceHandler) UpdateSessionHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.ClassSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	session, err := h.service.UpdateSession(userID, mux.Vars(r)["id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, session)
+}
+
+func (h *AttendanceHandler) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	if err := h.service.DeleteSession(userID, mux.Vars(r)["id"]); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Class session deleted successfully"})
+}
+
+func (h *AttendanceHandler) OpenCheckInHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	// The body is optional
+	var req types.OpenCheckInRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+		}
+	}
+
+	code, err := h.service.OpenCheckIn(userID, mux.Vars(r)["id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, code)
+}
+
+func (h *AttendanceHandler) CloseCheckInHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	session, err := h.service.CloseCheckIn(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, session)
+}
+
+func (h *AttendanceHandler) GetCheckInCodeHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	code, err := h.service.GetCheckInCode(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, code)
+}
+
+func (h *AttendanceHandler) CheckInHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.CheckInRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	result, err := h.service.CheckIn(userID, &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, result)
+}
+
+func (h *AttendanceHandler) SetRecordHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.AttendanceRecordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	vars := mux.Vars(r)
+	if err := h.service.SetRecord(userID, vars["id"], vars["user_id"], &req); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Attendance updated successfully"})
+}
+
+// GetCourseReportHandler returns the attendance summary of every student, or
+// all records as CSV with ?format=csv.
+func (h *AttendanceHandler) GetCourseReportHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	courseID := mux.Vars(r)["course_id"]
+	if r.URL.Query().Get("format") == "csv" {
+		records, err := h.service.GetCourseRecords(userID, courseID)
+		if err != nil {
+			return err
+		}
+		return writeAttendanceCSV(w, "attendance-"+courseID+".csv", records)
+	}
+
+	reports, err := h.service.GetCourseReport(userID, courseID)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, reports)
+}
+
+// GetStudentReportHandler returns the attendance of a student, or their
+// records as CSV with ?format=csv. "me" stands for the current user.
+func (h *AttendanceHandler) GetStudentReportHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	vars := mux.Vars(r)
+	studentID := vars["user_id"]
+	if studentID == "me" {
+		studentID = userID
+	}
+
+	report, err := h.service.GetStudentReport(userID, vars["course_id"], studentID)
+	if err != nil {
+		return err
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		return writeAttendanceCSV(w, "attendance-"+studentID+".csv", report.Records)
+	}
+	return utils.WriteJSON(w, http.StatusOK, report)
+}
+
+func writeAttendanceCSV(w http.ResponseWriter, filename string, records []types.AttendanceRecord) error {
+	data, err := services.AttendanceCSV(records)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(data)
+	return err
+}
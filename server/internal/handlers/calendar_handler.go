@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"course-flow/internal/services"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultCalendarRange is the range shown when none is given.
+	defaultCalendarRange = 31 * 24 * time.Hour
+	// maxCalendarRange bounds the range of one calendar request.
+	maxCalendarRange = 366 * 24 * time.Hour
+	// maxImportSize bounds ICS uploads.
+	maxImportSize = 1 << 20
+)
+
+type CalendarHandler struct {
+	service *services.CalendarService
+}
+
+func NewCalendarHandler(service *services.CalendarService) *CalendarHandler {
+	return &CalendarHandler{
+		service: service,
+	}
+}
+
+func (h *CalendarHandler) GetCourseEventsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	from, to, err := parseCalendarRange(r)
+	if err != nil {
+		return err
+	}
+
+	occurrences, err := h.service.GetCourseEvents(userID, mux.Vars(r)["course_id"], from, to)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, occurrences)
+}
+
+func (h *CalendarHandler) CreateEventHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.CourseEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	event, err := h.service.CreateEvent(userID, mux.Vars(r)["course_id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, event)
+}
+
+func (h *CalendarHandler) UpdateEventHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.CourseEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	event, err := h.service.UpdateEvent(userID, mux.Vars(r)["id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, event)
+}
+
+func (h *CalendarHandler) DeleteEventHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	if err := h.service.DeleteEvent(userID, mux.Vars(r)["id"]); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Event deleted successfully"})
+}
+
+// ImportEventsHandler imports an ICS file, sent as the request body or as the
+// "file" field of a multipart form.
+func (h *CalendarHandler) ImportEventsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	tooLarge := &utils.ApiError{Code: http.StatusRequestEntityTooLarge, Message: "Calendar files can be at most 1MB"}
+
+	var data []byte
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			return tooLarge
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return &utils.ApiError{Code: http.StatusBadRequest, Message: "The calendar file is required"}
+		}
+		defer file.Close()
+		data, err = io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+	} else {
+		data, err = io.ReadAll(r.Body)
+		if err != nil {
+			return tooLarge
+		}
+	}
+
+	query := r.URL.Query()
+	result, err := h.service.ImportEvents(userID, mux.Vars(r)["course_id"], data, query.Get("timezone"), query.Get("kind"))
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, result)
+}
+
+func (h *CalendarHandler) GetCalendarHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	from, to, err := parseCalendarRange(r)
+	if err != nil {
+		return err
+	}
+
+	occurrences, err := h.service.GetCalendar(userID, from, to)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, occurrences)
+}
+
+func (h *CalendarHandler) GetFeedHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	feed, err := h.service.GetFeed(userID)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, feed)
+}
+
+func (h *CalendarHandler) RotateFeedHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	feed, err := h.service.RotateFeed(userID)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, feed)
+}
+
+// FeedHandler serves the iCalendar feed calendar apps subscribe to. The token
+// in the URL is the only credential.
+func (h *CalendarHandler) FeedHandler(w http.ResponseWriter, r *http.Request) error {
+	feed, err := h.service.Feed(mux.Vars(r)["token"])
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="course-flow.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(feed)
+	return err
+}
+
+// parseCalendarRange reads the optional "from" and "to" query parameters, as
+// RFC 3339 times or dates. The range defaults to the next 31 days.
+func parseCalendarRange(r *http.Request) (time.Time, time.Time, error) {
+	parse := func(name string) (time.Time, error) {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			return time.Time{}, nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t.UTC(), nil
+		}
+		if t, err := time.Parse("2006-01-02", value); err == nil {
+			return t, nil
+		}
+		return time.Time{}, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: name + " must be an RFC 3339 time or a date like 2006-01-02",
+		}
+	}
+
+	from, err := parse("from")
+	if err != nil {
+		return from, from, err
+	}
+	to, err := parse("to")
+	if err != nil {
+		return from, to, err
+	}
+
+	if from.IsZero() {
+		from = time.Now().UTC().Truncate(24 * time.Hour)
+	}
+	if to.IsZero() {
+		to = from.Add(defaultCalendarRange)
+	}
+	if !to.After(from) || to.Sub(from) > maxCalendarRange {
+		return from, to, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "to must be after from and at most 366 days later",
+		}
+	}
+	return from, to, nil
+}
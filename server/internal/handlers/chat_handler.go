@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"course-flow/internal/services"
+	"course-flow/internal/types"
 	"course-flow/internal/utils"
+	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 )
@@ -25,10 +28,177 @@ func (h *ChatHandler) GetMessageHandler(w http.ResponseWriter, r *http.Request)
 		return err
 	}
 
-	messages, err := h.service.GetMessagesByCourse(courseID, userID)
+	page, err := parseChatPage(r)
+	if err != nil {
+		return err
+	}
+
+	messages, err := h.service.GetMessagesByCourse(courseID, userID, page)
 	if err != nil {
 		return err
 	}
 
 	return utils.WriteJSON(w, http.StatusOK, messages)
 }
+
+func (h *ChatHandler) GetUnreadCountsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	counts, err := h.service.GetUnreadCounts(userID)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, counts)
+}
+
+func (h *ChatHandler) GetChatSettingsHandler(w http.ResponseWriter, r *http.Request) error {
+	courseID := mux.Vars(r)["course_id"]
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	settings, err := h.service.GetChatSettings(courseID, userID)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, settings)
+}
+
+func (h *ChatHandler) UpdateChatSettingsHandler(w http.ResponseWriter, r *http.Request) error {
+	courseID := mux.Vars(r)["course_id"]
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var settings types.ChatSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request payload"}
+	}
+	settings.CourseID = courseID
+
+	updated, err := h.service.UpdateChatSettings(userID, &settings)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, updated)
+}
+
+func (h *ChatHandler) UpdateChatModerationHandler(w http.ResponseWriter, r *http.Request) error {
+	courseID := mux.Vars(r)["course_id"]
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var settings types.ChatSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request payload"}
+	}
+	settings.CourseID = courseID
+
+	updated, err := h.service.UpdateChatModeration(userID, &settings)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, updated)
+}
+
+func (h *ChatHandler) GetMutesHandler(w http.ResponseWriter, r *http.Request) error {
+	courseID := mux.Vars(r)["course_id"]
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	mutes, err := h.service.GetActiveMutes(courseID, userID)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, mutes)
+}
+
+func (h *ChatHandler) MuteUserHandler(w http.ResponseWriter, r *http.Request) error {
+	courseID := mux.Vars(r)["course_id"]
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.ChatMuteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request payload"}
+	}
+
+	mute, err := h.service.MuteUser(courseID, userID, &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, mute)
+}
+
+func (h *ChatHandler) UnmuteUserHandler(w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	if err := h.service.UnmuteUser(vars["course_id"], vars["user_id"], userID); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "User unmuted"})
+}
+
+func (h *ChatHandler) UploadChatFilesHandler(w http.ResponseWriter, r *http.Request) error {
+	courseID := mux.Vars(r)["course_id"]
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, services.MaxChatAttachments*services.MaxChatUploadSize+(1<<20))
+	if err := r.ParseMultipartForm(20 << 20); err != nil {
+		return &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Failed to parse form data: " + err.Error(),
+		}
+	}
+
+	documents, err := h.service.UploadChatFiles(courseID, userID, r.MultipartForm.File["files"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, documents)
+}
+
+// parseChatPage reads the optional "before" and "limit" query parameters used
+// to page through chat history.
+func parseChatPage(r *http.Request) (types.ChatPage, error) {
+	page := types.ChatPage{Before: r.URL.Query().Get("before")}
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 100 {
+			return page, &utils.ApiError{
+				Code:    http.StatusBadRequest,
+				Message: "limit must be a number between 1 and 100",
+			}
+		}
+		page.Limit = limit
+	}
+
+	return page, nil
+}
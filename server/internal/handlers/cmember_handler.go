@@ -1,23 +1,19 @@
 package handlers
 
 import (
-	"course-flow/internal/notifications"
 	"course-flow/internal/services"
 	"course-flow/internal/utils"
 	"encoding/json"
-	"log"
 	"net/http"
 )
 
 type CourseMemberHandler struct {
 	CourseMemberService *services.CourseMemberService
-	roleChangedNotifier *notifications.RoleChangedNotifier
 }
 
-func NewCourseMemberHandler(cmSerivces *services.CourseMemberService, roleChangedNotifier *notifications.RoleChangedNotifier) *CourseMemberHandler {
+func NewCourseMemberHandler(cmSerivces *services.CourseMemberService) *CourseMemberHandler {
 	return &CourseMemberHandler{
 		CourseMemberService: cmSerivces,
-		roleChangedNotifier: roleChangedNotifier,
 	}
 }
 
@@ -31,13 +27,7 @@ func (h *CourseMemberHandler) ChangeRoleHandler(w http.ResponseWriter, r *http.R
 		return err
 	}
 
-	classID, err := h.CourseMemberService.ChangeRole(req.MemberID, req.Role, r)
-	if err != nil {
-		return err
-	}
-
-	if err := h.roleChangedNotifier.Notify(classID, req.MemberID, req.Role); err != nil {
-		log.Fatal(err)
+	if _, err := h.CourseMemberService.ChangeRole(req.MemberID, req.Role, r); err != nil {
 		return err
 	}
 
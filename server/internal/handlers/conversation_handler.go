@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"course-flow/internal/services"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type ConversationHandler struct {
+	service *services.ConversationService
+}
+
+func NewConversationHandler(service *services.ConversationService) *ConversationHandler {
+	return &ConversationHandler{
+		service: service,
+	}
+}
+
+func (h *ConversationHandler) CreateConversationHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.ConversationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request payload"}
+	}
+
+	conversation, err := h.service.CreateConversation(userID, &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, conversation)
+}
+
+func (h *ConversationHandler) GetConversationsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	conversations, err := h.service.GetConversationsForUser(userID)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, conversations)
+}
+
+func (h *ConversationHandler) GetMessagesHandler(w http.ResponseWriter, r *http.Request) error {
+	conversationID := mux.Vars(r)["id"]
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	page, err := parseChatPage(r)
+	if err != nil {
+		return err
+	}
+
+	messages, err := h.service.GetMessages(conversationID, userID, page)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, messages)
+}
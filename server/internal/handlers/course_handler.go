@@ -1,23 +1,25 @@
 package handlers
 
 import (
-	"course-flow/internal/notifications"
 	"course-flow/internal/services"
 	"course-flow/internal/types"
 	"course-flow/internal/utils"
+	"course-flow/internal/websocket"
 	"encoding/json"
 	"log"
 	"net/http"
 	"strconv"
+
+	"github.com/gorilla/mux"
 )
 
 type CourseHandler struct {
-	Service            *services.CourseService
-	memberKickNotifier *notifications.UserKickedNotifier
+	Service *services.CourseService
+	hub     *websocket.Hub // Keeps live chat subscriptions in sync with membership
 }
 
-func NewCourseHandler(service *services.CourseService, memberKickNotifier *notifications.UserKickedNotifier) *CourseHandler {
-	return &CourseHandler{Service: service, memberKickNotifier: memberKickNotifier}
+func NewCourseHandler(service *services.CourseService, hub *websocket.Hub) *CourseHandler {
+	return &CourseHandler{Service: service, hub: hub}
 }
 
 func (h *CourseHandler) UpdateCourseSettingHandler(w http.ResponseWriter, r *http.Request) error {
@@ -76,15 +78,15 @@ func (h *CourseHandler) CoursePreviewHandler(w http.ResponseWriter, r *http.Requ
 
 func (h *CourseHandler) LeaveCourseHandler(w http.ResponseWriter, r *http.Request) error {
 	toKick := r.URL.Query().Get("to_kick")
-	creatorID, classID, err := h.Service.LeaveCourse(toKick, r)
+	userID, classID, err := h.Service.LeaveCourse(toKick, r)
 	if err != nil {
 		return err
 	}
 
 	if toKick != "" {
-		if err := h.memberKickNotifier.Notify(classID, creatorID, toKick); err != nil {
-			return err
-		}
+		h.hub.Unsubscribe(classID, websocket.RemovedKicked, toKick)
+	} else {
+		h.hub.Unsubscribe(classID, websocket.RemovedLeft, userID)
 	}
 
 	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "You have successfully left the course."})
@@ -95,6 +97,7 @@ func (h *CourseHandler) DeleteCourseHandler(w http.ResponseWriter, r *http.Reque
 	if err != nil {
 		return err
 	}
+	h.hub.RemoveCourse(mux.Vars(r)["id"], websocket.RemovedDeleted)
 
 	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Course deleted successfully!"})
 }
@@ -113,6 +116,13 @@ func (h *CourseHandler) RestoreArchivedCourseHandler(w http.ResponseWriter, r *h
 		return err
 	}
 
+	memberIDs, err := h.Service.GetCourseMemberIDs(req.CourseID)
+	if err != nil {
+		log.Printf("Failed to resubscribe members of course %s: %v", req.CourseID, err)
+	} else {
+		h.hub.Subscribe(req.CourseID, memberIDs...)
+	}
+
 	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Course restored successfully!"})
 }
 
@@ -128,6 +138,7 @@ func (h *CourseHandler) ArchiveCourseHandler(w http.ResponseWriter, r *http.Requ
 	if err != nil {
 		return err
 	}
+	h.hub.RemoveCourse(req.CourseID, websocket.RemovedArchived)
 
 	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Course archieved successfully!"})
 }
@@ -149,9 +160,11 @@ func (h *CourseHandler) JoinCourseHandler(w http.ResponseWriter, r *http.Request
 		return err
 	}
 
-	if err := h.Service.JoinCourseService(joinReq.JoinCode, r); err != nil {
+	userID, courseID, err := h.Service.JoinCourseService(joinReq.JoinCode, r)
+	if err != nil {
 		return err
 	}
+	h.hub.Subscribe(courseID, userID)
 
 	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "You have successfully joined the class."})
 }
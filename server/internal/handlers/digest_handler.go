@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"course-flow/internal/services"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+)
+
+type DigestHandler struct {
+	service *services.DigestService
+}
+
+func NewDigestHandler(service *services.DigestService) *DigestHandler {
+	return &DigestHandler{
+		service: service,
+	}
+}
+
+func (h *DigestHandler) GetSettingsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	settings, err := h.service.GetSettings(userID)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, settings)
+}
+
+func (h *DigestHandler) UpdateSettingsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var settings types.DigestSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request payload"}
+	}
+
+	if err := h.service.SetFrequency(userID, settings.Frequency); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, settings)
+}
+
+// UnsubscribeHandler serves the one-click links of digest emails. A GET only
+// shows a confirmation page, since mail scanners and prefetchers open links.
+// The change is made on POST, by mail clients (RFC 8058) or the page's form.
+func (h *DigestHandler) UnsubscribeHandler(w http.ResponseWriter, r *http.Request) error {
+	token := r.URL.Query().Get("token")
+
+	if r.Method != http.MethodPost {
+		question, err := h.service.ConfirmUnsubscribe(token)
+		if err != nil {
+			return err
+		}
+		return writeUnsubscribePage(w, fmt.Sprintf(
+			"<form method=\"post\" action=\"%s\"><p>%s</p><button type=\"submit\">Confirm</button></form>",
+			html.EscapeString(r.URL.RequestURI()),
+			html.EscapeString(question),
+		))
+	}
+
+	message, err := h.service.Unsubscribe(token)
+	if err != nil {
+		return err
+	}
+
+	if r.FormValue("List-Unsubscribe") == "One-Click" {
+		return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": message})
+	}
+	return writeUnsubscribePage(w, "<p>"+html.EscapeString(message)+"</p>")
+}
+
+func writeUnsubscribePage(w http.ResponseWriter, content string) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, err := fmt.Fprintf(w, "<!DOCTYPE html><html><body style=\"font-family: sans-serif;\">%s<p>You can change this at any time in your notification settings.</p></body></html>", content)
+	return err
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"course-flow/internal/services"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultJobLimit is the page size of the job list.
+const defaultJobLimit = 50
+
+type JobHandler struct {
+	service *services.JobService
+}
+
+func NewJobHandler(service *services.JobService) *JobHandler {
+	return &JobHandler{
+		service: service,
+	}
+}
+
+func (h *JobHandler) GetJobsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	page, err := parseJobPage(r)
+	if err != nil {
+		return err
+	}
+
+	jobs, err := h.service.GetJobs(userID, page)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, jobs)
+}
+
+func (h *JobHandler) GetJobHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	job, err := h.service.GetJob(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, job)
+}
+
+func (h *JobHandler) GetJobStatsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	stats, err := h.service.GetJobStats(userID)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, stats)
+}
+
+func (h *JobHandler) RetryJobHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	job, err := h.service.RetryJob(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusAccepted, job)
+}
+
+// parseJobPage reads the optional "type", "status", "before" and "limit"
+// query parameters used to page through jobs.
+func parseJobPage(r *http.Request) (types.JobPage, error) {
+	page := types.JobPage{
+		Type:   r.URL.Query().Get("type"),
+		Status: r.URL.Query().Get("status"),
+		Before: r.URL.Query().Get("before"),
+		Limit:  defaultJobLimit,
+	}
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 100 {
+			return page, &utils.ApiError{
+				Code:    http.StatusBadRequest,
+				Message: "limit must be a number between 1 and 100",
+			}
+		}
+		page.Limit = limit
+	}
+
+	switch page.Status {
+	case "", types.JobPending, types.JobRunning, types.JobSucceeded, types.JobDead:
+	default:
+		return page, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "status must be pending, running, succeeded or dead",
+		}
+	}
+
+	return page, nil
+}
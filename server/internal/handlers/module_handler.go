@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"course-flow/internal/services"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type ModuleHandler struct {
+	service *services.ModuleService
+}
+
+func NewModuleHandler(service *services.ModuleService) *ModuleHandler {
+	return &ModuleHandler{
+		service: service,
+	}
+}
+
+func (h *ModuleHandler) GetModulesHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	modules, err := h.service.GetModules(userID, mux.Vars(r)["course_id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, modules)
+}
+
+func (h *ModuleHandler) CreateModuleHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.CourseModuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	module, err := h.service.CreateModule(userID, mux.Vars(r)["course_id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, module)
+}
+
+func (h *ModuleHandler) ReorderModulesHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.ReorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	modules, err := h.service.ReorderModules(userID, mux.Vars(r)["course_id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, modules)
+}
+
+// GetProgressHandler returns the progress matrix of a course, or every
+// student's completion of every item as CSV with ?format=csv.
+func (h *ModuleHandler) GetProgressHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	courseID := mux.Vars(r)["course_id"]
+	progress, err := h.service.GetProgress(userID, courseID)
+	if err != nil {
+		return err
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		data, err := services.ProgressCSV(progress)
+		if err != nil {
+			return err
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "progress-"+courseID+".csv"))
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(data)
+		return err
+	}
+	return utils.WriteJSON(w, http.StatusOK, progress)
+}
+
+func (h *ModuleHandler) GetModuleHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	module, err := h.service.GetModule(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, module)
+}
+
+func (h *ModuleHandler) UpdateModuleHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.CourseModuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	module, err := h.service.UpdateModule(userID, mux.Vars(r)["id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, module)
+}
+
+func (h *ModuleHandler) DeleteModuleHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	if err := h.service.DeleteModule(userID, mux.Vars(r)["id"]); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Module deleted successfully"})
+}
+
+func (h *ModuleHandler) CreateItemHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.ModuleItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	item, err := h.service.CreateItem(userID, mux.Vars(r)["id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, item)
+}
+
+// UploadItemsHandler adds the uploaded "files" as attachment items, with an
+// optional "title" for a single file and "release_at".
+func (h *ModuleHandler) UploadItemsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	if err := r.ParseMultipartForm(20 << 20); err != nil {
+		return &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Failed to parse form data: " + err.Error(),
+		}
+	}
+
+	req := types.ModuleItemRequest{
+		Title:     r.FormValue("title"),
+		ReleaseAt: r.FormValue("release_at"),
+	}
+	module, err := h.service.UploadItems(userID, mux.Vars(r)["id"], &req, r.MultipartForm.File["files"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, module)
+}
+
+func (h *ModuleHandler) ReorderItemsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.ReorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	module, err := h.service.ReorderItems(userID, mux.Vars(r)["id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, module)
+}
+
+func (h *ModuleHandler) GetItemHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	item, err := h.service.GetItem(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, item)
+}
+
+func (h *ModuleHandler) UpdateItemHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.ModuleItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	item, err := h.service.UpdateItem(userID, mux.Vars(r)["id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, item)
+}
+
+func (h *ModuleHandler) DeleteItemHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	if err := h.service.DeleteItem(userID, mux.Vars(r)["id"]); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Item deleted successfully"})
+}
+
+func (h *ModuleHandler) CompleteItemHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	item, err := h.service.CompleteItem(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, item)
+}
+
+func (h *ModuleHandler) UncompleteItemHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	item, err := h.service.UncompleteItem(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, item)
+}
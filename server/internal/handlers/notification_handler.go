@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"course-flow/internal/services"
+	"course-flow/internal/types"
 	"course-flow/internal/utils"
+	"encoding/json"
 	"net/http"
+
+	"github.com/gorilla/mux"
 )
 
 type NotificationHandler struct {
@@ -71,4 +75,72 @@ func (h *NotificationHandler) ClearAllNotificationsHandler(w http.ResponseWriter
 	}
 
 	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "All notifications cleared"})
-}
\ No newline at end of file
+}
+
+func (h *NotificationHandler) GetPreferencesHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	preferences, err := h.service.GetPreferences(userID)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, preferences)
+}
+
+func (h *NotificationHandler) SetPreferenceHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var preference types.NotificationPreference
+	if err := json.NewDecoder(r.Body).Decode(&preference); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request payload"}
+	}
+
+	if err := h.service.SetPreference(userID, &preference); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, preference)
+}
+
+func (h *NotificationHandler) MuteCourseHandler(w http.ResponseWriter, r *http.Request) error {
+	courseID := mux.Vars(r)["course_id"]
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.NotificationCourseMuteRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request payload"}
+		}
+	}
+
+	mute, err := h.service.MuteCourse(userID, courseID, req.DurationMinutes)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, mute)
+}
+
+func (h *NotificationHandler) UnmuteCourseHandler(w http.ResponseWriter, r *http.Request) error {
+	courseID := mux.Vars(r)["course_id"]
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	if err := h.service.UnmuteCourse(userID, courseID); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Course unmuted"})
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"course-flow/internal/services"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"course-flow/internal/websocket"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type OfficeHourHandler struct {
+	service *services.OfficeHourService
+	hub     *websocket.Hub
+}
+
+func NewOfficeHourHandler(service *services.OfficeHourService, hub *websocket.Hub) *OfficeHourHandler {
+	return &OfficeHourHandler{
+		service: service,
+		hub:     hub,
+	}
+}
+
+func (h *OfficeHourHandler) GetOfficeHoursHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	officeHours, err := h.service.GetOfficeHours(userID, mux.Vars(r)["course_id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, officeHours)
+}
+
+func (h *OfficeHourHandler) CreateOfficeHourHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.OfficeHourRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	officeHour, err := h.service.CreateOfficeHour(userID, mux.Vars(r)["course_id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, officeHour)
+}
+
+func (h *OfficeHourHandler) GetOfficeHourHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	officeHour, err := h.service.GetOfficeHour(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, officeHour)
+}
+
+func (h *OfficeHourHandler) UpdateOfficeHourHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.OfficeHourRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	officeHour, err := h.service.UpdateOfficeHour(userID, mux.Vars(r)["id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, officeHour)
+}
+
+func (h *OfficeHourHandler) DeleteOfficeHourHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	if err := h.service.DeleteOfficeHour(userID, mux.Vars(r)["id"]); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Office hours deleted successfully"})
+}
+
+func (h *OfficeHourHandler) BookSlotHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.OfficeHourBookingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	booking, err := h.service.BookSlot(userID, mux.Vars(r)["id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, booking)
+}
+
+func (h *OfficeHourHandler) GetMyBookingsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	bookings, err := h.service.GetMyBookings(userID)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, bookings)
+}
+
+func (h *OfficeHourHandler) CancelBookingHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	if err := h.service.CancelBooking(userID, mux.Vars(r)["id"]); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Booking cancelled successfully"})
+}
+
+func (h *OfficeHourHandler) GetQueueHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	queue, err := h.service.GetQueue(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, queue)
+}
+
+func (h *OfficeHourHandler) JoinQueueHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.QueueJoinRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+		}
+	}
+
+	officeHourID := mux.Vars(r)["id"]
+	updates, err := h.service.JoinQueue(userID, officeHourID, &req)
+	if err != nil {
+		return err
+	}
+	h.publishQueue(updates)
+
+	return h.writeQueue(w, http.StatusCreated, userID, officeHourID)
+}
+
+func (h *OfficeHourHandler) LeaveQueueHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	updates, err := h.service.LeaveQueue(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+	h.publishQueue(updates)
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Left the queue successfully"})
+}
+
+// NextInQueueHandler finishes the student being served, calls the next one
+// and returns the queue.
+func (h *OfficeHourHandler) NextInQueueHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	officeHourID := mux.Vars(r)["id"]
+	updates, err := h.service.NextInQueue(userID, officeHourID)
+	if err != nil {
+		return err
+	}
+	h.publishQueue(updates)
+
+	return h.writeQueue(w, http.StatusOK, userID, officeHourID)
+}
+
+// publishQueue pushes the queue frames to the students and staff following
+// the queue.
+func (h *OfficeHourHandler) publishQueue(updates []types.QueueUpdate) {
+	for _, update := range updates {
+		h.hub.SendFrame(update.UserIDs, update.Frame)
+	}
+}
+
+func (h *OfficeHourHandler) writeQueue(w http.ResponseWriter, status int, userID, officeHourID string) error {
+	queue, err := h.service.GetQueue(userID, officeHourID)
+	if err != nil {
+		return err
+	}
+	return utils.WriteJSON(w, status, queue)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"course-flow/internal/services"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type PeerReviewHandler struct {
+	service *services.PeerReviewService
+}
+
+func NewPeerReviewHandler(service *services.PeerReviewService) *PeerReviewHandler {
+	return &PeerReviewHandler{
+		service: service,
+	}
+}
+
+func (h *PeerReviewHandler) OpenPeerReviewHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.PeerReviewPhaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	phase, err := h.service.OpenPeerReview(userID, mux.Vars(r)["id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, phase)
+}
+
+func (h *PeerReviewHandler) GetPeerReviewHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	phase, err := h.service.GetPeerReview(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, phase)
+}
+
+func (h *PeerReviewHandler) ClosePeerReviewHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	phase, err := h.service.ClosePeerReview(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, phase)
+}
+
+func (h *PeerReviewHandler) GetReviewsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	reviews, err := h.service.GetReviews(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, reviews)
+}
+
+func (h *PeerReviewHandler) GetReceivedReviewsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	reviews, err := h.service.GetReceivedReviews(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, reviews)
+}
+
+func (h *PeerReviewHandler) GetReviewHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	review, err := h.service.GetReview(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, review)
+}
+
+func (h *PeerReviewHandler) SubmitReviewHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.GradeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	review, err := h.service.SubmitReview(userID, mux.Vars(r)["id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, review)
+}
@@ -1,34 +1,86 @@
 package handlers
 
 import (
-	"course-flow/internal/notifications"
 	"course-flow/internal/services"
+	"course-flow/internal/types"
 	"course-flow/internal/utils"
+	"course-flow/internal/websocket"
 	"encoding/json"
 	"log"
 	"net/http"
+
+	"github.com/gorilla/mux"
 )
 
 type PostHandler struct {
-	postService            *services.PostService
-	postCreatedNotifier    *notifications.PostCreatedNotifier
-	commentCreatedNotifier *notifications.CommentAddedNotifier
+	postService *services.PostService
+	hub         *websocket.Hub
 }
 
-func NewPostHandler(postService *services.PostService, postCreatedNotifier *notifications.PostCreatedNotifier, commentAddedNotifer *notifications.CommentAddedNotifier) *PostHandler {
+func NewPostHandler(postService *services.PostService, hub *websocket.Hub) *PostHandler {
 	return &PostHandler{
-		postService:            postService,
-		postCreatedNotifier:    postCreatedNotifier,
-		commentCreatedNotifier: commentAddedNotifer,
+		postService: postService,
+		hub:         hub,
+	}
+}
+
+// publishPost sends the rendered post to the members viewing the course. The
+// change is already saved, so failures are only logged.
+func (h *PostHandler) publishPost(eventType, postID, actorID string) {
+	post, err := h.postService.GetPost(postID)
+	if err != nil {
+		log.Printf("Failed to load post %s for stream event: %v", postID, err)
+		return
 	}
+
+	h.hub.PublishStream(types.StreamEvent{
+		Type:     eventType,
+		CourseID: post.CourseID,
+		PostID:   postID,
+		ActorID:  actorID,
+		Post:     post,
+	})
+}
+
+// publishComment sends the rendered comment to the members viewing the course.
+func (h *PostHandler) publishComment(eventType, commentID, actorID string) {
+	comment, err := h.postService.GetComment(commentID)
+	if err != nil {
+		log.Printf("Failed to load comment %s for stream event: %v", commentID, err)
+		return
+	}
+
+	courseID, err := h.postService.GetPostCourseID(comment.PostID)
+	if err != nil {
+		log.Printf("Failed to load course of post %s for stream event: %v", comment.PostID, err)
+		return
+	}
+
+	h.hub.PublishStream(types.StreamEvent{
+		Type:      eventType,
+		CourseID:  courseID,
+		PostID:    comment.PostID,
+		CommentID: commentID,
+		ActorID:   actorID,
+		Comment:   comment,
+	})
 }
 
 func (h *PostHandler) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) error {
-	err := h.postService.DeleteComment(r)
+	postID, courseID, err := h.postService.DeleteComment(r)
 	if err != nil {
 		return err
 	}
 
+	userID, _ := utils.GetUserIDFromContext(r.Context())
+	h.hub.PublishStream(types.StreamEvent{
+		Type:      types.StreamCommentDeleted,
+		CourseID:  courseID,
+		PostID:    postID,
+		CommentID: mux.Vars(r)["comment_id"],
+		ActorID:   userID,
+	})
+
 	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Comment deleted successfully"})
 }
 
@@ -46,6 +98,9 @@ func (h *PostHandler) EditommentHandler(w http.ResponseWriter, r *http.Request)
 		return err
 	}
 
+	userID, _ := utils.GetUserIDFromContext(r.Context())
+	h.publishComment(types.StreamCommentUpdated, mux.Vars(r)["comment_id"], userID)
+
 	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Comment editted successfully"})
 }
 
@@ -72,10 +127,7 @@ func (h *PostHandler) AddCommentHandler(w http.ResponseWriter, r *http.Request)
 		return err
 	}
 
-	if err := h.commentCreatedNotifier.Notify(*payload); err != nil {
-		log.Fatal(err)
-		return err
-	}
+	h.publishComment(types.StreamCommentCreated, payload.CommentID, payload.UserID)
 
 	return utils.WriteJSON(w, http.StatusCreated, map[string]string{"message": "Comment created successfully"})
 }
@@ -89,7 +141,13 @@ func (h *PostHandler) EditPostHandler(w http.ResponseWriter, r *http.Request) er
 		}
 	}
 
-	return h.postService.EditPost(r)
+	if err := h.postService.EditPost(r); err != nil {
+		return err
+	}
+
+	userID, _ := utils.GetUserIDFromContext(r.Context())
+	h.publishPost(types.StreamPostUpdated, mux.Vars(r)["id"], userID)
+	return nil
 }
 
 func (h *PostHandler) GetAllPostHandler(w http.ResponseWriter, r *http.Request) error {
@@ -107,6 +165,14 @@ func (h *PostHandler) DeletePostHandler(w http.ResponseWriter, r *http.Request)
 		return err
 	}
 
+	userID, _ := utils.GetUserIDFromContext(r.Context())
+	h.hub.PublishStream(types.StreamEvent{
+		Type:     types.StreamPostDeleted,
+		CourseID: r.URL.Query().Get("course_id"),
+		PostID:   mux.Vars(r)["id"],
+		ActorID:  userID,
+	})
+
 	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Post deleted successfully"})
 }
 
@@ -132,10 +198,7 @@ func (h *PostHandler) CreateNewPostHandler(w http.ResponseWriter, r *http.Reques
 		return err
 	}
 
-	if err := h.postCreatedNotifier.Notify(payload.ClassID, content, payload.UserID); err != nil {
-		log.Fatal(err)
-		return err
-	}
+	h.publishPost(types.StreamPostCreated, payload.PostID, payload.UserID)
 
 	return utils.WriteJSON(w, http.StatusCreated, map[string]string{"message": "Post created successfully"})
 }
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"course-flow/internal/services"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"course-flow/internal/websocket"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type PresenceHandler struct {
+	service *services.PresenceService
+	hub     *websocket.Hub
+}
+
+func NewPresenceHandler(service *services.PresenceService, hub *websocket.Hub) *PresenceHandler {
+	return &PresenceHandler{
+		service: service,
+		hub:     hub,
+	}
+}
+
+func (h *PresenceHandler) GetOnlineMembersHandler(w http.ResponseWriter, r *http.Request) error {
+	courseID := mux.Vars(r)["course_id"]
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	members, err := h.service.GetOnlineMembers(courseID, userID, h.hub.OnlineUserIDs(courseID))
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, members)
+}
+
+func (h *PresenceHandler) GetSettingsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	settings, err := h.service.GetSettings(userID)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, settings)
+}
+
+func (h *PresenceHandler) UpdateSettingsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var settings types.PresenceSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request payload"}
+	}
+
+	if err := h.service.UpdateSettings(userID, &settings); err != nil {
+		return err
+	}
+	h.hub.SetAppearOffline(userID, settings.AppearOffline)
+
+	return utils.WriteJSON(w, http.StatusOK, settings)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"course-flow/internal/push"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"encoding/json"
+	"net/http"
+)
+
+type PushHandler struct {
+	service *push.Service
+}
+
+func NewPushHandler(service *push.Service) *PushHandler {
+	return &PushHandler{
+		service: service,
+	}
+}
+
+// GetPublicKeyHandler returns the applicationServerKey to subscribe with.
+func (h *PushHandler) GetPublicKeyHandler(w http.ResponseWriter, r *http.Request) error {
+	return utils.WriteJSON(w, http.StatusOK, types.VAPIDPublicKey{PublicKey: h.service.PublicKey()})
+}
+
+func (h *PushHandler) SubscribeHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.PushSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request payload"}
+	}
+
+	sub, err := h.service.Subscribe(userID, r.UserAgent(), req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, sub)
+}
+
+func (h *PushHandler) UnsubscribeHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.PushUnsubscribeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request payload"}
+	}
+
+	if err := h.service.Unsubscribe(userID, req.Endpoint); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Push subscription removed"})
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"course-flow/internal/services"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type RubricHandler struct {
+	service *services.RubricService
+}
+
+func NewRubricHandler(service *services.RubricService) *RubricHandler {
+	return &RubricHandler{
+		service: service,
+	}
+}
+
+func (h *RubricHandler) GetRubricsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	rubrics, err := h.service.GetRubrics(userID, mux.Vars(r)["course_id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, rubrics)
+}
+
+func (h *RubricHandler) CreateRubricHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.RubricRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	rubric, err := h.service.CreateRubric(userID, mux.Vars(r)["course_id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, rubric)
+}
+
+func (h *RubricHandler) GetRubricHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	rubric, err := h.service.GetRubric(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, rubric)
+}
+
+func (h *RubricHandler) UpdateRubricHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.RubricRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	rubric, err := h.service.UpdateRubric(userID, mux.Vars(r)["id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, rubric)
+}
+
+func (h *RubricHandler) DeleteRubricHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	if err := h.service.DeleteRubric(userID, mux.Vars(r)["id"]); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Rubric deleted successfully"})
+}
+
+func (h *RubricHandler) CopyRubricHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.CopyRubricRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	rubric, err := h.service.CopyRubric(userID, mux.Vars(r)["id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, rubric)
+}
+
+func (h *RubricHandler) SetItemRubricHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.ItemRubricRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+	if req.RubricID == "" {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "rubric_id is required"}
+	}
+
+	item, err := h.service.SetItemRubric(userID, mux.Vars(r)["id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, item)
+}
+
+func (h *RubricHandler) RemoveItemRubricHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	item, err := h.service.SetItemRubric(userID, mux.Vars(r)["id"], &types.ItemRubricRequest{})
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, item)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"course-flow/internal/services"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type SubmissionHandler struct {
+	service *services.SubmissionService
+}
+
+func NewSubmissionHandler(service *services.SubmissionService) *SubmissionHandler {
+	return &SubmissionHandler{
+		service: service,
+	}
+}
+
+// SubmitHandler hands in the "body" and "files" of a multipart form for an
+// assignment.
+func (h *SubmissionHandler) SubmitHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	if err := r.ParseMultipartForm(20 << 20); err != nil {
+		return &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Failed to parse form data: " + err.Error(),
+		}
+	}
+
+	submission, err := h.service.Submit(userID, mux.Vars(r)["id"], r.FormValue("body"), r.MultipartForm.File["files"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, submission)
+}
+
+func (h *SubmissionHandler) GetSubmissionsHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	submissions, err := h.service.GetSubmissions(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, submissions)
+}
+
+func (h *SubmissionHandler) GetSubmissionHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	submission, err := h.service.GetSubmission(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, submission)
+}
+
+func (h *SubmissionHandler) GradeSubmissionHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.GradeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+
+	submission, err := h.service.GradeSubmission(userID, mux.Vars(r)["id"], &req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, submission)
+}
+
+func (h *SubmissionHandler) ReturnGradeHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	submission, err := h.service.ReturnGrade(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, submission)
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"course-flow/internal/services"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultDeliveryLimit is the page size of the delivery history.
+const defaultDeliveryLimit = 50
+
+type WebhookHandler struct {
+	service *services.WebhookService
+}
+
+func NewWebhookHandler(service *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		service: service,
+	}
+}
+
+func (h *WebhookHandler) GetWebhooksHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	webhooks, err := h.service.GetWebhooks(userID, mux.Vars(r)["course_id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, webhooks)
+}
+
+func (h *WebhookHandler) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request payload"}
+	}
+
+	webhook, err := h.service.CreateWebhook(userID, mux.Vars(r)["course_id"], req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, webhook)
+}
+
+func (h *WebhookHandler) UpdateWebhookHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req types.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid request payload"}
+	}
+
+	webhook, err := h.service.UpdateWebhook(userID, mux.Vars(r)["id"], req)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, webhook)
+}
+
+func (h *WebhookHandler) RotateSecretHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	webhook, err := h.service.RotateSecret(userID, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, webhook)
+}
+
+func (h *WebhookHandler) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	if err := h.service.DeleteWebhook(userID, mux.Vars(r)["id"]); err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Webhook deleted"})
+}
+
+func (h *WebhookHandler) GetDeliveriesHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	page, err := parseDeliveryPage(r)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := h.service.GetDeliveries(userID, mux.Vars(r)["id"], page)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, deliveries)
+}
+
+func (h *WebhookHandler) GetDeliveryHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	vars := mux.Vars(r)
+	delivery, err := h.service.GetDelivery(userID, vars["id"], vars["delivery_id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, delivery)
+}
+
+func (h *WebhookHandler) ReplayDeliveryHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	vars := mux.Vars(r)
+	delivery, err := h.service.ReplayDelivery(userID, vars["id"], vars["delivery_id"])
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusAccepted, delivery)
+}
+
+// parseDeliveryPage reads the optional "before", "limit" and "status" query
+// parameters used to page through the delivery history.
+func parseDeliveryPage(r *http.Request) (types.WebhookDeliveryPage, error) {
+	page := types.WebhookDeliveryPage{
+		Before: r.URL.Query().Get("before"),
+		Limit:  defaultDeliveryLimit,
+		Status: r.URL.Query().Get("status"),
+	}
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 100 {
+			return page, &utils.ApiError{
+				Code:    http.StatusBadRequest,
+				Message: "limit must be a number between 1 and 100",
+			}
+		}
+		page.Limit = limit
+	}
+
+	switch page.Status {
+	case "", types.DeliveryPending, types.DeliverySucceeded, types.DeliveryFailed:
+	default:
+		return page, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "status must be pending, succeeded or failed",
+		}
+	}
+
+	return page, nil
+}
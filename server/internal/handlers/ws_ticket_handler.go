@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"course-flow/internal/services"
+	"course-flow/internal/utils"
+	"net/http"
+	"strings"
+)
+
+type WSTicketHandler struct {
+	service *services.WSTicketService
+}
+
+func NewWSTicketHandler(service *services.WSTicketService) *WSTicketHandler {
+	return &WSTicketHandler{
+		service: service,
+	}
+}
+
+func (h *WSTicketHandler) CreateTicketHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	// Connections opened with the ticket expire with the access token
+	_, tokenExpiresAt, err := utils.ParseAccessToken(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if err != nil {
+		return err
+	}
+
+	ticket, err := h.service.IssueTicket(userID, tokenExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteJSON(w, http.StatusCreated, ticket)
+}
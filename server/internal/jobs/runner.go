@@ -0,0 +1,309 @@
+// Package jobs runs background work stored in Postgres: jobs are claimed with
+// SKIP LOCKED by any number of workers, retried with backoff and moved to a
+// dead letter state after their last attempt. Recurring jobs are enqueued
+// from cron specs by whichever worker gets to them first.
+package jobs
+
+import (
+	"context"
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// pollInterval is how often due jobs are looked for when nothing wakes
+	// the runner up, e.g. for retries and scheduled jobs.
+	pollInterval = 5 * time.Second
+	// lockMargin is added to a job's timeout to get how long it is locked,
+	// so it is only claimed again once its worker surely gave up on it.
+	lockMargin = time.Minute
+	// The delay before a retry doubles from baseBackoff up to maxBackoff.
+	baseBackoff = 10 * time.Second
+	maxBackoff  = time.Hour
+
+	defaultConcurrency = 1
+	defaultMaxAttempts = 5
+	defaultTimeout     = 5 * time.Minute
+)
+
+// Handler runs a job. A returned error fails the attempt. The context ends
+// when the job times out.
+type Handler func(ctx context.Context, job types.Job) error
+
+// Options tune how the jobs of a type run. Zero values use the defaults.
+type Options struct {
+	// Concurrency is how many jobs of the type a process runs at once.
+	Concurrency int
+	// MaxAttempts is how many times a job is tried before it is dead.
+	MaxAttempts int
+	// Timeout bounds a single attempt.
+	Timeout time.Duration
+}
+
+type worker struct {
+	handle  Handler
+	opts    Options
+	running int
+}
+
+type schedule struct {
+	name string
+	spec string
+	cron *Cron
+	req  types.JobRequest
+}
+
+type Runner struct {
+	storage   *storage.JobStorage
+	mu        sync.Mutex
+	workers   map[string]*worker
+	schedules []schedule
+	wake      chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewRunner(storage *storage.JobStorage) *Runner {
+	return &Runner{
+		storage: storage,
+		workers: make(map[string]*worker),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Handle registers the handler of a job type. Handlers must be registered
+// before Run, and must tolerate running a job again after a crash.
+func (r *Runner) Handle(jobType string, opts Options, handle Handler) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	r.workers[jobType] = &worker{handle: handle, opts: opts}
+}
+
+// Register registers a handler that receives the job payload decoded as T.
+// A payload that does not decode kills the job right away, since retrying
+// cannot fix it.
+func Register[T any](r *Runner, jobType string, opts Options, handle func(ctx context.Context, payload T) error) {
+	r.Handle(jobType, opts, func(ctx context.Context, job types.Job) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return permanentError{fmt.Errorf("invalid %s payload: %v", jobType, err)}
+		}
+		return handle(ctx, payload)
+	})
+}
+
+// permanentError fails a job without retrying it.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+// Schedule enqueues a job of the given type and payload every time the cron
+// spec matches. The name identifies the schedule across restarts.
+func (r *Runner) Schedule(name, spec, jobType string, payload interface{}) error {
+	cron, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+	r.schedules = append(r.schedules, schedule{
+		name: name,
+		spec: spec,
+		cron: cron,
+		req:  types.JobRequest{Type: jobType, Payload: payload},
+	})
+	return nil
+}
+
+// Run claims and runs jobs until the context ends, then waits for the jobs
+// it started to finish. Several processes can run it at once.
+func (r *Runner) Run(ctx context.Context) {
+	for _, s := range r.schedules {
+		if err := r.storage.SaveSchedule(s.name, s.spec, s.cron.Next(time.Now())); err != nil {
+			log.Println(err)
+		}
+	}
+
+	r.listen(ctx)
+
+	jobTypes := make([]string, 0, len(r.workers))
+	for jobType := range r.workers {
+		jobTypes = append(jobTypes, jobType)
+	}
+	sort.Strings(jobTypes)
+	log.Printf("Job runner started for %v", jobTypes)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.enqueueScheduled()
+		for _, jobType := range jobTypes {
+			r.claim(jobType)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-r.wake:
+		case <-ctx.Done():
+			log.Println("Job runner stopping, waiting for running jobs")
+			r.wg.Wait()
+			return
+		}
+	}
+}
+
+// listen wakes the runner up when jobs are enqueued, so they do not wait for
+// the next poll.
+func (r *Runner) listen(ctx context.Context) {
+	connStr := os.Getenv("DATABASE_URL")
+	if connStr == "" {
+		return
+	}
+
+	listener := pq.NewListener(connStr, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Job listener event %d: %v", event, err)
+		}
+	})
+	if err := listener.Listen(storage.JobChannel); err != nil {
+		log.Printf("Failed to listen on %s, polling for jobs: %v", storage.JobChannel, err)
+		listener.Close()
+		return
+	}
+
+	go func() {
+		defer listener.Close()
+		for {
+			select {
+			case <-listener.Notify:
+				r.wakeUp()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (r *Runner) wakeUp() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Runner) enqueueScheduled() {
+	now := time.Now().UTC()
+	for _, s := range r.schedules {
+		claimed, err := r.storage.ClaimSchedule(s.name, now, s.cron.Next(now), s.req)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if claimed {
+			log.Printf("Successfully enqueued scheduled job %s", s.name)
+		}
+	}
+}
+
+// claim starts as many due jobs of the type as it has free slots for.
+func (r *Runner) claim(jobType string) {
+	w := r.workers[jobType]
+
+	r.mu.Lock()
+	free := w.opts.Concurrency - w.running
+	r.mu.Unlock()
+	if free <= 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	jobs, err := r.storage.ClaimJobs(jobType, now, now.Add(w.opts.Timeout+lockMargin), free)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, job := range jobs {
+		r.mu.Lock()
+		w.running++
+		r.mu.Unlock()
+
+		r.wg.Add(1)
+		go func(job types.Job) {
+			defer r.wg.Done()
+			r.run(w, job)
+
+			r.mu.Lock()
+			w.running--
+			r.mu.Unlock()
+			// A slot is free, more jobs may be waiting
+			r.wakeUp()
+		}(job)
+	}
+}
+
+func (r *Runner) run(w *worker, job types.Job) {
+	// Jobs are not cancelled on shutdown, they get their full timeout to
+	// finish
+	ctx, cancel := context.WithTimeout(context.Background(), w.opts.Timeout)
+	defer cancel()
+
+	err := safeHandle(ctx, w.handle, job)
+	if err == nil {
+		if err := r.storage.CompleteJob(job.ID, job.Attempts); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	_, permanent := err.(permanentError)
+	if permanent || job.Attempts >= w.opts.MaxAttempts {
+		log.Printf("Job %s (%s) is dead after %d attempts: %v", job.ID, job.Type, job.Attempts, err)
+		if err := r.storage.KillJob(job.ID, job.Attempts, err.Error()); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	log.Printf("Job %s (%s) failed, retrying: %v", job.ID, job.Type, err)
+	runAt := time.Now().UTC().Add(backoff(job.Attempts))
+	if err := r.storage.RescheduleJob(job.ID, job.Attempts, err.Error(), runAt); err != nil {
+		log.Println(err)
+	}
+}
+
+// safeHandle turns a panicking handler into a failed attempt.
+func safeHandle(ctx context.Context, handle Handler, job types.Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return handle(ctx, job)
+}
+
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff << (attempts - 1)
+	if delay <= 0 || delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,56 @@
+package jobs
+
+import (
+	"context"
+	"course-flow/internal/mailer"
+	"course-flow/internal/services"
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// retention is how long succeeded jobs are kept for inspection.
+const retention = 7 * 24 * time.Hour
+
+// NewAppRunner returns a runner with every job of the application
+// registered, for the server process and the worker command alike.
+func NewAppRunner(db *sql.DB, mail mailer.Mailer) (*Runner, error) {
+	jobStorage := storage.NewJobStorage(db)
+	runner := NewRunner(jobStorage)
+
+	digestService := services.NewDigestService(storage.NewDigestStorage(db), storage.NewNotificationPreferenceStorage(db), mail)
+	Register(runner, types.JobSendDigests, Options{Timeout: 30 * time.Minute, MaxAttempts: 3}, func(ctx context.Context, _ struct{}) error {
+		return digestService.SendDue()
+	})
+	if err := runner.Schedule("digests", "@hourly", types.JobSendDigests, nil); err != nil {
+		return nil, err
+	}
+
+	Register(runner, types.JobPruneJobs, Options{}, func(ctx context.Context, _ struct{}) error {
+		deleted, err := jobStorage.DeleteFinishedJobs(time.Now().UTC().Add(-retention))
+		if err != nil {
+			return err
+		}
+		if deleted > 0 {
+			log.Printf("Successfully pruned %d finished jobs", deleted)
+		}
+		return nil
+	})
+	if err := runner.Schedule("prune-jobs", "30 3 * * *", types.JobPruneJobs, nil); err != nil {
+		return nil, err
+	}
+
+	officeHourService := services.NewOfficeHourService(storage.NewOfficeHourStorage(db))
+	Register(runner, types.JobOfficeHourReminder, Options{Concurrency: 4}, func(ctx context.Context, payload types.OfficeHourReminderJob) error {
+		return officeHourService.SendReminder(payload.BookingID)
+	})
+
+	documentService := services.NewDocumentService(storage.NewDocumentStorage(db))
+	Register(runner, types.JobDocumentThumbnail, Options{Concurrency: 2, MaxAttempts: 3}, func(ctx context.Context, payload types.DocumentThumbnailJob) error {
+		return documentService.GenerateThumbnail(payload.DocumentID)
+	})
+
+	return runner, nil
+}
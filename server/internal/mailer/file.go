@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileMailer writes every message to an .eml file instead of sending it, so
+// emails can be inspected during development.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory %s: %v", dir, err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	data, err := build(m.from, msg)
+	if err != nil {
+		return fmt.Errorf("failed to build email: %v", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.NewString()[:8])
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write email to %s: %v", path, err)
+	}
+
+	log.Printf("Successfully wrote email to %s for %s", path, msg.To)
+	return nil
+}
@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+)
+
+// Message is a multipart email with a plain text and an HTML body.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string // Extra headers, e.g. List-Unsubscribe
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// NewMailerFromEnv picks the mailer selected by MAILER. "smtp" sends through
+// the SMTP_* settings; anything else writes messages to MAIL_DIR for local
+// development.
+func NewMailerFromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Course Flow <no-reply@localhost>"
+	}
+
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the smtp mailer")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return NewSMTPMailer(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from), nil
+	default:
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "./mail"
+		}
+		return NewFileMailer(dir, from)
+	}
+}
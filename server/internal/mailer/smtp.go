@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/mail"
+	"net/smtp"
+)
+
+// SMTPMailer sends messages through an SMTP server, authenticating when a
+// username is configured.
+type SMTPMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	data, err := build(m.from, msg)
+	if err != nil {
+		return fmt.Errorf("failed to build email: %v", err)
+	}
+
+	sender, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return fmt.Errorf("invalid MAIL_FROM address: %v", err)
+	}
+
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	if err := smtp.SendMail(m.host+":"+m.port, auth, sender.Address, []string{msg.To}, data); err != nil {
+		return fmt.Errorf("failed to send email to %s: %v", msg.To, err)
+	}
+
+	log.Printf("Successfully sent email to %s", msg.To)
+	return nil
+}
@@ -13,21 +13,13 @@ func CORSMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			origin := r.Header.Get("Origin")
-			allowed := false
 
-			for _, o := range allowedOrigins {
-				if o == "*" || o == origin {
-					allowed = true
-					break
-				}
-			}
-
-			if allowed {
+			if OriginAllowed(allowedOrigins, origin) {
 				// Set CORS headers
 				w.Header().Set("Access-Control-Allow-Origin", origin)
 				w.Header().Set("Vary", "Origin")
 				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Last-Event-ID")
 				w.Header().Set("Access-Control-Allow-Credentials", "true")
 			}
 
@@ -41,6 +33,17 @@ func CORSMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
 	}
 }
 
+// OriginAllowed reports whether the origin is in the allowlist, where "*"
+// allows any origin.
+func OriginAllowed(allowedOrigins []string, origin string) bool {
+	for _, o := range allowedOrigins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
 func AuthMiddleware(next apiFunc) apiFunc {
 	return func(w http.ResponseWriter, r *http.Request) error {
 		userID, err := utils.ExtractUserIDFromToken(r)
@@ -0,0 +1,79 @@
+// Package netguard keeps requests to user-supplied URLs, such as push
+// endpoints and webhooks, from reaching the server's own network.
+package netguard
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, which
+// net.IP does not count as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// PublicAddress reports whether an address is reachable on the internet.
+func PublicAddress(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	return ok && !sharedAddressSpace.Contains(addr.Unmap())
+}
+
+// CheckHost resolves the host of a URL and fails unless every address is
+// public.
+func CheckHost(host string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("cannot resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if !PublicAddress(addr.IP) {
+			return fmt.Errorf("%s resolves to the non-public address %s", host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// NewClient returns a client for user-supplied URLs. Unless local addresses
+// are allowed, it refuses to connect to non-public addresses, checked on the
+// address actually dialed so DNS changes after CheckHost do not get around
+// it. Proxies are not used and redirects are not followed.
+func NewClient(timeout time.Duration, allowLocal bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowLocal {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !PublicAddress(ip) {
+				return fmt.Errorf("refusing to connect to non-public address %s", host)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// The URL was checked, do not let it point elsewhere
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
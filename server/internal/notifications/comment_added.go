@@ -1,6 +1,7 @@
 package notifications
 
 import (
+	"course-flow/internal/push"
 	"course-flow/internal/services"
 	"course-flow/internal/types"
 	"course-flow/internal/websocket"
@@ -9,24 +10,27 @@ import (
 
 type CommentAddedNotifier struct {
 	hub     *websocket.Hub
+	push    *push.Service
 	service *services.NotificationService
 }
 
-func NewCommentAddedNotifier(hub *websocket.Hub, db *sql.DB) *CommentAddedNotifier {
+func NewCommentAddedNotifier(hub *websocket.Hub, push *push.Service, db *sql.DB) *CommentAddedNotifier {
 	return &CommentAddedNotifier{
 		hub:     hub,
+		push:    push,
 		service: services.NewNotificationService(db),
 	}
 }
 
-func (n *CommentAddedNotifier) Notify(payload types.NotifCommentCreatedResponse) error {
-	notifications, err := n.service.CreateCommentAddedNotification(payload)
+func (n *CommentAddedNotifier) Notify(eventID string, payload types.NotifCommentCreatedResponse) error {
+	notifications, err := n.service.CreateCommentAddedNotification(eventID, payload)
 	if err != nil {
 		return err
 	}
 
 	for _, notif := range notifications {
 		n.hub.Notify(notif)
+		n.push.Notify(notif)
 	}
 
 	return nil
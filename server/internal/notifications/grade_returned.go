@@ -0,0 +1,37 @@
+package notifications
+
+import (
+	"course-flow/internal/push"
+	"course-flow/internal/services"
+	"course-flow/internal/types"
+	"course-flow/internal/websocket"
+	"database/sql"
+)
+
+type GradeReturnedNotifier struct {
+	hub     *websocket.Hub
+	push    *push.Service
+	service *services.NotificationService
+}
+
+func NewGradeReturnedNotifier(hub *websocket.Hub, push *push.Service, db *sql.DB) *GradeReturnedNotifier {
+	return &GradeReturnedNotifier{
+		hub:     hub,
+		push:    push,
+		service: services.NewNotificationService(db),
+	}
+}
+
+func (n *GradeReturnedNotifier) Notify(eventID string, payload types.GradeReturned) error {
+	notifications, err := n.service.GradeReturnedNotification(eventID, payload)
+	if err != nil {
+		return err
+	}
+
+	for _, notif := range notifications {
+		n.hub.Notify(notif)
+		n.push.Notify(notif)
+	}
+
+	return nil
+}
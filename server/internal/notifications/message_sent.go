@@ -1,6 +1,7 @@
 package notifications
 
 import (
+	"course-flow/internal/push"
 	"course-flow/internal/services"
 	"course-flow/internal/types"
 	"course-flow/internal/websocket"
@@ -10,12 +11,14 @@ import (
 
 type MessageSentNotifier struct {
 	hub     *websocket.Hub
+	push    *push.Service
 	service *services.NotificationService
 }
 
-func NewMessageSentNotifier(hub *websocket.Hub, db *sql.DB) *MessageSentNotifier {
+func NewMessageSentNotifier(hub *websocket.Hub, push *push.Service, db *sql.DB) *MessageSentNotifier {
 	return &MessageSentNotifier{
 		hub:     hub,
+		push:    push,
 		service: services.NewNotificationService(db),
 	}
 }
@@ -28,6 +31,7 @@ func (n *MessageSentNotifier) Notify(payload types.NotifMessageSentResponse) err
 
 	for _, notif := range notifications {
 		n.hub.Notify(notif)
+		n.push.Notify(notif)
 		fmt.Printf("not -> %+v\n", notif)
 	}
 
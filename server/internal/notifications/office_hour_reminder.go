@@ -0,0 +1,37 @@
+package notifications
+
+import (
+	"course-flow/internal/push"
+	"course-flow/internal/services"
+	"course-flow/internal/types"
+	"course-flow/internal/websocket"
+	"database/sql"
+)
+
+type OfficeHourReminderNotifier struct {
+	hub     *websocket.Hub
+	push    *push.Service
+	service *services.NotificationService
+}
+
+func NewOfficeHourReminderNotifier(hub *websocket.Hub, push *push.Service, db *sql.DB) *OfficeHourReminderNotifier {
+	return &OfficeHourReminderNotifier{
+		hub:     hub,
+		push:    push,
+		service: services.NewNotificationService(db),
+	}
+}
+
+func (n *OfficeHourReminderNotifier) Notify(eventID string, reminder types.OfficeHourReminder) error {
+	notifications, err := n.service.OfficeHourReminderNotification(eventID, reminder)
+	if err != nil {
+		return err
+	}
+
+	for _, notif := range notifications {
+		n.hub.Notify(notif)
+		n.push.Notify(notif)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package notifications
+
+import (
+	"course-flow/internal/outbox"
+	"course-flow/internal/push"
+	"course-flow/internal/services"
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"course-flow/internal/websocket"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Outbox consumer names, recorded per event
+const (
+	consumerNotifications = "notifications"
+	consumerWebhooks      = "webhooks"
+)
+
+// RegisterOutboxConsumers lets the notifiers create and broadcast the
+// notifications of domain events, and forwards the events webhooks can
+// subscribe to. Notifications carry the outbox event ID, so an event that is
+// delivered again after a crash does not notify anyone twice.
+func RegisterOutboxConsumers(dispatcher *outbox.Dispatcher, hub *websocket.Hub, push *push.Service, webhooks *services.WebhookService, db *sql.DB) {
+	postStorage := storage.NewPostStorage(db)
+
+	postCreatedNotifier := NewPostCreatedNotifier(hub, push, db)
+	commentAddedNotifier := NewCommentAddedNotifier(hub, push, db)
+	roleChangedNotifier := NewRoleChangedNotifier(hub, push, db)
+	userKickedNotifier := NewUserKickedNotifier(hub, push, db)
+	officeHourReminderNotifier := NewOfficeHourReminderNotifier(hub, push, db)
+	gradeReturnedNotifier := NewGradeReturnedNotifier(hub, push, db)
+
+	dispatcher.Handle(types.EventPostCreated, consumerNotifications, func(event types.OutboxEvent) error {
+		var payload types.NotifCreatedResponse
+		if err := decodePayload(event, &payload); err != nil {
+			return err
+		}
+		if deleted, err := postDeleted(postStorage, payload.PostID); deleted || err != nil {
+			return err
+		}
+		content, _ := payload.Data["content"].(string)
+		return postCreatedNotifier.Notify(event.ID, payload, content)
+	})
+
+	dispatcher.Handle(types.EventCommentAdded, consumerNotifications, func(event types.OutboxEvent) error {
+		var payload types.NotifCommentCreatedResponse
+		if err := decodePayload(event, &payload); err != nil {
+			return err
+		}
+		return commentAddedNotifier.Notify(event.ID, payload)
+	})
+
+	dispatcher.Handle(types.EventRoleChanged, consumerNotifications, func(event types.OutboxEvent) error {
+		var payload types.NotifRoleChangedResponse
+		if err := decodePayload(event, &payload); err != nil {
+			return err
+		}
+		return roleChangedNotifier.Notify(event.ID, payload.ClassID, payload.UserID, payload.Role)
+	})
+
+	dispatcher.Handle(types.EventMemberKicked, consumerNotifications, func(event types.OutboxEvent) error {
+		var payload types.NotifKickedResponse
+		if err := decodePayload(event, &payload); err != nil {
+			return err
+		}
+		return userKickedNotifier.Notify(event.ID, payload.ClassID, payload.AdminID, payload.UserID)
+	})
+
+	dispatcher.Handle(types.EventOfficeHourReminder, consumerNotifications, func(event types.OutboxEvent) error {
+		var payload types.OfficeHourReminder
+		if err := decodePayload(event, &payload); err != nil {
+			return err
+		}
+		return officeHourReminderNotifier.Notify(event.ID, payload)
+	})
+
+	dispatcher.Handle(types.EventGradeReturned, consumerNotifications, func(event types.OutboxEvent) error {
+		var payload types.GradeReturned
+		if err := decodePayload(event, &payload); err != nil {
+			return err
+		}
+		return gradeReturnedNotifier.Notify(event.ID, payload)
+	})
+
+	for _, eventType := range types.WebhookEventTypes {
+		dispatcher.Handle(eventType, consumerWebhooks, func(event types.OutboxEvent) error {
+			if event.Type == types.EventPostCreated {
+				var payload types.NotifCreatedResponse
+				if err := decodePayload(event, &payload); err != nil {
+					return err
+				}
+				if deleted, err := postDeleted(postStorage, payload.PostID); deleted || err != nil {
+					return err
+				}
+			}
+
+			// The outbox event ID doubles as the webhook event ID, so
+			// receivers can deduplicate retried events
+			return webhooks.Dispatch(types.WebhookEvent{
+				ID:        event.ID,
+				Type:      event.Type,
+				CourseID:  event.CourseID,
+				CreatedAt: event.CreatedAt,
+				Data:      event.Payload,
+			})
+		})
+	}
+}
+
+func decodePayload(event types.OutboxEvent, payload interface{}) error {
+	if err := json.Unmarshal(event.Payload, payload); err != nil {
+		return fmt.Errorf("invalid %s payload: %v", event.Type, err)
+	}
+	return nil
+}
+
+// postDeleted reports whether a post is gone, e.g. because its attachments
+// failed to upload after it was created. Its events are then dropped.
+func postDeleted(postStorage *storage.PostStorage, postID string) (bool, error) {
+	_, err := postStorage.GetPostCourseID(postID)
+	if apiErr, ok := err.(*utils.ApiError); ok && apiErr.Code == http.StatusNotFound {
+		return true, nil
+	}
+	return false, err
+}
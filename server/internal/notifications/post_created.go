@@ -1,33 +1,38 @@
 package notifications
 
 import (
+	"course-flow/internal/push"
 	"course-flow/internal/services"
+	"course-flow/internal/types"
 	"course-flow/internal/websocket"
 	"database/sql"
 )
 
 type PostCreatedNotifier struct {
 	hub     *websocket.Hub
+	push    *push.Service
 	service *services.NotificationService
 }
 
-func NewPostCreatedNotifier(hub *websocket.Hub, db *sql.DB) *PostCreatedNotifier {
+func NewPostCreatedNotifier(hub *websocket.Hub, push *push.Service, db *sql.DB) *PostCreatedNotifier {
 	return &PostCreatedNotifier{
 		hub:     hub,
+		push:    push,
 		service: services.NewNotificationService(db),
 	}
 }
 
-func (n *PostCreatedNotifier) Notify(classID, postContent, creatorID string) error {
+func (n *PostCreatedNotifier) Notify(eventID string, payload types.NotifCreatedResponse, postContent string) error {
 	// Create notifications through service
-	notifications, err := n.service.CreatePostCreatedNotifications(classID, postContent, creatorID)
+	notifications, err := n.service.CreatePostCreatedNotifications(eventID, payload.ClassID, postContent, payload.UserID)
 	if err != nil {
 		return err
 	}
 
-	// Send real-time notifications via WebSocket
+	// Send real-time notifications via WebSocket, and Web Push to offline users
 	for _, notif := range notifications {
 		n.hub.Notify(notif)
+		n.push.Notify(notif)
 	}
 
 	return nil
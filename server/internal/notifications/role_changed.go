@@ -1,6 +1,7 @@
 package notifications
 
 import (
+	"course-flow/internal/push"
 	"course-flow/internal/services"
 	"course-flow/internal/websocket"
 	"database/sql"
@@ -8,25 +9,28 @@ import (
 
 type RoleChangedNotifier struct {
 	hub     *websocket.Hub
+	push    *push.Service
 	service *services.NotificationService
 }
 
-func NewRoleChangedNotifier(hub *websocket.Hub, db *sql.DB) *RoleChangedNotifier {
+func NewRoleChangedNotifier(hub *websocket.Hub, push *push.Service, db *sql.DB) *RoleChangedNotifier {
 	return &RoleChangedNotifier{
 		hub:     hub,
+		push:    push,
 		service: services.NewNotificationService(db),
 	}
 }
 
-func (n *RoleChangedNotifier) Notify(classID, userID string, role int) error {
-	notifications, err := n.service.ChangeRoleNotification(classID, userID, role)
+func (n *RoleChangedNotifier) Notify(eventID, classID, userID string, role int) error {
+	notifications, err := n.service.ChangeRoleNotification(eventID, classID, userID, role)
 	if err != nil {
 		return err
 	}
 
-	// Send real-time notifications via WebSocket
+	// Send real-time notifications via WebSocket, and Web Push to offline users
 	for _, notif := range notifications {
 		n.hub.Notify(notif)
+		n.push.Notify(notif)
 	}
 
 	return nil
@@ -1,6 +1,7 @@
 package notifications
 
 import (
+	"course-flow/internal/push"
 	"course-flow/internal/services"
 	"course-flow/internal/types"
 	"course-flow/internal/websocket"
@@ -9,18 +10,20 @@ import (
 
 type UserKickedNotifier struct {
 	hub     *websocket.Hub
+	push    *push.Service
 	service *services.NotificationService
 }
 
-func NewUserKickedNotifier(hub *websocket.Hub, db *sql.DB) *UserKickedNotifier {
+func NewUserKickedNotifier(hub *websocket.Hub, push *push.Service, db *sql.DB) *UserKickedNotifier {
 	return &UserKickedNotifier{
 		hub:     hub,
+		push:    push,
 		service: services.NewNotificationService(db),
 	}
 }
 
-func (n *UserKickedNotifier) Notify(classID, creatorID, toKick string) error {
-	notifications, err := n.service.UserKickedNotification(types.NotifKickedResponse{
+func (n *UserKickedNotifier) Notify(eventID, classID, creatorID, toKick string) error {
+	notifications, err := n.service.UserKickedNotification(eventID, types.NotifKickedResponse{
 		ClassID: classID,
 		AdminID: creatorID,
 		UserID:  toKick,
@@ -31,6 +34,7 @@ func (n *UserKickedNotifier) Notify(classID, creatorID, toKick string) error {
 
 	for _, notif := range notifications {
 		n.hub.Notify(notif)
+		n.push.Notify(notif)
 	}
 
 	return nil
@@ -0,0 +1,192 @@
+// Package outbox dispatches the domain events stored with the changes that
+// caused them to their consumers: notification creation and hub broadcast,
+// webhooks, ... Every consumer sees an event at least once; the consumers
+// that handled it are recorded so retries only run the ones that failed.
+package outbox
+
+import (
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// pollInterval is how often due events are looked for when no commit
+	// wakes the dispatcher up, e.g. for retries.
+	pollInterval = 5 * time.Second
+	// lease is how long a claimed event is left to its instance.
+	lease     = time.Minute
+	batchSize = 50
+	// maxAttempts bounds the retries, with the delay doubling from baseBackoff
+	// up to maxBackoff.
+	maxAttempts = 10
+	baseBackoff = 5 * time.Second
+	maxBackoff  = 10 * time.Minute
+	// retention is how long dispatched events are kept.
+	retention = 7 * 24 * time.Hour
+)
+
+// Handler handles one event for a consumer. Handlers must tolerate seeing
+// the same event again after a crash.
+type Handler func(event types.OutboxEvent) error
+
+type consumer struct {
+	name   string
+	handle Handler
+}
+
+type Dispatcher struct {
+	storage   *storage.OutboxStorage
+	consumers map[string][]consumer
+	wake      chan struct{}
+}
+
+func NewDispatcher(storage *storage.OutboxStorage) *Dispatcher {
+	return &Dispatcher{
+		storage:   storage,
+		consumers: make(map[string][]consumer),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Handle registers a consumer of an event type. Consumer names are recorded
+// per event, so they must stay stable.
+func (d *Dispatcher) Handle(eventType, name string, handle Handler) {
+	d.consumers[eventType] = append(d.consumers[eventType], consumer{name: name, handle: handle})
+}
+
+// Run dispatches events until the process exits. Several instances can run
+// it, each event is claimed by one of them at a time. Consumers must be
+// registered before.
+func (d *Dispatcher) Run() {
+	d.listen()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	pruneTicker := time.NewTicker(time.Hour)
+	defer pruneTicker.Stop()
+
+	for {
+		d.DispatchDue()
+		select {
+		case <-ticker.C:
+		case <-d.wake:
+		case <-pruneTicker.C:
+			d.prune()
+		}
+	}
+}
+
+// listen wakes the dispatcher up when events are committed, so they do not
+// wait for the next poll.
+func (d *Dispatcher) listen() {
+	connStr := os.Getenv("DATABASE_URL")
+	if connStr == "" {
+		return
+	}
+
+	listener := pq.NewListener(connStr, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Outbox listener event %d: %v", event, err)
+		}
+	})
+	if err := listener.Listen(storage.OutboxChannel); err != nil {
+		log.Printf("Failed to listen on %s, polling for outbox events: %v", storage.OutboxChannel, err)
+		listener.Close()
+		return
+	}
+
+	go func() {
+		for range listener.Notify {
+			select {
+			case d.wake <- struct{}{}:
+			default:
+			}
+		}
+	}()
+}
+
+// DispatchDue dispatches every event that is due, a batch at a time.
+func (d *Dispatcher) DispatchDue() {
+	for {
+		events, err := d.storage.ClaimEvents(time.Now().UTC(), lease, batchSize)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		for _, event := range events {
+			d.dispatch(event)
+		}
+
+		if len(events) < batchSize {
+			return
+		}
+	}
+}
+
+// dispatch runs the consumers that have not handled the event yet. Failed
+// ones are retried later without running the others again.
+func (d *Dispatcher) dispatch(event types.OutboxEvent) {
+	var failures []string
+	for _, c := range d.consumers[event.Type] {
+		if slices.Contains(event.Consumed, c.name) {
+			continue
+		}
+
+		if err := c.handle(event); err != nil {
+			failures = append(failures, c.name+": "+err.Error())
+			continue
+		}
+
+		if err := d.storage.MarkConsumed(event.ID, c.name); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+
+	if len(failures) == 0 {
+		if err := d.storage.MarkDispatched(event.ID); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	lastError := strings.Join(failures, "; ")
+	var nextAttemptAt *time.Time
+	if event.Attempts < maxAttempts {
+		next := time.Now().UTC().Add(backoff(event.Attempts))
+		nextAttemptAt = &next
+		log.Printf("Outbox event %s (%s) failed, retrying: %s", event.ID, event.Type, lastError)
+	} else {
+		log.Printf("Giving up on outbox event %s (%s) after %d attempts: %s", event.ID, event.Type, event.Attempts, lastError)
+	}
+
+	if err := d.storage.RetryEvent(event.ID, lastError, nextAttemptAt); err != nil {
+		log.Println(err)
+	}
+}
+
+func (d *Dispatcher) prune() {
+	deleted, err := d.storage.DeleteDispatched(time.Now().UTC().Add(-retention))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Successfully pruned %d dispatched outbox events", deleted)
+	}
+}
+
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff << (attempts - 1)
+	if delay <= 0 || delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,162 @@
+package push
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// recordSize is the aes128gcm record size. Payloads are sent as a single
+	// record, so they must fit in it with the padding delimiter and GCM tag.
+	recordSize = 4096
+	// maxMessageSize is the largest message push services have to accept
+	// (RFC 8291, section 4), header included.
+	maxMessageSize = 4096
+	// headerSize is the aes128gcm header: salt, record size, key ID length
+	// and the 65 byte sender key.
+	headerSize = 16 + 4 + 1 + 65
+	// MaxPayloadSize is the largest payload Encrypt accepts, leaving room for
+	// the header, the padding delimiter and the GCM tag.
+	MaxPayloadSize = maxMessageSize - headerSize - 1 - 16
+)
+
+// Encrypt encrypts a payload for a subscription as described in RFC 8291,
+// using the aes128gcm content encoding of RFC 8188. uaPublic is the
+// subscription's p256dh key and authSecret its auth secret.
+func Encrypt(payload, uaPublic, authSecret []byte) ([]byte, error) {
+	if len(payload) > MaxPayloadSize {
+		return nil, fmt.Errorf("push payload of %d bytes exceeds %d", len(payload), MaxPayloadSize)
+	}
+
+	curve := ecdh.P256()
+	uaKey, err := curve.NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription key: %v", err)
+	}
+
+	asKey, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asKey.PublicKey().Bytes()
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	ecdhSecret, err := asKey.ECDH(uaKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cek, nonce, err := deriveKeys(ecdhSecret, authSecret, salt, uaPublic, asPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single, last record: the payload followed by the 0x02 delimiter
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
+
+	var body bytes.Buffer
+	body.Write(salt)
+	binary.Write(&body, binary.BigEndian, uint32(recordSize))
+	body.WriteByte(byte(len(asPublic)))
+	body.Write(asPublic)
+	body.Write(ciphertext)
+	return body.Bytes(), nil
+}
+
+// Decrypt reverses Encrypt for the holder of the subscription's private key.
+// Push services never do this, it lets a local stub check what was sent.
+func Decrypt(body []byte, uaKey *ecdh.PrivateKey, authSecret []byte) ([]byte, error) {
+	if len(body) < 21 {
+		return nil, fmt.Errorf("push message too short")
+	}
+	salt := body[:16]
+	idLen := int(body[20])
+	if len(body) < 21+idLen {
+		return nil, fmt.Errorf("push message too short")
+	}
+	asPublic := body[21 : 21+idLen]
+	ciphertext := body[21+idLen:]
+
+	asKey, err := ecdh.P256().NewPublicKey(asPublic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender key: %v", err)
+	}
+	ecdhSecret, err := uaKey.ECDH(asKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cek, nonce, err := deriveKeys(ecdhSecret, authSecret, salt, uaKey.PublicKey().Bytes(), asPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt push message: %v", err)
+	}
+
+	// Strip the padding up to the delimiter
+	end := bytes.LastIndexByte(plaintext, 0x02)
+	if end < 0 {
+		return nil, fmt.Errorf("push message has no padding delimiter")
+	}
+	return plaintext[:end], nil
+}
+
+// deriveKeys computes the content encryption key and nonce of RFC 8291
+// section 3.4.
+func deriveKeys(ecdhSecret, authSecret, salt, uaPublic, asPublic []byte) ([]byte, []byte, error) {
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+
+	ikm := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ecdhSecret, authSecret, keyInfo), ikm); err != nil {
+		return nil, nil, err
+	}
+
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+
+	cek := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return nil, nil, err
+	}
+
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, nil, err
+	}
+
+	return cek, nonce, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,294 @@
+package push
+
+import (
+	"bytes"
+	"course-flow/internal/netguard"
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// pushTTL is how long push services keep a message for an offline browser.
+	pushTTL = 24 * time.Hour
+	// pushTimeout bounds one request to a push service.
+	pushTimeout = 10 * time.Second
+	// pushWorkers is the number of concurrent deliveries.
+	pushWorkers = 4
+	// pushQueueSize bounds the notifications waiting for delivery. Once full,
+	// new ones are dropped rather than blocking the request that caused them.
+	pushQueueSize = 256
+	// maxPushMessage bounds the notification text included in a payload.
+	maxPushMessage = 1024
+)
+
+// Service delivers notifications as Web Push messages to the browsers of
+// users who are not connected to the hub.
+type Service struct {
+	storage       *storage.PushStorage
+	keys          *VAPIDKeys
+	subject       string
+	allowInsecure bool
+	online        func(userID string) bool
+	client        *http.Client
+	queue         chan types.Notification
+}
+
+// NewService loads the VAPID keys, generating them on first start, and starts
+// the delivery workers. online reports users who already get notifications
+// over the hub, they are not pushed to.
+func NewService(pushStorage *storage.PushStorage, online func(userID string) bool) (*Service, error) {
+	keys, err := loadKeys(pushStorage)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := os.Getenv("VAPID_SUBJECT")
+	if subject == "" {
+		subject = strings.TrimSuffix(utils.GetEnv("BASE_URL"), "/")
+	}
+
+	// Development setups push to a local stub
+	allowInsecure := os.Getenv("PUSH_ALLOW_INSECURE_ENDPOINTS") == "true"
+
+	s := &Service{
+		storage:       pushStorage,
+		keys:          keys,
+		subject:       subject,
+		allowInsecure: allowInsecure,
+		online:        online,
+		client:        netguard.NewClient(pushTimeout, allowInsecure),
+		queue:         make(chan types.Notification, pushQueueSize),
+	}
+
+	for i := 0; i < pushWorkers; i++ {
+		go s.worker()
+	}
+	return s, nil
+}
+
+func loadKeys(pushStorage *storage.PushStorage) (*VAPIDKeys, error) {
+	privateKey, _, err := pushStorage.GetVAPIDKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	if privateKey == "" {
+		keys, encoded, err := GenerateVAPIDKeys()
+		if err != nil {
+			return nil, err
+		}
+		// Another instance may have stored its pair first, use whichever won
+		privateKey, _, err = pushStorage.CreateVAPIDKeys(encoded, keys.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("Successfully generated VAPID keys")
+	}
+
+	return ParseVAPIDKeys(privateKey)
+}
+
+// PublicKey returns the applicationServerKey browsers subscribe with.
+func (s *Service) PublicKey() string {
+	return s.keys.PublicKey
+}
+
+func (s *Service) Subscribe(userID, userAgent string, req types.PushSubscriptionRequest) (*types.PushSubscription, error) {
+	endpoint, err := url.Parse(req.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid push endpoint"}
+	}
+	if endpoint.Scheme != "https" && !(s.allowInsecure && endpoint.Scheme == "http") {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Push endpoint must use https"}
+	}
+	if !s.allowInsecure {
+		if err := netguard.CheckHost(endpoint.Hostname()); err != nil {
+			log.Printf("Rejected push endpoint of user %s: %v", userID, err)
+			return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Push endpoint must be a public push service"}
+		}
+	}
+
+	p256dh, err := decodeKey(req.Keys.P256dh)
+	if err != nil || len(p256dh) != 65 {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid p256dh key"}
+	}
+	auth, err := decodeKey(req.Keys.Auth)
+	if err != nil || len(auth) != 16 {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid auth secret"}
+	}
+	// Make sure messages can be encrypted for the key before storing it
+	if _, err := Encrypt(nil, p256dh, auth); err != nil {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid p256dh key"}
+	}
+
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	sub := &types.PushSubscription{
+		UserID:    userID,
+		Endpoint:  endpoint.String(),
+		Keys:      req.Keys,
+		UserAgent: userAgent,
+	}
+	if err := s.storage.SaveSubscription(sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (s *Service) Unsubscribe(userID, endpoint string) error {
+	if endpoint == "" {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Endpoint is required"}
+	}
+	return s.storage.DeleteSubscription(userID, endpoint)
+}
+
+// Notify queues a notification for its recipients who are offline. It does
+// not block, deliveries happen in the background.
+func (s *Service) Notify(notif types.Notification) {
+	select {
+	case s.queue <- notif:
+	default:
+		log.Printf("Push queue is full, dropping notification %s", notif.ID)
+	}
+}
+
+func (s *Service) worker() {
+	for notif := range s.queue {
+		s.deliver(notif)
+	}
+}
+
+// pushPayload is what the service worker receives in its push event.
+type pushPayload struct {
+	ID        string                 `json:"id"`
+	Type      types.NotificationType `json:"type"`
+	ClassID   string                 `json:"classId"`
+	Message   string                 `json:"message"`
+	Count     int                    `json:"count,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+func (s *Service) deliver(notif types.Notification) {
+	var offline []string
+	for _, userID := range notif.RecipientIDs {
+		if s.online == nil || !s.online(userID) {
+			offline = append(offline, userID)
+		}
+	}
+	if len(offline) == 0 {
+		return
+	}
+
+	subscriptions, err := s.storage.GetSubscriptions(offline)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if len(subscriptions) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(pushPayload{
+		ID:        notif.ID,
+		Type:      notif.Type,
+		ClassID:   notif.ClassID,
+		Message:   truncate(notif.Message, maxPushMessage),
+		Count:     notif.Count,
+		Timestamp: notif.Timestamp,
+	})
+	if err != nil {
+		log.Printf("Failed to encode push payload: %v", err)
+		return
+	}
+
+	urgency := "normal"
+	if notif.Type == types.TypeMessageSent {
+		urgency = "high"
+	}
+
+	for _, sub := range subscriptions {
+		if err := s.send(sub, payload, urgency); err != nil {
+			log.Printf("Failed to push notification %s to subscription %s: %v", notif.ID, sub.ID, err)
+		}
+	}
+}
+
+// send encrypts the payload for the subscription and posts it to the push
+// service, pruning the subscription when the service says it is gone.
+func (s *Service) send(sub types.PushSubscription, payload []byte, urgency string) error {
+	p256dh, err := decodeKey(sub.Keys.P256dh)
+	if err != nil {
+		return fmt.Errorf("invalid p256dh key: %v", err)
+	}
+	auth, err := decodeKey(sub.Keys.Auth)
+	if err != nil {
+		return fmt.Errorf("invalid auth secret: %v", err)
+	}
+
+	body, err := Encrypt(payload, p256dh, auth)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := s.keys.authorization(sub.Endpoint, s.subject)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid push endpoint: %v", err)
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(pushTTL.Seconds())))
+	req.Header.Set("Urgency", urgency)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return s.storage.PruneSubscription(sub.ID)
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	default:
+		return fmt.Errorf("push service responded with %s", resp.Status)
+	}
+}
+
+// decodeKey decodes a base64url key, with or without padding.
+func decodeKey(key string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(key, "="))
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	s = s[:max]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s + "…"
+}
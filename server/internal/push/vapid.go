@@ -0,0 +1,95 @@
+package push
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// vapidTTL is the lifetime of VAPID tokens, push services allow up to 24h.
+const vapidTTL = 12 * time.Hour
+
+// VAPIDKeys identify this server to push services (RFC 8292).
+type VAPIDKeys struct {
+	private *ecdsa.PrivateKey
+	// PublicKey is the uncompressed P-256 point, base64url encoded, that
+	// browsers pass as applicationServerKey when subscribing.
+	PublicKey string
+}
+
+// GenerateVAPIDKeys creates a new key pair and returns it with the PKCS #8
+// encoding of the private key for storage.
+func GenerateVAPIDKeys() (*VAPIDKeys, string, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate VAPID key: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode VAPID key: %v", err)
+	}
+
+	keys, err := newVAPIDKeys(private)
+	if err != nil {
+		return nil, "", err
+	}
+	return keys, base64.StdEncoding.EncodeToString(der), nil
+}
+
+// ParseVAPIDKeys loads a key pair stored by GenerateVAPIDKeys.
+func ParseVAPIDKeys(encoded string) (*VAPIDKeys, error) {
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode VAPID key: %v", err)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse VAPID key: %v", err)
+	}
+	private, ok := key.(*ecdsa.PrivateKey)
+	if !ok || private.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("VAPID key is not a P-256 key")
+	}
+
+	return newVAPIDKeys(private)
+}
+
+func newVAPIDKeys(private *ecdsa.PrivateKey) (*VAPIDKeys, error) {
+	public, err := private.PublicKey.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID key: %v", err)
+	}
+	return &VAPIDKeys{
+		private:   private,
+		PublicKey: base64.RawURLEncoding.EncodeToString(public.Bytes()),
+	}, nil
+}
+
+// authorization returns the Authorization header for a push endpoint.
+func (k *VAPIDKeys) authorization(endpoint, subject string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid push endpoint: %v", err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(vapidTTL).Unix(),
+		"sub": subject,
+	})
+	signed, err := token.SignedString(k.private)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign VAPID token: %v", err)
+	}
+
+	return "vapid t=" + signed + ", k=" + k.PublicKey, nil
+}
@@ -0,0 +1,31 @@
+package router
+
+import (
+	"course-flow/internal/handlers"
+	"course-flow/internal/middleware"
+	"course-flow/internal/services"
+	"course-flow/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+func (r *Router) setupAttendanceRouter(router *mux.Router) {
+	attendanceService := services.NewAttendanceService(storage.NewAttendanceStorage(r.DB))
+	attendanceHandler := handlers.NewAttendanceHandler(attendanceService)
+
+	router.HandleFunc("/courses/{course_id}/attendance", middleware.ConvertToHandlerFunc(attendanceHandler.GetCourseReportHandler, middleware.AuthMiddleware)).Methods("GET")
+	router.HandleFunc("/courses/{course_id}/attendance/sessions", middleware.ConvertToHandlerFunc(attendanceHandler.GetSessionsHandler, middleware.AuthMiddleware)).Methods("GET")
+	router.HandleFunc("/courses/{course_id}/attendance/sessions", middleware.ConvertToHandlerFunc(attendanceHandler.CreateSessionHandler, middleware.AuthMiddleware)).Methods("POST")
+	router.HandleFunc("/courses/{course_id}/attendance/students/{user_id}", middleware.ConvertToHandlerFunc(attendanceHandler.GetStudentReportHandler, middleware.AuthMiddleware)).Methods("GET")
+
+	attendanceRouter := router.PathPrefix("/attendance").Subrouter()
+
+	attendanceRouter.HandleFunc("/checkin", middleware.ConvertToHandlerFunc(attendanceHandler.CheckInHandler, middleware.AuthMiddleware)).Methods("POST")
+	attendanceRouter.HandleFunc("/sessions/{id}", middleware.ConvertToHandlerFunc(attendanceHandler.GetSessionReportHandler, middleware.AuthMiddleware)).Methods("GET")
+	attendanceRouter.HandleFunc("/sessions/{id}", middleware.ConvertToHandlerFunc(attendanceHandler.UpdateSessionHandler, middleware.AuthMiddleware)).Methods("PUT")
+	attendanceRouter.HandleFunc("/sessions/{id}", middleware.ConvertToHandlerFunc(attendanceHandler.DeleteSessionHandler, middleware.AuthMiddleware)).Methods("DELETE")
+	attendanceRouter.HandleFunc("/sessions/{id}/checkin/open", middleware.ConvertToHandlerFunc(attendanceHandler.OpenCheckInHandler, middleware.AuthMiddleware)).Methods("POST")
+	attendanceRouter.HandleFunc("/sessions/{id}/checkin/close", middleware.ConvertToHandlerFunc(attendanceHandler.CloseCheckInHandler, middleware.AuthMiddleware)).Methods("POST")
+	attendanceRouter.HandleFunc("/sessions/{id}/checkin/code", middleware.ConvertToHandlerFunc(attendanceHandler.GetCheckInCodeHandler, middleware.AuthMiddleware)).Methods("GET")
+	attendanceRouter.HandleFunc("/sessions/{id}/records/{user_id}", middleware.ConvertToHandlerFunc(attendanceHandler.SetRecordHandler, middleware.AuthMiddleware)).Methods("PUT")
+}
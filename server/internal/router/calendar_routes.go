@@ -0,0 +1,29 @@
+package router
+
+import (
+	"course-flow/internal/handlers"
+	"course-flow/internal/middleware"
+	"course-flow/internal/services"
+	"course-flow/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+func (r *Router) setupCalendarRouter(router *mux.Router) {
+	calendarService := services.NewCalendarService(storage.NewCalendarStorage(r.DB), storage.NewCourseStorage(r.DB))
+	calendarHandler := handlers.NewCalendarHandler(calendarService)
+
+	router.HandleFunc("/courses/{course_id}/events", middleware.ConvertToHandlerFunc(calendarHandler.GetCourseEventsHandler, middleware.AuthMiddleware)).Methods("GET")
+	router.HandleFunc("/courses/{course_id}/events", middleware.ConvertToHandlerFunc(calendarHandler.CreateEventHandler, middleware.AuthMiddleware)).Methods("POST")
+	router.HandleFunc("/courses/{course_id}/events/import", middleware.ConvertToHandlerFunc(calendarHandler.ImportEventsHandler, middleware.AuthMiddleware)).Methods("POST")
+
+	calendarRouter := router.PathPrefix("/calendar").Subrouter()
+
+	calendarRouter.HandleFunc("", middleware.ConvertToHandlerFunc(calendarHandler.GetCalendarHandler, middleware.AuthMiddleware)).Methods("GET")
+	calendarRouter.HandleFunc("/events/{id}", middleware.ConvertToHandlerFunc(calendarHandler.UpdateEventHandler, middleware.AuthMiddleware)).Methods("PUT")
+	calendarRouter.HandleFunc("/events/{id}", middleware.ConvertToHandlerFunc(calendarHandler.DeleteEventHandler, middleware.AuthMiddleware)).Methods("DELETE")
+	calendarRouter.HandleFunc("/feed", middleware.ConvertToHandlerFunc(calendarHandler.GetFeedHandler, middleware.AuthMiddleware)).Methods("GET")
+	calendarRouter.HandleFunc("/feed/rotate", middleware.ConvertToHandlerFunc(calendarHandler.RotateFeedHandler, middleware.AuthMiddleware)).Methods("POST")
+	// Calendar apps cannot log in, the token authenticates the feed
+	calendarRouter.HandleFunc("/feed/{token:[A-Za-z0-9_-]+}.ics", middleware.ConvertToHandlerFunc(calendarHandler.FeedHandler)).Methods("GET")
+}
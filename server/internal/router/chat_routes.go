@@ -12,12 +12,23 @@ import (
 func (r *Router) setupChatRouter(router *mux.Router) {
 	chatStorage := storage.NewChatStorage(r.DB)
 	userStorage := storage.NewUserStorage(r.DB)
+	conversationStorage := storage.NewConversationStorage(r.DB)
+	docStorage := storage.NewDocumentStorage(r.DB)
 
-	chatService := services.NewChatService(chatStorage, userStorage)
+	documentService := services.NewDocumentService(docStorage)
+	chatService := services.NewChatService(chatStorage, userStorage, conversationStorage, documentService)
 
 	chatHandler := handlers.NewChatHandler(chatService)
 
 	chatRouter := router.PathPrefix("/chat").Subrouter()
 
+	chatRouter.HandleFunc("/unread", middleware.ConvertToHandlerFunc(chatHandler.GetUnreadCountsHandler, middleware.AuthMiddleware)).Methods("GET")
 	chatRouter.HandleFunc("/{course_id}", middleware.ConvertToHandlerFunc(chatHandler.GetMessageHandler, middleware.AuthMiddleware)).Methods("GET")
+	chatRouter.HandleFunc("/{course_id}/settings", middleware.ConvertToHandlerFunc(chatHandler.GetChatSettingsHandler, middleware.AuthMiddleware)).Methods("GET")
+	chatRouter.HandleFunc("/{course_id}/settings", middleware.ConvertToHandlerFunc(chatHandler.UpdateChatSettingsHandler, middleware.AuthMiddleware)).Methods("PUT")
+	chatRouter.HandleFunc("/{course_id}/uploads", middleware.ConvertToHandlerFunc(chatHandler.UploadChatFilesHandler, middleware.AuthMiddleware)).Methods("POST")
+	chatRouter.HandleFunc("/{course_id}/moderation", middleware.ConvertToHandlerFunc(chatHandler.UpdateChatModerationHandler, middleware.AuthMiddleware)).Methods("PUT")
+	chatRouter.HandleFunc("/{course_id}/mutes", middleware.ConvertToHandlerFunc(chatHandler.GetMutesHandler, middleware.AuthMiddleware)).Methods("GET")
+	chatRouter.HandleFunc("/{course_id}/mutes", middleware.ConvertToHandlerFunc(chatHandler.MuteUserHandler, middleware.AuthMiddleware)).Methods("POST")
+	chatRouter.HandleFunc("/{course_id}/mutes/{user_id}", middleware.ConvertToHandlerFunc(chatHandler.UnmuteUserHandler, middleware.AuthMiddleware)).Methods("DELETE")
 }
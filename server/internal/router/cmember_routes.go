@@ -3,7 +3,6 @@ package router
 import (
 	"course-flow/internal/handlers"
 	"course-flow/internal/middleware"
-	"course-flow/internal/notifications"
 	"course-flow/internal/services"
 	"course-flow/internal/storage"
 
@@ -14,9 +13,7 @@ func (r *Router) setupCourseMemberRouter(router *mux.Router) {
 	cmStorage := storage.NewCourseMemberStorage(r.DB)
 	cmService := services.NewCourseMemberService(cmStorage)
 
-	roleChangedNotifier := notifications.NewRoleChangedNotifier(r.Hub, r.DB)
-
-	cmHandler := handlers.NewCourseMemberHandler(cmService, roleChangedNotifier)
+	cmHandler := handlers.NewCourseMemberHandler(cmService)
 
 	cmRouter := router.PathPrefix("/members").Subrouter()
 
@@ -0,0 +1,25 @@
+package router
+
+import (
+	"course-flow/internal/handlers"
+	"course-flow/internal/middleware"
+	"course-flow/internal/services"
+	"course-flow/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+func (r *Router) setupConversationRouter(router *mux.Router) {
+	conversationStorage := storage.NewConversationStorage(r.DB)
+	chatStorage := storage.NewChatStorage(r.DB)
+
+	conversationService := services.NewConversationService(conversationStorage, chatStorage)
+
+	conversationHandler := handlers.NewConversationHandler(conversationService)
+
+	conversationRouter := router.PathPrefix("/conversations").Subrouter()
+
+	conversationRouter.HandleFunc("", middleware.ConvertToHandlerFunc(conversationHandler.GetConversationsHandler, middleware.AuthMiddleware)).Methods("GET")
+	conversationRouter.HandleFunc("", middleware.ConvertToHandlerFunc(conversationHandler.CreateConversationHandler, middleware.AuthMiddleware)).Methods("POST")
+	conversationRouter.HandleFunc("/{id}/messages", middleware.ConvertToHandlerFunc(conversationHandler.GetMessagesHandler, middleware.AuthMiddleware)).Methods("GET")
+}
@@ -3,7 +3,6 @@ package router
 import (
 	"course-flow/internal/handlers"
 	"course-flow/internal/middleware"
-	"course-flow/internal/notifications"
 	"course-flow/internal/services"
 	"course-flow/internal/storage"
 
@@ -15,9 +14,7 @@ func (r *Router) setupCourseRouter(router *mux.Router) {
 	documentStorage := storage.NewDocumentStorage(r.DB)
 	courseService := services.NewCourseService(courseStorage, documentStorage)
 
-	memberKickNotifier := notifications.NewUserKickedNotifier(r.Hub, r.DB)
-
-	courseHandler := handlers.NewCourseHandler(courseService, memberKickNotifier)
+	courseHandler := handlers.NewCourseHandler(courseService, r.Hub)
 
 	courseRouter := router.PathPrefix("/courses").Subrouter()
 
@@ -0,0 +1,22 @@
+package router
+
+import (
+	"course-flow/internal/handlers"
+	"course-flow/internal/middleware"
+	"course-flow/internal/services"
+	"course-flow/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+func (r *Router) setupJobRouter(router *mux.Router) {
+	jobService := services.NewJobService(storage.NewJobStorage(r.DB), storage.NewUserStorage(r.DB))
+	jobHandler := handlers.NewJobHandler(jobService)
+
+	jobRouter := router.PathPrefix("/admin/jobs").Subrouter()
+
+	jobRouter.HandleFunc("", middleware.ConvertToHandlerFunc(jobHandler.GetJobsHandler, middleware.AuthMiddleware)).Methods("GET")
+	jobRouter.HandleFunc("/stats", middleware.ConvertToHandlerFunc(jobHandler.GetJobStatsHandler, middleware.AuthMiddleware)).Methods("GET")
+	jobRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(jobHandler.GetJobHandler, middleware.AuthMiddleware)).Methods("GET")
+	jobRouter.HandleFunc("/{id}/retry", middleware.ConvertToHandlerFunc(jobHandler.RetryJobHandler, middleware.AuthMiddleware)).Methods("POST")
+}
@@ -0,0 +1,38 @@
+package router
+
+import (
+	"course-flow/internal/handlers"
+	"course-flow/internal/middleware"
+	"course-flow/internal/services"
+	"course-flow/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+func (r *Router) setupModuleRouter(router *mux.Router) {
+	docService := services.NewDocumentService(storage.NewDocumentStorage(r.DB))
+	moduleService := services.NewModuleService(storage.NewModuleStorage(r.DB), docService)
+	moduleHandler := handlers.NewModuleHandler(moduleService)
+
+	router.HandleFunc("/courses/{course_id}/modules", middleware.ConvertToHandlerFunc(moduleHandler.GetModulesHandler, middleware.AuthMiddleware)).Methods("GET")
+	router.HandleFunc("/courses/{course_id}/modules", middleware.ConvertToHandlerFunc(moduleHandler.CreateModuleHandler, middleware.AuthMiddleware)).Methods("POST")
+	router.HandleFunc("/courses/{course_id}/modules/order", middleware.ConvertToHandlerFunc(moduleHandler.ReorderModulesHandler, middleware.AuthMiddleware)).Methods("PUT")
+	router.HandleFunc("/courses/{course_id}/modules/progress", middleware.ConvertToHandlerFunc(moduleHandler.GetProgressHandler, middleware.AuthMiddleware)).Methods("GET")
+
+	moduleRouter := router.PathPrefix("/modules").Subrouter()
+
+	moduleRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(moduleHandler.GetModuleHandler, middleware.AuthMiddleware)).Methods("GET")
+	moduleRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(moduleHandler.UpdateModuleHandler, middleware.AuthMiddleware)).Methods("PUT")
+	moduleRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(moduleHandler.DeleteModuleHandler, middleware.AuthMiddleware)).Methods("DELETE")
+	moduleRouter.HandleFunc("/{id}/items", middleware.ConvertToHandlerFunc(moduleHandler.CreateItemHandler, middleware.AuthMiddleware)).Methods("POST")
+	moduleRouter.HandleFunc("/{id}/items/files", middleware.ConvertToHandlerFunc(moduleHandler.UploadItemsHandler, middleware.AuthMiddleware)).Methods("POST")
+	moduleRouter.HandleFunc("/{id}/items/order", middleware.ConvertToHandlerFunc(moduleHandler.ReorderItemsHandler, middleware.AuthMiddleware)).Methods("PUT")
+
+	itemRouter := router.PathPrefix("/module-items").Subrouter()
+
+	itemRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(moduleHandler.GetItemHandler, middleware.AuthMiddleware)).Methods("GET")
+	itemRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(moduleHandler.UpdateItemHandler, middleware.AuthMiddleware)).Methods("PUT")
+	itemRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(moduleHandler.DeleteItemHandler, middleware.AuthMiddleware)).Methods("DELETE")
+	itemRouter.HandleFunc("/{id}/completion", middleware.ConvertToHandlerFunc(moduleHandler.CompleteItemHandler, middleware.AuthMiddleware)).Methods("PUT")
+	itemRouter.HandleFunc("/{id}/completion", middleware.ConvertToHandlerFunc(moduleHandler.UncompleteItemHandler, middleware.AuthMiddleware)).Methods("DELETE")
+}
@@ -4,6 +4,7 @@ import (
 	"course-flow/internal/handlers"
 	"course-flow/internal/middleware"
 	"course-flow/internal/services"
+	"course-flow/internal/storage"
 
 	"github.com/gorilla/mux"
 )
@@ -12,10 +13,21 @@ func (r *Router) setupNotifRouter(router *mux.Router) {
 	notifService := services.NewNotificationService(r.DB)
 	notifHandler := handlers.NewNotificationHandler(notifService)
 
+	digestService := services.NewDigestService(storage.NewDigestStorage(r.DB), storage.NewNotificationPreferenceStorage(r.DB), r.Mailer)
+	digestHandler := handlers.NewDigestHandler(digestService)
+
 	notifRouter := router.PathPrefix("/notifications").Subrouter()
 
 	notifRouter.HandleFunc("", middleware.ConvertToHandlerFunc(notifHandler.GetAllNotificationForUserHandler, middleware.AuthMiddleware)).Methods("GET")
 	notifRouter.HandleFunc("/read", middleware.ConvertToHandlerFunc(notifHandler.MarkNotificationAsReadHandler, middleware.AuthMiddleware)).Methods("POST")
 	notifRouter.HandleFunc("/read-all", middleware.ConvertToHandlerFunc(notifHandler.MarkAllNotificationsAsReadHandler, middleware.AuthMiddleware)).Methods("POST")
 	notifRouter.HandleFunc("/clear", middleware.ConvertToHandlerFunc(notifHandler.ClearAllNotificationsHandler, middleware.AuthMiddleware)).Methods("POST")
+	notifRouter.HandleFunc("/preferences", middleware.ConvertToHandlerFunc(notifHandler.GetPreferencesHandler, middleware.AuthMiddleware)).Methods("GET")
+	notifRouter.HandleFunc("/preferences", middleware.ConvertToHandlerFunc(notifHandler.SetPreferenceHandler, middleware.AuthMiddleware)).Methods("PUT")
+	notifRouter.HandleFunc("/mutes/{course_id}", middleware.ConvertToHandlerFunc(notifHandler.MuteCourseHandler, middleware.AuthMiddleware)).Methods("PUT")
+	notifRouter.HandleFunc("/mutes/{course_id}", middleware.ConvertToHandlerFunc(notifHandler.UnmuteCourseHandler, middleware.AuthMiddleware)).Methods("DELETE")
+	notifRouter.HandleFunc("/digest", middleware.ConvertToHandlerFunc(digestHandler.GetSettingsHandler, middleware.AuthMiddleware)).Methods("GET")
+	notifRouter.HandleFunc("/digest", middleware.ConvertToHandlerFunc(digestHandler.UpdateSettingsHandler, middleware.AuthMiddleware)).Methods("PUT")
+	// Unsubscribe links are signed and work without logging in
+	notifRouter.HandleFunc("/unsubscribe", middleware.ConvertToHandlerFunc(digestHandler.UnsubscribeHandler)).Methods("GET", "POST")
 }
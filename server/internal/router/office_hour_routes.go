@@ -0,0 +1,31 @@
+package router
+
+import (
+	"course-flow/internal/handlers"
+	"course-flow/internal/middleware"
+	"course-flow/internal/services"
+	"course-flow/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+func (r *Router) setupOfficeHourRouter(router *mux.Router) {
+	officeHourService := services.NewOfficeHourService(storage.NewOfficeHourStorage(r.DB))
+	officeHourHandler := handlers.NewOfficeHourHandler(officeHourService, r.Hub)
+
+	router.HandleFunc("/courses/{course_id}/office-hours", middleware.ConvertToHandlerFunc(officeHourHandler.GetOfficeHoursHandler, middleware.AuthMiddleware)).Methods("GET")
+	router.HandleFunc("/courses/{course_id}/office-hours", middleware.ConvertToHandlerFunc(officeHourHandler.CreateOfficeHourHandler, middleware.AuthMiddleware)).Methods("POST")
+
+	officeHourRouter := router.PathPrefix("/office-hours").Subrouter()
+
+	officeHourRouter.HandleFunc("/bookings", middleware.ConvertToHandlerFunc(officeHourHandler.GetMyBookingsHandler, middleware.AuthMiddleware)).Methods("GET")
+	officeHourRouter.HandleFunc("/bookings/{id}", middleware.ConvertToHandlerFunc(officeHourHandler.CancelBookingHandler, middleware.AuthMiddleware)).Methods("DELETE")
+	officeHourRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(officeHourHandler.GetOfficeHourHandler, middleware.AuthMiddleware)).Methods("GET")
+	officeHourRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(officeHourHandler.UpdateOfficeHourHandler, middleware.AuthMiddleware)).Methods("PUT")
+	officeHourRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(officeHourHandler.DeleteOfficeHourHandler, middleware.AuthMiddleware)).Methods("DELETE")
+	officeHourRouter.HandleFunc("/{id}/bookings", middleware.ConvertToHandlerFunc(officeHourHandler.BookSlotHandler, middleware.AuthMiddleware)).Methods("POST")
+	officeHourRouter.HandleFunc("/{id}/queue", middleware.ConvertToHandlerFunc(officeHourHandler.GetQueueHandler, middleware.AuthMiddleware)).Methods("GET")
+	officeHourRouter.HandleFunc("/{id}/queue", middleware.ConvertToHandlerFunc(officeHourHandler.JoinQueueHandler, middleware.AuthMiddleware)).Methods("POST")
+	officeHourRouter.HandleFunc("/{id}/queue", middleware.ConvertToHandlerFunc(officeHourHandler.LeaveQueueHandler, middleware.AuthMiddleware)).Methods("DELETE")
+	officeHourRouter.HandleFunc("/{id}/queue/next", middleware.ConvertToHandlerFunc(officeHourHandler.NextInQueueHandler, middleware.AuthMiddleware)).Methods("POST")
+}
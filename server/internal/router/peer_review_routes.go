@@ -0,0 +1,33 @@
+package router
+
+import (
+	"course-flow/internal/handlers"
+	"course-flow/internal/middleware"
+	"course-flow/internal/services"
+	"course-flow/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+func (r *Router) setupPeerReviewRouter(router *mux.Router) {
+	docService := services.NewDocumentService(storage.NewDocumentStorage(r.DB))
+	moduleService := services.NewModuleService(storage.NewModuleStorage(r.DB), docService)
+	peerReviewService := services.NewPeerReviewService(
+		storage.NewPeerReviewStorage(r.DB),
+		storage.NewSubmissionStorage(r.DB),
+		storage.NewRubricStorage(r.DB),
+		moduleService,
+	)
+	peerReviewHandler := handlers.NewPeerReviewHandler(peerReviewService)
+
+	router.HandleFunc("/module-items/{id}/peer-review", middleware.ConvertToHandlerFunc(peerReviewHandler.GetPeerReviewHandler, middleware.AuthMiddleware)).Methods("GET")
+	router.HandleFunc("/module-items/{id}/peer-review", middleware.ConvertToHandlerFunc(peerReviewHandler.OpenPeerReviewHandler, middleware.AuthMiddleware)).Methods("POST")
+	router.HandleFunc("/module-items/{id}/peer-review/close", middleware.ConvertToHandlerFunc(peerReviewHandler.ClosePeerReviewHandler, middleware.AuthMiddleware)).Methods("POST")
+	router.HandleFunc("/module-items/{id}/peer-reviews", middleware.ConvertToHandlerFunc(peerReviewHandler.GetReviewsHandler, middleware.AuthMiddleware)).Methods("GET")
+	router.HandleFunc("/module-items/{id}/peer-reviews/received", middleware.ConvertToHandlerFunc(peerReviewHandler.GetReceivedReviewsHandler, middleware.AuthMiddleware)).Methods("GET")
+
+	peerReviewRouter := router.PathPrefix("/peer-reviews").Subrouter()
+
+	peerReviewRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(peerReviewHandler.GetReviewHandler, middleware.AuthMiddleware)).Methods("GET")
+	peerReviewRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(peerReviewHandler.SubmitReviewHandler, middleware.AuthMiddleware)).Methods("PUT")
+}
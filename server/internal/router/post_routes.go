@@ -3,7 +3,6 @@ package router
 import (
 	"course-flow/internal/handlers"
 	"course-flow/internal/middleware"
-	"course-flow/internal/notifications"
 	"course-flow/internal/services"
 	"course-flow/internal/storage"
 
@@ -22,10 +21,7 @@ func (r *Router) setupPostRouter(router *mux.Router) {
 
 	postService := services.NewPostService(postStorage, attchmentService)
 
-	postCreatedNotifier := notifications.NewPostCreatedNotifier(r.Hub, r.DB)
-	commentAddedNotifier := notifications.NewCommentAddedNotifier(r.Hub, r.DB)
-
-	postHandler := handlers.NewPostHandler(postService, postCreatedNotifier, commentAddedNotifier)
+	postHandler := handlers.NewPostHandler(postService, r.Hub)
 
 	postRouter := router.PathPrefix("/posts").Subrouter()
 
@@ -0,0 +1,25 @@
+package router
+
+import (
+	"course-flow/internal/handlers"
+	"course-flow/internal/middleware"
+	"course-flow/internal/services"
+	"course-flow/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+func (r *Router) setupPresenceRouter(router *mux.Router) {
+	presenceStorage := storage.NewPresenceStorage(r.DB)
+	chatStorage := storage.NewChatStorage(r.DB)
+
+	presenceService := services.NewPresenceService(presenceStorage, chatStorage)
+
+	presenceHandler := handlers.NewPresenceHandler(presenceService, r.Hub)
+
+	presenceRouter := router.PathPrefix("/presence").Subrouter()
+
+	presenceRouter.HandleFunc("", middleware.ConvertToHandlerFunc(presenceHandler.GetSettingsHandler, middleware.AuthMiddleware)).Methods("GET")
+	presenceRouter.HandleFunc("", middleware.ConvertToHandlerFunc(presenceHandler.UpdateSettingsHandler, middleware.AuthMiddleware)).Methods("PUT")
+	presenceRouter.HandleFunc("/courses/{course_id}", middleware.ConvertToHandlerFunc(presenceHandler.GetOnlineMembersHandler, middleware.AuthMiddleware)).Methods("GET")
+}
@@ -0,0 +1,18 @@
+package router
+
+import (
+	"course-flow/internal/handlers"
+	"course-flow/internal/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+func (r *Router) setupPushRouter(router *mux.Router) {
+	pushHandler := handlers.NewPushHandler(r.Push)
+
+	pushRouter := router.PathPrefix("/push").Subrouter()
+
+	pushRouter.HandleFunc("/vapid-public-key", middleware.ConvertToHandlerFunc(pushHandler.GetPublicKeyHandler)).Methods("GET")
+	pushRouter.HandleFunc("/subscriptions", middleware.ConvertToHandlerFunc(pushHandler.SubscribeHandler, middleware.AuthMiddleware)).Methods("POST")
+	pushRouter.HandleFunc("/subscriptions", middleware.ConvertToHandlerFunc(pushHandler.UnsubscribeHandler, middleware.AuthMiddleware)).Methods("DELETE")
+}
@@ -1,30 +1,70 @@
 package router
 
 import (
+	"context"
+	"course-flow/internal/jobs"
+	"course-flow/internal/mailer"
 	"course-flow/internal/notifications"
+	"course-flow/internal/outbox"
+	"course-flow/internal/push"
 	"course-flow/internal/services"
 	"course-flow/internal/storage"
 	"course-flow/internal/utils"
 	"course-flow/internal/websocket"
 	"database/sql"
-	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 )
 
 type Router struct {
-	DB  *sql.DB
-	Hub *websocket.Hub
+	DB       *sql.DB
+	Hub      *websocket.Hub
+	Mailer   mailer.Mailer
+	Push     *push.Service
+	Webhooks *services.WebhookService
 }
 
 func NewRouter(db *sql.DB) *Router {
-	hub := websocket.NewHub()
+	broker, err := websocket.NewBrokerFromEnv(db)
+	if err != nil {
+		log.Fatalf("Failed to create hub broker: %v", err)
+	}
+
+	hub := websocket.NewHub(broker, storage.NewHubEventStorage(db))
 	go hub.Run()
-	return &Router{DB: db, Hub: hub}
+	go hub.RunCheckInCodes(storage.NewAttendanceStorage(db))
+
+	mail, err := mailer.NewMailerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to create mailer: %v", err)
+	}
+
+	runner, err := jobs.NewAppRunner(db, mail)
+	if err != nil {
+		log.Fatalf("Failed to create job runner: %v", err)
+	}
+	// Jobs run in a separate worker process when this is disabled
+	if os.Getenv("JOBS_IN_PROCESS") != "false" {
+		go runner.Run(context.Background())
+	}
+
+	pushService, err := push.NewService(storage.NewPushStorage(db), hub.IsConnected)
+	if err != nil {
+		log.Fatalf("Failed to create push service: %v", err)
+	}
+
+	webhookService := services.NewWebhookService(storage.NewWebhookStorage(db))
+	go webhookService.Run()
+
+	dispatcher := outbox.NewDispatcher(storage.NewOutboxStorage(db))
+	notifications.RegisterOutboxConsumers(dispatcher, hub, pushService, webhookService, db)
+	go dispatcher.Run()
+
+	return &Router{DB: db, Hub: hub, Mailer: mail, Push: pushService, Webhooks: webhookService}
 }
 
 func (r *Router) Setup() *mux.Router {
@@ -33,6 +73,7 @@ func (r *Router) Setup() *mux.Router {
 	apiRouter_v1 := router.PathPrefix("/api/v1").Subrouter()
 
 	apiRouter_v1.HandleFunc("/ws", r.setupWebSocketHandler).Methods("GET", "POST")
+	apiRouter_v1.HandleFunc("/events", r.setupEventsHandler).Methods("GET")
 
 	r.setupUserRouter(apiRouter_v1)
 	r.setupAuthRouter(apiRouter_v1)
@@ -42,6 +83,19 @@ func (r *Router) Setup() *mux.Router {
 	r.setupAttachmentRouter(apiRouter_v1)
 	r.setupNotifRouter(apiRouter_v1)
 	r.setupChatRouter(apiRouter_v1)
+	r.setupConversationRouter(apiRouter_v1)
+	r.setupPresenceRouter(apiRouter_v1)
+	r.setupWSTicketRouter(apiRouter_v1)
+	r.setupPushRouter(apiRouter_v1)
+	r.setupWebhookRouter(apiRouter_v1)
+	r.setupCalendarRouter(apiRouter_v1)
+	r.setupAttendanceRouter(apiRouter_v1)
+	r.setupOfficeHourRouter(apiRouter_v1)
+	r.setupModuleRouter(apiRouter_v1)
+	r.setupRubricRouter(apiRouter_v1)
+	r.setupSubmissionRouter(apiRouter_v1)
+	r.setupPeerReviewRouter(apiRouter_v1)
+	r.setupJobRouter(apiRouter_v1)
 
 	mediaDir := utils.GetEnv("MEDIA_DIR")
 	fs := http.FileServer(http.Dir(mediaDir))
@@ -50,65 +104,52 @@ func (r *Router) Setup() *mux.Router {
 }
 
 func (R *Router) setupWebSocketHandler(w http.ResponseWriter, r *http.Request) {
-	tokenString := r.URL.Query().Get("token")
-	if tokenString == "" {
-		http.Error(w, "Missing authentication token", http.StatusUnauthorized)
-		return
-	}
-
-	// Retrieve secret key
-	secret_key := utils.GetEnv("SECRET_KEY")
-	if secret_key == "" {
-		log.Println("ERROR: Secret key not configured")
-		http.Error(w, "Server configuration error", http.StatusInternalServerError)
+	session, ok := R.authenticateStream(w, r)
+	if !ok {
 		return
 	}
 
-	// Parse and validate token
-	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return []byte(secret_key), nil
-	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
+	chatStorage := storage.NewChatStorage(R.DB)
+	userStorage := storage.NewUserStorage(R.DB)
+	conversationStorage := storage.NewConversationStorage(R.DB)
+	documentService := services.NewDocumentService(storage.NewDocumentStorage(R.DB))
+	chatService := services.NewChatService(chatStorage, userStorage, conversationStorage, documentService)
+	notifier := notifications.NewMessageSentNotifier(R.Hub, R.Push, R.DB)
 
-	if err != nil {
-		var errorMessage string
-		var statusCode int
-
-		switch {
-		case errors.Is(err, jwt.ErrTokenExpired):
-			errorMessage = "Authentication token has expired"
-			statusCode = http.StatusUnauthorized
-		case errors.Is(err, jwt.ErrTokenMalformed):
-			errorMessage = "Malformed authentication token"
-			statusCode = http.StatusUnauthorized
-		case errors.Is(err, jwt.ErrTokenSignatureInvalid):
-			errorMessage = "Invalid token signature"
-			statusCode = http.StatusUnauthorized
-		default:
-			errorMessage = "Token validation failed"
-			statusCode = http.StatusUnauthorized
-		}
+	R.Hub.Handler(session, chatService, notifier)(w, r)
+}
 
-		log.Printf("WebSocket authentication error: %v", err)
-		http.Error(w, errorMessage, statusCode)
+// setupEventsHandler streams the hub's events over Server-Sent Events for
+// clients whose network blocks WebSocket upgrades.
+func (R *Router) setupEventsHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := R.authenticateStream(w, r)
+	if !ok {
 		return
 	}
 
-	// Extract claims
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-		return
+	R.Hub.SSEHandler(session)(w, r)
+}
+
+// authenticateStream authenticates a WebSocket or SSE request with the
+// single-use ticket from POST /ws/ticket and loads what the hub needs to know
+// about the user. On failure the error is written and ok is false.
+func (R *Router) authenticateStream(w http.ResponseWriter, r *http.Request) (websocket.Session, bool) {
+	ticket := r.URL.Query().Get("ticket")
+	if ticket == "" {
+		http.Error(w, "Missing authentication ticket", http.StatusUnauthorized)
+		return websocket.Session{}, false
 	}
 
-	// Extract user ID
-	userID, ok := claims["sub"].(string)
-	if !ok || userID == "" {
-		http.Error(w, "User ID not found in token", http.StatusUnauthorized)
-		return
+	ticketService := services.NewWSTicketService(storage.NewWSTicketStorage(R.DB))
+	userID, expiresAt, err := ticketService.RedeemTicket(ticket)
+	if err != nil {
+		log.Printf("WebSocket authentication error: %v", err)
+		if apiErr, ok := err.(*utils.ApiError); ok {
+			http.Error(w, apiErr.Message, apiErr.Code)
+		} else {
+			http.Error(w, "Authentication failed", http.StatusInternalServerError)
+		}
+		return websocket.Session{}, false
 	}
 
 	classMap := make(map[string]bool)
@@ -116,25 +157,32 @@ func (R *Router) setupWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	IDs, err := getUserCourseIDs(userID, R.DB)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
-		return
+		return websocket.Session{}, false
 	}
 	for _, id := range IDs {
 		classMap[id] = true
 	}
 
-	chatStorage := storage.NewChatStorage(R.DB)
-	userStorage := storage.NewUserStorage(R.DB)
-	chatService := services.NewChatService(chatStorage, userStorage)
-	notifier := notifications.NewMessageSentNotifier(R.Hub, R.DB)
+	appearOffline, err := storage.NewPresenceStorage(R.DB).GetAppearOffline(userID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return websocket.Session{}, false
+	}
 
-	R.Hub.Handler(userID, classMap, chatService, notifier)(w, r)
+	return websocket.Session{
+		UserID:        userID,
+		ClassIDs:      classMap,
+		AppearOffline: appearOffline,
+		ExpiresAt:     expiresAt,
+	}, true
 }
 
 func getUserCourseIDs(userID string, db *sql.DB) ([]string, error) {
 	query := `
-		SELECT course_id
-		FROM course_members
-		WHERE user_id = $1
+		SELECT cm.course_id
+		FROM course_members cm
+		JOIN courses c ON c.id = cm.course_id
+		WHERE cm.user_id = $1 AND COALESCE(c.archived, FALSE) = FALSE
 	`
 
 	rows, err := db.Query(query, userID)
@@ -0,0 +1,29 @@
+package router
+
+import (
+	"course-flow/internal/handlers"
+	"course-flow/internal/middleware"
+	"course-flow/internal/services"
+	"course-flow/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+func (r *Router) setupRubricRouter(router *mux.Router) {
+	docService := services.NewDocumentService(storage.NewDocumentStorage(r.DB))
+	moduleService := services.NewModuleService(storage.NewModuleStorage(r.DB), docService)
+	rubricService := services.NewRubricService(storage.NewRubricStorage(r.DB), moduleService)
+	rubricHandler := handlers.NewRubricHandler(rubricService)
+
+	router.HandleFunc("/courses/{course_id}/rubrics", middleware.ConvertToHandlerFunc(rubricHandler.GetRubricsHandler, middleware.AuthMiddleware)).Methods("GET")
+	router.HandleFunc("/courses/{course_id}/rubrics", middleware.ConvertToHandlerFunc(rubricHandler.CreateRubricHandler, middleware.AuthMiddleware)).Methods("POST")
+	router.HandleFunc("/module-items/{id}/rubric", middleware.ConvertToHandlerFunc(rubricHandler.SetItemRubricHandler, middleware.AuthMiddleware)).Methods("PUT")
+	router.HandleFunc("/module-items/{id}/rubric", middleware.ConvertToHandlerFunc(rubricHandler.RemoveItemRubricHandler, middleware.AuthMiddleware)).Methods("DELETE")
+
+	rubricRouter := router.PathPrefix("/rubrics").Subrouter()
+
+	rubricRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(rubricHandler.GetRubricHandler, middleware.AuthMiddleware)).Methods("GET")
+	rubricRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(rubricHandler.UpdateRubricHandler, middleware.AuthMiddleware)).Methods("PUT")
+	rubricRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(rubricHandler.DeleteRubricHandler, middleware.AuthMiddleware)).Methods("DELETE")
+	rubricRouter.HandleFunc("/{id}/copy", middleware.ConvertToHandlerFunc(rubricHandler.CopyRubricHandler, middleware.AuthMiddleware)).Methods("POST")
+}
@@ -0,0 +1,31 @@
+package router
+
+import (
+	"course-flow/internal/handlers"
+	"course-flow/internal/middleware"
+	"course-flow/internal/services"
+	"course-flow/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+func (r *Router) setupSubmissionRouter(router *mux.Router) {
+	docService := services.NewDocumentService(storage.NewDocumentStorage(r.DB))
+	moduleService := services.NewModuleService(storage.NewModuleStorage(r.DB), docService)
+	submissionService := services.NewSubmissionService(
+		storage.NewSubmissionStorage(r.DB),
+		storage.NewRubricStorage(r.DB),
+		moduleService,
+		docService,
+	)
+	submissionHandler := handlers.NewSubmissionHandler(submissionService)
+
+	router.HandleFunc("/module-items/{id}/submissions", middleware.ConvertToHandlerFunc(submissionHandler.GetSubmissionsHandler, middleware.AuthMiddleware)).Methods("GET")
+	router.HandleFunc("/module-items/{id}/submissions", middleware.ConvertToHandlerFunc(submissionHandler.SubmitHandler, middleware.AuthMiddleware)).Methods("POST")
+
+	submissionRouter := router.PathPrefix("/submissions").Subrouter()
+
+	submissionRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(submissionHandler.GetSubmissionHandler, middleware.AuthMiddleware)).Methods("GET")
+	submissionRouter.HandleFunc("/{id}/grade", middleware.ConvertToHandlerFunc(submissionHandler.GradeSubmissionHandler, middleware.AuthMiddleware)).Methods("PUT")
+	submissionRouter.HandleFunc("/{id}/grade/return", middleware.ConvertToHandlerFunc(submissionHandler.ReturnGradeHandler, middleware.AuthMiddleware)).Methods("POST")
+}
@@ -0,0 +1,24 @@
+package router
+
+import (
+	"course-flow/internal/handlers"
+	"course-flow/internal/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+func (r *Router) setupWebhookRouter(router *mux.Router) {
+	webhookHandler := handlers.NewWebhookHandler(r.Webhooks)
+
+	router.HandleFunc("/courses/{course_id}/webhooks", middleware.ConvertToHandlerFunc(webhookHandler.GetWebhooksHandler, middleware.AuthMiddleware)).Methods("GET")
+	router.HandleFunc("/courses/{course_id}/webhooks", middleware.ConvertToHandlerFunc(webhookHandler.CreateWebhookHandler, middleware.AuthMiddleware)).Methods("POST")
+
+	webhookRouter := router.PathPrefix("/webhooks").Subrouter()
+
+	webhookRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(webhookHandler.UpdateWebhookHandler, middleware.AuthMiddleware)).Methods("PUT")
+	webhookRouter.HandleFunc("/{id}", middleware.ConvertToHandlerFunc(webhookHandler.DeleteWebhookHandler, middleware.AuthMiddleware)).Methods("DELETE")
+	webhookRouter.HandleFunc("/{id}/secret", middleware.ConvertToHandlerFunc(webhookHandler.RotateSecretHandler, middleware.AuthMiddleware)).Methods("POST")
+	webhookRouter.HandleFunc("/{id}/deliveries", middleware.ConvertToHandlerFunc(webhookHandler.GetDeliveriesHandler, middleware.AuthMiddleware)).Methods("GET")
+	webhookRouter.HandleFunc("/{id}/deliveries/{delivery_id}", middleware.ConvertToHandlerFunc(webhookHandler.GetDeliveryHandler, middleware.AuthMiddleware)).Methods("GET")
+	webhookRouter.HandleFunc("/{id}/deliveries/{delivery_id}/replay", middleware.ConvertToHandlerFunc(webhookHandler.ReplayDeliveryHandler, middleware.AuthMiddleware)).Methods("POST")
+}
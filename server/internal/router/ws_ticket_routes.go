@@ -0,0 +1,20 @@
+package router
+
+import (
+	"course-flow/internal/handlers"
+	"course-flow/internal/middleware"
+	"course-flow/internal/services"
+	"course-flow/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+func (r *Router) setupWSTicketRouter(router *mux.Router) {
+	ticketStorage := storage.NewWSTicketStorage(r.DB)
+
+	ticketService := services.NewWSTicketService(ticketStorage)
+
+	ticketHandler := handlers.NewWSTicketHandler(ticketService)
+
+	router.HandleFunc("/ws/ticket", middleware.ConvertToHandlerFunc(ticketHandler.CreateTicketHandler, middleware.AuthMiddleware)).Methods("POST")
+}
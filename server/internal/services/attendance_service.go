@@ -0,0 +1,411 @@
+package services
+
+import (
+	"bytes"
+	"course-flow/internal/attendance"
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// defaultLateAfter is how long after the start of a session students can
+	// check in without being late.
+	defaultLateAfter = 10
+	// defaultCheckInDuration is how long check-in stays open.
+	defaultCheckInDuration = 15
+	// maxCheckInDuration bounds how long check-in can stay open, in minutes.
+	maxCheckInDuration = 240
+)
+
+type AttendanceService struct {
+	storage *storage.AttendanceStorage
+}
+
+func NewAttendanceService(storage *storage.AttendanceStorage) *AttendanceService {
+	return &AttendanceService{
+		storage: storage,
+	}
+}
+
+func (s *AttendanceService) CreateSession(userID, courseID string, req *types.ClassSessionRequest) (*types.ClassSession, error) {
+	if err := s.storage.CheckCourseStaff(courseID, userID); err != nil {
+		return nil, err
+	}
+
+	session, err := buildClassSession(req)
+	if err != nil {
+		return nil, err
+	}
+	session.CourseID = courseID
+	session.CreatedBy = userID
+
+	secret, err := newCheckInSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CreateSession(session, secret); err != nil {
+		return nil, err
+	}
+	return s.storage.GetSession(session.ID)
+}
+
+func (s *AttendanceService) GetSessions(userID, courseID string) ([]*types.ClassSession, error) {
+	if err := s.storage.CheckCourseStaff(courseID, userID); err != nil {
+		return nil, err
+	}
+	return s.storage.GetSessions(courseID)
+}
+
+func (s *AttendanceService) UpdateSession(userID, sessionID string, req *types.ClassSessionRequest) (*types.ClassSession, error) {
+	if _, err := s.staffSession(userID, sessionID); err != nil {
+		return nil, err
+	}
+
+	session, err := buildClassSession(req)
+	if err != nil {
+		return nil, err
+	}
+	session.ID = sessionID
+
+	if err := s.storage.UpdateSession(session); err != nil {
+		return nil, err
+	}
+	return s.storage.GetSession(sessionID)
+}
+
+func (s *AttendanceService) DeleteSession(userID, sessionID string) error {
+	if _, err := s.staffSession(userID, sessionID); err != nil {
+		return err
+	}
+	return s.storage.DeleteSession(sessionID)
+}
+
+// OpenCheckIn lets students check in for the next minutes and returns the
+// first code. Later codes are pushed to the course staff over the hub.
+func (s *AttendanceService) OpenCheckIn(userID, sessionID string, req *types.OpenCheckInRequest) (*types.CheckInCode, error) {
+	if _, err := s.staffSession(userID, sessionID); err != nil {
+		return nil, err
+	}
+
+	duration := req.DurationMinutes
+	if duration == 0 {
+		duration = defaultCheckInDuration
+	}
+	if duration < 1 || duration > maxCheckInDuration {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("duration_minutes must be between 1 and %d", maxCheckInDuration),
+		}
+	}
+
+	secret, err := newCheckInSecret()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if err := s.storage.OpenCheckIn(sessionID, secret, now.Add(time.Duration(duration)*time.Minute)); err != nil {
+		return nil, err
+	}
+	return s.currentCode(sessionID, now)
+}
+
+func (s *AttendanceService) CloseCheckIn(userID, sessionID string) (*types.ClassSession, error) {
+	if _, err := s.staffSession(userID, sessionID); err != nil {
+		return nil, err
+	}
+	if err := s.storage.CloseCheckIn(sessionID); err != nil {
+		return nil, err
+	}
+	return s.storage.GetSession(sessionID)
+}
+
+// GetCheckInCode returns the current code, e.g. for staff who just opened
+// the check-in screen.
+func (s *AttendanceService) GetCheckInCode(userID, sessionID string) (*types.CheckInCode, error) {
+	if _, err := s.staffSession(userID, sessionID); err != nil {
+		return nil, err
+	}
+	return s.currentCode(sessionID, time.Now().UTC())
+}
+
+func (s *AttendanceService) currentCode(sessionID string, now time.Time) (*types.CheckInCode, error) {
+	checkIn, err := s.storage.GetCheckIn(sessionID, now)
+	if err != nil {
+		return nil, err
+	}
+	code := attendance.CurrentCode(*checkIn, now)
+	return &code, nil
+}
+
+// CheckIn records the user as present, or late after the session's late
+// threshold, when the code is the current code of an open session in one of
+// the user's courses.
+func (s *AttendanceService) CheckIn(userID string, req *types.CheckInRequest) (*types.CheckInResult, error) {
+	if strings.TrimSpace(req.Code) == "" {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "A check-in code is required"}
+	}
+
+	now := time.Now().UTC()
+	checkIns, err := s.storage.GetUserCheckIns(userID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched *types.OpenCheckIn
+	for i, checkIn := range checkIns {
+		if req.SessionID != "" && checkIn.SessionID != req.SessionID {
+			continue
+		}
+		if attendance.Verify(checkIn.Secret, req.Code, now) {
+			matched = &checkIns[i]
+			break
+		}
+	}
+	if matched == nil {
+		if req.SessionID != "" && !slices.ContainsFunc(checkIns, func(c types.OpenCheckIn) bool { return c.SessionID == req.SessionID }) {
+			return nil, &utils.ApiError{Code: http.StatusConflict, Message: "Check-in is not open for this session"}
+		}
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid or expired check-in code"}
+	}
+
+	status := types.AttendancePresent
+	if now.After(matched.LateAfter) {
+		status = types.AttendanceLate
+	}
+
+	recorded, created, err := s.storage.CheckIn(matched.SessionID, userID, status, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.CheckInResult{
+		SessionID:       matched.SessionID,
+		CourseID:        matched.CourseID,
+		Status:          recorded,
+		AlreadyRecorded: !created,
+	}, nil
+}
+
+// SetRecord overrides the attendance of a member at a session.
+func (s *AttendanceService) SetRecord(userID, sessionID, memberID string, req *types.AttendanceRecordRequest) error {
+	session, err := s.staffSession(userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains(types.AttendanceStatuses, req.Status) {
+		return &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "status must be one of " + strings.Join(types.AttendanceStatuses, ", "),
+		}
+	}
+	if utf8.RuneCountInString(req.Note) > 500 {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "note must be at most 500 characters"}
+	}
+	if err := s.storage.CheckStudent(session.CourseID, memberID); err != nil {
+		return err
+	}
+
+	return s.storage.SetRecord(sessionID, memberID, req.Status, strings.TrimSpace(req.Note), userID)
+}
+
+// GetSessionReport returns the attendance of every student at a session.
+func (s *AttendanceService) GetSessionReport(userID, sessionID string) (*types.SessionAttendance, error) {
+	session, err := s.staffSession(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := s.storage.GetSessionRecords(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		records[i].SessionTitle = session.Title
+		records[i].StartsAt = &session.StartsAt
+	}
+
+	return &types.SessionAttendance{Session: session, Records: records}, nil
+}
+
+// GetCourseReport returns the attendance of every student of a course over
+// the sessions that started so far, without the records themselves.
+func (s *AttendanceService) GetCourseReport(userID, courseID string) ([]types.StudentAttendance, error) {
+	records, err := s.GetCourseRecords(userID, courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := []types.StudentAttendance{}
+	for start := 0; start < len(records); {
+		end := start
+		for end < len(records) && records[end].User.ID == records[start].User.ID {
+			end++
+		}
+		report := summarizeAttendance(records[start].User, records[start:end])
+		report.Records = nil
+		reports = append(reports, report)
+		start = end
+	}
+	return reports, nil
+}
+
+// GetCourseRecords returns every record of a course over the sessions that
+// started so far, ordered by student.
+func (s *AttendanceService) GetCourseRecords(userID, courseID string) ([]types.AttendanceRecord, error) {
+	if err := s.storage.CheckCourseStaff(courseID, userID); err != nil {
+		return nil, err
+	}
+	return s.storage.GetCourseRecords(courseID, "", time.Now().UTC())
+}
+
+// GetStudentReport returns the attendance of a student over the sessions of
+// a course that started so far. Students can see their own report.
+func (s *AttendanceService) GetStudentReport(userID, courseID, studentID string) (*types.StudentAttendance, error) {
+	if studentID != userID {
+		if err := s.storage.CheckCourseStaff(courseID, userID); err != nil {
+			return nil, err
+		}
+	} else if err := s.storage.CheckCourseMember(courseID, userID); err != nil {
+		return nil, err
+	}
+
+	student, err := s.storage.GetStudent(studentID)
+	if err != nil {
+		return nil, err
+	}
+	records, err := s.storage.GetCourseRecords(courseID, studentID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	report := summarizeAttendance(*student, records)
+	return &report, nil
+}
+
+// staffSession returns the session if the user is staff of its course.
+func (s *AttendanceService) staffSession(userID, sessionID string) (*types.ClassSession, error) {
+	session, err := s.storage.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CheckCourseStaff(session.CourseID, userID); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// AttendanceCSV renders records as CSV, one row per student and session.
+func AttendanceCSV(records []types.AttendanceRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{
+		"session_id", "session", "starts_at", "user_id", "first_name", "last_name",
+		"email", "status", "checked_in_at", "note",
+	})
+
+	for _, record := range records {
+		var startsAt, checkedInAt string
+		if record.StartsAt != nil {
+			startsAt = record.StartsAt.UTC().Format(time.RFC3339)
+		}
+		if record.CheckedInAt != nil {
+			checkedInAt = record.CheckedInAt.UTC().Format(time.RFC3339)
+		}
+		w.Write([]string{
+			record.SessionID,
+			csvCell(record.SessionTitle),
+			startsAt,
+			record.User.ID,
+			csvCell(record.User.FirstName),
+			csvCell(record.User.LastName),
+			csvCell(record.User.Email),
+			record.Status,
+			checkedInAt,
+			csvCell(record.Note),
+		})
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write attendance CSV: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// csvCell keeps spreadsheets from running user input that looks like a
+// formula.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func summarizeAttendance(user types.User, records []types.AttendanceRecord) types.StudentAttendance {
+	report := types.StudentAttendance{
+		User:    user,
+		Counts:  map[string]int{},
+		Records: records,
+	}
+	for _, status := range types.AttendanceStatuses {
+		report.Counts[status] = 0
+	}
+	for _, record := range records {
+		report.Counts[record.Status]++
+	}
+
+	attended := report.Counts[types.AttendancePresent] + report.Counts[types.AttendanceLate]
+	if counted := len(records) - report.Counts[types.AttendanceExcused]; counted > 0 {
+		report.Rate = float64(attended) / float64(counted)
+	}
+	return report
+}
+
+// buildClassSession validates a request and turns it into a session.
+func buildClassSession(req *types.ClassSessionRequest) (*types.ClassSession, error) {
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Title is required"}
+	}
+	if utf8.RuneCountInString(title) > 200 {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Title must be at most 200 characters"}
+	}
+
+	startsAt, err := time.Parse(time.RFC3339, req.StartsAt)
+	if err != nil {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "starts_at must be an RFC 3339 time"}
+	}
+
+	lateAfter := defaultLateAfter
+	if req.LateAfterMinutes != nil {
+		lateAfter = *req.LateAfterMinutes
+	}
+	if lateAfter < 0 || lateAfter > 24*60 {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "late_after_minutes must be between 0 and 1440"}
+	}
+
+	return &types.ClassSession{
+		Title:     title,
+		StartsAt:  startsAt.UTC(),
+		LateAfter: startsAt.UTC().Add(time.Duration(lateAfter) * time.Minute),
+	}, nil
+}
+
+func newCheckInSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate check-in secret: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
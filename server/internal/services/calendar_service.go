@@ -0,0 +1,379 @@
+package services
+
+import (
+	"bytes"
+	"course-flow/internal/calendar"
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxOccurrences bounds the occurrences returned for one calendar range.
+	maxOccurrences = 2000
+	// maxImportEvents bounds the events of one ICS import.
+	maxImportEvents = 1000
+	// feedHistory is how far back the calendar feed goes.
+	feedHistory = 365 * 24 * time.Hour
+)
+
+type CalendarService struct {
+	storage       *storage.CalendarStorage
+	courseStorage *storage.CourseStorage
+}
+
+func NewCalendarService(storage *storage.CalendarStorage, courseStorage *storage.CourseStorage) *CalendarService {
+	return &CalendarService{
+		storage:       storage,
+		courseStorage: courseStorage,
+	}
+}
+
+func (s *CalendarService) CreateEvent(userID, courseID string, req *types.CourseEventRequest) (*types.CourseEvent, error) {
+	if err := s.storage.CheckCourseStaff(courseID, userID); err != nil {
+		return nil, err
+	}
+
+	event, err := buildCourseEvent(req)
+	if err != nil {
+		return nil, err
+	}
+	event.CourseID = courseID
+	event.UID = uuid.NewString() + "@course-flow"
+	event.CreatedBy = userID
+
+	if err := s.storage.CreateEvent(event); err != nil {
+		return nil, err
+	}
+	return s.storage.GetEvent(event.ID)
+}
+
+func (s *CalendarService) UpdateEvent(userID, eventID string, req *types.CourseEventRequest) (*types.CourseEvent, error) {
+	existing, err := s.storage.GetEvent(eventID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CheckCourseStaff(existing.CourseID, userID); err != nil {
+		return nil, err
+	}
+
+	event, err := buildCourseEvent(req)
+	if err != nil {
+		return nil, err
+	}
+	event.ID = existing.ID
+
+	if err := s.storage.UpdateEvent(event); err != nil {
+		return nil, err
+	}
+	return s.storage.GetEvent(event.ID)
+}
+
+func (s *CalendarService) DeleteEvent(userID, eventID string) error {
+	event, err := s.storage.GetEvent(eventID)
+	if err != nil {
+		return err
+	}
+	if err := s.storage.CheckCourseStaff(event.CourseID, userID); err != nil {
+		return err
+	}
+	return s.storage.DeleteEvent(eventID)
+}
+
+// GetCourseEvents returns the occurrences of the course's events between from
+// and to.
+func (s *CalendarService) GetCourseEvents(userID, courseID string, from, to time.Time) ([]types.EventOccurrence, error) {
+	if err := s.storage.CheckCourseMember(courseID, userID); err != nil {
+		return nil, err
+	}
+	return s.occurrences(userID, []string{courseID}, from, to)
+}
+
+// GetCalendar returns the occurrences of the events of every active course
+// of the user between from and to.
+func (s *CalendarService) GetCalendar(userID string, from, to time.Time) ([]types.EventOccurrence, error) {
+	courseIDs, err := s.userCourseIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.occurrences(userID, courseIDs, from, to)
+}
+
+func (s *CalendarService) occurrences(userID string, courseIDs []string, from, to time.Time) ([]types.EventOccurrence, error) {
+	occurrences := []types.EventOccurrence{}
+	if len(courseIDs) == 0 {
+		return occurrences, nil
+	}
+
+	events, err := s.events(userID, courseIDs, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, event := range events {
+		expanded, err := calendar.Expand(event, from, to, maxOccurrences)
+		if err != nil {
+			return nil, err
+		}
+		occurrences = append(occurrences, expanded...)
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].StartsAt.Before(occurrences[j].StartsAt)
+	})
+	if len(occurrences) > maxOccurrences {
+		occurrences = occurrences[:maxOccurrences]
+	}
+	return occurrences, nil
+}
+
+// events returns the events of the courses together with the user's office
+// hour bookings in them.
+func (s *CalendarService) events(userID string, courseIDs []string, from, to time.Time) ([]types.CourseEvent, error) {
+	events, err := s.storage.GetEvents(courseIDs, from, to)
+	if err != nil {
+		return nil, err
+	}
+	bookings, err := s.storage.GetBookingEvents(userID, courseIDs, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(events, bookings...), nil
+}
+
+func (s *CalendarService) userCourseIDs(userID string) ([]string, error) {
+	courses, err := s.courseStorage.GetCourseByUserID(userID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	courseIDs := make([]string, 0, len(courses))
+	for _, course := range courses {
+		courseIDs = append(courseIDs, course.ID)
+	}
+	return courseIDs, nil
+}
+
+// ImportEvents adds the events of an ICS file to the course. Events are
+// matched on their UID, so importing an updated file updates them. Times
+// without a time zone are read in timezone, and events without a category
+// naming their kind get kind.
+func (s *CalendarService) ImportEvents(userID, courseID string, data []byte, timezone, kind string) (*types.CalendarImportResult, error) {
+	if err := s.storage.CheckCourseStaff(courseID, userID); err != nil {
+		return nil, err
+	}
+
+	if kind == "" {
+		kind = types.CalendarOther
+	}
+	if !slices.Contains(types.CalendarEventKinds, kind) {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid event kind"}
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Unknown time zone " + timezone}
+	}
+
+	parsed, skipped, err := calendar.ParseCalendar(data, timezone)
+	if err != nil {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid calendar file: " + err.Error()}
+	}
+	if len(parsed) > maxImportEvents {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("A calendar file can have at most %d events", maxImportEvents),
+		}
+	}
+
+	result := &types.CalendarImportResult{Skipped: skipped}
+	if result.Skipped == nil {
+		result.Skipped = []types.CalendarImportSkip{}
+	}
+
+	var events []types.CourseEvent
+	for _, event := range parsed {
+		if event.Kind == "" {
+			event.Kind = kind
+		}
+		if err := checkCourseEvent(&event); err != nil {
+			result.Skipped = append(result.Skipped, types.CalendarImportSkip{UID: event.UID, Summary: event.Title, Reason: err.Error()})
+			continue
+		}
+		events = append(events, event)
+	}
+
+	if len(events) > 0 {
+		result.Created, result.Updated, err = s.storage.ImportEvents(courseID, userID, events)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// GetFeed returns the user's private calendar subscription URL, creating it
+// on first use.
+func (s *CalendarService) GetFeed(userID string) (*types.CalendarFeed, error) {
+	newToken, err := newFeedToken()
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.storage.GetFeedToken(userID, newToken)
+	if err != nil {
+		return nil, err
+	}
+	return &types.CalendarFeed{URL: feedURL(token)}, nil
+}
+
+// RotateFeed replaces the user's subscription URL, e.g. after it leaked.
+func (s *CalendarService) RotateFeed(userID string) (*types.CalendarFeed, error) {
+	token, err := newFeedToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.RotateFeedToken(userID, token); err != nil {
+		return nil, err
+	}
+	return &types.CalendarFeed{URL: feedURL(token)}, nil
+}
+
+// Feed renders the iCalendar feed of the user the token belongs to, with
+// the events of all their active courses from the last year on.
+func (s *CalendarService) Feed(token string) ([]byte, error) {
+	userID, err := s.storage.GetFeedUser(token)
+	if err != nil {
+		return nil, err
+	}
+
+	courseIDs, err := s.userCourseIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []types.CourseEvent{}
+	if len(courseIDs) > 0 {
+		events, err = s.events(userID, courseIDs, time.Now().UTC().Add(-feedHistory), time.Time{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := calendar.WriteCalendar(&buf, "Course Flow", events); err != nil {
+		return nil, fmt.Errorf("failed to render calendar feed: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func newFeedToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate calendar feed token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func feedURL(token string) string {
+	baseURL := strings.TrimSuffix(utils.GetEnv("BASE_URL"), "/")
+	return baseURL + "/api/v1/calendar/feed/" + token + ".ics"
+}
+
+// buildCourseEvent validates a request and turns it into an event.
+func buildCourseEvent(req *types.CourseEventRequest) (*types.CourseEvent, error) {
+	event := &types.CourseEvent{
+		Title:       strings.TrimSpace(req.Title),
+		Description: req.Description,
+		Location:    strings.TrimSpace(req.Location),
+		Kind:        req.Kind,
+		AllDay:      req.AllDay,
+		Timezone:    req.Timezone,
+		RRule:       strings.TrimSpace(req.RRule),
+	}
+	if event.Kind == "" {
+		event.Kind = types.CalendarOther
+	}
+	if event.Timezone == "" {
+		event.Timezone = "UTC"
+	}
+
+	loc, err := time.LoadLocation(event.Timezone)
+	if err != nil {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Unknown time zone " + event.Timezone}
+	}
+
+	if event.StartsAt, err = parseEventTime(req.StartsAt, req.AllDay, loc); err != nil {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid starts_at: " + err.Error()}
+	}
+	switch {
+	case req.EndsAt != "":
+		if event.EndsAt, err = parseEventTime(req.EndsAt, req.AllDay, loc); err != nil {
+			return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid ends_at: " + err.Error()}
+		}
+	case req.AllDay:
+		event.EndsAt = event.StartsAt.In(loc).AddDate(0, 0, 1).UTC()
+	default:
+		event.EndsAt = event.StartsAt
+	}
+
+	event.ExDates = []time.Time{}
+	for _, value := range req.ExDates {
+		exDate, err := parseEventTime(value, req.AllDay, loc)
+		if err != nil {
+			return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid exdate: " + err.Error()}
+		}
+		event.ExDates = append(event.ExDates, exDate)
+	}
+
+	if err := checkCourseEvent(event); err != nil {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return event, nil
+}
+
+// parseEventTime reads an RFC 3339 time, or a date in loc for all-day
+// events.
+func parseEventTime(value string, allDay bool, loc *time.Location) (time.Time, error) {
+	if allDay {
+		t, err := time.ParseInLocation("2006-01-02", value, loc)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("expected a date like 2006-01-02")
+		}
+		return t.UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected an RFC 3339 time")
+	}
+	return t.UTC(), nil
+}
+
+// checkCourseEvent applies the rules every event must follow, whether it is
+// created through the API or imported.
+func checkCourseEvent(event *types.CourseEvent) error {
+	if event.Title == "" {
+		return fmt.Errorf("Title is required")
+	}
+	if utf8.RuneCountInString(event.Title) > 200 {
+		return fmt.Errorf("Title must be at most 200 characters")
+	}
+	if utf8.RuneCountInString(event.Location) > 255 {
+		return fmt.Errorf("Location must be at most 255 characters")
+	}
+	if len(event.UID) > 255 {
+		return fmt.Errorf("UID must be at most 255 characters")
+	}
+	if !slices.Contains(types.CalendarEventKinds, event.Kind) {
+		return fmt.Errorf("Kind must be one of %s", strings.Join(types.CalendarEventKinds, ", "))
+	}
+	return calendar.Normalize(event)
+}
@@ -5,26 +5,42 @@ import (
 	"course-flow/internal/types"
 	"course-flow/internal/utils"
 	"fmt"
+	"mime/multipart"
 	"net/http"
+	"regexp"
+	"strings"
 	"time"
+	"unicode/utf8"
+)
+
+// Limits for the chat moderation settings
+const (
+	maxSlowModeSeconds   = 3600
+	maxMuteMinutes       = 30 * 24 * 60
+	maxBlockedWords      = 200
+	maxBlockedWordLength = 64
 )
 
 type ChatService struct {
-	storage     *storage.ChatStorage
-	userStorage *storage.UserStorage
+	storage             *storage.ChatStorage
+	userStorage         *storage.UserStorage
+	conversationStorage *storage.ConversationStorage
+	documentService     *DocumentService
 }
 
-func NewChatService(storage *storage.ChatStorage, userStorage *storage.UserStorage) *ChatService {
-	return &ChatService{storage: storage, userStorage: userStorage}
+func NewChatService(storage *storage.ChatStorage, userStorage *storage.UserStorage, conversationStorage *storage.ConversationStorage, documentService *DocumentService) *ChatService {
+	return &ChatService{
+		storage:             storage,
+		userStorage:         userStorage,
+		conversationStorage: conversationStorage,
+		documentService:     documentService,
+	}
 }
 
 func (s *ChatService) ProcessChatMessage(chatMsg *types.ChatMessage) error {
 	// Validate the message
-	if chatMsg.CourseID == "" {
-		return &utils.ApiError{
-			Code:    http.StatusBadRequest,
-			Message: "Course ID is required",
-		}
+	if err := s.resolveScope(chatMsg); err != nil {
+		return err
 	}
 	if chatMsg.FromID == "" {
 		return &utils.ApiError{
@@ -32,17 +48,39 @@ func (s *ChatService) ProcessChatMessage(chatMsg *types.ChatMessage) error {
 			Message: "Sender ID is required",
 		}
 	}
-	if chatMsg.Content == "" {
+	if err := s.validateAttachments(chatMsg); err != nil {
+		return err
+	}
+	if chatMsg.Content == "" && len(chatMsg.AttachmentIDs) == 0 {
 		return &utils.ApiError{
 			Code:    http.StatusBadRequest,
 			Message: "Message content is required",
 		}
 	}
 
+	if err := s.moderate(chatMsg, true); err != nil {
+		return err
+	}
+
 	if chatMsg.Timestamp.IsZero() {
 		chatMsg.Timestamp = time.Now().UTC()
 	}
 
+	// Replies must quote a message from the same course or conversation
+	if chatMsg.ParentID != "" {
+		parent, err := s.storage.GetChatMessage(chatMsg.ParentID)
+		if err != nil {
+			return err
+		}
+		if parent.CourseID != chatMsg.CourseID || parent.ConversationID != chatMsg.ConversationID {
+			return &utils.ApiError{
+				Code:    http.StatusBadRequest,
+				Message: "Replied message does not belong to this chat",
+			}
+		}
+		chatMsg.Parent = parent
+	}
+
 	if err := s.storage.CreateChatMessage(chatMsg); err != nil {
 		return fmt.Errorf("failed to save chat message: %v", err)
 	}
@@ -56,10 +94,481 @@ func (s *ChatService) ProcessChatMessage(chatMsg *types.ChatMessage) error {
 	return nil
 }
 
-func (s *ChatService) GetMessagesByCourse(courseID, userID string) ([]types.ChatMessage, error) {
-	messages, err := s.storage.GetMessageByCourse(courseID, userID)
+// validateAttachments removes duplicate attachment IDs and enforces the
+// per-message attachment limit.
+func (s *ChatService) validateAttachments(chatMsg *types.ChatMessage) error {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range chatMsg.AttachmentIDs {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	if len(ids) > MaxChatAttachments {
+		return &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("A message can have at most %d attachments", MaxChatAttachments),
+		}
+	}
+	chatMsg.AttachmentIDs = ids
+	return nil
+}
+
+// UploadChatFiles stores files to be attached to a chat message in the course.
+// The returned document IDs are sent as attachment_ids with the message.
+func (s *ChatService) UploadChatFiles(courseID, userID string, fileHeaders []*multipart.FileHeader) ([]types.Document, error) {
+	isMember, err := s.storage.IsCourseMember(courseID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check course membership: %v", err)
+	}
+	if !isMember {
+		return nil, &utils.ApiError{
+			Code:    http.StatusForbidden,
+			Message: "You are not a member of this course",
+		}
+	}
+
+	if len(fileHeaders) == 0 {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "No files uploaded",
+		}
+	}
+	if len(fileHeaders) > MaxChatAttachments {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("At most %d files can be uploaded at once", MaxChatAttachments),
+		}
+	}
+
+	documents := make([]types.Document, 0, len(fileHeaders))
+	for _, fh := range fileHeaders {
+		doc, err := s.documentService.SaveChatUpload(fh, userID)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, *doc)
+	}
+
+	return documents, nil
+}
+
+func (s *ChatService) GetMessagesByCourse(courseID, userID string, page types.ChatPage) ([]types.ChatMessage, error) {
+	messages, err := s.storage.GetMessageByCourse(courseID, userID, page)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch messages: %v", err)
 	}
 	return messages, nil
 }
+
+func (s *ChatService) EditChatMessage(chatMsg *types.ChatMessage) error {
+	if err := s.resolveScope(chatMsg); err != nil {
+		return err
+	}
+	if chatMsg.ID == "" {
+		return &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Message ID is required",
+		}
+	}
+	if strings.TrimSpace(chatMsg.Content) == "" {
+		return &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Message content is required",
+		}
+	}
+
+	if err := s.moderate(chatMsg, false); err != nil {
+		return err
+	}
+
+	if err := s.storage.EditChatMessage(chatMsg); err != nil {
+		return err
+	}
+
+	return s.attachSender(chatMsg)
+}
+
+func (s *ChatService) DeleteChatMessage(chatMsg *types.ChatMessage) error {
+	if err := s.resolveScope(chatMsg); err != nil {
+		return err
+	}
+	if chatMsg.ID == "" {
+		return &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Message ID is required",
+		}
+	}
+
+	if err := s.storage.DeleteChatMessage(chatMsg.ID, chatMsg.CourseID, chatMsg.ConversationID, chatMsg.FromID); err != nil {
+		return err
+	}
+
+	chatMsg.Content = ""
+	chatMsg.Deleted = true
+	return s.attachSender(chatMsg)
+}
+
+// MarkRead stores the read watermark carried by a chat_read frame. The frame's
+// ID is the last message the user has seen.
+func (s *ChatService) MarkRead(chatMsg *types.ChatMessage) error {
+	if err := s.resolveScope(chatMsg); err != nil {
+		return err
+	}
+	if chatMsg.ID == "" {
+		return &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Message ID is required",
+		}
+	}
+
+	var readAt time.Time
+	var err error
+	if chatMsg.ConversationID != "" {
+		readAt, err = s.storage.MarkConversationRead(chatMsg.ConversationID, chatMsg.FromID, chatMsg.ID)
+	} else {
+		readAt, err = s.storage.MarkMessagesRead(chatMsg.CourseID, chatMsg.FromID, chatMsg.ID)
+	}
+	if err != nil {
+		return err
+	}
+	chatMsg.Timestamp = readAt
+	chatMsg.Content = ""
+
+	return s.attachSender(chatMsg)
+}
+
+// ProcessTyping prepares a typing indicator for broadcast. Nothing is persisted.
+func (s *ChatService) ProcessTyping(chatMsg *types.ChatMessage) error {
+	if err := s.resolveScope(chatMsg); err != nil {
+		return err
+	}
+	chatMsg.ID = ""
+	chatMsg.Content = ""
+	chatMsg.Timestamp = time.Now().UTC()
+
+	return s.attachSender(chatMsg)
+}
+
+func (s *ChatService) GetUnreadCounts(userID string) ([]types.ChatUnreadCount, error) {
+	counts, err := s.storage.GetUnreadCounts(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch unread counts: %v", err)
+	}
+	return counts, nil
+}
+
+func (s *ChatService) attachSender(chatMsg *types.ChatMessage) error {
+	user, err := s.userStorage.GetUserWithID(chatMsg.FromID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch user: %v", err)
+	}
+	chatMsg.Sender = *user
+	return nil
+}
+
+func (s *ChatService) GetChatSettings(courseID, userID string) (*types.ChatSettings, error) {
+	isMember, err := s.storage.IsCourseMember(courseID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check course membership: %v", err)
+	}
+	if !isMember {
+		return nil, &utils.ApiError{
+			Code:    http.StatusForbidden,
+			Message: "You are not a member of this course",
+		}
+	}
+
+	settings, err := s.storage.GetChatSettings(courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The blocked words list is only visible to the people maintaining it
+	isStaff, err := s.storage.CanModerate(courseID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isStaff {
+		settings.BlockedWords = []string{}
+	}
+
+	return settings, nil
+}
+
+func (s *ChatService) UpdateChatSettings(userID string, settings *types.ChatSettings) (*types.ChatSettings, error) {
+	if settings.CourseID == "" {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Course ID is required",
+		}
+	}
+
+	if err := s.storage.UpdateChatSettings(userID, settings); err != nil {
+		return nil, err
+	}
+
+	return s.storage.GetChatSettings(settings.CourseID)
+}
+
+// UpdateChatModeration validates and saves the slow mode, staff-only and
+// blocked words settings of a course chat.
+func (s *ChatService) UpdateChatModeration(userID string, settings *types.ChatSettings) (*types.ChatSettings, error) {
+	if settings.CourseID == "" {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Course ID is required",
+		}
+	}
+	if settings.SlowModeSeconds < 0 || settings.SlowModeSeconds > maxSlowModeSeconds {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("slow_mode_seconds must be between 0 and %d", maxSlowModeSeconds),
+		}
+	}
+
+	switch settings.FilterMode {
+	case "":
+		settings.FilterMode = types.ChatFilterReject
+	case types.ChatFilterReject, types.ChatFilterMask:
+	default:
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "filter_mode must be either reject or mask",
+		}
+	}
+
+	words := []string{}
+	seen := make(map[string]bool)
+	for _, word := range settings.BlockedWords {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word == "" || seen[word] {
+			continue
+		}
+		if len(word) > maxBlockedWordLength {
+			return nil, &utils.ApiError{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Blocked words can be at most %d characters long", maxBlockedWordLength),
+			}
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	if len(words) > maxBlockedWords {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("At most %d blocked words are allowed", maxBlockedWords),
+		}
+	}
+	settings.BlockedWords = words
+
+	if err := s.storage.UpdateChatModeration(userID, settings); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (s *ChatService) MuteUser(courseID, moderatorID string, req *types.ChatMuteRequest) (*types.ChatMute, error) {
+	if req.UserID == "" {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "User ID is required",
+		}
+	}
+	if req.UserID == moderatorID {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "You cannot mute yourself",
+		}
+	}
+	if req.DurationMinutes < 1 || req.DurationMinutes > maxMuteMinutes {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("duration_minutes must be between 1 and %d", maxMuteMinutes),
+		}
+	}
+
+	mute := &types.ChatMute{
+		CourseID:   courseID,
+		UserID:     req.UserID,
+		MutedBy:    moderatorID,
+		MutedUntil: time.Now().UTC().Add(time.Duration(req.DurationMinutes) * time.Minute),
+	}
+	if err := s.storage.MuteUser(mute); err != nil {
+		return nil, err
+	}
+
+	return mute, nil
+}
+
+func (s *ChatService) UnmuteUser(courseID, userID, moderatorID string) error {
+	return s.storage.UnmuteUser(courseID, userID, moderatorID)
+}
+
+func (s *ChatService) GetActiveMutes(courseID, userID string) ([]types.ChatMute, error) {
+	isStaff, err := s.storage.CanModerate(courseID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isStaff {
+		return nil, &utils.ApiError{
+			Code:    http.StatusForbidden,
+			Message: "Only moderators can view muted members",
+		}
+	}
+
+	return s.storage.GetActiveMutes(courseID)
+}
+
+// moderate applies the course chat moderation settings to a message before it
+// is persisted. Moderators bypass the mute, staff-only and slow mode checks but
+// the word filter applies to everyone. Direct messages are not moderated.
+func (s *ChatService) moderate(chatMsg *types.ChatMessage, checkSlowMode bool) error {
+	if chatMsg.ConversationID != "" {
+		return nil
+	}
+
+	settings, err := s.storage.GetChatSettings(chatMsg.CourseID)
+	if err != nil {
+		return err
+	}
+
+	isStaff, err := s.storage.CanModerate(chatMsg.CourseID, chatMsg.FromID)
+	if err != nil {
+		return err
+	}
+
+	if !isStaff {
+		if settings.StaffOnly {
+			return &utils.ApiError{
+				Code:    http.StatusForbidden,
+				Message: "Only staff can post in this chat right now",
+			}
+		}
+
+		mutedUntil, err := s.storage.GetMuteUntil(chatMsg.CourseID, chatMsg.FromID)
+		if err != nil {
+			return err
+		}
+		if mutedUntil != nil {
+			return &utils.ApiError{
+				Code:    http.StatusForbidden,
+				Message: fmt.Sprintf("You are muted in this chat until %s", mutedUntil.UTC().Format(time.RFC3339)),
+			}
+		}
+
+		if checkSlowMode && settings.SlowModeSeconds > 0 {
+			lastAt, err := s.storage.GetLastMessageTime(chatMsg.CourseID, chatMsg.FromID)
+			if err != nil {
+				return err
+			}
+			if lastAt != nil {
+				wait := time.Duration(settings.SlowModeSeconds)*time.Second - time.Since(*lastAt)
+				if wait > 0 {
+					return &utils.ApiError{
+						Code:    http.StatusTooManyRequests,
+						Message: fmt.Sprintf("Slow mode is on, wait %d seconds before sending another message", int(wait.Seconds())+1),
+					}
+				}
+			}
+		}
+	}
+
+	filtered, matched := filterBlockedWords(chatMsg.Content, settings.BlockedWords)
+	if !matched {
+		return nil
+	}
+	if settings.FilterMode == types.ChatFilterMask {
+		chatMsg.Content = filtered
+		return nil
+	}
+	return &utils.ApiError{
+		Code:    http.StatusUnprocessableEntity,
+		Message: "Your message contains blocked words",
+	}
+}
+
+// filterBlockedWords masks every case-insensitive occurrence of the blocked
+// words in content and reports whether any were found.
+func filterBlockedWords(content string, words []string) (string, bool) {
+	if len(words) == 0 {
+		return content, false
+	}
+
+	patterns := make([]string, 0, len(words))
+	for _, word := range words {
+		pattern := regexp.QuoteMeta(word)
+		// Only anchor on word boundaries where the word itself starts or ends
+		// with a word character, otherwise \b would never match
+		if isWordByte(word[0]) {
+			pattern = `\b` + pattern
+		}
+		if isWordByte(word[len(word)-1]) {
+			pattern = pattern + `\b`
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	re, err := regexp.Compile(`(?i)(?:` + strings.Join(patterns, "|") + `)`)
+	if err != nil {
+		return content, false
+	}
+	if !re.MatchString(content) {
+		return content, false
+	}
+
+	return re.ReplaceAllStringFunc(content, func(match string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(match))
+	}), true
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || ('0' <= b && b <= '9') || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
+
+// resolveScope checks that a frame targets either a course or a conversation.
+// For direct messages it verifies the sender is a participant, re-checks the
+// course DM policy and fills in the participants to deliver to.
+func (s *ChatService) resolveScope(chatMsg *types.ChatMessage) error {
+	if chatMsg.ConversationID == "" {
+		if chatMsg.CourseID == "" {
+			return &utils.ApiError{
+				Code:    http.StatusBadRequest,
+				Message: "Course ID or conversation ID is required",
+			}
+		}
+		return nil
+	}
+
+	conversation, err := s.conversationStorage.GetConversation(chatMsg.ConversationID)
+	if err != nil {
+		return err
+	}
+
+	var participantIDs []string
+	isParticipant := false
+	for _, participant := range conversation.Participants {
+		participantIDs = append(participantIDs, participant.ID)
+		if participant.ID == chatMsg.FromID {
+			isParticipant = true
+		}
+	}
+	if !isParticipant {
+		return &utils.ApiError{
+			Code:    http.StatusForbidden,
+			Message: "You are not a participant of this conversation",
+		}
+	}
+
+	if err := s.conversationStorage.CheckDMPolicy(conversation.CourseID, participantIDs); err != nil {
+		return err
+	}
+
+	// Direct messages never belong to the course chat itself
+	chatMsg.CourseID = ""
+	chatMsg.RecipientIDs = participantIDs
+	return nil
+}
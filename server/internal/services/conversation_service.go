@@ -0,0 +1,116 @@
+package services
+
+import (
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxConversationParticipants caps the size of group conversations, including
+// the creator.
+const maxConversationParticipants = 10
+
+type ConversationService struct {
+	storage     *storage.ConversationStorage
+	chatStorage *storage.ChatStorage
+}
+
+func NewConversationService(storage *storage.ConversationStorage, chatStorage *storage.ChatStorage) *ConversationService {
+	return &ConversationService{storage: storage, chatStorage: chatStorage}
+}
+
+// CreateConversation starts a conversation between the creator and the
+// requested participants. An existing one-to-one conversation between the same
+// two users is returned instead of creating a duplicate.
+func (s *ConversationService) CreateConversation(userID string, req *types.ConversationRequest) (*types.Conversation, error) {
+	if req.CourseID == "" {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Course ID is required",
+		}
+	}
+
+	participantIDs := []string{userID}
+	seen := map[string]bool{userID: true}
+	for _, id := range req.ParticipantIDs {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		participantIDs = append(participantIDs, id)
+	}
+
+	if len(participantIDs) < 2 {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "At least one other participant is required",
+		}
+	}
+	if len(participantIDs) > maxConversationParticipants {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("A conversation can have at most %d participants", maxConversationParticipants),
+		}
+	}
+
+	if err := s.storage.CheckDMPolicy(req.CourseID, participantIDs); err != nil {
+		return nil, err
+	}
+
+	isGroup := len(participantIDs) > 2
+	if !isGroup {
+		existingID, err := s.storage.FindDirectConversation(req.CourseID, participantIDs)
+		if err != nil {
+			return nil, err
+		}
+		if existingID != "" {
+			return s.storage.GetConversation(existingID)
+		}
+	}
+
+	conversation := &types.Conversation{
+		CourseID:  req.CourseID,
+		CreatedBy: userID,
+		IsGroup:   isGroup,
+	}
+	if err := s.storage.CreateConversation(conversation, participantIDs); err != nil {
+		return nil, err
+	}
+
+	return s.storage.GetConversation(conversation.ID)
+}
+
+func (s *ConversationService) GetConversationsForUser(userID string) ([]types.Conversation, error) {
+	return s.storage.GetConversationsForUser(userID)
+}
+
+func (s *ConversationService) GetMessages(conversationID, userID string, page types.ChatPage) ([]types.ChatMessage, error) {
+	conversation, err := s.storage.GetConversation(conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	isParticipant := false
+	for _, participant := range conversation.Participants {
+		if participant.ID == userID {
+			isParticipant = true
+			break
+		}
+	}
+	if !isParticipant {
+		return nil, &utils.ApiError{
+			Code:    http.StatusForbidden,
+			Message: "You are not a participant of this conversation",
+		}
+	}
+
+	messages, err := s.chatStorage.GetMessagesByConversation(conversationID, page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch messages: %v", err)
+	}
+	return messages, nil
+}
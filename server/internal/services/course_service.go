@@ -104,7 +104,9 @@ func (s *CourseService) LeaveCourse(toKick string, r *http.Request) (string, str
 		return "", "", err
 	}
 
+	kickedBy := ""
 	if toKick != "" {
+		kickedBy = userID
 		userID = toKick
 	}
 
@@ -117,7 +119,7 @@ func (s *CourseService) LeaveCourse(toKick string, r *http.Request) (string, str
 		}
 	}
 
-	return userID, courseID, s.CourseStorage.LeaveCourse(courseID, userID)
+	return userID, courseID, s.CourseStorage.LeaveCourse(courseID, userID, kickedBy)
 }
 
 func (s *CourseService) DeleteCourse(r *http.Request) error {
@@ -182,21 +184,28 @@ func (s *CourseService) GetCourseOfSingleUser(r *http.Request) ([]*types.CourseL
 	return s.CourseStorage.GetCourseByUserID(userID, archived)
 }
 
-func (s *CourseService) JoinCourseService(joinCode string, r *http.Request) error {
+// JoinCourseService adds the current user to a course and returns the user
+// and course IDs.
+func (s *CourseService) JoinCourseService(joinCode string, r *http.Request) (string, string, error) {
 	ctx := r.Context()
 	userID, err := utils.GetUserIDFromContext(ctx)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
 	if strings.TrimSpace(joinCode) == "" {
-		return &utils.ApiError{
+		return "", "", &utils.ApiError{
 			Code:    http.StatusNotFound,
 			Message: "Course ID is required.",
 		}
 	}
 
-	return s.CourseStorage.JoinCourse(joinCode, userID)
+	courseID, err := s.CourseStorage.JoinCourse(joinCode, userID)
+	return userID, courseID, err
+}
+
+func (s *CourseService) GetCourseMemberIDs(courseID string) ([]string, error) {
+	return s.CourseStorage.GetCourseMemberIDs(courseID)
 }
 
 // GetCoursesByInstructor fetches all courses where the given user is the instructor.
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"bytes"
+	"course-flow/internal/mailer"
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// maxDigestItems bounds the notifications listed per course.
+const maxDigestItems = 20
+
+type DigestService struct {
+	storage           *storage.DigestStorage
+	preferenceStorage *storage.NotificationPreferenceStorage
+	mailer            mailer.Mailer
+}
+
+func NewDigestService(storage *storage.DigestStorage, preferenceStorage *storage.NotificationPreferenceStorage, mailer mailer.Mailer) *DigestService {
+	return &DigestService{
+		storage:           storage,
+		preferenceStorage: preferenceStorage,
+		mailer:            mailer,
+	}
+}
+
+func (s *DigestService) GetSettings(userID string) (*types.DigestSettings, error) {
+	return s.storage.GetSettings(userID)
+}
+
+func (s *DigestService) SetFrequency(userID, frequency string) error {
+	switch frequency {
+	case types.DigestDaily, types.DigestWeekly, types.DigestOff:
+	default:
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Frequency must be daily, weekly or off"}
+	}
+	return s.storage.SetFrequency(userID, frequency)
+}
+
+// SendDue sends the digests of every user who is due one. It runs as an
+// hourly job; each digest is claimed so overlapping runs do not send it twice.
+func (s *DigestService) SendDue() error {
+	now := time.Now().UTC()
+	dailyCutoff := now.Add(-24 * time.Hour)
+	weeklyCutoff := now.Add(-7 * 24 * time.Hour)
+
+	recipients, err := s.storage.GetDueRecipients(dailyCutoff, weeklyCutoff)
+	if err != nil {
+		return err
+	}
+
+	for _, recipient := range recipients {
+		cutoff := dailyCutoff
+		if recipient.Frequency == types.DigestWeekly {
+			cutoff = weeklyCutoff
+		}
+		if err := s.send(recipient, now, cutoff); err != nil {
+			log.Printf("Failed to send digest to user %s: %v", recipient.UserID, err)
+		}
+	}
+	return nil
+}
+
+func (s *DigestService) send(recipient types.DigestRecipient, now, cutoff time.Time) error {
+	claimed, err := s.storage.ClaimDigest(recipient.UserID, now, cutoff)
+	if err != nil || !claimed {
+		return err
+	}
+
+	since := cutoff
+	if recipient.LastSentAt != nil {
+		since = *recipient.LastSentAt
+	}
+
+	courses, err := s.storage.GetUnreadByCourse(recipient.UserID, since)
+	if err != nil {
+		s.release(recipient)
+		return err
+	}
+	if len(courses) == 0 {
+		return nil
+	}
+
+	msg, err := s.render(recipient, courses)
+	if err != nil {
+		s.release(recipient)
+		return err
+	}
+
+	if err := s.mailer.Send(*msg); err != nil {
+		s.release(recipient)
+		return err
+	}
+
+	log.Printf("Successfully sent %s digest to user %s", recipient.Frequency, recipient.UserID)
+	return nil
+}
+
+func (s *DigestService) release(recipient types.DigestRecipient) {
+	if err := s.storage.ReleaseDigest(recipient.UserID, recipient.LastSentAt); err != nil {
+		log.Println(err)
+	}
+}
+
+type digestView struct {
+	FirstName      string
+	Period         string
+	Total          int
+	Courses        []types.DigestCourse
+	UnsubscribeURL string
+}
+
+var digestHTML = htmltemplate.Must(htmltemplate.New("digest").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #1f2937;">
+  <p>Hi {{if .FirstName}}{{.FirstName}}{{else}}there{{end}},</p>
+  <p>You have {{.Total}} unread notification{{if ne .Total 1}}s{{end}} from the last {{.Period}}.</p>
+  {{range .Courses}}
+  <h3 style="margin-bottom: 4px;">{{if .CourseName}}{{.CourseName}}{{else}}Other{{end}}</h3>
+  <ul>
+    {{range .Notifications}}<li>{{.Message}}</li>{{end}}
+  </ul>
+  {{if .MuteURL}}<p style="font-size: 12px;"><a href="{{.MuteURL}}">Mute notifications from this course</a></p>{{end}}
+  {{end}}
+  <p style="font-size: 12px; color: #6b7280;">
+    <a href="{{.UnsubscribeURL}}">Unsubscribe from email digests</a>
+  </p>
+</body>
+</html>
+`))
+
+var digestText = texttemplate.Must(texttemplate.New("digest").Parse(`Hi {{if .FirstName}}{{.FirstName}}{{else}}there{{end}},
+
+You have {{.Total}} unread notification{{if ne .Total 1}}s{{end}} from the last {{.Period}}.
+{{range .Courses}}
+{{if .CourseName}}{{.CourseName}}{{else}}Other{{end}}
+{{range .Notifications}}  - {{.Message}}
+{{end}}{{if .MuteURL}}  Mute this course: {{.MuteURL}}
+{{end}}{{end}}
+Unsubscribe from email digests: {{.UnsubscribeURL}}
+`))
+
+// render builds the digest email, grouped by course, with signed links to
+// unsubscribe and to mute each course.
+func (s *DigestService) render(recipient types.DigestRecipient, courses []types.DigestCourse) (*mailer.Message, error) {
+	view := digestView{
+		FirstName:      recipient.FirstName,
+		Period:         "day",
+		UnsubscribeURL: unsubscribeURL(recipient.UserID, ""),
+	}
+	if recipient.Frequency == types.DigestWeekly {
+		view.Period = "week"
+	}
+
+	for _, course := range courses {
+		view.Total += len(course.Notifications)
+		if len(course.Notifications) > maxDigestItems {
+			course.Notifications = course.Notifications[:maxDigestItems]
+		}
+		if course.CourseID != "" {
+			course.MuteURL = unsubscribeURL(recipient.UserID, course.CourseID)
+		}
+		view.Courses = append(view.Courses, course)
+	}
+
+	var html, text bytes.Buffer
+	if err := digestHTML.Execute(&html, view); err != nil {
+		return nil, fmt.Errorf("failed to render digest: %v", err)
+	}
+	if err := digestText.Execute(&text, view); err != nil {
+		return nil, fmt.Errorf("failed to render digest: %v", err)
+	}
+
+	return &mailer.Message{
+		To:      recipient.Email,
+		Subject: fmt.Sprintf("Your %s Course Flow digest: %d unread", recipient.Frequency, view.Total),
+		Text:    text.String(),
+		HTML:    html.String(),
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + view.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}, nil
+}
+
+// unsubscribeClaims identifies what an unsubscribe link turns off: the digest
+// of the user, or every notification of one course when CourseID is set.
+type unsubscribeClaims struct {
+	UserID   string `json:"u"`
+	CourseID string `json:"c,omitempty"`
+}
+
+func unsubscribeURL(userID, courseID string) string {
+	payload, _ := json.Marshal(unsubscribeClaims{UserID: userID, CourseID: courseID})
+	token := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signUnsubscribe(payload))
+
+	baseURL := strings.TrimSuffix(utils.GetEnv("BASE_URL"), "/")
+	return baseURL + "/api/v1/notifications/unsubscribe?token=" + url.QueryEscape(token)
+}
+
+func signUnsubscribe(payload []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(utils.GetEnv("SECRET_KEY")))
+	mac.Write([]byte("unsubscribe:"))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// ConfirmUnsubscribe checks a signed unsubscribe link without applying it and
+// returns what it would turn off. Links are only applied on POST, as mail
+// scanners and prefetchers follow them with GET.
+func (s *DigestService) ConfirmUnsubscribe(token string) (string, error) {
+	claims, err := parseUnsubscribeToken(token)
+	if err != nil {
+		return "", err
+	}
+	if claims.CourseID != "" {
+		return "Stop receiving notifications from this course?", nil
+	}
+	return "Unsubscribe from email digests?", nil
+}
+
+// Unsubscribe applies a signed unsubscribe link and returns what was turned
+// off. Links do not expire so old emails keep working.
+func (s *DigestService) Unsubscribe(token string) (string, error) {
+	claims, err := parseUnsubscribeToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	if claims.CourseID != "" {
+		if err := s.preferenceStorage.MuteCourse(claims.UserID, claims.CourseID, nil); err != nil {
+			return "", err
+		}
+		return "You will no longer receive notifications from this course.", nil
+	}
+
+	if err := s.storage.SetFrequency(claims.UserID, types.DigestOff); err != nil {
+		return "", err
+	}
+	return "You have been unsubscribed from email digests.", nil
+}
+
+func parseUnsubscribeToken(token string) (*unsubscribeClaims, error) {
+	invalid := &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid unsubscribe link"}
+
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, invalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, invalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, signUnsubscribe(payload)) {
+		return nil, invalid
+	}
+
+	var claims unsubscribeClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.UserID == "" {
+		return nil, invalid
+	}
+	return &claims, nil
+}
@@ -4,8 +4,11 @@ import (
 	"course-flow/internal/types"
 	"course-flow/internal/storage"
 	"course-flow/internal/utils"
+	"database/sql"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"net/http"
 	"os"
@@ -84,6 +87,7 @@ func (s *DocumentService) SaveFilesToLocal(fileHeaders []*multipart.FileHeader,
 				FileName:  fh.Filename,
 				FilePath:  filePath,
 				FileType:  fileType,
+				FileSize:  fh.Size,
 				CreatedAt: time.Now(),
 				UpdatedAt: time.Now(),
 			}
@@ -117,6 +121,138 @@ func (s *DocumentService) SaveFilesToLocal(fileHeaders []*multipart.FileHeader,
 	return files, nil
 }
 
+// Limits for files shared in chat
+const (
+	MaxChatUploadSize  = 10 << 20
+	MaxChatAttachments = 5
+)
+
+// chatUploadTypes maps the file extensions accepted in chat to the content
+// type prefixes they have to sniff as, so a renamed executable is rejected.
+var chatUploadTypes = map[string][]string{
+	"png":  {"image/png"},
+	"jpg":  {"image/jpeg"},
+	"jpeg": {"image/jpeg"},
+	"gif":  {"image/gif"},
+	"webp": {"image/webp"},
+	"pdf":  {"application/pdf"},
+	"txt":  {"text/plain"},
+	"md":   {"text/plain"},
+	"csv":  {"text/plain", "text/csv"},
+	"zip":  {"application/zip"},
+	"docx": {"application/zip"},
+	"xlsx": {"application/zip"},
+	"pptx": {"application/zip"},
+}
+
+// thumbnailTypes are the extensions the server can generate a preview for.
+var thumbnailTypes = map[string]bool{"png": true, "jpg": true, "jpeg": true, "gif": true}
+
+// SaveChatUpload validates a file shared in chat against the size and type
+// limits and stores it. Thumbnails of images are generated by a background
+// job afterwards. The returned document is not attached to any message yet.
+func (s *DocumentService) SaveChatUpload(fh *multipart.FileHeader, userID string) (*types.Document, error) {
+	if fh.Size > MaxChatUploadSize {
+		return nil, &utils.ApiError{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("%s is larger than %d MB", fh.Filename, MaxChatUploadSize>>20),
+		}
+	}
+
+	fileType := strings.ToLower(strings.TrimPrefix(filepath.Ext(fh.Filename), "."))
+	allowedTypes, ok := chatUploadTypes[fileType]
+	if !ok {
+		return nil, &utils.ApiError{
+			Code:    http.StatusUnsupportedMediaType,
+			Message: fmt.Sprintf("Files of type .%s cannot be shared in chat", fileType),
+		}
+	}
+
+	file, err := fh.Open()
+	if err != nil {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Error opening file",
+		}
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Error reading file",
+		}
+	}
+	contentType := http.DetectContentType(head[:n])
+	matches := false
+	for _, prefix := range allowedTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			matches = true
+			break
+		}
+	}
+	if !matches {
+		return nil, &utils.ApiError{
+			Code:    http.StatusUnsupportedMediaType,
+			Message: fmt.Sprintf("The content of %s does not match its extension", fh.Filename),
+		}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind upload: %v", err)
+	}
+
+	filePath, err := s.SaveFileToLocal(file, fh.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &types.Document{
+		UserID:    userID,
+		FileName:  fh.Filename,
+		FilePath:  filePath,
+		FileType:  fileType,
+		FileSize:  fh.Size,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	var thumbnail *types.JobRequest
+	if thumbnailTypes[fileType] {
+		thumbnail = &types.JobRequest{Type: types.JobDocumentThumbnail}
+	}
+
+	if err := s.DocumentStorage.SaveUpload(doc, thumbnail); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// GenerateThumbnail writes the preview of an uploaded image. Documents that
+// already have one are skipped, and images that cannot be previewed are only
+// logged since retrying would not help.
+func (s *DocumentService) GenerateThumbnail(documentID string) error {
+	doc, err := s.DocumentStorage.GetDocument(documentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if doc.ThumbnailPath != "" {
+		return nil
+	}
+
+	thumbPath, err := generateThumbnail(doc.FilePath)
+	if err != nil {
+		log.Printf("Failed to generate thumbnail for %s: %v", doc.FilePath, err)
+		return nil
+	}
+	return s.DocumentStorage.SetThumbnail(documentID, thumbPath)
+}
+
 // UploadDocument saves the document metadata
 func (s *DocumentService) UploadDocument(userID, filePath, fileType, fileName string) (*types.Document, error) {
 	doc := &types.Document{
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"net/http"
+)
+
+// JobService lets admins inspect background jobs and retry the dead ones.
+type JobService struct {
+	storage     *storage.JobStorage
+	userStorage *storage.UserStorage
+}
+
+func NewJobService(storage *storage.JobStorage, userStorage *storage.UserStorage) *JobService {
+	return &JobService{
+		storage:     storage,
+		userStorage: userStorage,
+	}
+}
+
+func (s *JobService) GetJobs(userID string, page types.JobPage) ([]types.Job, error) {
+	if err := s.checkAdmin(userID); err != nil {
+		return nil, err
+	}
+	return s.storage.GetJobs(page)
+}
+
+func (s *JobService) GetJob(userID, jobID string) (*types.Job, error) {
+	if err := s.checkAdmin(userID); err != nil {
+		return nil, err
+	}
+	return s.storage.GetJob(jobID)
+}
+
+func (s *JobService) GetJobStats(userID string) ([]types.JobStats, error) {
+	if err := s.checkAdmin(userID); err != nil {
+		return nil, err
+	}
+	return s.storage.GetJobStats()
+}
+
+func (s *JobService) RetryJob(userID, jobID string) (*types.Job, error) {
+	if err := s.checkAdmin(userID); err != nil {
+		return nil, err
+	}
+	return s.storage.RetryJob(jobID)
+}
+
+func (s *JobService) checkAdmin(userID string) error {
+	isAdmin, err := s.userStorage.IsAdmin(userID)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "Only admins can manage jobs"}
+	}
+	return nil
+}
@@ -0,0 +1,693 @@
+package services
+
+import (
+	"bytes"
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"encoding/csv"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxModuleItemFiles bounds the files uploaded as items at once.
+	maxModuleItemFiles = 10
+	// maxModuleItemBody bounds the content of pages and instructions.
+	maxModuleItemBody = 100000
+	// maxModuleItemPoints bounds the points of assignments and quizzes.
+	maxModuleItemPoints = 10000
+)
+
+type ModuleService struct {
+	storage         *storage.ModuleStorage
+	documentService *DocumentService
+}
+
+func NewModuleService(storage *storage.ModuleStorage, documentService *DocumentService) *ModuleService {
+	return &ModuleService{
+		storage:         storage,
+		documentService: documentService,
+	}
+}
+
+func (s *ModuleService) CreateModule(userID, courseID string, req *types.CourseModuleRequest) (*types.CourseModule, error) {
+	if err := s.storage.CheckCourseStaff(courseID, userID); err != nil {
+		return nil, err
+	}
+
+	module, err := buildCourseModule(req)
+	if err != nil {
+		return nil, err
+	}
+	module.CourseID = courseID
+	module.CreatedBy = userID
+
+	if err := s.storage.CreateModule(module); err != nil {
+		return nil, err
+	}
+	return s.GetModule(userID, module.ID)
+}
+
+// GetModules returns the modules of a course in order with their items and
+// the user's progress. Students cannot see the content of locked items.
+func (s *ModuleService) GetModules(userID, courseID string) ([]*types.CourseModule, error) {
+	if err := s.storage.CheckCourseMember(courseID, userID); err != nil {
+		return nil, err
+	}
+	return s.courseModules(userID, courseID)
+}
+
+func (s *ModuleService) GetModule(userID, moduleID string) (*types.CourseModule, error) {
+	module, err := s.storage.GetModule(moduleID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CheckCourseMember(module.CourseID, userID); err != nil {
+		return nil, err
+	}
+
+	modules, err := s.courseModules(userID, module.CourseID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range modules {
+		if m.ID == moduleID {
+			return m, nil
+		}
+	}
+	return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Module not found"}
+}
+
+// UpdateModule replaces a module. Its prerequisites cannot require the
+// module in turn.
+func (s *ModuleService) UpdateModule(userID, moduleID string, req *types.CourseModuleRequest) (*types.CourseModule, error) {
+	existing, err := s.staffModule(userID, moduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	module, err := buildCourseModule(req)
+	if err != nil {
+		return nil, err
+	}
+	module.ID = moduleID
+	module.CourseID = existing.CourseID
+
+	modules, err := s.storage.GetModules(existing.CourseID)
+	if err != nil {
+		return nil, err
+	}
+	if requiresModule(modules, module.PrerequisiteIDs, moduleID) {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Prerequisites cannot depend on the module itself"}
+	}
+
+	if err := s.storage.UpdateModule(module); err != nil {
+		return nil, err
+	}
+	return s.GetModule(userID, moduleID)
+}
+
+func (s *ModuleService) DeleteModule(userID, moduleID string) error {
+	if _, err := s.staffModule(userID, moduleID); err != nil {
+		return err
+	}
+	return s.storage.DeleteModule(moduleID)
+}
+
+func (s *ModuleService) ReorderModules(userID, courseID string, req *types.ReorderRequest) ([]*types.CourseModule, error) {
+	if err := s.storage.CheckCourseStaff(courseID, userID); err != nil {
+		return nil, err
+	}
+	if err := checkOrder(req.IDs); err != nil {
+		return nil, err
+	}
+
+	if err := s.storage.ReorderModules(courseID, req.IDs); err != nil {
+		return nil, err
+	}
+	return s.courseModules(userID, courseID)
+}
+
+func (s *ModuleService) CreateItem(userID, moduleID string, req *types.ModuleItemRequest) (*types.ModuleItem, error) {
+	if _, err := s.staffModule(userID, moduleID); err != nil {
+		return nil, err
+	}
+	if req.Kind == types.ModuleItemAttachment {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Upload files to add attachments"}
+	}
+
+	item, err := buildModuleItem(req, req.Kind)
+	if err != nil {
+		return nil, err
+	}
+	item.ModuleID = moduleID
+	item.CreatedBy = userID
+
+	if err := s.storage.CreateItem(item); err != nil {
+		return nil, err
+	}
+	return s.GetItem(userID, item.ID)
+}
+
+// UploadItems stores the files and adds an attachment item for each of them,
+// returning the module. The title of the request names a single file;
+// otherwise the items are named after their files.
+func (s *ModuleService) UploadItems(userID, moduleID string, req *types.ModuleItemRequest, files []*multipart.FileHeader) (*types.CourseModule, error) {
+	if _, err := s.staffModule(userID, moduleID); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "At least one file is required"}
+	}
+	if len(files) > maxModuleItemFiles {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("At most %d files can be uploaded at once", maxModuleItemFiles),
+		}
+	}
+
+	title := req.Title
+	if len(files) > 1 {
+		title = ""
+	}
+	if title == "" {
+		title = truncateRunes(files[0].Filename, 200)
+	}
+	template, err := buildModuleItem(&types.ModuleItemRequest{Title: title, ReleaseAt: req.ReleaseAt}, types.ModuleItemAttachment)
+	if err != nil {
+		return nil, err
+	}
+
+	documents, err := s.documentService.SaveFilesToLocal(files, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range documents {
+		item := *template
+		if len(documents) > 1 {
+			item.Title = truncateRunes(documents[i].FileName, 200)
+		}
+		item.ModuleID = moduleID
+		item.Document = &documents[i]
+		item.CreatedBy = userID
+		if err := s.storage.CreateItem(&item); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetModule(userID, moduleID)
+}
+
+// GetItem returns an item with the user's progress. Students cannot see the
+// content of locked items.
+func (s *ModuleService) GetItem(userID, itemID string) (*types.ModuleItem, error) {
+	item, err := s.storage.GetItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	module, err := s.GetModule(userID, item.ModuleID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range module.Items {
+		if module.Items[i].ID == itemID {
+			return &module.Items[i], nil
+		}
+	}
+	return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Item not found"}
+}
+
+// UpdateItem replaces the content of an item. Its kind cannot change, and
+// attachments keep their file.
+func (s *ModuleService) UpdateItem(userID, itemID string, req *types.ModuleItemRequest) (*types.ModuleItem, error) {
+	existing, err := s.staffItem(userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := buildModuleItem(req, existing.Kind)
+	if err != nil {
+		return nil, err
+	}
+	item.ID = itemID
+
+	if err := s.storage.UpdateItem(item); err != nil {
+		return nil, err
+	}
+	return s.GetItem(userID, itemID)
+}
+
+func (s *ModuleService) DeleteItem(userID, itemID string) error {
+	if _, err := s.staffItem(userID, itemID); err != nil {
+		return err
+	}
+	return s.storage.DeleteItem(itemID)
+}
+
+func (s *ModuleService) ReorderItems(userID, moduleID string, req *types.ReorderRequest) (*types.CourseModule, error) {
+	if _, err := s.staffModule(userID, moduleID); err != nil {
+		return nil, err
+	}
+	if err := checkOrder(req.IDs); err != nil {
+		return nil, err
+	}
+
+	if err := s.storage.ReorderItems(moduleID, req.IDs); err != nil {
+		return nil, err
+	}
+	return s.GetModule(userID, moduleID)
+}
+
+// CompleteItem marks an item complete for the user. Locked items cannot be
+// completed.
+func (s *ModuleService) CompleteItem(userID, itemID string) (*types.ModuleItem, error) {
+	item, err := s.GetItem(userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if item.Locked {
+		return nil, &utils.ApiError{Code: http.StatusForbidden, Message: "This item is locked"}
+	}
+
+	if err := s.storage.CompleteItem(itemID, userID); err != nil {
+		return nil, err
+	}
+	return s.GetItem(userID, itemID)
+}
+
+func (s *ModuleService) UncompleteItem(userID, itemID string) (*types.ModuleItem, error) {
+	if _, err := s.GetItem(userID, itemID); err != nil {
+		return nil, err
+	}
+
+	if err := s.storage.UncompleteItem(itemID, userID); err != nil {
+		return nil, err
+	}
+	return s.GetItem(userID, itemID)
+}
+
+// GetProgress returns the progress matrix of a course: which items and
+// modules each student completed.
+func (s *ModuleService) GetProgress(userID, courseID string) (*types.CourseProgress, error) {
+	if err := s.storage.CheckCourseStaff(courseID, userID); err != nil {
+		return nil, err
+	}
+
+	modules, err := s.storage.GetModules(courseID)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.storage.GetItems(courseID)
+	if err != nil {
+		return nil, err
+	}
+	students, err := s.storage.GetStudents(courseID)
+	if err != nil {
+		return nil, err
+	}
+	completions, err := s.storage.GetCompletions(courseID, "")
+	if err != nil {
+		return nil, err
+	}
+	attachItems(modules, items)
+
+	byUser := map[string]map[string]time.Time{}
+	for _, completion := range completions {
+		if byUser[completion.UserID] == nil {
+			byUser[completion.UserID] = map[string]time.Time{}
+		}
+		byUser[completion.UserID][completion.ItemID] = completion.CompletedAt
+	}
+
+	progress := &types.CourseProgress{
+		Items:    []types.ProgressItem{},
+		Students: []types.StudentProgress{},
+	}
+	for _, module := range modules {
+		for _, item := range module.Items {
+			progress.Items = append(progress.Items, types.ProgressItem{
+				ID:          item.ID,
+				ModuleID:    module.ID,
+				ModuleTitle: module.Title,
+				Kind:        item.Kind,
+				Title:       item.Title,
+			})
+		}
+	}
+
+	for _, student := range students {
+		completed := byUser[student.ID]
+		row := types.StudentProgress{
+			User:               student,
+			Completed:          map[string]time.Time{},
+			CompletedModuleIDs: []string{},
+		}
+		for _, module := range modules {
+			done := completedItems(module.Items, completed)
+			if done == len(module.Items) {
+				row.CompletedModuleIDs = append(row.CompletedModuleIDs, module.ID)
+			}
+			row.CompletedItems += done
+		}
+		for _, item := range progress.Items {
+			if at, ok := completed[item.ID]; ok {
+				row.Completed[item.ID] = at
+			}
+		}
+		if len(progress.Items) > 0 {
+			row.Rate = float64(row.CompletedItems) / float64(len(progress.Items))
+		}
+		progress.Students = append(progress.Students, row)
+	}
+
+	return progress, nil
+}
+
+// courseModules loads the modules of a course with their items and applies
+// the user's progress to them.
+func (s *ModuleService) courseModules(userID, courseID string) ([]*types.CourseModule, error) {
+	isStaff, err := s.storage.IsCourseStaff(courseID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	modules, err := s.storage.GetModules(courseID)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.storage.GetItems(courseID)
+	if err != nil {
+		return nil, err
+	}
+	completions, err := s.storage.GetCompletions(courseID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	completed := map[string]time.Time{}
+	for _, completion := range completions {
+		completed[completion.ItemID] = completion.CompletedAt
+	}
+
+	attachItems(modules, items)
+	applyProgress(modules, completed, !isStaff, time.Now().UTC())
+	return modules, nil
+}
+
+func (s *ModuleService) staffModule(userID, moduleID string) (*types.CourseModule, error) {
+	module, err := s.storage.GetModule(moduleID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CheckCourseStaff(module.CourseID, userID); err != nil {
+		return nil, err
+	}
+	return module, nil
+}
+
+func (s *ModuleService) staffItem(userID, itemID string) (*types.ModuleItem, error) {
+	item, err := s.storage.GetItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CheckCourseStaff(item.CourseID, userID); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// ProgressCSV renders the progress matrix as CSV, one row per student and
+// item.
+func ProgressCSV(progress *types.CourseProgress) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{
+		"user_id", "first_name", "last_name", "email", "module_id", "module",
+		"item_id", "item", "kind", "completed_at",
+	})
+
+	for _, student := range progress.Students {
+		for _, item := range progress.Items {
+			var completedAt string
+			if at, ok := student.Completed[item.ID]; ok {
+				completedAt = at.UTC().Format(time.RFC3339)
+			}
+			w.Write([]string{
+				student.User.ID,
+				csvCell(student.User.FirstName),
+				csvCell(student.User.LastName),
+				csvCell(student.User.Email),
+				item.ModuleID,
+				csvCell(item.ModuleTitle),
+				item.ID,
+				csvCell(item.Title),
+				item.Kind,
+				completedAt,
+			})
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write progress CSV: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// attachItems puts the items, which are in course order, into their modules.
+func attachItems(modules []*types.CourseModule, items []types.ModuleItem) {
+	byID := map[string]*types.CourseModule{}
+	for _, module := range modules {
+		byID[module.ID] = module
+	}
+	for _, item := range items {
+		if module, ok := byID[item.ModuleID]; ok {
+			module.Items = append(module.Items, item)
+		}
+	}
+}
+
+// applyProgress marks the completed items and modules. For students it also
+// locks modules that are not released yet or whose prerequisites are not
+// complete, and items that are not released yet, leaving out their content.
+func applyProgress(modules []*types.CourseModule, completed map[string]time.Time, lock bool, now time.Time) {
+	byID := map[string]*types.CourseModule{}
+	for _, module := range modules {
+		byID[module.ID] = module
+		for i := range module.Items {
+			item := &module.Items[i]
+			if at, ok := completed[item.ID]; ok {
+				item.Completed = true
+				item.CompletedAt = &at
+			}
+		}
+		module.CompletedItems = completedItems(module.Items, completed)
+		module.Completed = module.CompletedItems == len(module.Items)
+	}
+	if !lock {
+		return
+	}
+
+	for _, module := range modules {
+		if module.ReleaseAt != nil && module.ReleaseAt.After(now) {
+			module.Locked, module.LockReason = true, types.LockNotReleased
+		} else {
+			for _, id := range module.PrerequisiteIDs {
+				if prerequisite, ok := byID[id]; ok && !prerequisite.Completed {
+					module.Locked, module.LockReason = true, types.LockPrerequisites
+					break
+				}
+			}
+		}
+
+		for i := range module.Items {
+			item := &module.Items[i]
+			if module.Locked {
+				item.Locked, item.LockReason = true, module.LockReason
+			} else if item.ReleaseAt != nil && item.ReleaseAt.After(now) {
+				item.Locked, item.LockReason = true, types.LockNotReleased
+			}
+			if item.Locked {
+				item.Body, item.URL, item.Document = "", "", nil
+			}
+		}
+	}
+}
+
+func completedItems(items []types.ModuleItem, completed map[string]time.Time) int {
+	count := 0
+	for _, item := range items {
+		if _, ok := completed[item.ID]; ok {
+			count++
+		}
+	}
+	return count
+}
+
+// requiresModule reports whether any of the prerequisites requires the
+// module, directly or through their own prerequisites.
+func requiresModule(modules []*types.CourseModule, prerequisiteIDs []string, moduleID string) bool {
+	byID := map[string]*types.CourseModule{}
+	for _, module := range modules {
+		byID[module.ID] = module
+	}
+
+	seen := map[string]bool{}
+	pending := slices.Clone(prerequisiteIDs)
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if id == moduleID {
+			return true
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if module, ok := byID[id]; ok {
+			pending = append(pending, module.PrerequisiteIDs...)
+		}
+	}
+	return false
+}
+
+func checkOrder(ids []string) error {
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			return &utils.ApiError{Code: http.StatusBadRequest, Message: "ids must not repeat"}
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// buildCourseModule validates a request and turns it into a module.
+func buildCourseModule(req *types.CourseModuleRequest) (*types.CourseModule, error) {
+	module := &types.CourseModule{
+		Title:           strings.TrimSpace(req.Title),
+		Description:     strings.TrimSpace(req.Description),
+		PrerequisiteIDs: []string{},
+	}
+
+	if module.Title == "" {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Title is required"}
+	}
+	if utf8.RuneCountInString(module.Title) > 200 {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Title must be at most 200 characters"}
+	}
+	if utf8.RuneCountInString(module.Description) > maxModuleItemBody {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Description must be at most %d characters", maxModuleItemBody),
+		}
+	}
+
+	releaseAt, err := parseOptionalTime(req.ReleaseAt, "release_at")
+	if err != nil {
+		return nil, err
+	}
+	module.ReleaseAt = releaseAt
+
+	for _, id := range req.PrerequisiteIDs {
+		if !slices.Contains(module.PrerequisiteIDs, id) {
+			module.PrerequisiteIDs = append(module.PrerequisiteIDs, id)
+		}
+	}
+
+	return module, nil
+}
+
+// buildModuleItem validates a request and turns it into an item of the
+// kind. Fields the kind does not use are dropped.
+func buildModuleItem(req *types.ModuleItemRequest, kind string) (*types.ModuleItem, error) {
+	if !slices.Contains(types.ModuleItemKinds, kind) {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "kind must be one of " + strings.Join(types.ModuleItemKinds, ", "),
+		}
+	}
+
+	item := &types.ModuleItem{
+		Kind:  kind,
+		Title: strings.TrimSpace(req.Title),
+	}
+	if item.Title == "" {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Title is required"}
+	}
+	if utf8.RuneCountInString(item.Title) > 200 {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Title must be at most 200 characters"}
+	}
+
+	releaseAt, err := parseOptionalTime(req.ReleaseAt, "release_at")
+	if err != nil {
+		return nil, err
+	}
+	item.ReleaseAt = releaseAt
+
+	switch kind {
+	case types.ModuleItemLink:
+		item.URL = strings.TrimSpace(req.URL)
+		u, err := url.Parse(item.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "url must be an http or https URL"}
+		}
+	case types.ModuleItemPage, types.ModuleItemAssignment, types.ModuleItemQuiz:
+		item.Body = req.Body
+		if utf8.RuneCountInString(item.Body) > maxModuleItemBody {
+			return nil, &utils.ApiError{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("body must be at most %d characters", maxModuleItemBody),
+			}
+		}
+	}
+
+	if kind == types.ModuleItemAssignment || kind == types.ModuleItemQuiz {
+		dueAt, err := parseOptionalTime(req.DueAt, "due_at")
+		if err != nil {
+			return nil, err
+		}
+		item.DueAt = dueAt
+
+		if req.Points != nil {
+			if *req.Points < 0 || *req.Points > maxModuleItemPoints {
+				return nil, &utils.ApiError{
+					Code:    http.StatusBadRequest,
+					Message: fmt.Sprintf("points must be between 0 and %d", maxModuleItemPoints),
+				}
+			}
+			item.Points = req.Points
+		}
+	}
+
+	return item, nil
+}
+
+// parseOptionalTime parses an RFC 3339 time, returning nil when it is empty.
+func parseOptionalTime(value, field string) (*time.Time, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+	if err != nil {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: field + " must be an RFC 3339 time"}
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -7,15 +7,22 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// messageGroupWindow is how long new chat messages keep being grouped into
+// the same unread notification.
+const messageGroupWindow = time.Hour
+
 type NotificationService struct {
 	courseMemberStorage *storage.CourseMemberStorage
 	notificationStorage *storage.NotificationStorage
 	postStorage         *storage.PostStorage
 	courseStorage       *storage.CourseStorage
 	userStorage         *storage.UserStorage
+	preferenceStorage   *storage.NotificationPreferenceStorage
 }
 
 func NewNotificationService(db *sql.DB) *NotificationService {
@@ -25,6 +32,7 @@ func NewNotificationService(db *sql.DB) *NotificationService {
 		postStorage:         storage.NewPostStorage(db),
 		courseStorage:       storage.NewCourseStorage(db),
 		userStorage:         storage.NewUserStorage(db),
+		preferenceStorage:   storage.NewNotificationPreferenceStorage(db),
 	}
 }
 
@@ -76,8 +84,10 @@ func (s *NotificationService) CreateMessageSentNotification(payload types.NotifM
 		Data:      payload.Data,
 	}
 
-	// Store in database
-	createdNotifications, err := s.notificationStorage.CreateNotifications([]types.Notification{notification})
+	// Store in database, following the recipients' preferences. Messages are
+	// grouped into one unread notification per course and recipient.
+	groupFormat := fmt.Sprintf("%%s new messages in \"%s\"", strings.ReplaceAll(className, "%", "%%"))
+	createdNotifications, err := s.deliverGrouped(notification, messageGroupWindow, groupFormat)
 	if err != nil {
 		return nil, fmt.Errorf("failed to store notification: %v", err)
 	}
@@ -85,7 +95,7 @@ func (s *NotificationService) CreateMessageSentNotification(payload types.NotifM
 	return createdNotifications, nil
 }
 
-func (s *NotificationService) ChangeRoleNotification(classID, userID string, role int) ([]types.Notification, error) {
+func (s *NotificationService) ChangeRoleNotification(eventID, classID, userID string, role int) ([]types.Notification, error) {
 	className, err := s.courseStorage.GetCourseName(classID)
 	if err != nil {
 		return nil, err
@@ -111,15 +121,16 @@ func (s *NotificationService) ChangeRoleNotification(classID, userID string, rol
 	}
 
 	notification := types.Notification{
-		Type:         types.TypeRoleChanged,
-		ClassID:      classID,
-		RecipientIDs: []string{user.ID},
-		Message:      message,
-		Timestamp:    time.Now().UTC(),
+		Type:          types.TypeRoleChanged,
+		OutboxEventID: eventID,
+		ClassID:       classID,
+		RecipientIDs:  []string{user.ID},
+		Message:       message,
+		Timestamp:     time.Now().UTC(),
 	}
 
-	// Store in database
-	createdNotifications, err := s.notificationStorage.CreateNotifications([]types.Notification{notification})
+	// Store in database, following the recipients' preferences
+	createdNotifications, err := s.deliver(notification)
 	if err != nil {
 		return nil, err
 	}
@@ -127,7 +138,7 @@ func (s *NotificationService) ChangeRoleNotification(classID, userID string, rol
 	return createdNotifications, nil
 }
 
-func (s *NotificationService) UserKickedNotification(payload types.NotifKickedResponse) ([]types.Notification, error) {
+func (s *NotificationService) UserKickedNotification(eventID string, payload types.NotifKickedResponse) ([]types.Notification, error) {
 	className, err := s.courseStorage.GetCourseName(payload.ClassID)
 	if err != nil {
 		return nil, err
@@ -139,16 +150,17 @@ func (s *NotificationService) UserKickedNotification(payload types.NotifKickedRe
 	}
 
 	notification := types.Notification{
-		Type:         types.TypeUserKicked,
-		ClassID:      payload.ClassID,
-		RecipientIDs: []string{kickedUser.ID},
-		Message:      fmt.Sprintf("You have been kicked out from the class \"%s\"", className),
-		Timestamp:    time.Now().UTC(),
-		Data:         payload.Data,
+		Type:          types.TypeUserKicked,
+		OutboxEventID: eventID,
+		ClassID:       payload.ClassID,
+		RecipientIDs:  []string{kickedUser.ID},
+		Message:       fmt.Sprintf("You have been kicked out from the class \"%s\"", className),
+		Timestamp:     time.Now().UTC(),
+		Data:          payload.Data,
 	}
 
-	// Store in database
-	createdNotifications, err := s.notificationStorage.CreateNotifications([]types.Notification{notification})
+	// Store in database, following the recipients' preferences
+	createdNotifications, err := s.deliver(notification)
 	if err != nil {
 		return nil, err
 	}
@@ -156,7 +168,50 @@ func (s *NotificationService) UserKickedNotification(payload types.NotifKickedRe
 	return createdNotifications, nil
 }
 
-func (s *NotificationService) CreateCommentAddedNotification(payload types.NotifCommentCreatedResponse) ([]types.Notification, error) {
+// OfficeHourReminderNotification reminds a student of a booked office hours
+// slot.
+func (s *NotificationService) OfficeHourReminderNotification(eventID string, payload types.OfficeHourReminder) ([]types.Notification, error) {
+	message := fmt.Sprintf("Your office hours \"%s\" start soon", payload.Title)
+	if payload.Location != "" {
+		message = fmt.Sprintf("Your office hours \"%s\" start soon in %s", payload.Title, payload.Location)
+	}
+
+	notification := types.Notification{
+		Type:          types.TypeOfficeHourReminder,
+		OutboxEventID: eventID,
+		ClassID:       payload.CourseID,
+		RecipientIDs:  []string{payload.UserID},
+		Message:       message,
+		Timestamp:     time.Now().UTC(),
+		Data:          payload,
+	}
+
+	// Store in database, following the recipients' preferences
+	return s.deliver(notification)
+}
+
+// GradeReturnedNotification tells a student that their work was graded.
+func (s *NotificationService) GradeReturnedNotification(eventID string, payload types.GradeReturned) ([]types.Notification, error) {
+	notification := types.Notification{
+		Type:          types.TypeGradeReturned,
+		OutboxEventID: eventID,
+		ClassID:       payload.CourseID,
+		RecipientIDs:  []string{payload.UserID},
+		Message: fmt.Sprintf(
+			"Your work for \"%s\" was graded: %s of %s points",
+			payload.ItemTitle,
+			strconv.FormatFloat(payload.Score, 'f', -1, 64),
+			strconv.FormatFloat(payload.MaxScore, 'f', -1, 64),
+		),
+		Timestamp: time.Now().UTC(),
+		Data:      payload,
+	}
+
+	// Store in database, following the recipients' preferences
+	return s.deliver(notification)
+}
+
+func (s *NotificationService) CreateCommentAddedNotification(eventID string, payload types.NotifCommentCreatedResponse) ([]types.Notification, error) {
 	whoCreated, tempRecipientIDs, err := s.postStorage.GetAllCommentedUserForPost(payload.PostID, payload.CommentID)
 	if err != nil {
 		return nil, err
@@ -188,9 +243,10 @@ func (s *NotificationService) CreateCommentAddedNotification(payload types.Notif
 		payload.Data["user"] = whoCreated
 	}
 	notification := types.Notification{
-		Type:         types.TypeCommentAdded,
-		ClassID:      payload.ClassID,
-		RecipientIDs: recipientIDs,
+		Type:          types.TypeCommentAdded,
+		OutboxEventID: eventID,
+		ClassID:       payload.ClassID,
+		RecipientIDs:  recipientIDs,
 		Message: fmt.Sprintf(
 			"%s %s just commented on %s %s's post in \"%s\". Check out the discussion!",
 			whoCreated.FirstName,
@@ -202,8 +258,8 @@ func (s *NotificationService) CreateCommentAddedNotification(payload types.Notif
 		Timestamp: time.Now().UTC(),
 		Data:      payload.Data,
 	}
-	// Store in database
-	createdNotifications, err := s.notificationStorage.CreateNotifications([]types.Notification{notification})
+	// Store in database, following the recipients' preferences
+	createdNotifications, err := s.deliver(notification)
 	if err != nil {
 		return nil, err
 	}
@@ -211,7 +267,7 @@ func (s *NotificationService) CreateCommentAddedNotification(payload types.Notif
 	return createdNotifications, nil
 }
 
-func (s *NotificationService) CreatePostCreatedNotifications(classID, postContent, creatorID string) ([]types.Notification, error) {
+func (s *NotificationService) CreatePostCreatedNotifications(eventID, classID, postContent, creatorID string) ([]types.Notification, error) {
 	// Fetch all class members
 	members, err := s.courseMemberStorage.GetAllMember(classID)
 	if err != nil {
@@ -243,16 +299,17 @@ func (s *NotificationService) CreatePostCreatedNotifications(classID, postConten
 
 	// Prepare notification
 	notification := types.Notification{
-		Type:         types.TypePostCreated,
-		ClassID:      classID,
-		RecipientIDs: recipientIDs,
-		Message:      fmt.Sprintf("New post in %s by %s", className, name),
-		Data:         map[string]string{"creatorId": creatorID, "content": postContent},
-		Timestamp:    time.Now().UTC(),
+		Type:          types.TypePostCreated,
+		OutboxEventID: eventID,
+		ClassID:       classID,
+		RecipientIDs:  recipientIDs,
+		Message:       fmt.Sprintf("New post in %s by %s", className, name),
+		Data:          map[string]string{"creatorId": creatorID, "content": postContent},
+		Timestamp:     time.Now().UTC(),
 	}
 
-	// Store in database
-	createdNotifications, err := s.notificationStorage.CreateNotifications([]types.Notification{notification})
+	// Store in database, following the recipients' preferences
+	createdNotifications, err := s.deliver(notification)
 	if err != nil {
 		return nil, err
 	}
@@ -260,6 +317,147 @@ func (s *NotificationService) CreatePostCreatedNotifications(classID, postConten
 	return createdNotifications, nil
 }
 
+// deliver stores a notification following the preferences of its recipients
+// and returns the notifications to push in-app. Recipients who chose the email
+// digest only get a stored row, and those who turned the type off or muted the
+// course get nothing.
+func (s *NotificationService) deliver(notification types.Notification) ([]types.Notification, error) {
+	return s.deliverGrouped(notification, 0, "")
+}
+
+// deliverGrouped is deliver for frequent events. When window is positive, a
+// recipient with an unread notification of the same type and course updated
+// within the window has it updated in place, with its message built from
+// groupFormat and the new count, instead of receiving a new one.
+func (s *NotificationService) deliverGrouped(notification types.Notification, window time.Duration, groupFormat string) ([]types.Notification, error) {
+	if len(notification.RecipientIDs) == 0 {
+		return nil, nil
+	}
+
+	channels, err := s.preferenceStorage.GetChannels(notification.RecipientIDs, notification.Type, notification.ClassID)
+	if err != nil {
+		return nil, err
+	}
+
+	byChannel := make(map[string][]string)
+	for _, recipientID := range notification.RecipientIDs {
+		channel := channels[recipientID]
+		if channel == "" {
+			channel = types.ChannelInApp
+		}
+		byChannel[channel] = append(byChannel[channel], recipientID)
+	}
+
+	var inApp []types.Notification
+	for _, channel := range []string{types.ChannelInApp, types.ChannelEmail} {
+		if len(byChannel[channel]) == 0 {
+			continue
+		}
+		notif := notification
+		notif.RecipientIDs = byChannel[channel]
+		notif.Delivery = channel
+
+		var created []types.Notification
+		if window > 0 {
+			created, err = s.notificationStorage.CoalesceNotifications(notif, time.Now().UTC().Add(-window), groupFormat)
+		} else {
+			created, err = s.notificationStorage.CreateNotifications([]types.Notification{notif})
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if channel == types.ChannelInApp {
+			inApp = created
+		}
+	}
+
+	if err := s.setUnreadCounts(inApp); err != nil {
+		return nil, err
+	}
+	return inApp, nil
+}
+
+// setUnreadCounts adds the recipient's unread count to notifications about to
+// be pushed, so clients update their badge without refetching.
+func (s *NotificationService) setUnreadCounts(notifications []types.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	var userIDs []string
+	for _, notif := range notifications {
+		userIDs = append(userIDs, notif.RecipientIDs...)
+	}
+
+	counts, err := s.notificationStorage.GetUnreadCounts(userIDs)
+	if err != nil {
+		return err
+	}
+	for i := range notifications {
+		notifications[i].UnreadCount = counts[notifications[i].RecipientIDs[0]]
+	}
+	return nil
+}
+
+func (s *NotificationService) GetPreferences(userID string) (*types.NotificationPreferences, error) {
+	preferences, err := s.preferenceStorage.GetPreferences(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	mutes, err := s.preferenceStorage.GetCourseMutes(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.NotificationPreferences{Preferences: preferences, MutedCourses: mutes}, nil
+}
+
+func (s *NotificationService) SetPreference(userID string, preference *types.NotificationPreference) error {
+	validType := false
+	for _, notifType := range types.NotificationTypes {
+		if preference.Type == notifType {
+			validType = true
+			break
+		}
+	}
+	if !validType {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("Unknown notification type %q", preference.Type)}
+	}
+
+	switch preference.Channel {
+	case types.ChannelInApp, types.ChannelEmail, types.ChannelOff:
+	default:
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Channel must be in_app, email or off"}
+	}
+
+	return s.preferenceStorage.SetPreference(userID, preference)
+}
+
+// MuteCourse silences every notification of a course for the user, for the
+// given number of minutes or until unmuted when it is 0.
+func (s *NotificationService) MuteCourse(userID, courseID string, durationMinutes int) (*types.NotificationCourseMute, error) {
+	if durationMinutes < 0 {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Duration cannot be negative"}
+	}
+
+	var mutedUntil *time.Time
+	if durationMinutes > 0 {
+		until := time.Now().UTC().Add(time.Duration(durationMinutes) * time.Minute)
+		mutedUntil = &until
+	}
+
+	if err := s.preferenceStorage.MuteCourse(userID, courseID, mutedUntil); err != nil {
+		return nil, err
+	}
+	return &types.NotificationCourseMute{CourseID: courseID, MutedUntil: mutedUntil}, nil
+}
+
+func (s *NotificationService) UnmuteCourse(userID, courseID string) error {
+	return s.preferenceStorage.UnmuteCourse(userID, courseID)
+}
+
 func (s *NotificationService) GetUserNotifications(userID string) ([]types.Notification, error) {
 	return s.notificationStorage.GetUserNotifications(userID)
 }
@@ -0,0 +1,488 @@
+package services
+
+import (
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// reminderLead is how long before a booked slot the student is reminded.
+	reminderLead = 15 * time.Minute
+	// queueOpensBefore is how early students can line up for drop-ins.
+	queueOpensBefore = 15 * time.Minute
+	// maxOfficeHourLength bounds a single window.
+	maxOfficeHourLength = 12 * time.Hour
+	// maxSlotCapacity bounds the students sharing a slot.
+	maxSlotCapacity = 50
+)
+
+type OfficeHourService struct {
+	storage *storage.OfficeHourStorage
+}
+
+func NewOfficeHourService(storage *storage.OfficeHourStorage) *OfficeHourService {
+	return &OfficeHourService{
+		storage: storage,
+	}
+}
+
+func (s *OfficeHourService) CreateOfficeHour(userID, courseID string, req *types.OfficeHourRequest) (*types.OfficeHour, error) {
+	if err := s.storage.CheckCourseStaff(courseID, userID); err != nil {
+		return nil, err
+	}
+
+	officeHour, err := buildOfficeHour(req, "")
+	if err != nil {
+		return nil, err
+	}
+	officeHour.CourseID = courseID
+	officeHour.Host.ID = userID
+
+	if err := s.storage.CreateOfficeHour(officeHour); err != nil {
+		return nil, err
+	}
+	return s.GetOfficeHour(userID, officeHour.ID)
+}
+
+// GetOfficeHours returns the office hours of a course that have not ended.
+func (s *OfficeHourService) GetOfficeHours(userID, courseID string) ([]*types.OfficeHour, error) {
+	if err := s.storage.CheckCourseMember(courseID, userID); err != nil {
+		return nil, err
+	}
+	return s.storage.GetOfficeHours(courseID, time.Now().UTC())
+}
+
+// GetOfficeHour returns a window with its slots. Staff also see who booked
+// them.
+func (s *OfficeHourService) GetOfficeHour(userID, officeHourID string) (*types.OfficeHour, error) {
+	officeHour, err := s.storage.GetOfficeHour(officeHourID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CheckCourseMember(officeHour.CourseID, userID); err != nil {
+		return nil, err
+	}
+	if officeHour.Mode != types.OfficeHourModeBooking {
+		return officeHour, nil
+	}
+
+	bookings, err := s.storage.GetBookings(officeHourID)
+	if err != nil {
+		return nil, err
+	}
+	officeHour.Slots = buildSlots(officeHour, bookings, userID)
+
+	isStaff, err := s.storage.IsCourseStaff(officeHour.CourseID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if isStaff {
+		officeHour.Bookings = bookings
+	}
+	return officeHour, nil
+}
+
+// UpdateOfficeHour changes a window. Its mode stays the same, and its times
+// only change while nobody booked it.
+func (s *OfficeHourService) UpdateOfficeHour(userID, officeHourID string, req *types.OfficeHourRequest) (*types.OfficeHour, error) {
+	existing, err := s.staffOfficeHour(userID, officeHourID)
+	if err != nil {
+		return nil, err
+	}
+
+	officeHour, err := buildOfficeHour(req, existing.Mode)
+	if err != nil {
+		return nil, err
+	}
+	officeHour.ID = existing.ID
+	officeHour.CourseID = existing.CourseID
+	officeHour.Host = existing.Host
+
+	slotsChanged := !officeHour.StartsAt.Equal(existing.StartsAt) ||
+		!officeHour.EndsAt.Equal(existing.EndsAt) ||
+		officeHour.SlotMinutes != existing.SlotMinutes
+	if err := s.storage.UpdateOfficeHour(officeHour, slotsChanged); err != nil {
+		return nil, err
+	}
+	return s.GetOfficeHour(userID, officeHourID)
+}
+
+func (s *OfficeHourService) DeleteOfficeHour(userID, officeHourID string) error {
+	if _, err := s.staffOfficeHour(userID, officeHourID); err != nil {
+		return err
+	}
+	return s.storage.DeleteOfficeHour(officeHourID)
+}
+
+// BookSlot books the slot starting at req.StartsAt for the user and schedules
+// a reminder shortly before it.
+func (s *OfficeHourService) BookSlot(userID, officeHourID string, req *types.OfficeHourBookingRequest) (*types.OfficeHourBooking, error) {
+	officeHour, err := s.storage.GetOfficeHour(officeHourID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CheckCourseMember(officeHour.CourseID, userID); err != nil {
+		return nil, err
+	}
+	if officeHour.Mode != types.OfficeHourModeBooking {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "These office hours take drop-ins, join the queue instead"}
+	}
+	if officeHour.Host.ID == userID {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "You cannot book your own office hours"}
+	}
+
+	startsAt, err := time.Parse(time.RFC3339, req.StartsAt)
+	if err != nil {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "starts_at must be an RFC 3339 time"}
+	}
+	startsAt = startsAt.UTC()
+
+	slot := time.Duration(officeHour.SlotMinutes) * time.Minute
+	offset := startsAt.Sub(officeHour.StartsAt)
+	if offset < 0 || offset%slot != 0 || startsAt.Add(slot).After(officeHour.EndsAt) {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "starts_at must be the start of a slot"}
+	}
+	now := time.Now().UTC()
+	if !startsAt.After(now) {
+		return nil, &utils.ApiError{Code: http.StatusConflict, Message: "This slot has already started"}
+	}
+
+	note := strings.TrimSpace(req.Note)
+	if utf8.RuneCountInString(note) > 500 {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "note must be at most 500 characters"}
+	}
+
+	booking := &types.OfficeHourBooking{
+		OfficeHourID: officeHourID,
+		CourseID:     officeHour.CourseID,
+		Title:        officeHour.Title,
+		Location:     officeHour.Location,
+		User:         types.User{ID: userID},
+		StartsAt:     startsAt,
+		EndsAt:       startsAt.Add(slot),
+		Note:         note,
+	}
+
+	var reminder *types.JobRequest
+	if remindAt := startsAt.Add(-reminderLead); remindAt.After(now) {
+		reminder = &types.JobRequest{Type: types.JobOfficeHourReminder, RunAt: remindAt}
+	}
+
+	if err := s.storage.CreateBooking(booking, officeHour.Capacity, reminder); err != nil {
+		return nil, err
+	}
+	return s.storage.GetBooking(booking.ID)
+}
+
+// CancelBooking cancels a booking. Students can cancel their own bookings
+// until the slot starts; staff can cancel any booking.
+func (s *OfficeHourService) CancelBooking(userID, bookingID string) error {
+	booking, err := s.storage.GetBooking(bookingID)
+	if err != nil {
+		return err
+	}
+
+	isStaff, err := s.storage.IsCourseStaff(booking.CourseID, userID)
+	if err != nil {
+		return err
+	}
+	if !isStaff {
+		if booking.User.ID != userID {
+			return &utils.ApiError{Code: http.StatusForbidden, Message: "You can only cancel your own bookings"}
+		}
+		if !booking.StartsAt.After(time.Now().UTC()) {
+			return &utils.ApiError{Code: http.StatusConflict, Message: "This slot has already started"}
+		}
+	}
+
+	return s.storage.DeleteBooking(bookingID)
+}
+
+// GetMyBookings returns the user's bookings that have not ended.
+func (s *OfficeHourService) GetMyBookings(userID string) ([]types.OfficeHourBooking, error) {
+	return s.storage.GetUserBookings(userID, time.Now().UTC())
+}
+
+// SendReminder hands the reminder of a booking to the notifiers. Cancelled
+// bookings are skipped.
+func (s *OfficeHourService) SendReminder(bookingID string) error {
+	return s.storage.QueueReminder(bookingID)
+}
+
+// GetQueue returns the queue of a drop-in window. Students only see their
+// own entry.
+func (s *OfficeHourService) GetQueue(userID, officeHourID string) (*types.OfficeHourQueue, error) {
+	officeHour, err := s.queueOfficeHour(userID, officeHourID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.storage.GetQueue(officeHourID)
+	if err != nil {
+		return nil, err
+	}
+	queue := buildQueue(officeHour, entries)
+
+	isStaff, err := s.storage.IsCourseStaff(officeHour.CourseID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isStaff {
+		own := []types.QueueEntry{}
+		for _, entry := range queue.Entries {
+			if entry.User.ID == userID {
+				own = append(own, entry)
+			}
+		}
+		queue.Entries = own
+	}
+	return queue, nil
+}
+
+// JoinQueue lines the user up for a drop-in window that is about to start or
+// running, and returns the updates for the people following the queue.
+func (s *OfficeHourService) JoinQueue(userID, officeHourID string, req *types.QueueJoinRequest) ([]types.QueueUpdate, error) {
+	officeHour, err := s.queueOfficeHour(userID, officeHourID)
+	if err != nil {
+		return nil, err
+	}
+
+	if officeHour.Host.ID == userID {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "You cannot join the queue of your own office hours"}
+	}
+
+	now := time.Now().UTC()
+	if now.Before(officeHour.StartsAt.Add(-queueOpensBefore)) || !now.Before(officeHour.EndsAt) {
+		return nil, &utils.ApiError{Code: http.StatusConflict, Message: "The queue is not open"}
+	}
+
+	note := strings.TrimSpace(req.Note)
+	if utf8.RuneCountInString(note) > 500 {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "note must be at most 500 characters"}
+	}
+
+	if err := s.storage.JoinQueue(officeHourID, userID, note); err != nil {
+		return nil, err
+	}
+	return s.queueUpdates(officeHour, nil)
+}
+
+func (s *OfficeHourService) LeaveQueue(userID, officeHourID string) ([]types.QueueUpdate, error) {
+	officeHour, err := s.queueOfficeHour(userID, officeHourID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.storage.LeaveQueue(officeHourID, userID); err != nil {
+		return nil, err
+	}
+	return s.queueUpdates(officeHour, nil)
+}
+
+// NextInQueue finishes the current student and calls the next one.
+func (s *OfficeHourService) NextInQueue(userID, officeHourID string) ([]types.QueueUpdate, error) {
+	officeHour, err := s.queueOfficeHour(userID, officeHourID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CheckCourseStaff(officeHour.CourseID, userID); err != nil {
+		return nil, err
+	}
+
+	finished, err := s.storage.NextInQueue(officeHourID)
+	if err != nil {
+		return nil, err
+	}
+	return s.queueUpdates(officeHour, finished)
+}
+
+// queueUpdates tells every student in the queue where they stand, the
+// finished students that they are done, and the staff how the queue looks.
+func (s *OfficeHourService) queueUpdates(officeHour *types.OfficeHour, finished []string) ([]types.QueueUpdate, error) {
+	entries, err := s.storage.GetQueue(officeHour.ID)
+	if err != nil {
+		return nil, err
+	}
+	queue := buildQueue(officeHour, entries)
+
+	frame := types.OfficeHourQueueFrame{
+		Type:         types.FrameOfficeHourQueue,
+		OfficeHourID: officeHour.ID,
+		CourseID:     officeHour.CourseID,
+		Waiting:      queue.Waiting,
+	}
+
+	var updates []types.QueueUpdate
+	for _, entry := range queue.Entries {
+		update := frame
+		update.Status = entry.Status
+		update.Position = entry.Position
+		switch {
+		case entry.Status == types.QueueServing:
+			update.Message = "It's your turn"
+		case entry.Position == 1:
+			update.Message = "You're next"
+		}
+		updates = append(updates, types.QueueUpdate{UserIDs: []string{entry.User.ID}, Frame: update})
+	}
+
+	if len(finished) > 0 {
+		update := frame
+		update.Status = types.QueueDone
+		updates = append(updates, types.QueueUpdate{UserIDs: finished, Frame: update})
+	}
+
+	staffIDs, err := s.storage.GetStaffIDs(officeHour.CourseID)
+	if err != nil {
+		return nil, err
+	}
+	staffFrame := frame
+	staffFrame.Entries = queue.Entries
+	updates = append(updates, types.QueueUpdate{UserIDs: staffIDs, Frame: staffFrame})
+
+	return updates, nil
+}
+
+// queueOfficeHour returns a drop-in window of a course the user belongs to.
+func (s *OfficeHourService) queueOfficeHour(userID, officeHourID string) (*types.OfficeHour, error) {
+	officeHour, err := s.storage.GetOfficeHour(officeHourID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CheckCourseMember(officeHour.CourseID, userID); err != nil {
+		return nil, err
+	}
+	if officeHour.Mode != types.OfficeHourModeQueue {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "These office hours take bookings, book a slot instead"}
+	}
+	return officeHour, nil
+}
+
+// staffOfficeHour returns the window if the user is staff of its course.
+func (s *OfficeHourService) staffOfficeHour(userID, officeHourID string) (*types.OfficeHour, error) {
+	officeHour, err := s.storage.GetOfficeHour(officeHourID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CheckCourseStaff(officeHour.CourseID, userID); err != nil {
+		return nil, err
+	}
+	return officeHour, nil
+}
+
+// buildQueue numbers the waiting students from 1.
+func buildQueue(officeHour *types.OfficeHour, entries []types.QueueEntry) *types.OfficeHourQueue {
+	queue := &types.OfficeHourQueue{
+		OfficeHourID: officeHour.ID,
+		CourseID:     officeHour.CourseID,
+		Entries:      entries,
+	}
+	for i := range queue.Entries {
+		if queue.Entries[i].Status == types.QueueWaiting {
+			queue.Waiting++
+			queue.Entries[i].Position = queue.Waiting
+		}
+	}
+	return queue
+}
+
+// buildSlots splits a booking window into its slots and counts their
+// bookings.
+func buildSlots(officeHour *types.OfficeHour, bookings []types.OfficeHourBooking, userID string) []types.OfficeHourSlot {
+	slot := time.Duration(officeHour.SlotMinutes) * time.Minute
+	slots := []types.OfficeHourSlot{}
+	for start := officeHour.StartsAt; !start.Add(slot).After(officeHour.EndsAt); start = start.Add(slot) {
+		slots = append(slots, types.OfficeHourSlot{StartsAt: start, EndsAt: start.Add(slot)})
+	}
+
+	for _, booking := range bookings {
+		i := int(booking.StartsAt.Sub(officeHour.StartsAt) / slot)
+		if i < 0 || i >= len(slots) {
+			continue
+		}
+		slots[i].Booked++
+		if booking.User.ID == userID {
+			slots[i].BookedByMe = true
+		}
+	}
+	for i := range slots {
+		slots[i].Available = max(officeHour.Capacity-slots[i].Booked, 0)
+	}
+	return slots
+}
+
+// buildOfficeHour validates a request and turns it into a window. An update
+// passes the existing mode, which cannot change.
+func buildOfficeHour(req *types.OfficeHourRequest, mode string) (*types.OfficeHour, error) {
+	officeHour := &types.OfficeHour{
+		Title:    strings.TrimSpace(req.Title),
+		Location: strings.TrimSpace(req.Location),
+		Mode:     mode,
+	}
+	if officeHour.Mode == "" {
+		officeHour.Mode = req.Mode
+		if officeHour.Mode == "" {
+			officeHour.Mode = types.OfficeHourModeBooking
+		}
+	}
+
+	if officeHour.Title == "" {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Title is required"}
+	}
+	if utf8.RuneCountInString(officeHour.Title) > 200 {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Title must be at most 200 characters"}
+	}
+	if utf8.RuneCountInString(officeHour.Location) > 255 {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Location must be at most 255 characters"}
+	}
+
+	startsAt, err := time.Parse(time.RFC3339, req.StartsAt)
+	if err != nil {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "starts_at must be an RFC 3339 time"}
+	}
+	endsAt, err := time.Parse(time.RFC3339, req.EndsAt)
+	if err != nil {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "ends_at must be an RFC 3339 time"}
+	}
+	officeHour.StartsAt, officeHour.EndsAt = startsAt.UTC(), endsAt.UTC()
+
+	length := officeHour.EndsAt.Sub(officeHour.StartsAt)
+	if length <= 0 || length > maxOfficeHourLength {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Office hours must end after they start and last at most 12 hours"}
+	}
+	if !officeHour.EndsAt.After(time.Now().UTC()) {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Office hours must end in the future"}
+	}
+
+	switch officeHour.Mode {
+	case types.OfficeHourModeBooking:
+		officeHour.SlotMinutes = req.SlotMinutes
+		if officeHour.SlotMinutes == 0 {
+			officeHour.SlotMinutes = 15
+		}
+		officeHour.Capacity = req.Capacity
+		if officeHour.Capacity == 0 {
+			officeHour.Capacity = 1
+		}
+		if officeHour.SlotMinutes < 5 || time.Duration(officeHour.SlotMinutes)*time.Minute > length {
+			return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "slot_minutes must be at least 5 and fit into the office hours"}
+		}
+		if officeHour.Capacity < 1 || officeHour.Capacity > maxSlotCapacity {
+			return nil, &utils.ApiError{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("capacity must be between 1 and %d", maxSlotCapacity),
+			}
+		}
+	case types.OfficeHourModeQueue:
+	default:
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "mode must be booking or queue"}
+	}
+
+	return officeHour, nil
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// maxPeerReviewers bounds the reviewers of a submission.
+const maxPeerReviewers = 10
+
+type PeerReviewService struct {
+	storage           *storage.PeerReviewStorage
+	submissionStorage *storage.SubmissionStorage
+	rubricStorage     *storage.RubricStorage
+	moduleService     *ModuleService
+}
+
+func NewPeerReviewService(storage *storage.PeerReviewStorage, submissionStorage *storage.SubmissionStorage, rubricStorage *storage.RubricStorage, moduleService *ModuleService) *PeerReviewService {
+	return &PeerReviewService{
+		storage:           storage,
+		submissionStorage: submissionStorage,
+		rubricStorage:     rubricStorage,
+		moduleService:     moduleService,
+	}
+}
+
+// OpenPeerReview starts peer review of an assignment after its due date and
+// hands every submission to other students who submitted. Submissions close
+// while it runs.
+func (s *PeerReviewService) OpenPeerReview(userID, itemID string, req *types.PeerReviewPhaseRequest) (*types.PeerReviewPhase, error) {
+	item, err := s.moduleService.GetItem(userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CheckCourseInstructor(item.CourseID, userID); err != nil {
+		return nil, err
+	}
+	if item.Kind != types.ModuleItemAssignment {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Only assignments can be peer reviewed"}
+	}
+	now := time.Now().UTC()
+	if item.DueAt == nil {
+		return nil, &utils.ApiError{Code: http.StatusConflict, Message: "Set a due date for this assignment first"}
+	}
+	if now.Before(*item.DueAt) {
+		return nil, &utils.ApiError{Code: http.StatusConflict, Message: "Peer review opens after the assignment's due date"}
+	}
+
+	if req.ReviewersPerSubmission < 1 || req.ReviewersPerSubmission > maxPeerReviewers {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("reviewers_per_submission must be between 1 and %d", maxPeerReviewers),
+		}
+	}
+	dueAt, err := parseOptionalTime(req.DueAt, "due_at")
+	if err != nil {
+		return nil, err
+	}
+	if dueAt != nil && !dueAt.After(now) {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "due_at must be in the future"}
+	}
+
+	rubricID := req.RubricID
+	if rubricID == "" {
+		rubricID = item.RubricID
+	}
+	if rubricID == "" {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "rubric_id is required when the assignment has no rubric"}
+	}
+	rubric, err := s.rubricStorage.GetRubric(rubricID)
+	if err != nil {
+		return nil, err
+	}
+	if rubric.CourseID != item.CourseID {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "The rubric belongs to another course, copy it first"}
+	}
+
+	authors, err := s.storage.GetSubmissionAuthors(itemID)
+	if err != nil {
+		return nil, err
+	}
+	if len(authors) < 2 {
+		return nil, &utils.ApiError{Code: http.StatusConflict, Message: "Peer review needs submissions from at least two students"}
+	}
+
+	assignments := assignReviewers(authors, req.ReviewersPerSubmission)
+	phase := &types.PeerReviewPhase{
+		ItemID:                 itemID,
+		RubricID:               rubric.ID,
+		ReviewersPerSubmission: min(req.ReviewersPerSubmission, len(authors)-1),
+		Anonymous:              req.Anonymous,
+		DueAt:                  dueAt,
+		OpenedBy:               userID,
+	}
+	if err := s.storage.OpenPhase(phase, assignments); err != nil {
+		return nil, err
+	}
+	return s.GetPeerReview(userID, itemID)
+}
+
+// GetPeerReview returns the peer review of an assignment with its rubric.
+// Staff see the progress of every review, students their own.
+func (s *PeerReviewService) GetPeerReview(userID, itemID string) (*types.PeerReviewPhase, error) {
+	item, err := s.moduleService.GetItem(userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	isStaff, err := s.storage.IsCourseStaff(item.CourseID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	reviewerID := userID
+	if isStaff {
+		reviewerID = ""
+	}
+	phase, err := s.storage.GetPhase(itemID, reviewerID)
+	if err != nil {
+		return nil, err
+	}
+	if phase.Rubric, err = s.rubricStorage.GetRubric(phase.RubricID); err != nil {
+		return nil, err
+	}
+	return phase, nil
+}
+
+// ClosePeerReview stops reviews from being written before the due date of
+// the peer review.
+func (s *PeerReviewService) ClosePeerReview(userID, itemID string) (*types.PeerReviewPhase, error) {
+	item, err := s.moduleService.GetItem(userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CheckCourseInstructor(item.CourseID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.storage.ClosePhase(itemID, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return s.GetPeerReview(userID, itemID)
+}
+
+// GetReviews returns every review of an assignment for staff, and the
+// reviews students have to write.
+func (s *PeerReviewService) GetReviews(userID, itemID string) ([]*types.PeerReview, error) {
+	phase, isStaff, err := s.itemPhase(userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	reviewerID := userID
+	if isStaff {
+		reviewerID = ""
+	}
+	reviews, err := s.storage.GetReviews(itemID, reviewerID, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, review := range reviews {
+		hideIdentities(review, phase, userID, isStaff)
+	}
+	return reviews, nil
+}
+
+// GetReceivedReviews returns the completed reviews of the user's submission.
+func (s *PeerReviewService) GetReceivedReviews(userID, itemID string) ([]*types.PeerReview, error) {
+	phase, _, err := s.itemPhase(userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	reviews, err := s.storage.GetReviews(itemID, "", userID)
+	if err != nil {
+		return nil, err
+	}
+	received := []*types.PeerReview{}
+	for _, review := range reviews {
+		if !review.Completed {
+			continue
+		}
+		hideIdentities(review, phase, userID, false)
+		received = append(received, review)
+	}
+	return received, nil
+}
+
+// GetReview returns a review with the reviewed work to its reviewer and the
+// staff, and to the author once it is completed.
+func (s *PeerReviewService) GetReview(userID, reviewID string) (*types.PeerReview, error) {
+	review, err := s.storage.GetReview(reviewID)
+	if err != nil {
+		return nil, err
+	}
+	phase, isStaff, err := s.itemPhase(userID, review.ItemID)
+	if err != nil {
+		return nil, err
+	}
+
+	isReviewer := review.Reviewer.ID == userID
+	isAuthor := review.Author.ID == userID && review.Completed
+	if !isStaff && !isReviewer && !isAuthor {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Review not found"}
+	}
+
+	if isStaff || isReviewer {
+		submission, err := s.submissionStorage.GetSubmission(review.SubmissionID)
+		if err != nil {
+			return nil, err
+		}
+		review.SubmissionBody = submission.Body
+		review.SubmissionFiles = submission.Files
+	}
+	hideIdentities(review, phase, userID, isStaff)
+	return review, nil
+}
+
+// SubmitReview scores the reviewed work on every criterion of the peer
+// review's rubric. Reviews can be revised while the peer review is open.
+func (s *PeerReviewService) SubmitReview(userID, reviewID string, req *types.GradeRequest) (*types.PeerReview, error) {
+	review, err := s.storage.GetReview(reviewID)
+	if err != nil {
+		return nil, err
+	}
+	if review.Reviewer.ID != userID {
+		return nil, &utils.ApiError{Code: http.StatusForbidden, Message: "Only the assigned reviewer can write this review"}
+	}
+	phase, _, err := s.itemPhase(userID, review.ItemID)
+	if err != nil {
+		return nil, err
+	}
+	if !phase.Open {
+		return nil, &utils.ApiError{Code: http.StatusConflict, Message: "Peer review is closed"}
+	}
+
+	rubric, err := s.rubricStorage.GetRubric(phase.RubricID)
+	if err != nil {
+		return nil, err
+	}
+	criteria, comment, err := buildScores(rubric, req.Criteria, req.Comment)
+	if err != nil {
+		return nil, err
+	}
+
+	score := totalScore(criteria)
+	review.Criteria = criteria
+	review.Score = &score
+	review.MaxScore = &rubric.MaxPoints
+	review.Comment = comment
+	if err := s.storage.SaveReview(review); err != nil {
+		return nil, err
+	}
+	return s.GetReview(userID, reviewID)
+}
+
+// itemPhase returns the peer review of an item the user can see and whether
+// the user is course staff.
+func (s *PeerReviewService) itemPhase(userID, itemID string) (*types.PeerReviewPhase, bool, error) {
+	item, err := s.moduleService.GetItem(userID, itemID)
+	if err != nil {
+		return nil, false, err
+	}
+	isStaff, err := s.storage.IsCourseStaff(item.CourseID, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	phase, err := s.storage.GetPhase(itemID, "")
+	if err != nil {
+		return nil, false, err
+	}
+	return phase, isStaff, nil
+}
+
+// hideIdentities leaves out the other side of an anonymous review for
+// students.
+func hideIdentities(review *types.PeerReview, phase *types.PeerReviewPhase, userID string, isStaff bool) {
+	if isStaff || !phase.Anonymous {
+		return
+	}
+	if review.Author.ID != userID {
+		review.Author = nil
+	}
+	if review.Reviewer.ID != userID {
+		review.Reviewer = nil
+	}
+}
+
+// assignReviewers hands every submission to n other authors. The authors are
+// shuffled into a circle and everyone reviews the next n submissions, so all
+// of them write and receive the same number of reviews.
+func assignReviewers(authors []types.SubmissionAuthor, n int) []types.ReviewAssignment {
+	circle := slices.Clone(authors)
+	rand.Shuffle(len(circle), func(i, j int) {
+		circle[i], circle[j] = circle[j], circle[i]
+	})
+	n = min(n, len(circle)-1)
+
+	assignments := make([]types.ReviewAssignment, 0, len(circle)*n)
+	for i, author := range circle {
+		for k := 1; k <= n; k++ {
+			assignments = append(assignments, types.ReviewAssignment{
+				SubmissionID: author.SubmissionID,
+				ReviewerID:   circle[(i+k)%len(circle)].UserID,
+			})
+		}
+	}
+	return assignments
+}
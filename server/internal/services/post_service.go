@@ -27,21 +27,23 @@ func NewPostService(
 	}
 }
 
-func (s *PostService) DeleteComment(r *http.Request) error {
+// DeleteComment deletes the comment of the request and returns the post and
+// course it belonged to.
+func (s *PostService) DeleteComment(r *http.Request) (string, string, error) {
 	userID, err := utils.GetUserIDFromContext(r.Context())
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
 	vars := mux.Vars(r)
 	commentID := vars["comment_id"]
 	if commentID == "" {
-		return &utils.ApiError{Code: http.StatusNotFound, Message: "Comment ID not found"}
+		return "", "", &utils.ApiError{Code: http.StatusNotFound, Message: "Comment ID not found"}
 	}
 
 	postID := r.URL.Query().Get("post_id")
 	if postID == "" {
-		return &utils.ApiError{Code: http.StatusNotFound, Message: "Post ID not found"}
+		return "", "", &utils.ApiError{Code: http.StatusNotFound, Message: "Post ID not found"}
 	}
 
 	return s.PostStorage.DeleteComment(commentID, userID, postID)
@@ -210,6 +212,18 @@ func (s *PostService) EditPost(r *http.Request) error {
 	return nil
 }
 
+func (s *PostService) GetPost(postID string) (*types.PostResponse, error) {
+	return s.PostStorage.GetPost(postID)
+}
+
+func (s *PostService) GetComment(commentID string) (*types.Comment, error) {
+	return s.PostStorage.GetComment(commentID)
+}
+
+func (s *PostService) GetPostCourseID(postID string) (string, error) {
+	return s.PostStorage.GetPostCourseID(postID)
+}
+
 func (s *PostService) GetAllPost(r *http.Request) ([]types.PostResponse, error) {
 	vars := mux.Vars(r)
 	courseID := vars["id"]
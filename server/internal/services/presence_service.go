@@ -0,0 +1,50 @@
+package services
+
+import (
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"fmt"
+	"net/http"
+)
+
+type PresenceService struct {
+	storage     *storage.PresenceStorage
+	chatStorage *storage.ChatStorage
+}
+
+func NewPresenceService(storage *storage.PresenceStorage, chatStorage *storage.ChatStorage) *PresenceService {
+	return &PresenceService{storage: storage, chatStorage: chatStorage}
+}
+
+// GetOnlineMembers returns the members of the course among the online users.
+// Only members of the course can see who is online in it.
+func (s *PresenceService) GetOnlineMembers(courseID, userID string, onlineIDs []string) ([]types.User, error) {
+	isMember, err := s.chatStorage.IsCourseMember(courseID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check course membership: %v", err)
+	}
+	if !isMember {
+		return nil, &utils.ApiError{
+			Code:    http.StatusForbidden,
+			Message: "You are not a member of this course",
+		}
+	}
+
+	if len(onlineIDs) == 0 {
+		return []types.User{}, nil
+	}
+	return s.storage.GetCourseMembersByIDs(courseID, onlineIDs)
+}
+
+func (s *PresenceService) GetSettings(userID string) (*types.PresenceSettings, error) {
+	appearOffline, err := s.storage.GetAppearOffline(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &types.PresenceSettings{AppearOffline: appearOffline}, nil
+}
+
+func (s *PresenceService) UpdateSettings(userID string, settings *types.PresenceSettings) error {
+	return s.storage.SetAppearOffline(userID, settings.AppearOffline)
+}
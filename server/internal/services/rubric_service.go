@@ -0,0 +1,249 @@
+package services
+
+import (
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxRubricCriteria bounds the criteria of a rubric.
+	maxRubricCriteria = 50
+	// maxRubricLevels bounds the performance levels of a criterion.
+	maxRubricLevels = 10
+	// maxRubricPoints bounds the points of a level.
+	maxRubricPoints = 10000
+	// maxRubricText bounds descriptions and grading comments.
+	maxRubricText = 5000
+)
+
+type RubricService struct {
+	storage       *storage.RubricStorage
+	moduleService *ModuleService
+}
+
+func NewRubricService(storage *storage.RubricStorage, moduleService *ModuleService) *RubricService {
+	return &RubricService{
+		storage:       storage,
+		moduleService: moduleService,
+	}
+}
+
+func (s *RubricService) CreateRubric(userID, courseID string, req *types.RubricRequest) (*types.Rubric, error) {
+	if err := s.storage.CheckCourseInstructor(courseID, userID); err != nil {
+		return nil, err
+	}
+
+	rubric, err := buildRubric(req)
+	if err != nil {
+		return nil, err
+	}
+	rubric.CourseID = courseID
+	rubric.CreatedBy = userID
+
+	if err := s.storage.CreateRubric(rubric); err != nil {
+		return nil, err
+	}
+	return s.storage.GetRubric(rubric.ID)
+}
+
+// GetRubrics returns the rubrics of a course. Members can see them, so
+// students know how their work is graded.
+func (s *RubricService) GetRubrics(userID, courseID string) ([]*types.Rubric, error) {
+	if err := s.storage.CheckCourseMember(courseID, userID); err != nil {
+		return nil, err
+	}
+	return s.storage.GetRubrics(courseID)
+}
+
+func (s *RubricService) GetRubric(userID, rubricID string) (*types.Rubric, error) {
+	rubric, err := s.storage.GetRubric(rubricID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CheckCourseMember(rubric.CourseID, userID); err != nil {
+		return nil, err
+	}
+	return rubric, nil
+}
+
+// UpdateRubric replaces a rubric with its criteria, as long as nothing was
+// graded with it.
+func (s *RubricService) UpdateRubric(userID, rubricID string, req *types.RubricRequest) (*types.Rubric, error) {
+	existing, err := s.instructorRubric(userID, rubricID)
+	if err != nil {
+		return nil, err
+	}
+
+	rubric, err := buildRubric(req)
+	if err != nil {
+		return nil, err
+	}
+	rubric.ID = existing.ID
+
+	if err := s.storage.UpdateRubric(rubric); err != nil {
+		return nil, err
+	}
+	return s.storage.GetRubric(rubricID)
+}
+
+func (s *RubricService) DeleteRubric(userID, rubricID string) error {
+	if _, err := s.instructorRubric(userID, rubricID); err != nil {
+		return err
+	}
+	return s.storage.DeleteRubric(rubricID)
+}
+
+// CopyRubric copies a rubric into another course. The user has to be an
+// instructor of both courses.
+func (s *RubricService) CopyRubric(userID, rubricID string, req *types.CopyRubricRequest) (*types.Rubric, error) {
+	source, err := s.instructorRubric(userID, rubricID)
+	if err != nil {
+		return nil, err
+	}
+	if req.CourseID == "" {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "course_id is required"}
+	}
+	if err := s.storage.CheckCourseInstructor(req.CourseID, userID); err != nil {
+		return nil, err
+	}
+
+	rubric := &types.Rubric{
+		CourseID:    req.CourseID,
+		Title:       source.Title,
+		Description: source.Description,
+		Criteria:    source.Criteria,
+		CreatedBy:   userID,
+	}
+	if err := s.storage.CreateRubric(rubric); err != nil {
+		return nil, err
+	}
+	return s.storage.GetRubric(rubric.ID)
+}
+
+// SetItemRubric attaches a rubric of the course to an assignment, or
+// detaches it when rubric_id is empty. Grades keep the rubric they were
+// given with.
+func (s *RubricService) SetItemRubric(userID, itemID string, req *types.ItemRubricRequest) (*types.ModuleItem, error) {
+	item, err := s.moduleService.GetItem(userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CheckCourseInstructor(item.CourseID, userID); err != nil {
+		return nil, err
+	}
+	if item.Kind != types.ModuleItemAssignment {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Only assignments are graded with rubrics"}
+	}
+
+	if req.RubricID != "" {
+		rubric, err := s.storage.GetRubric(req.RubricID)
+		if err != nil {
+			return nil, err
+		}
+		if rubric.CourseID != item.CourseID {
+			return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "The rubric belongs to another course, copy it first"}
+		}
+	}
+
+	if err := s.storage.SetItemRubric(itemID, req.RubricID); err != nil {
+		return nil, err
+	}
+	return s.moduleService.GetItem(userID, itemID)
+}
+
+func (s *RubricService) instructorRubric(userID, rubricID string) (*types.Rubric, error) {
+	rubric, err := s.storage.GetRubric(rubricID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CheckCourseInstructor(rubric.CourseID, userID); err != nil {
+		return nil, err
+	}
+	return rubric, nil
+}
+
+// buildRubric validates a request and turns it into a rubric. Points are
+// rounded to hundredths.
+func buildRubric(req *types.RubricRequest) (*types.Rubric, error) {
+	rubric := &types.Rubric{
+		Title:       strings.TrimSpace(req.Title),
+		Description: strings.TrimSpace(req.Description),
+		Criteria:    []types.RubricCriterion{},
+	}
+
+	if rubric.Title == "" {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Title is required"}
+	}
+	if utf8.RuneCountInString(rubric.Title) > 200 {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Title must be at most 200 characters"}
+	}
+	if utf8.RuneCountInString(rubric.Description) > maxRubricText {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Description must be at most %d characters", maxRubricText),
+		}
+	}
+	if len(req.Criteria) == 0 || len(req.Criteria) > maxRubricCriteria {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("A rubric needs between 1 and %d criteria", maxRubricCriteria),
+		}
+	}
+
+	for _, c := range req.Criteria {
+		criterion := types.RubricCriterion{
+			Title:       strings.TrimSpace(c.Title),
+			Description: strings.TrimSpace(c.Description),
+			Levels:      []types.RubricLevel{},
+		}
+		if criterion.Title == "" {
+			return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Every criterion needs a title"}
+		}
+		if utf8.RuneCountInString(criterion.Title) > 200 || utf8.RuneCountInString(criterion.Description) > maxRubricText {
+			return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("Criterion %q is too long", truncateRunes(criterion.Title, 50))}
+		}
+		if len(c.Levels) == 0 || len(c.Levels) > maxRubricLevels {
+			return nil, &utils.ApiError{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Criterion %q needs between 1 and %d levels", criterion.Title, maxRubricLevels),
+			}
+		}
+
+		for _, l := range c.Levels {
+			level := types.RubricLevel{
+				Title:       strings.TrimSpace(l.Title),
+				Description: strings.TrimSpace(l.Description),
+				Points:      roundPoints(l.Points),
+			}
+			if level.Title == "" {
+				return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Every level needs a title"}
+			}
+			if utf8.RuneCountInString(level.Title) > 200 || utf8.RuneCountInString(level.Description) > maxRubricText {
+				return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("Level %q is too long", truncateRunes(level.Title, 50))}
+			}
+			if math.IsNaN(l.Points) || level.Points < 0 || level.Points > maxRubricPoints {
+				return nil, &utils.ApiError{
+					Code:    http.StatusBadRequest,
+					Message: fmt.Sprintf("points must be between 0 and %d", maxRubricPoints),
+				}
+			}
+			criterion.Levels = append(criterion.Levels, level)
+			criterion.MaxPoints = max(criterion.MaxPoints, level.Points)
+		}
+
+		rubric.Criteria = append(rubric.Criteria, criterion)
+		rubric.MaxPoints += criterion.MaxPoints
+	}
+
+	return rubric, nil
+}
+
+func roundPoints(points float64) float64 {
+	return math.Round(points*100) / 100
+}
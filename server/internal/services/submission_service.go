@@ -0,0 +1,319 @@
+package services
+
+import (
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"fmt"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxSubmissionFiles bounds the files handed in with a submission.
+const maxSubmissionFiles = 10
+
+type SubmissionService struct {
+	storage         *storage.SubmissionStorage
+	rubricStorage   *storage.RubricStorage
+	moduleService   *ModuleService
+	documentService *DocumentService
+}
+
+func NewSubmissionService(storage *storage.SubmissionStorage, rubricStorage *storage.RubricStorage, moduleService *ModuleService, documentService *DocumentService) *SubmissionService {
+	return &SubmissionService{
+		storage:         storage,
+		rubricStorage:   rubricStorage,
+		moduleService:   moduleService,
+		documentService: documentService,
+	}
+}
+
+// Submit hands in the user's work for an assignment, replacing an earlier
+// submission that was not graded yet, and completes the assignment in its
+// module.
+func (s *SubmissionService) Submit(userID, itemID, body string, files []*multipart.FileHeader) (*types.Submission, error) {
+	item, err := s.moduleService.GetItem(userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if item.Kind != types.ModuleItemAssignment {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "Only assignments take submissions"}
+	}
+	isStaff, err := s.storage.IsCourseStaff(item.CourseID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if isStaff {
+		return nil, &utils.ApiError{Code: http.StatusForbidden, Message: "Course staff cannot submit work"}
+	}
+	if item.Locked {
+		return nil, &utils.ApiError{Code: http.StatusForbidden, Message: "This item is locked"}
+	}
+
+	body = strings.TrimSpace(body)
+	if body == "" && len(files) == 0 {
+		return nil, &utils.ApiError{Code: http.StatusBadRequest, Message: "A submission needs a body or files"}
+	}
+	if utf8.RuneCountInString(body) > maxModuleItemBody {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("body must be at most %d characters", maxModuleItemBody),
+		}
+	}
+	if len(files) > maxSubmissionFiles {
+		return nil, &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("At most %d files can be submitted", maxSubmissionFiles),
+		}
+	}
+
+	documentIDs := []string{}
+	if len(files) > 0 {
+		documents, err := s.documentService.SaveFilesToLocal(files, userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range documents {
+			documentIDs = append(documentIDs, doc.ID)
+		}
+	}
+
+	submissionID, err := s.storage.SaveSubmission(itemID, userID, body, documentIDs)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.moduleService.CompleteItem(userID, itemID); err != nil {
+		return nil, err
+	}
+	return s.GetSubmission(userID, submissionID)
+}
+
+// GetSubmissions returns the submissions for an assignment: all of them for
+// staff, the user's own for students.
+func (s *SubmissionService) GetSubmissions(userID, itemID string) ([]*types.Submission, error) {
+	item, err := s.moduleService.GetItem(userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	isStaff, err := s.storage.IsCourseStaff(item.CourseID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	authorID := userID
+	if isStaff {
+		authorID = ""
+	}
+	submissions, err := s.storage.GetSubmissions(itemID, authorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.prepare(submissions, isStaff); err != nil {
+		return nil, err
+	}
+	return submissions, nil
+}
+
+// GetSubmission returns a submission to its author or the course staff.
+// Authors only see the grade once it is returned.
+func (s *SubmissionService) GetSubmission(userID, submissionID string) (*types.Submission, error) {
+	submission, err := s.storage.GetSubmission(submissionID)
+	if err != nil {
+		return nil, err
+	}
+	isStaff, err := s.storage.IsCourseStaff(submission.CourseID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isStaff && submission.User.ID != userID {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Submission not found"}
+	}
+
+	if err := s.prepare([]*types.Submission{submission}, isStaff); err != nil {
+		return nil, err
+	}
+	return submission, nil
+}
+
+// GradeSubmission scores a submission on every criterion of the rubric of
+// its assignment and computes the total.
+func (s *SubmissionService) GradeSubmission(userID, submissionID string, req *types.GradeRequest) (*types.Submission, error) {
+	submission, err := s.staffSubmission(userID, submissionID)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.moduleService.GetItem(userID, submission.ItemID)
+	if err != nil {
+		return nil, err
+	}
+	if item.RubricID == "" {
+		return nil, &utils.ApiError{Code: http.StatusConflict, Message: "Attach a rubric to this assignment first"}
+	}
+	rubric, err := s.rubricStorage.GetRubric(item.RubricID)
+	if err != nil {
+		return nil, err
+	}
+
+	criteria, comment, err := buildScores(rubric, req.Criteria, req.Comment)
+	if err != nil {
+		return nil, err
+	}
+
+	grade := &types.SubmissionGrade{
+		SubmissionID: submissionID,
+		RubricID:     rubric.ID,
+		GraderID:     userID,
+		Criteria:     criteria,
+		Score:        totalScore(criteria),
+		MaxScore:     rubric.MaxPoints,
+		Comment:      comment,
+	}
+	if err := s.storage.SaveGrade(grade); err != nil {
+		return nil, err
+	}
+	return s.GetSubmission(userID, submissionID)
+}
+
+// ReturnGrade shows the grade to the author, who is notified.
+func (s *SubmissionService) ReturnGrade(userID, submissionID string) (*types.Submission, error) {
+	submission, err := s.staffSubmission(userID, submissionID)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &types.GradeReturned{
+		SubmissionID: submission.ID,
+		ItemID:       submission.ItemID,
+		ItemTitle:    submission.ItemTitle,
+		CourseID:     submission.CourseID,
+		UserID:       submission.User.ID,
+		ReturnedAt:   time.Now().UTC(),
+	}
+	if err := s.storage.ReturnGrade(event); err != nil {
+		return nil, err
+	}
+	return s.GetSubmission(userID, submissionID)
+}
+
+func (s *SubmissionService) staffSubmission(userID, submissionID string) (*types.Submission, error) {
+	submission, err := s.storage.GetSubmission(submissionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.CheckCourseStaff(submission.CourseID, userID); err != nil {
+		return nil, err
+	}
+	return submission, nil
+}
+
+// prepare hides grades that were not returned from students and adds the
+// rubric to the others.
+func (s *SubmissionService) prepare(submissions []*types.Submission, isStaff bool) error {
+	rubrics := map[string]*types.Rubric{}
+	for _, submission := range submissions {
+		grade := submission.Grade
+		if grade == nil {
+			continue
+		}
+		if !isStaff && !grade.Returned {
+			submission.Grade = nil
+			continue
+		}
+
+		rubric, ok := rubrics[grade.RubricID]
+		if !ok {
+			var err error
+			if rubric, err = s.rubricStorage.GetRubric(grade.RubricID); err != nil {
+				return err
+			}
+			rubrics[grade.RubricID] = rubric
+		}
+		grade.Rubric = rubric
+	}
+	return nil
+}
+
+// buildScores validates the scores of every criterion of the rubric. A
+// level sets the points of a criterion unless points are given, which can
+// range up to the criterion's best level.
+func buildScores(rubric *types.Rubric, reqs []types.CriterionScoreRequest, comment string) ([]types.CriterionScore, string, error) {
+	byCriterion := map[string]types.CriterionScoreRequest{}
+	for _, req := range reqs {
+		if _, ok := byCriterion[req.CriterionID]; ok {
+			return nil, "", &utils.ApiError{Code: http.StatusBadRequest, Message: "Every criterion can only be scored once"}
+		}
+		byCriterion[req.CriterionID] = req
+	}
+
+	scores := []types.CriterionScore{}
+	for _, criterion := range rubric.Criteria {
+		req, ok := byCriterion[criterion.ID]
+		if !ok {
+			return nil, "", &utils.ApiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("Criterion %q is not scored", criterion.Title)}
+		}
+		delete(byCriterion, criterion.ID)
+
+		score := types.CriterionScore{
+			CriterionID: criterion.ID,
+			LevelID:     req.LevelID,
+			Comment:     strings.TrimSpace(req.Comment),
+		}
+		if req.LevelID == "" && req.Points == nil {
+			return nil, "", &utils.ApiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("Criterion %q needs a level_id or points", criterion.Title)}
+		}
+		if req.LevelID != "" {
+			found := false
+			for _, level := range criterion.Levels {
+				if level.ID == req.LevelID {
+					score.Points, found = level.Points, true
+					break
+				}
+			}
+			if !found {
+				return nil, "", &utils.ApiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("level_id is not a level of criterion %q", criterion.Title)}
+			}
+		}
+		if req.Points != nil {
+			score.Points = roundPoints(*req.Points)
+			if math.IsNaN(*req.Points) || score.Points < 0 || score.Points > criterion.MaxPoints {
+				return nil, "", &utils.ApiError{
+					Code:    http.StatusBadRequest,
+					Message: fmt.Sprintf("Points of criterion %q must be between 0 and %g", criterion.Title, criterion.MaxPoints),
+				}
+			}
+		}
+		if utf8.RuneCountInString(score.Comment) > maxRubricText {
+			return nil, "", &utils.ApiError{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Comments must be at most %d characters", maxRubricText),
+			}
+		}
+		scores = append(scores, score)
+	}
+	if len(byCriterion) > 0 {
+		return nil, "", &utils.ApiError{Code: http.StatusBadRequest, Message: "criterion_id is not a criterion of the rubric"}
+	}
+
+	comment = strings.TrimSpace(comment)
+	if utf8.RuneCountInString(comment) > maxRubricText {
+		return nil, "", &utils.ApiError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Comments must be at most %d characters", maxRubricText),
+		}
+	}
+	return scores, comment, nil
+}
+
+func totalScore(scores []types.CriterionScore) float64 {
+	total := 0.0
+	for _, score := range scores {
+		total += score.Points
+	}
+	return roundPoints(total)
+}
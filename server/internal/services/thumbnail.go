@@ -0,0 +1,96 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// thumbnailMaxSize is the longest edge of a generated thumbnail in pixels.
+	thumbnailMaxSize = 320
+	// thumbnailMaxPixels guards against decompression bombs; larger images are
+	// stored without a thumbnail.
+	thumbnailMaxPixels = 40_000_000
+)
+
+// generateThumbnail writes a JPEG preview of the image at srcPath next to it and
+// returns the thumbnail path. Transparent areas are flattened onto white.
+func generateThumbnail(srcPath string) (string, error) {
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open image: %v", err)
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image header: %v", err)
+	}
+	if config.Width*config.Height > thumbnailMaxPixels {
+		return "", fmt.Errorf("image is too large for a thumbnail: %dx%d", config.Width, config.Height)
+	}
+
+	if _, err := file.Seek(0, 0); err != nil {
+		return "", fmt.Errorf("failed to rewind image: %v", err)
+	}
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return "", fmt.Errorf("image has no pixels")
+	}
+
+	// Scale the longest edge down to thumbnailMaxSize, never up
+	dstWidth, dstHeight := width, height
+	if width > thumbnailMaxSize || height > thumbnailMaxSize {
+		if width >= height {
+			dstWidth = thumbnailMaxSize
+			dstHeight = max(1, height*thumbnailMaxSize/width)
+		} else {
+			dstHeight = thumbnailMaxSize
+			dstWidth = max(1, width*thumbnailMaxSize/height)
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+
+	// Nearest neighbour sampling is good enough for chat previews
+	scaled := image.NewRGBA(dst.Bounds())
+	for y := 0; y < dstHeight; y++ {
+		srcY := bounds.Min.Y + y*height/dstHeight
+		for x := 0; x < dstWidth; x++ {
+			srcX := bounds.Min.X + x*width/dstWidth
+			scaled.Set(x, y, src.At(srcX, srcY))
+		}
+	}
+	draw.Draw(dst, dst.Bounds(), scaled, image.Point{}, draw.Over)
+
+	base := strings.TrimSuffix(filepath.Base(srcPath), filepath.Ext(srcPath))
+	thumbPath := filepath.Join(filepath.Dir(srcPath), "thumb_"+base+".jpg")
+
+	out, err := os.Create(thumbPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create thumbnail: %v", err)
+	}
+	defer out.Close()
+
+	if err := jpeg.Encode(out, dst, &jpeg.Options{Quality: 80}); err != nil {
+		os.Remove(thumbPath)
+		return "", fmt.Errorf("failed to encode thumbnail: %v", err)
+	}
+
+	return thumbPath, nil
+}
@@ -0,0 +1,366 @@
+package services
+
+import (
+	"bytes"
+	"course-flow/internal/netguard"
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// webhookPollInterval is how often due deliveries are looked for when no
+	// new event wakes the worker up.
+	webhookPollInterval = 5 * time.Second
+	// webhookLease is how long a claimed delivery is left to its instance.
+	webhookLease     = 2 * time.Minute
+	webhookBatchSize = 20
+	// webhookMaxAttempts bounds the retries: 30s, 1m, 2m, ... about an hour
+	// in total before a delivery is marked failed.
+	webhookMaxAttempts = 8
+	webhookBaseBackoff = 30 * time.Second
+	webhookTimeout     = 10 * time.Second
+)
+
+// Headers sent with every delivery. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" with the webhook's secret.
+const (
+	WebhookEventHeader     = "X-CourseFlow-Event"
+	WebhookDeliveryHeader  = "X-CourseFlow-Delivery"
+	WebhookTimestampHeader = "X-CourseFlow-Timestamp"
+	WebhookSignatureHeader = "X-CourseFlow-Signature"
+)
+
+type WebhookService struct {
+	storage       *storage.WebhookStorage
+	client        *http.Client
+	allowInsecure bool
+	wake          chan struct{}
+}
+
+func NewWebhookService(storage *storage.WebhookStorage) *WebhookService {
+	// Development setups deliver to receivers on the local network
+	allowInsecure := os.Getenv("WEBHOOK_ALLOW_INSECURE_URLS") == "true"
+
+	return &WebhookService{
+		storage:       storage,
+		allowInsecure: allowInsecure,
+		client:        netguard.NewClient(webhookTimeout, allowInsecure),
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+func (s *WebhookService) CreateWebhook(userID, courseID string, req types.WebhookRequest) (*types.Webhook, error) {
+	if err := s.storage.CheckCourseAdmin(courseID, userID); err != nil {
+		return nil, err
+	}
+
+	webhook := &types.Webhook{
+		CourseID:  courseID,
+		Active:    true,
+		CreatedBy: userID,
+	}
+	if err := s.applyRequest(webhook, req); err != nil {
+		return nil, err
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	webhook.Secret = secret
+
+	if err := s.storage.CreateWebhook(webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *WebhookService) GetWebhooks(userID, courseID string) ([]types.Webhook, error) {
+	if err := s.storage.CheckCourseAdmin(courseID, userID); err != nil {
+		return nil, err
+	}
+	return s.storage.GetWebhooks(courseID)
+}
+
+func (s *WebhookService) UpdateWebhook(userID, webhookID string, req types.WebhookRequest) (*types.Webhook, error) {
+	webhook, err := s.storage.GetWebhook(webhookID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyRequest(webhook, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.storage.UpdateWebhook(webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// RotateSecret replaces the signing secret of a webhook and returns it.
+func (s *WebhookService) RotateSecret(userID, webhookID string) (*types.Webhook, error) {
+	webhook, err := s.storage.GetWebhook(webhookID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.SetSecret(webhook.ID, secret); err != nil {
+		return nil, err
+	}
+
+	webhook.Secret = secret
+	return webhook, nil
+}
+
+func (s *WebhookService) DeleteWebhook(userID, webhookID string) error {
+	webhook, err := s.storage.GetWebhook(webhookID, userID)
+	if err != nil {
+		return err
+	}
+	return s.storage.DeleteWebhook(webhook.ID)
+}
+
+func (s *WebhookService) GetDeliveries(userID, webhookID string, page types.WebhookDeliveryPage) ([]types.WebhookDelivery, error) {
+	if _, err := s.storage.GetWebhook(webhookID, userID); err != nil {
+		return nil, err
+	}
+	return s.storage.GetDeliveries(webhookID, page)
+}
+
+func (s *WebhookService) GetDelivery(userID, webhookID, deliveryID string) (*types.WebhookDelivery, error) {
+	if _, err := s.storage.GetWebhook(webhookID, userID); err != nil {
+		return nil, err
+	}
+	return s.storage.GetDelivery(webhookID, deliveryID)
+}
+
+// ReplayDelivery sends the event of a past delivery again, with the current
+// URL and secret of the webhook.
+func (s *WebhookService) ReplayDelivery(userID, webhookID, deliveryID string) (*types.WebhookDelivery, error) {
+	if _, err := s.storage.GetWebhook(webhookID, userID); err != nil {
+		return nil, err
+	}
+
+	delivery, err := s.storage.ReplayDelivery(webhookID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	s.wakeUp()
+	return delivery, nil
+}
+
+// applyRequest validates a create or update request and applies it.
+func (s *WebhookService) applyRequest(webhook *types.Webhook, req types.WebhookRequest) error {
+	endpoint, err := url.Parse(req.URL)
+	if err != nil || endpoint.Host == "" {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid webhook URL"}
+	}
+	if endpoint.Scheme != "https" && !(s.allowInsecure && endpoint.Scheme == "http") {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "Webhook URL must use https"}
+	}
+	if !s.allowInsecure {
+		if err := netguard.CheckHost(endpoint.Hostname()); err != nil {
+			log.Printf("Rejected webhook URL of course %s: %v", webhook.CourseID, err)
+			return &utils.ApiError{Code: http.StatusBadRequest, Message: "Webhook URL must be a public address"}
+		}
+	}
+
+	if len(req.EventTypes) == 0 {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "At least one event type is required"}
+	}
+	var eventTypes []string
+	for _, eventType := range req.EventTypes {
+		if !slices.Contains(types.WebhookEventTypes, eventType) {
+			return &utils.ApiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("Unknown event type %q", eventType)}
+		}
+		if !slices.Contains(eventTypes, eventType) {
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+
+	webhook.URL = endpoint.String()
+	webhook.EventTypes = eventTypes
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %v", err)
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Dispatch queues an event for the webhooks of the course subscribed to it.
+// An event ID is only queued once per webhook, so dispatching an event again
+// is harmless.
+func (s *WebhookService) Dispatch(event types.WebhookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s webhook event: %v", event.Type, err)
+	}
+
+	queued, err := s.storage.CreateDeliveries(event.CourseID, event.Type, event.ID, payload)
+	if err != nil {
+		return err
+	}
+	if queued > 0 {
+		s.wakeUp()
+	}
+	return nil
+}
+
+func (s *WebhookService) wakeUp() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends due deliveries until the process exits. Several instances can
+// run it, each delivery is claimed by one of them.
+func (s *WebhookService) Run() {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.SendDue()
+		select {
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// SendDue sends every delivery that is due, a batch at a time.
+func (s *WebhookService) SendDue() {
+	for {
+		jobs, err := s.storage.ClaimDeliveries(time.Now().UTC(), webhookLease, webhookBatchSize)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, job := range jobs {
+			wg.Add(1)
+			go func(job types.WebhookJob) {
+				defer wg.Done()
+				s.send(job)
+			}(job)
+		}
+		wg.Wait()
+
+		if len(jobs) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// send makes one attempt at a delivery and schedules the next one when it
+// fails, doubling the delay each time.
+func (s *WebhookService) send(job types.WebhookJob) {
+	attempt := types.WebhookDeliveryAttempt{
+		Attempt:     job.Attempts + 1,
+		AttemptedAt: time.Now().UTC(),
+	}
+
+	statusCode, err := s.post(job)
+	attempt.DurationMs = time.Since(attempt.AttemptedAt).Milliseconds()
+	if statusCode > 0 {
+		attempt.ResponseStatus = &statusCode
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	status := types.DeliveryPending
+	var nextAttemptAt *time.Time
+	switch {
+	case err == nil && statusCode >= 200 && statusCode < 300:
+		status = types.DeliverySucceeded
+	case attempt.Attempt >= webhookMaxAttempts:
+		status = types.DeliveryFailed
+	default:
+		next := time.Now().UTC().Add(webhookBaseBackoff << (attempt.Attempt - 1))
+		nextAttemptAt = &next
+	}
+
+	if err := s.storage.RecordAttempt(job.DeliveryID, attempt, status, nextAttemptAt); err != nil {
+		log.Println(err)
+		return
+	}
+
+	switch status {
+	case types.DeliverySucceeded:
+		log.Printf("Successfully delivered %s to webhook %s", job.EventType, job.WebhookID)
+	case types.DeliveryFailed:
+		log.Printf("Giving up on delivery %s to webhook %s after %d attempts", job.DeliveryID, job.WebhookID, attempt.Attempt)
+	}
+}
+
+// post signs the payload and posts it to the webhook, returning the response
+// status. Response bodies are discarded so receivers cannot be used to read
+// hosts the server can reach.
+func (s *WebhookService) post(job types.WebhookJob) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, job.URL, bytes.NewReader(job.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook URL: %v", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CourseFlow-Webhooks/1.0")
+	req.Header.Set(WebhookEventHeader, job.EventType)
+	req.Header.Set(WebhookDeliveryHeader, job.DeliveryID)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(job.Secret, timestamp, job.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhook returns the hex signature of a delivery body sent at timestamp.
+// Receivers recompute it with their secret and reject old timestamps.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
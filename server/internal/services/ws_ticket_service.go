@@ -0,0 +1,53 @@
+package services
+
+import (
+	"course-flow/internal/storage"
+	"course-flow/internal/types"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// wsTicketTTL is how long a ticket can be used to open a connection.
+const wsTicketTTL = 30 * time.Second
+
+type WSTicketService struct {
+	storage *storage.WSTicketStorage
+}
+
+func NewWSTicketService(storage *storage.WSTicketStorage) *WSTicketService {
+	return &WSTicketService{storage: storage}
+}
+
+// IssueTicket creates a single-use ticket for the user. Connections opened
+// with it last until the access token it was issued for expires, unless the
+// client re-authenticates.
+func (s *WSTicketService) IssueTicket(userID string, tokenExpiresAt time.Time) (*types.WSTicket, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate websocket ticket: %v", err)
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(b)
+
+	expiresAt := time.Now().UTC().Add(wsTicketTTL)
+	if err := s.storage.CreateTicket(hashTicket(ticket), userID, tokenExpiresAt, expiresAt); err != nil {
+		return nil, err
+	}
+
+	return &types.WSTicket{Ticket: ticket, ExpiresAt: expiresAt}, nil
+}
+
+// RedeemTicket consumes a ticket and returns its user and the expiry of the
+// access token it was issued for.
+func (s *WSTicketService) RedeemTicket(ticket string) (string, time.Time, error) {
+	return s.storage.RedeemTicket(hashTicket(ticket))
+}
+
+// hashTicket keeps plain tickets out of the database.
+func hashTicket(ticket string) string {
+	sum := sha256.Sum256([]byte(ticket))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,564 @@
+package storage
+
+import (
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const classSessionColumns = `
+	id, course_id, title, starts_at, late_after, checkin_closes_at,
+	COALESCE(created_by::text, ''), created_at, updated_at`
+
+// userSummaryColumns reads the public details of a user joined as u.
+const userSummaryColumns = `
+	u.id, u.email, COALESCE(u.username, ''), COALESCE(u.first_name, ''),
+	COALESCE(u.last_name, ''), COALESCE(u.avatar, '')`
+
+// sessionStudents lists who a session's attendance is reported for: the
+// current students of the course and anyone with a record for the session,
+// e.g. a student who left the course since. It expects the session as se.
+const sessionStudents = `
+	SELECT user_id FROM course_members WHERE course_id = se.course_id AND role = 1
+	UNION
+	SELECT user_id FROM attendance_records WHERE session_id = se.id`
+
+type AttendanceStorage struct {
+	DB *sql.DB
+}
+
+func NewAttendanceStorage(db *sql.DB) *AttendanceStorage {
+	return &AttendanceStorage{
+		DB: db,
+	}
+}
+
+func (s *AttendanceStorage) CheckCourseMember(courseID, userID string) error {
+	var isMember bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM course_members WHERE course_id = $1 AND user_id = $2
+		) OR EXISTS (
+			SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2
+		)
+	`, courseID, userID).Scan(&isMember)
+	if err != nil {
+		return fmt.Errorf("failed to check membership of course %s: %v", courseID, err)
+	}
+	if !isMember {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "You are not a member of this course"}
+	}
+	return nil
+}
+
+// IsCourseStaff reports whether the user is the course admin or a member with
+// the moderator or instructor role.
+func (s *AttendanceStorage) IsCourseStaff(courseID, userID string) (bool, error) {
+	var isStaff bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2
+		) OR EXISTS (
+			SELECT 1 FROM course_members
+			WHERE course_id = $1 AND user_id = $2 AND role >= 2
+		)
+	`, courseID, userID).Scan(&isStaff)
+	if err != nil {
+		return false, fmt.Errorf("failed to check staff permission in course %s: %v", courseID, err)
+	}
+	return isStaff, nil
+}
+
+func (s *AttendanceStorage) CheckCourseStaff(courseID, userID string) error {
+	isStaff, err := s.IsCourseStaff(courseID, userID)
+	if err != nil {
+		return err
+	}
+	if !isStaff {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "Only course staff can manage attendance"}
+	}
+	return nil
+}
+
+// CheckStudent makes sure attendance can be recorded for the user, that is
+// the user is a member of the course.
+func (s *AttendanceStorage) CheckStudent(courseID, userID string) error {
+	var isMember bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM course_members WHERE course_id = $1 AND user_id = $2)
+	`, courseID, userID).Scan(&isMember)
+	if err != nil {
+		return fmt.Errorf("failed to check membership of course %s: %v", courseID, err)
+	}
+	if !isMember {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Member not found in this course"}
+	}
+	return nil
+}
+
+func (s *AttendanceStorage) CreateSession(session *types.ClassSession, secret string) error {
+	query := `
+		INSERT INTO class_sessions (course_id, title, starts_at, late_after, checkin_secret, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		RETURNING id, created_at, updated_at
+	`
+	err := s.DB.QueryRow(
+		query,
+		session.CourseID,
+		session.Title,
+		session.StartsAt,
+		session.LateAfter,
+		secret,
+		session.CreatedBy,
+		time.Now().UTC(),
+	).Scan(&session.ID, &session.CreatedAt, &session.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create class session in course %s: %v", session.CourseID, err)
+	}
+
+	log.Printf("Successfully created class session %s in course %s by user %s", session.ID, session.CourseID, session.CreatedBy)
+	return nil
+}
+
+func (s *AttendanceStorage) GetSession(sessionID string) (*types.ClassSession, error) {
+	row := s.DB.QueryRow(`SELECT `+classSessionColumns+` FROM class_sessions WHERE id = $1`, sessionID)
+	session, err := scanClassSession(row)
+	if err == sql.ErrNoRows {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Class session not found"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.fillCounts(`se.id = $1`, sessionID, []*types.ClassSession{session}); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetSessions returns the sessions of a course, latest first.
+func (s *AttendanceStorage) GetSessions(courseID string) ([]*types.ClassSession, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+classSessionColumns+`
+		FROM class_sessions
+		WHERE course_id = $1
+		ORDER BY starts_at DESC, id
+	`, courseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query class sessions of course %s: %v", courseID, err)
+	}
+	defer rows.Close()
+
+	sessions := []*types.ClassSession{}
+	for rows.Next() {
+		session, err := scanClassSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over class session rows: %v", err)
+	}
+
+	if err := s.fillCounts(`se.course_id = $1`, courseID, sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// fillCounts sets the number of students per status of the sessions matching
+// the condition.
+func (s *AttendanceStorage) fillCounts(condition, arg string, sessions []*types.ClassSession) error {
+	byID := make(map[string]*types.ClassSession, len(sessions))
+	for _, session := range sessions {
+		session.Counts = map[string]int{}
+		for _, status := range types.AttendanceStatuses {
+			session.Counts[status] = 0
+		}
+		byID[session.ID] = session
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT se.id, COALESCE(r.status, 'absent'), COUNT(*)
+		FROM class_sessions se
+		JOIN LATERAL (`+sessionStudents+`) st ON TRUE
+		LEFT JOIN attendance_records r ON r.session_id = se.id AND r.user_id = st.user_id
+		WHERE `+condition+`
+		GROUP BY se.id, 2
+	`, arg)
+	if err != nil {
+		return fmt.Errorf("failed to count attendance: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sessionID, status string
+		var count int
+		if err := rows.Scan(&sessionID, &status, &count); err != nil {
+			return fmt.Errorf("error scanning attendance count: %v", err)
+		}
+		if session, ok := byID[sessionID]; ok {
+			session.Counts[status] = count
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over attendance count rows: %v", err)
+	}
+	return nil
+}
+
+func (s *AttendanceStorage) UpdateSession(session *types.ClassSession) error {
+	err := s.DB.QueryRow(`
+		UPDATE class_sessions
+		SET title = $2, starts_at = $3, late_after = $4, updated_at = $5
+		WHERE id = $1
+		RETURNING updated_at
+	`, session.ID, session.Title, session.StartsAt, session.LateAfter, time.Now().UTC()).Scan(&session.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Class session not found"}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update class session %s: %v", session.ID, err)
+	}
+
+	log.Printf("Successfully updated class session %s", session.ID)
+	return nil
+}
+
+func (s *AttendanceStorage) DeleteSession(sessionID string) error {
+	result, err := s.DB.Exec(`DELETE FROM class_sessions WHERE id = $1`, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to delete class session %s: %v", sessionID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Class session not found"}
+	}
+
+	log.Printf("Successfully deleted class session %s", sessionID)
+	return nil
+}
+
+// OpenCheckIn accepts check-ins until closesAt with codes derived from a new
+// secret, so codes shown before no longer work.
+func (s *AttendanceStorage) OpenCheckIn(sessionID, secret string, closesAt time.Time) error {
+	result, err := s.DB.Exec(`
+		UPDATE class_sessions
+		SET checkin_secret = $2, checkin_closes_at = $3, updated_at = $4
+		WHERE id = $1
+	`, sessionID, secret, closesAt, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to open check-in of class session %s: %v", sessionID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Class session not found"}
+	}
+
+	log.Printf("Successfully opened check-in of class session %s until %s", sessionID, closesAt.Format(time.RFC3339))
+	return nil
+}
+
+func (s *AttendanceStorage) CloseCheckIn(sessionID string) error {
+	result, err := s.DB.Exec(`
+		UPDATE class_sessions SET checkin_closes_at = NULL, updated_at = $2 WHERE id = $1
+	`, sessionID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to close check-in of class session %s: %v", sessionID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Class session not found"}
+	}
+
+	log.Printf("Successfully closed check-in of class session %s", sessionID)
+	return nil
+}
+
+// GetOpenCheckIns returns the sessions accepting check-ins at now, with the
+// course staff their codes are shown to.
+func (s *AttendanceStorage) GetOpenCheckIns(now time.Time) ([]types.OpenCheckIn, error) {
+	rows, err := s.DB.Query(`
+		SELECT se.id, se.course_id, se.checkin_secret, se.late_after,
+		       (SELECT COUNT(*) FROM attendance_records r WHERE r.session_id = se.id AND r.checked_in_at IS NOT NULL),
+		       ARRAY(
+		           SELECT admin_id::text FROM courses WHERE id = se.course_id AND admin_id IS NOT NULL
+		           UNION
+		           SELECT user_id::text FROM course_members WHERE course_id = se.course_id AND role >= 2
+		       )
+		FROM class_sessions se
+		WHERE se.checkin_closes_at > $1
+	`, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query open check-ins: %v", err)
+	}
+	defer rows.Close()
+
+	return scanOpenCheckIns(rows)
+}
+
+// GetCheckIn returns the session if it accepts check-ins at now.
+func (s *AttendanceStorage) GetCheckIn(sessionID string, now time.Time) (*types.OpenCheckIn, error) {
+	var checkIn types.OpenCheckIn
+	err := s.DB.QueryRow(`
+		SELECT se.id, se.course_id, se.checkin_secret, se.late_after,
+		       (SELECT COUNT(*) FROM attendance_records r WHERE r.session_id = se.id AND r.checked_in_at IS NOT NULL)
+		FROM class_sessions se
+		WHERE se.id = $1 AND se.checkin_closes_at > $2
+	`, sessionID, now).Scan(&checkIn.SessionID, &checkIn.CourseID, &checkIn.Secret, &checkIn.LateAfter, &checkIn.CheckedIn)
+	if err == sql.ErrNoRows {
+		return nil, &utils.ApiError{Code: http.StatusConflict, Message: "Check-in is not open for this session"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get check-in of class session %s: %v", sessionID, err)
+	}
+	return &checkIn, nil
+}
+
+// GetUserCheckIns returns the sessions accepting check-ins at now in the
+// courses the user is a member of.
+func (s *AttendanceStorage) GetUserCheckIns(userID string, now time.Time) ([]types.OpenCheckIn, error) {
+	rows, err := s.DB.Query(`
+		SELECT se.id, se.course_id, se.checkin_secret, se.late_after, 0, '{}'::text[]
+		FROM class_sessions se
+		JOIN course_members cm ON cm.course_id = se.course_id AND cm.user_id = $1
+		WHERE se.checkin_closes_at > $2
+	`, userID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query open check-ins of user %s: %v", userID, err)
+	}
+	defer rows.Close()
+
+	return scanOpenCheckIns(rows)
+}
+
+// CheckIn records the user as checked in with the status, unless the user
+// already has a record for the session. It returns the record the user ends
+// up with and whether it was created.
+func (s *AttendanceStorage) CheckIn(sessionID, userID, status string, at time.Time) (string, bool, error) {
+	var recorded string
+	var created bool
+	err := s.DB.QueryRow(`
+		WITH inserted AS (
+			INSERT INTO attendance_records (session_id, user_id, status, checked_in_at, updated_at)
+			VALUES ($1, $2, $3, $4, $4)
+			ON CONFLICT (session_id, user_id) DO NOTHING
+			RETURNING status
+		)
+		SELECT status, TRUE FROM inserted
+		UNION ALL
+		SELECT status, FALSE FROM attendance_records WHERE session_id = $1 AND user_id = $2
+		LIMIT 1
+	`, sessionID, userID, status, at).Scan(&recorded, &created)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to check in user %s to class session %s: %v", userID, sessionID, err)
+	}
+
+	if created {
+		log.Printf("Successfully checked in user %s to class session %s as %s", userID, sessionID, status)
+	}
+	return recorded, created, nil
+}
+
+// SetRecord sets the status of the user at the session by hand. The check-in
+// time, if any, is kept.
+func (s *AttendanceStorage) SetRecord(sessionID, userID, status, note, markedBy string) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO attendance_records (session_id, user_id, status, marked_by, note, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (session_id, user_id) DO UPDATE
+		SET status = EXCLUDED.status,
+		    marked_by = EXCLUDED.marked_by,
+		    note = EXCLUDED.note,
+		    updated_at = EXCLUDED.updated_at
+	`, sessionID, userID, status, markedBy, note, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to set attendance of user %s at class session %s: %v", userID, sessionID, err)
+	}
+
+	log.Printf("Successfully set attendance of user %s at class session %s to %s by user %s", userID, sessionID, status, markedBy)
+	return nil
+}
+
+// GetSessionRecords returns the attendance of every student of the session,
+// ordered by name.
+func (s *AttendanceStorage) GetSessionRecords(sessionID string) ([]types.AttendanceRecord, error) {
+	rows, err := s.DB.Query(`
+		SELECT se.id, '', NULL::timestamp, `+userSummaryColumns+`,
+		       r.status, r.checked_in_at, COALESCE(r.marked_by::text, ''), COALESCE(r.note, ''), r.updated_at
+		FROM class_sessions se
+		JOIN LATERAL (`+sessionStudents+`) st ON TRUE
+		JOIN users u ON u.id = st.user_id
+		LEFT JOIN attendance_records r ON r.session_id = se.id AND r.user_id = st.user_id
+		WHERE se.id = $1
+		ORDER BY u.last_name, u.first_name, u.id
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attendance of class session %s: %v", sessionID, err)
+	}
+	defer rows.Close()
+
+	return scanAttendanceRecords(rows)
+}
+
+// GetCourseRecords returns the attendance at the sessions of the course that
+// started before now, of one student or, when userID is empty, of every
+// student. Records are ordered by student and session.
+func (s *AttendanceStorage) GetCourseRecords(courseID, userID string, now time.Time) ([]types.AttendanceRecord, error) {
+	rows, err := s.DB.Query(`
+		SELECT se.id, se.title, se.starts_at, `+userSummaryColumns+`,
+		       r.status, r.checked_in_at, COALESCE(r.marked_by::text, ''), COALESCE(r.note, ''), r.updated_at
+		FROM class_sessions se
+		JOIN LATERAL (`+sessionStudents+`) st ON TRUE
+		JOIN users u ON u.id = st.user_id
+		LEFT JOIN attendance_records r ON r.session_id = se.id AND r.user_id = st.user_id
+		WHERE se.course_id = $1 AND se.starts_at <= $2
+		  AND ($3::uuid IS NULL OR st.user_id = $3::uuid)
+		ORDER BY u.last_name, u.first_name, u.id, se.starts_at, se.id
+	`, courseID, now, sql.NullString{String: userID, Valid: userID != ""})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attendance of course %s: %v", courseID, err)
+	}
+	defer rows.Close()
+
+	return scanAttendanceRecords(rows)
+}
+
+// GetStudent returns the user attendance is reported for.
+func (s *AttendanceStorage) GetStudent(userID string) (*types.User, error) {
+	var user types.User
+	err := s.DB.QueryRow(`
+		SELECT `+userSummaryColumns+` FROM users u WHERE u.id = $1
+	`, userID).Scan(&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName, &user.Avatar)
+	if err == sql.ErrNoRows {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "User not found"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %s: %v", userID, err)
+	}
+	user.Avatar = utils.NormalizeMedia(user.Avatar)
+	return &user, nil
+}
+
+func scanClassSession(row rowScanner) (*types.ClassSession, error) {
+	var session types.ClassSession
+	var closesAt sql.NullTime
+	err := row.Scan(
+		&session.ID,
+		&session.CourseID,
+		&session.Title,
+		&session.StartsAt,
+		&session.LateAfter,
+		&closesAt,
+		&session.CreatedBy,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error scanning class session: %v", err)
+	}
+
+	if closesAt.Valid && closesAt.Time.After(time.Now().UTC()) {
+		session.CheckInOpen = true
+		session.CheckInClosesAt = &closesAt.Time
+	}
+	return &session, nil
+}
+
+func scanOpenCheckIns(rows *sql.Rows) ([]types.OpenCheckIn, error) {
+	var checkIns []types.OpenCheckIn
+	for rows.Next() {
+		var checkIn types.OpenCheckIn
+		if err := rows.Scan(
+			&checkIn.SessionID,
+			&checkIn.CourseID,
+			&checkIn.Secret,
+			&checkIn.LateAfter,
+			&checkIn.CheckedIn,
+			pq.Array(&checkIn.StaffIDs),
+		); err != nil {
+			return nil, fmt.Errorf("error scanning open check-in: %v", err)
+		}
+		checkIns = append(checkIns, checkIn)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over open check-in rows: %v", err)
+	}
+	return checkIns, nil
+}
+
+// scanAttendanceRecords reads records of students, reporting those without a
+// record as absent.
+func scanAttendanceRecords(rows *sql.Rows) ([]types.AttendanceRecord, error) {
+	records := []types.AttendanceRecord{}
+	for rows.Next() {
+		var record types.AttendanceRecord
+		var startsAt, checkedInAt, updatedAt sql.NullTime
+		var status sql.NullString
+		if err := rows.Scan(
+			&record.SessionID,
+			&record.SessionTitle,
+			&startsAt,
+			&record.User.ID,
+			&record.User.Email,
+			&record.User.Username,
+			&record.User.FirstName,
+			&record.User.LastName,
+			&record.User.Avatar,
+			&status,
+			&checkedInAt,
+			&record.MarkedBy,
+			&record.Note,
+			&updatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning attendance record: %v", err)
+		}
+
+		record.User.Avatar = utils.NormalizeMedia(record.User.Avatar)
+		record.Status = types.AttendanceAbsent
+		if status.Valid {
+			record.Status = status.String
+			record.Recorded = true
+		}
+		if startsAt.Valid {
+			record.StartsAt = &startsAt.Time
+		}
+		if checkedInAt.Valid {
+			record.CheckedInAt = &checkedInAt.Time
+		}
+		if updatedAt.Valid {
+			record.UpdatedAt = &updatedAt.Time
+		}
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over attendance record rows: %v", err)
+	}
+	return records, nil
+}
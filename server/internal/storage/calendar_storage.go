@@ -0,0 +1,438 @@
+package storage
+
+import (
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// timestampLayout reads timestamps cast to text by Postgres.
+const timestampLayout = "2006-01-02 15:04:05.999999999"
+
+const courseEventColumns = `
+	e.id, e.course_id, c.name, e.uid, e.title, e.description, e.location, e.kind,
+	e.starts_at, e.ends_at, e.all_day, e.timezone, e.rrule, e.exdates::text[], e.last_ends_at,
+	COALESCE(e.created_by::text, ''), e.created_at, e.updated_at`
+
+type CalendarStorage struct {
+	DB *sql.DB
+}
+
+func NewCalendarStorage(db *sql.DB) *CalendarStorage {
+	return &CalendarStorage{
+		DB: db,
+	}
+}
+
+func (s *CalendarStorage) CheckCourseMember(courseID, userID string) error {
+	var isMember bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM course_members WHERE course_id = $1 AND user_id = $2
+		) OR EXISTS (
+			SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2
+		)
+	`, courseID, userID).Scan(&isMember)
+	if err != nil {
+		return fmt.Errorf("failed to check membership of course %s: %v", courseID, err)
+	}
+	if !isMember {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "You are not a member of this course"}
+	}
+	return nil
+}
+
+// CheckCourseStaff allows the course admin and members with the moderator or
+// instructor role.
+func (s *CalendarStorage) CheckCourseStaff(courseID, userID string) error {
+	var isStaff bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2
+		) OR EXISTS (
+			SELECT 1 FROM course_members
+			WHERE course_id = $1 AND user_id = $2 AND role >= 2
+		)
+	`, courseID, userID).Scan(&isStaff)
+	if err != nil {
+		return fmt.Errorf("failed to check staff permission in course %s: %v", courseID, err)
+	}
+	if !isStaff {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "Only course staff can manage events"}
+	}
+	return nil
+}
+
+func (s *CalendarStorage) CreateEvent(event *types.CourseEvent) error {
+	query := `
+		INSERT INTO course_events (
+			course_id, uid, title, description, location, kind, starts_at, ends_at,
+			all_day, timezone, rrule, exdates, last_ends_at, created_by, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12::timestamp[], $13, $14, $15, $15)
+		RETURNING id, created_at, updated_at
+	`
+	now := time.Now().UTC()
+	err := s.DB.QueryRow(
+		query,
+		event.CourseID,
+		event.UID,
+		event.Title,
+		event.Description,
+		event.Location,
+		event.Kind,
+		event.StartsAt,
+		event.EndsAt,
+		event.AllDay,
+		event.Timezone,
+		event.RRule,
+		formatTimestamps(event.ExDates),
+		event.LastEndsAt,
+		event.CreatedBy,
+		now,
+	).Scan(&event.ID, &event.CreatedAt, &event.UpdatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return &utils.ApiError{Code: http.StatusConflict, Message: "An event with this UID already exists in the course"}
+		}
+		return fmt.Errorf("failed to create event in course %s: %v", event.CourseID, err)
+	}
+
+	log.Printf("Successfully created event %s in course %s by user %s", event.ID, event.CourseID, event.CreatedBy)
+	return nil
+}
+
+func (s *CalendarStorage) GetEvent(eventID string) (*types.CourseEvent, error) {
+	row := s.DB.QueryRow(`
+		SELECT `+courseEventColumns+`
+		FROM course_events e
+		JOIN courses c ON c.id = e.course_id
+		WHERE e.id = $1
+	`, eventID)
+	event, err := scanCourseEvent(row)
+	if err == sql.ErrNoRows {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Event not found"}
+	}
+	return event, err
+}
+
+// UpdateEvent replaces the details of an event. Its course and UID do not
+// change.
+func (s *CalendarStorage) UpdateEvent(event *types.CourseEvent) error {
+	query := `
+		UPDATE course_events
+		SET title = $2, description = $3, location = $4, kind = $5, starts_at = $6, ends_at = $7,
+		    all_day = $8, timezone = $9, rrule = $10, exdates = $11::timestamp[], last_ends_at = $12, updated_at = $13
+		WHERE id = $1
+		RETURNING updated_at
+	`
+	err := s.DB.QueryRow(
+		query,
+		event.ID,
+		event.Title,
+		event.Description,
+		event.Location,
+		event.Kind,
+		event.StartsAt,
+		event.EndsAt,
+		event.AllDay,
+		event.Timezone,
+		event.RRule,
+		formatTimestamps(event.ExDates),
+		event.LastEndsAt,
+		time.Now().UTC(),
+	).Scan(&event.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Event not found"}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update event %s: %v", event.ID, err)
+	}
+
+	log.Printf("Successfully updated event %s", event.ID)
+	return nil
+}
+
+func (s *CalendarStorage) DeleteEvent(eventID string) error {
+	result, err := s.DB.Exec(`DELETE FROM course_events WHERE id = $1`, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to delete event %s: %v", eventID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Event not found"}
+	}
+
+	log.Printf("Successfully deleted event %s", eventID)
+	return nil
+}
+
+// GetEvents returns the events of the courses that may have occurrences
+// between from and to, ordered by their first start. Zero times leave the
+// range open.
+func (s *CalendarStorage) GetEvents(courseIDs []string, from, to time.Time) ([]types.CourseEvent, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+courseEventColumns+`
+		FROM course_events e
+		JOIN courses c ON c.id = e.course_id
+		WHERE e.course_id = ANY($1::uuid[])
+		  AND ($2::timestamp IS NULL OR e.last_ends_at IS NULL OR e.last_ends_at >= $2)
+		  AND ($3::timestamp IS NULL OR e.starts_at < $3)
+		ORDER BY e.starts_at, e.id
+	`, pq.Array(courseIDs), sql.NullTime{Time: from, Valid: !from.IsZero()}, sql.NullTime{Time: to, Valid: !to.IsZero()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query course events: %v", err)
+	}
+	defer rows.Close()
+
+	events := []types.CourseEvent{}
+	for rows.Next() {
+		event, err := scanCourseEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over course event rows: %v", err)
+	}
+
+	return events, nil
+}
+
+// GetBookingEvents returns the office hour bookings of the user in the
+// courses between from and to as events. Zero times leave the range open.
+func (s *CalendarStorage) GetBookingEvents(userID string, courseIDs []string, from, to time.Time) ([]types.CourseEvent, error) {
+	rows, err := s.DB.Query(`
+		SELECT b.id, o.course_id, c.name, o.title, o.location, b.starts_at, b.ends_at, b.note, b.created_at
+		FROM office_hour_bookings b
+		JOIN office_hours o ON o.id = b.office_hour_id
+		JOIN courses c ON c.id = o.course_id
+		WHERE b.user_id = $1 AND o.course_id = ANY($2::uuid[])
+		  AND ($3::timestamp IS NULL OR b.ends_at >= $3)
+		  AND ($4::timestamp IS NULL OR b.starts_at < $4)
+		ORDER BY b.starts_at, b.id
+	`, userID, pq.Array(courseIDs), sql.NullTime{Time: from, Valid: !from.IsZero()}, sql.NullTime{Time: to, Valid: !to.IsZero()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query office hour bookings of user %s: %v", userID, err)
+	}
+	defer rows.Close()
+
+	events := []types.CourseEvent{}
+	for rows.Next() {
+		var event types.CourseEvent
+		if err := rows.Scan(
+			&event.ID,
+			&event.CourseID,
+			&event.CourseName,
+			&event.Title,
+			&event.Location,
+			&event.StartsAt,
+			&event.EndsAt,
+			&event.Description,
+			&event.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning office hour booking: %v", err)
+		}
+
+		event.UID = "office-hours-booking-" + event.ID + "@course-flow"
+		event.Title = "Booked: " + event.Title
+		event.Kind = types.CalendarOfficeHours
+		event.Timezone = "UTC"
+		event.ExDates = []time.Time{}
+		event.UpdatedAt = event.CreatedAt
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over office hour booking rows: %v", err)
+	}
+
+	return events, nil
+}
+
+// ImportEvents adds the events to the course, replacing the events that have
+// the same UID, and returns how many were created and updated.
+func (s *CalendarStorage) ImportEvents(courseID, userID string, events []types.CourseEvent) (int, int, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO course_events (
+			course_id, uid, title, description, location, kind, starts_at, ends_at,
+			all_day, timezone, rrule, exdates, last_ends_at, created_by, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12::timestamp[], $13, $14, $15, $15)
+		ON CONFLICT (course_id, uid) DO UPDATE
+		SET title = EXCLUDED.title,
+		    description = EXCLUDED.description,
+		    location = EXCLUDED.location,
+		    kind = EXCLUDED.kind,
+		    starts_at = EXCLUDED.starts_at,
+		    ends_at = EXCLUDED.ends_at,
+		    all_day = EXCLUDED.all_day,
+		    timezone = EXCLUDED.timezone,
+		    rrule = EXCLUDED.rrule,
+		    exdates = EXCLUDED.exdates,
+		    last_ends_at = EXCLUDED.last_ends_at,
+		    updated_at = EXCLUDED.updated_at
+		RETURNING xmax = 0
+	`
+	now := time.Now().UTC()
+	created, updated := 0, 0
+	for _, event := range events {
+		var inserted bool
+		err := tx.QueryRow(
+			query,
+			courseID,
+			event.UID,
+			event.Title,
+			event.Description,
+			event.Location,
+			event.Kind,
+			event.StartsAt,
+			event.EndsAt,
+			event.AllDay,
+			event.Timezone,
+			event.RRule,
+			formatTimestamps(event.ExDates),
+			event.LastEndsAt,
+			userID,
+			now,
+		).Scan(&inserted)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to import event %s into course %s: %v", event.UID, courseID, err)
+		}
+		if inserted {
+			created++
+		} else {
+			updated++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	log.Printf("Successfully imported %d new and %d updated events into course %s by user %s", created, updated, courseID, userID)
+	return created, updated, nil
+}
+
+// GetFeedToken returns the calendar feed token of the user, saving the given
+// one if the user has none yet.
+func (s *CalendarStorage) GetFeedToken(userID, newToken string) (string, error) {
+	var token string
+	err := s.DB.QueryRow(`
+		WITH inserted AS (
+			INSERT INTO calendar_feed_tokens (user_id, token, created_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id) DO NOTHING
+			RETURNING token
+		)
+		SELECT token FROM inserted
+		UNION ALL
+		SELECT token FROM calendar_feed_tokens WHERE user_id = $1
+		LIMIT 1
+	`, userID, newToken, time.Now().UTC()).Scan(&token)
+	if err != nil {
+		return "", fmt.Errorf("failed to get calendar feed token of user %s: %v", userID, err)
+	}
+	return token, nil
+}
+
+// RotateFeedToken replaces the calendar feed token of the user, so the old
+// feed URL stops working.
+func (s *CalendarStorage) RotateFeedToken(userID, token string) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO calendar_feed_tokens (user_id, token, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET token = EXCLUDED.token, created_at = EXCLUDED.created_at
+	`, userID, token, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to rotate calendar feed token of user %s: %v", userID, err)
+	}
+
+	log.Printf("Successfully rotated calendar feed token of user %s", userID)
+	return nil
+}
+
+// GetFeedUser returns the user a calendar feed token belongs to.
+func (s *CalendarStorage) GetFeedUser(token string) (string, error) {
+	var userID string
+	err := s.DB.QueryRow(`SELECT user_id FROM calendar_feed_tokens WHERE token = $1`, token).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", &utils.ApiError{Code: http.StatusNotFound, Message: "Calendar not found"}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up calendar feed token: %v", err)
+	}
+	return userID, nil
+}
+
+func scanCourseEvent(row rowScanner) (*types.CourseEvent, error) {
+	var event types.CourseEvent
+	var exDates []string
+	var lastEndsAt sql.NullTime
+	err := row.Scan(
+		&event.ID,
+		&event.CourseID,
+		&event.CourseName,
+		&event.UID,
+		&event.Title,
+		&event.Description,
+		&event.Location,
+		&event.Kind,
+		&event.StartsAt,
+		&event.EndsAt,
+		&event.AllDay,
+		&event.Timezone,
+		&event.RRule,
+		pq.Array(&exDates),
+		&lastEndsAt,
+		&event.CreatedBy,
+		&event.CreatedAt,
+		&event.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error scanning course event: %v", err)
+	}
+
+	event.ExDates = []time.Time{}
+	for _, exDate := range exDates {
+		t, err := time.Parse(timestampLayout, exDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exdate %q of event %s: %v", exDate, event.ID, err)
+		}
+		event.ExDates = append(event.ExDates, t)
+	}
+	if lastEndsAt.Valid {
+		event.LastEndsAt = &lastEndsAt.Time
+	}
+	return &event, nil
+}
+
+func formatTimestamps(times []time.Time) interface{} {
+	values := make([]string, len(times))
+	for i, t := range times {
+		values[i] = t.UTC().Format(timestampLayout)
+	}
+	return pq.Array(values)
+}
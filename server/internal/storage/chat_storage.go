@@ -5,7 +5,11 @@ import (
 	"course-flow/internal/utils"
 	"database/sql"
 	"fmt"
+	"log"
+	"net/http"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type ChatStorage struct {
@@ -18,27 +22,310 @@ func NewChatStorage(db *sql.DB) *ChatStorage {
 	}
 }
 
+// CreateChatMessage stores a message and links the uploaded documents listed in
+// AttachmentIDs. Only documents uploaded by the sender that are not attached to
+// another message can be used.
 func (s *ChatStorage) CreateChatMessage(chatMsg *types.ChatMessage) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO messages (course_id, from_id, content, created_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO messages (course_id, conversation_id, from_id, content, parent_id, created_at)
+		VALUES (NULLIF($1, '')::uuid, NULLIF($2, '')::uuid, $3, $4, NULLIF($5, '')::uuid, $6)
 		RETURNING id, created_at
 	`
-	err := s.DB.QueryRow(
+	err = tx.QueryRow(
 		query,
 		chatMsg.CourseID,
+		chatMsg.ConversationID,
 		chatMsg.FromID,
 		chatMsg.Content,
+		chatMsg.ParentID,
 		time.Now().UTC(),
 	).Scan(&chatMsg.ID, &chatMsg.Timestamp)
 	if err != nil {
 		return fmt.Errorf("failed to create chat message: %v", err)
 	}
+
+	if len(chatMsg.AttachmentIDs) > 0 {
+		result, err := tx.Exec(`
+			INSERT INTO message_attachments (message_id, document_id)
+			SELECT $1, d.id
+			FROM documents d
+			WHERE d.id = ANY($2::uuid[]) AND d.user_id = $3
+			AND NOT EXISTS (SELECT 1 FROM message_attachments ma WHERE ma.document_id = d.id)`,
+			chatMsg.ID, pq.Array(chatMsg.AttachmentIDs), chatMsg.FromID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to attach documents: %v", err)
+		}
+		if rows, _ := result.RowsAffected(); int(rows) != len(chatMsg.AttachmentIDs) {
+			return &utils.ApiError{
+				Code:    http.StatusBadRequest,
+				Message: "Attachments must be your own uploads that are not used by another message",
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	if len(chatMsg.AttachmentIDs) > 0 {
+		attachments, err := s.getAttachments([]string{chatMsg.ID})
+		if err != nil {
+			return err
+		}
+		chatMsg.Attachments = attachments[chatMsg.ID]
+	}
+
+	return nil
+}
+
+// GetChatMessage returns a single message with its sender. Deleted messages are
+// returned with their content cleared.
+func (s *ChatStorage) GetChatMessage(messageID string) (*types.ChatMessage, error) {
+	query := `
+		SELECT m.id, COALESCE(m.course_id::text, ''), COALESCE(m.conversation_id::text, ''),
+		       m.content, m.created_at, m.edited_at, m.deleted_at,
+		       u.id, u.avatar, u.first_name, u.last_name, u.username, u.email
+		FROM messages m
+		LEFT JOIN users u ON m.from_id = u.id
+		WHERE m.id = $1
+	`
+
+	var (
+		msg                              types.ChatMessage
+		editedAt, deletedAt              sql.NullTime
+		uID, avatar, firstName, lastName sql.NullString
+		username, email                  sql.NullString
+	)
+	err := s.DB.QueryRow(query, messageID).Scan(
+		&msg.ID, &msg.CourseID, &msg.ConversationID, &msg.Content, &msg.Timestamp, &editedAt, &deletedAt,
+		&uID, &avatar, &firstName, &lastName, &username, &email,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Message not found"}
+		}
+		return nil, fmt.Errorf("failed to query message %s: %v", messageID, err)
+	}
+
+	msg.FromID = uID.String
+	msg.Sender = types.User{
+		ID:        uID.String,
+		Avatar:    utils.NormalizeMedia(avatar.String),
+		FirstName: firstName.String,
+		LastName:  lastName.String,
+		Username:  username.String,
+		Email:     email.String,
+	}
+	if editedAt.Valid {
+		msg.EditedAt = &editedAt.Time
+	}
+	if deletedAt.Valid {
+		msg.Deleted = true
+		msg.Content = ""
+	}
+
+	return &msg, nil
+}
+
+// EditChatMessage updates the content of a message. Only the original sender
+// can edit, and deleted messages cannot be edited.
+func (s *ChatStorage) EditChatMessage(chatMsg *types.ChatMessage) error {
+	query := `
+		UPDATE messages
+		SET content = $1, edited_at = $2
+		WHERE id = $3 AND from_id = $4 AND deleted_at IS NULL
+		AND course_id IS NOT DISTINCT FROM NULLIF($5, '')::uuid
+		AND conversation_id IS NOT DISTINCT FROM NULLIF($6, '')::uuid
+		RETURNING created_at, edited_at, COALESCE(parent_id::text, '')
+	`
+
+	var editedAt time.Time
+	err := s.DB.QueryRow(
+		query,
+		chatMsg.Content,
+		time.Now().UTC(),
+		chatMsg.ID,
+		chatMsg.FromID,
+		chatMsg.CourseID,
+		chatMsg.ConversationID,
+	).Scan(&chatMsg.Timestamp, &editedAt, &chatMsg.ParentID)
+	if err == sql.ErrNoRows {
+		return s.messageAccessError(chatMsg.ID, chatMsg.CourseID, chatMsg.ConversationID, "You can only edit your own messages")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to edit message %s: %v", chatMsg.ID, err)
+	}
+	chatMsg.EditedAt = &editedAt
+
+	attachments, err := s.getAttachments([]string{chatMsg.ID})
+	if err != nil {
+		return err
+	}
+	chatMsg.Attachments = attachments[chatMsg.ID]
+
+	log.Printf("Successfully edited message %s by user %s", chatMsg.ID, chatMsg.FromID)
+	return nil
+}
+
+// DeleteChatMessage soft deletes a message. The sender, the course admin and
+// moderators (role >= 2) are allowed to delete course messages. Direct messages
+// can only be deleted by their sender.
+func (s *ChatStorage) DeleteChatMessage(messageID, courseID, conversationID, userID string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var senderID sql.NullString
+	err = tx.QueryRow(`
+		SELECT from_id FROM messages
+		WHERE id = $1 AND deleted_at IS NULL
+		AND course_id IS NOT DISTINCT FROM NULLIF($2, '')::uuid
+		AND conversation_id IS NOT DISTINCT FROM NULLIF($3, '')::uuid`,
+		messageID, courseID, conversationID,
+	).Scan(&senderID)
+	if err == sql.ErrNoRows {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Message not found"}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query message %s: %v", messageID, err)
+	}
+
+	if senderID.String != userID {
+		if conversationID != "" {
+			return &utils.ApiError{Code: http.StatusForbidden, Message: "You are not authorized to delete this message"}
+		}
+
+		canModerate, err := s.canModerate(tx, courseID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to check moderator permission: %v", err)
+		}
+		if !canModerate {
+			return &utils.ApiError{Code: http.StatusForbidden, Message: "You are not authorized to delete this message"}
+		}
+	}
+
+	_, err = tx.Exec(
+		"UPDATE messages SET content = '', deleted_at = $1 WHERE id = $2",
+		time.Now().UTC(), messageID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete message %s: %v", messageID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	log.Printf("Successfully deleted message %s by user %s", messageID, userID)
 	return nil
 }
 
-func (s *ChatStorage) GetMessageByCourse(courseID, userID string) ([]types.ChatMessage, error) {
-	isMember, err := s.isCourseMember(courseID, userID)
+// MarkMessagesRead moves the user's read watermark for a course up to the given
+// message. The watermark never moves backwards.
+func (s *ChatStorage) MarkMessagesRead(courseID, userID, messageID string) (time.Time, error) {
+	var readAt time.Time
+	err := s.DB.QueryRow(
+		"SELECT created_at FROM messages WHERE id = $1 AND course_id = $2",
+		messageID, courseID,
+	).Scan(&readAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, &utils.ApiError{Code: http.StatusNotFound, Message: "Message not found"}
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query message %s: %v", messageID, err)
+	}
+
+	query := `
+		INSERT INTO message_reads (course_id, user_id, last_read_message_id, last_read_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (course_id, user_id) DO UPDATE
+		SET last_read_message_id = EXCLUDED.last_read_message_id,
+		    last_read_at = EXCLUDED.last_read_at
+		WHERE message_reads.last_read_at < EXCLUDED.last_read_at
+	`
+	if _, err := s.DB.Exec(query, courseID, userID, messageID, readAt); err != nil {
+		return time.Time{}, fmt.Errorf("failed to update read watermark: %v", err)
+	}
+
+	return readAt, nil
+}
+
+// MarkConversationRead moves the participant's read watermark for a
+// conversation up to the given message.
+func (s *ChatStorage) MarkConversationRead(conversationID, userID, messageID string) (time.Time, error) {
+	var readAt time.Time
+	err := s.DB.QueryRow(
+		"SELECT created_at FROM messages WHERE id = $1 AND conversation_id = $2",
+		messageID, conversationID,
+	).Scan(&readAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, &utils.ApiError{Code: http.StatusNotFound, Message: "Message not found"}
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query message %s: %v", messageID, err)
+	}
+
+	query := `
+		UPDATE conversation_participants
+		SET last_read_at = $3
+		WHERE conversation_id = $1 AND user_id = $2
+		AND (last_read_at IS NULL OR last_read_at < $3)
+	`
+	if _, err := s.DB.Exec(query, conversationID, userID, readAt); err != nil {
+		return time.Time{}, fmt.Errorf("failed to update conversation read watermark: %v", err)
+	}
+
+	return readAt, nil
+}
+
+// GetUnreadCounts returns the number of unread messages in every course the
+// user belongs to.
+func (s *ChatStorage) GetUnreadCounts(userID string) ([]types.ChatUnreadCount, error) {
+	query := `
+		SELECT cm.course_id, COUNT(m.id)
+		FROM course_members cm
+		LEFT JOIN message_reads r ON r.course_id = cm.course_id AND r.user_id = cm.user_id
+		LEFT JOIN messages m ON m.course_id = cm.course_id
+			AND m.deleted_at IS NULL
+			AND m.from_id IS DISTINCT FROM cm.user_id
+			AND (r.last_read_at IS NULL OR m.created_at > r.last_read_at)
+		WHERE cm.user_id = $1
+		GROUP BY cm.course_id
+	`
+
+	rows, err := s.DB.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unread counts for user %s: %v", userID, err)
+	}
+	defer rows.Close()
+
+	counts := []types.ChatUnreadCount{}
+	for rows.Next() {
+		var count types.ChatUnreadCount
+		if err := rows.Scan(&count.CourseID, &count.Unread); err != nil {
+			return nil, fmt.Errorf("error scanning unread count: %v", err)
+		}
+		counts = append(counts, count)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over unread count rows: %v", err)
+	}
+
+	return counts, nil
+}
+
+func (s *ChatStorage) GetMessageByCourse(courseID, userID string, page types.ChatPage) ([]types.ChatMessage, error) {
+	isMember, err := s.IsCourseMember(courseID, userID)
 	if err != nil {
 		return nil, &utils.ApiError{
 			Code:    500, // Internal Server Error
@@ -52,15 +339,45 @@ func (s *ChatStorage) GetMessageByCourse(courseID, userID string) ([]types.ChatM
 		}
 	}
 
+	return s.listMessages("m.course_id", courseID, page)
+}
+
+// GetMessagesByConversation returns the messages of a direct conversation.
+// Callers are responsible for checking that the user is a participant.
+func (s *ChatStorage) GetMessagesByConversation(conversationID string, page types.ChatPage) ([]types.ChatMessage, error) {
+	return s.listMessages("m.conversation_id", conversationID, page)
+}
+
+// listMessages returns the messages whose scope column matches scopeID in
+// chronological order. When the page has a limit, the newest messages before
+// page.Before are returned.
+func (s *ChatStorage) listMessages(scopeColumn, scopeID string, page types.ChatPage) ([]types.ChatMessage, error) {
 	query := `
-        SELECT m.id, m.course_id, m.content, m.created_at,
-               u.id, u.avatar, u.first_name, u.last_name, u.username, u.email
+        SELECT m.id, COALESCE(m.course_id::text, ''), COALESCE(m.conversation_id::text, ''),
+               m.content, m.created_at, m.edited_at, m.deleted_at,
+               u.id, u.avatar, u.first_name, u.last_name, u.username, u.email,
+               p.id, p.content, p.created_at, p.deleted_at,
+               pu.id, pu.avatar, pu.first_name, pu.last_name, pu.username
         FROM messages m
         JOIN users u ON m.from_id = u.id
-        WHERE m.course_id = $1
-        ORDER BY m.created_at ASC
+        LEFT JOIN messages p ON m.parent_id = p.id
+        LEFT JOIN users pu ON p.from_id = pu.id
+        WHERE ` + scopeColumn + ` = $1
     `
-	rows, err := s.DB.Query(query, courseID)
+	args := []interface{}{scopeID}
+
+	if page.Before != "" {
+		args = append(args, page.Before)
+		query += fmt.Sprintf(" AND m.created_at < (SELECT created_at FROM messages WHERE id = $%d)", len(args))
+	}
+	if page.Limit > 0 {
+		args = append(args, page.Limit)
+		query += fmt.Sprintf(" ORDER BY m.created_at DESC LIMIT $%d", len(args))
+	} else {
+		query += " ORDER BY m.created_at ASC"
+	}
+
+	rows, err := s.DB.Query(query, args...)
 	if err != nil {
 		return nil, &utils.ApiError{
 			Code:    500,
@@ -71,12 +388,21 @@ func (s *ChatStorage) GetMessageByCourse(courseID, userID string) ([]types.ChatM
 
 	var messages []types.ChatMessage
 	for rows.Next() {
-		var msg types.ChatMessage
-		var user types.User
+		var (
+			msg                                     types.ChatMessage
+			user                                    types.User
+			editedAt, deletedAt                     sql.NullTime
+			pID, pContent                           sql.NullString
+			pCreatedAt, pDeletedAt                  sql.NullTime
+			puID, puAvatar, puFirstName, puLastName sql.NullString
+			puUsername                              sql.NullString
+		)
 
 		err := rows.Scan(
-			&msg.ID, &msg.CourseID, &msg.Content, &msg.Timestamp,
+			&msg.ID, &msg.CourseID, &msg.ConversationID, &msg.Content, &msg.Timestamp, &editedAt, &deletedAt,
 			&user.ID, &user.Avatar, &user.FirstName, &user.LastName, &user.Username, &user.Email,
+			&pID, &pContent, &pCreatedAt, &pDeletedAt,
+			&puID, &puAvatar, &puFirstName, &puLastName, &puUsername,
 		)
 		if err != nil {
 			return nil, &utils.ApiError{
@@ -86,6 +412,38 @@ func (s *ChatStorage) GetMessageByCourse(courseID, userID string) ([]types.ChatM
 		}
 		user.Avatar = utils.NormalizeMedia(user.Avatar)
 		msg.Sender = user
+		msg.FromID = user.ID
+		if editedAt.Valid {
+			msg.EditedAt = &editedAt.Time
+		}
+		if deletedAt.Valid {
+			msg.Deleted = true
+			msg.Content = ""
+		}
+
+		// Attach the quoted parent for replies
+		if pID.Valid {
+			msg.ParentID = pID.String
+			msg.Parent = &types.ChatMessage{
+				ID:             pID.String,
+				CourseID:       msg.CourseID,
+				ConversationID: msg.ConversationID,
+				Content:        pContent.String,
+				Timestamp:      pCreatedAt.Time,
+				FromID:         puID.String,
+				Sender: types.User{
+					ID:        puID.String,
+					Avatar:    utils.NormalizeMedia(puAvatar.String),
+					FirstName: puFirstName.String,
+					LastName:  puLastName.String,
+					Username:  puUsername.String,
+				},
+			}
+			if pDeletedAt.Valid {
+				msg.Parent.Deleted = true
+				msg.Parent.Content = ""
+			}
+		}
 		messages = append(messages, msg)
 	}
 
@@ -96,10 +454,72 @@ func (s *ChatStorage) GetMessageByCourse(courseID, userID string) ([]types.ChatM
 		}
 	}
 
+	var messageIDs []string
+	for _, msg := range messages {
+		if !msg.Deleted {
+			messageIDs = append(messageIDs, msg.ID)
+		}
+	}
+	if len(messageIDs) > 0 {
+		attachments, err := s.getAttachments(messageIDs)
+		if err != nil {
+			return nil, err
+		}
+		for i := range messages {
+			messages[i].Attachments = attachments[messages[i].ID]
+		}
+	}
+
+	// Limited pages are fetched newest first, flip them back to chronological order
+	if page.Limit > 0 {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+
 	return messages, nil
 }
 
-func (s *ChatStorage) isCourseMember(courseID, userID string) (bool, error) {
+// getAttachments returns the documents attached to each message keyed by
+// message ID.
+func (s *ChatStorage) getAttachments(messageIDs []string) (map[string][]types.Document, error) {
+	query := `
+		SELECT ma.message_id, d.id, COALESCE(d.user_id::text, ''), d.file_name, d.file_path, d.file_type,
+		       d.file_size, COALESCE(d.thumbnail_path, ''), d.created_at, d.updated_at
+		FROM message_attachments ma
+		JOIN documents d ON d.id = ma.document_id
+		WHERE ma.message_id = ANY($1::uuid[])
+		ORDER BY d.created_at ASC
+	`
+
+	rows, err := s.DB.Query(query, pq.Array(messageIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message attachments: %v", err)
+	}
+	defer rows.Close()
+
+	attachments := make(map[string][]types.Document)
+	for rows.Next() {
+		var messageID string
+		var doc types.Document
+		err := rows.Scan(
+			&messageID, &doc.ID, &doc.UserID, &doc.FileName, &doc.FilePath, &doc.FileType,
+			&doc.FileSize, &doc.ThumbnailPath, &doc.CreatedAt, &doc.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning message attachment: %v", err)
+		}
+		attachments[messageID] = append(attachments[messageID], doc)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over attachment rows: %v", err)
+	}
+
+	return attachments, nil
+}
+
+func (s *ChatStorage) IsCourseMember(courseID, userID string) (bool, error) {
 	var exists bool
 	query := `
 		SELECT EXISTS (
@@ -114,3 +534,337 @@ func (s *ChatStorage) isCourseMember(courseID, userID string) (bool, error) {
 	}
 	return exists, nil
 }
+
+// messageAccessError works out whether a failed update was caused by a missing
+// message or by the user lacking permission.
+func (s *ChatStorage) messageAccessError(messageID, courseID, conversationID, forbiddenMessage string) error {
+	var exists bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM messages
+			WHERE id = $1 AND deleted_at IS NULL
+			AND course_id IS NOT DISTINCT FROM NULLIF($2, '')::uuid
+			AND conversation_id IS NOT DISTINCT FROM NULLIF($3, '')::uuid
+		)`,
+		messageID, courseID, conversationID,
+	).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check if message exists: %v", err)
+	}
+	if !exists {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Message not found"}
+	}
+	return &utils.ApiError{Code: http.StatusForbidden, Message: forbiddenMessage}
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// canModerate reports whether the user is the course admin or has at least the
+// moderator role in the course.
+func (s *ChatStorage) canModerate(q queryRower, courseID, userID string) (bool, error) {
+	var allowed bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2
+		) OR EXISTS (
+			SELECT 1 FROM course_members
+			WHERE course_id = $1 AND user_id = $2 AND role >= 2
+		)
+	`
+	err := q.QueryRow(query, courseID, userID).Scan(&allowed)
+	if err != nil {
+		return false, err
+	}
+	return allowed, nil
+}
+
+func (s *ChatStorage) CanModerate(courseID, userID string) (bool, error) {
+	allowed, err := s.canModerate(s.DB, courseID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check moderator permission: %v", err)
+	}
+	return allowed, nil
+}
+
+// GetChatSettings returns the chat settings of a course, falling back to the
+// defaults when none have been saved yet.
+func (s *ChatStorage) GetChatSettings(courseID string) (*types.ChatSettings, error) {
+	settings := types.ChatSettings{
+		CourseID:        courseID,
+		AllowStudentDMs: true,
+		BlockedWords:    []string{},
+		FilterMode:      types.ChatFilterReject,
+	}
+
+	query := `
+		SELECT allow_student_dms, slow_mode_seconds, staff_only, blocked_words, filter_mode, updated_at
+		FROM chat_settings
+		WHERE course_id = $1
+	`
+	err := s.DB.QueryRow(query, courseID).Scan(
+		&settings.AllowStudentDMs,
+		&settings.SlowModeSeconds,
+		&settings.StaffOnly,
+		pq.Array(&settings.BlockedWords),
+		&settings.FilterMode,
+		&settings.UpdatedAt,
+	)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to query chat settings for course %s: %v", courseID, err)
+	}
+
+	return &settings, nil
+}
+
+// UpdateChatSettings saves the chat settings of a course. Only the course admin
+// and instructors (role >= 3) can change them.
+func (s *ChatStorage) UpdateChatSettings(userID string, settings *types.ChatSettings) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var allowed bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2
+		) OR EXISTS (
+			SELECT 1 FROM course_members
+			WHERE course_id = $1 AND user_id = $2 AND role >= 3
+		)`,
+		settings.CourseID, userID,
+	).Scan(&allowed)
+	if err != nil {
+		return fmt.Errorf("failed to check instructor permission: %v", err)
+	}
+	if !allowed {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "Only instructors can change the chat settings"}
+	}
+
+	query := `
+		INSERT INTO chat_settings (course_id, allow_student_dms, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (course_id) DO UPDATE
+		SET allow_student_dms = EXCLUDED.allow_student_dms,
+		    updated_at = EXCLUDED.updated_at
+	`
+	settings.UpdatedAt = time.Now().UTC()
+	if _, err := tx.Exec(query, settings.CourseID, settings.AllowStudentDMs, settings.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to save chat settings: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	log.Printf("Successfully updated chat settings for course %s by user %s", settings.CourseID, userID)
+	return nil
+}
+
+// UpdateChatModeration saves the slow mode, staff-only and word filter settings
+// of a course chat. Moderators and above can change them.
+func (s *ChatStorage) UpdateChatModeration(userID string, settings *types.ChatSettings) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	allowed, err := s.canModerate(tx, settings.CourseID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check moderator permission: %v", err)
+	}
+	if !allowed {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "Only moderators can change chat moderation settings"}
+	}
+
+	query := `
+		INSERT INTO chat_settings (course_id, slow_mode_seconds, staff_only, blocked_words, filter_mode, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (course_id) DO UPDATE
+		SET slow_mode_seconds = EXCLUDED.slow_mode_seconds,
+		    staff_only = EXCLUDED.staff_only,
+		    blocked_words = EXCLUDED.blocked_words,
+		    filter_mode = EXCLUDED.filter_mode,
+		    updated_at = EXCLUDED.updated_at
+		RETURNING allow_student_dms
+	`
+	settings.UpdatedAt = time.Now().UTC()
+	err = tx.QueryRow(
+		query,
+		settings.CourseID,
+		settings.SlowModeSeconds,
+		settings.StaffOnly,
+		pq.Array(settings.BlockedWords),
+		settings.FilterMode,
+		settings.UpdatedAt,
+	).Scan(&settings.AllowStudentDMs)
+	if err != nil {
+		return fmt.Errorf("failed to save chat moderation settings: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	log.Printf("Successfully updated chat moderation for course %s by user %s", settings.CourseID, userID)
+	return nil
+}
+
+// MuteUser mutes a member of the course chat until mute.MutedUntil, replacing
+// any previous mute. Staff members cannot be muted.
+func (s *ChatStorage) MuteUser(mute *types.ChatMute) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	allowed, err := s.canModerate(tx, mute.CourseID, mute.MutedBy)
+	if err != nil {
+		return fmt.Errorf("failed to check moderator permission: %v", err)
+	}
+	if !allowed {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "Only moderators can mute members"}
+	}
+
+	var isMember bool
+	err = tx.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM course_members WHERE course_id = $1 AND user_id = $2)`,
+		mute.CourseID, mute.UserID,
+	).Scan(&isMember)
+	if err != nil {
+		return fmt.Errorf("failed to check course membership: %v", err)
+	}
+	if !isMember {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "User is not a member of this course"}
+	}
+
+	targetIsStaff, err := s.canModerate(tx, mute.CourseID, mute.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to check target role: %v", err)
+	}
+	if targetIsStaff {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "Moderators and instructors cannot be muted"}
+	}
+
+	query := `
+		INSERT INTO chat_mutes (course_id, user_id, muted_by, muted_until, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (course_id, user_id) DO UPDATE
+		SET muted_by = EXCLUDED.muted_by,
+		    muted_until = EXCLUDED.muted_until,
+		    created_at = EXCLUDED.created_at
+	`
+	mute.CreatedAt = time.Now().UTC()
+	if _, err := tx.Exec(query, mute.CourseID, mute.UserID, mute.MutedBy, mute.MutedUntil, mute.CreatedAt); err != nil {
+		return fmt.Errorf("failed to mute user: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	log.Printf("Successfully muted user %s in course %s until %s", mute.UserID, mute.CourseID, mute.MutedUntil.Format(time.RFC3339))
+	return nil
+}
+
+func (s *ChatStorage) UnmuteUser(courseID, userID, moderatorID string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	allowed, err := s.canModerate(tx, courseID, moderatorID)
+	if err != nil {
+		return fmt.Errorf("failed to check moderator permission: %v", err)
+	}
+	if !allowed {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "Only moderators can unmute members"}
+	}
+
+	result, err := tx.Exec(`DELETE FROM chat_mutes WHERE course_id = $1 AND user_id = $2`, courseID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to unmute user: %v", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "User is not muted"}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	log.Printf("Successfully unmuted user %s in course %s", userID, courseID)
+	return nil
+}
+
+// GetActiveMutes lists the mutes of a course that have not expired yet.
+func (s *ChatStorage) GetActiveMutes(courseID string) ([]types.ChatMute, error) {
+	query := `
+		SELECT course_id, user_id, COALESCE(muted_by::text, ''), muted_until, created_at
+		FROM chat_mutes
+		WHERE course_id = $1 AND muted_until > $2
+		ORDER BY muted_until ASC
+	`
+
+	rows, err := s.DB.Query(query, courseID, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query mutes for course %s: %v", courseID, err)
+	}
+	defer rows.Close()
+
+	mutes := []types.ChatMute{}
+	for rows.Next() {
+		var mute types.ChatMute
+		if err := rows.Scan(&mute.CourseID, &mute.UserID, &mute.MutedBy, &mute.MutedUntil, &mute.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning mute: %v", err)
+		}
+		mutes = append(mutes, mute)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over mute rows: %v", err)
+	}
+
+	return mutes, nil
+}
+
+// GetMuteUntil returns when the user's mute in the course ends, or nil when the
+// user is not muted.
+func (s *ChatStorage) GetMuteUntil(courseID, userID string) (*time.Time, error) {
+	var mutedUntil time.Time
+	err := s.DB.QueryRow(
+		`SELECT muted_until FROM chat_mutes WHERE course_id = $1 AND user_id = $2 AND muted_until > $3`,
+		courseID, userID, time.Now().UTC(),
+	).Scan(&mutedUntil)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query mute: %v", err)
+	}
+	return &mutedUntil, nil
+}
+
+// GetLastMessageTime returns when the user last posted in the course chat, or
+// nil when they never did.
+func (s *ChatStorage) GetLastMessageTime(courseID, userID string) (*time.Time, error) {
+	var lastAt sql.NullTime
+	err := s.DB.QueryRow(
+		`SELECT MAX(created_at) FROM messages WHERE course_id = $1 AND from_id = $2`,
+		courseID, userID,
+	).Scan(&lastAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query last message time: %v", err)
+	}
+	if !lastAt.Valid {
+		return nil, nil
+	}
+	return &lastAt.Time, nil
+}
@@ -56,13 +56,19 @@ func (s *CourseMemberStorage) ChangeRole(courseID, userID, memberID string, role
 		}
 	}
 
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
 	// Update the member's role
 	query := `
 		UPDATE course_members
 		SET role = $1
 		WHERE course_id = $2 AND user_id = $3
 	`
-	result, err := s.DB.Exec(query, role, courseID, memberID)
+	result, err := tx.Exec(query, role, courseID, memberID)
 	if err != nil {
 		return fmt.Errorf("Error updating role: %v", err)
 	}
@@ -76,6 +82,19 @@ func (s *CourseMemberStorage) ChangeRole(courseID, userID, memberID string, role
 		}
 	}
 
+	err = AppendOutboxEvent(tx, types.EventRoleChanged, courseID, types.NotifRoleChangedResponse{
+		ClassID: courseID,
+		UserID:  memberID,
+		Role:    role,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
 	log.Printf("Successfully changed role for member %s in course %s to role %d by user %s", memberID, courseID, role, userID)
 	return nil
 }
@@ -0,0 +1,292 @@
+package storage
+
+import (
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type ConversationStorage struct {
+	DB *sql.DB
+}
+
+func NewConversationStorage(db *sql.DB) *ConversationStorage {
+	return &ConversationStorage{
+		DB: db,
+	}
+}
+
+// CheckDMPolicy verifies that every user is a member of the course and that
+// the course allows the conversation. When student-to-student DMs are disabled
+// at least one participant has to be the course admin or staff (role >= 2).
+func (s *ConversationStorage) CheckDMPolicy(courseID string, userIDs []string) error {
+	query := `
+		SELECT
+			COUNT(cm.user_id),
+			COALESCE(BOOL_OR(cm.role >= 2 OR c.admin_id = cm.user_id), FALSE),
+			COALESCE((SELECT allow_student_dms FROM chat_settings WHERE course_id = $1), TRUE)
+		FROM courses c
+		LEFT JOIN course_members cm ON cm.course_id = c.id AND cm.user_id = ANY($2::uuid[])
+		WHERE c.id = $1
+		GROUP BY c.id
+	`
+
+	var (
+		memberCount     int
+		hasStaff        bool
+		allowStudentDMs bool
+	)
+	err := s.DB.QueryRow(query, courseID, pq.Array(userIDs)).Scan(&memberCount, &hasStaff, &allowStudentDMs)
+	if err == sql.ErrNoRows {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Course not found"}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check direct message policy: %v", err)
+	}
+
+	if memberCount != len(userIDs) {
+		return &utils.ApiError{
+			Code:    http.StatusForbidden,
+			Message: "Direct messages are only allowed between members of the same course",
+		}
+	}
+	if !allowStudentDMs && !hasStaff {
+		return &utils.ApiError{
+			Code:    http.StatusForbidden,
+			Message: "Student-to-student direct messages are disabled in this course",
+		}
+	}
+
+	return nil
+}
+
+// FindDirectConversation returns the ID of an existing one-to-one conversation
+// between exactly the given users in the course, or an empty string.
+func (s *ConversationStorage) FindDirectConversation(courseID string, userIDs []string) (string, error) {
+	query := `
+		SELECT c.id
+		FROM conversations c
+		WHERE c.course_id = $1 AND c.is_group = FALSE
+		AND ARRAY(SELECT user_id FROM conversation_participants WHERE conversation_id = c.id) @> $2::uuid[]
+		AND ARRAY(SELECT user_id FROM conversation_participants WHERE conversation_id = c.id) <@ $2::uuid[]
+		LIMIT 1
+	`
+
+	var conversationID string
+	err := s.DB.QueryRow(query, courseID, pq.Array(userIDs)).Scan(&conversationID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up direct conversation: %v", err)
+	}
+
+	return conversationID, nil
+}
+
+func (s *ConversationStorage) CreateConversation(conversation *types.Conversation, participantIDs []string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO conversations (course_id, created_by, is_group, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+	conversation.CreatedAt = time.Now().UTC()
+	err = tx.QueryRow(
+		query,
+		conversation.CourseID,
+		conversation.CreatedBy,
+		conversation.IsGroup,
+		conversation.CreatedAt,
+	).Scan(&conversation.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create conversation: %v", err)
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO conversation_participants (conversation_id, user_id, joined_at)
+		VALUES ($1, $2, $3)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare participant insert: %v", err)
+	}
+	defer stmt.Close()
+
+	for _, userID := range participantIDs {
+		if _, err := stmt.Exec(conversation.ID, userID, conversation.CreatedAt); err != nil {
+			return fmt.Errorf("failed to add participant %s: %v", userID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	log.Printf("Successfully created conversation %s in course %s by user %s", conversation.ID, conversation.CourseID, conversation.CreatedBy)
+	return nil
+}
+
+// GetConversation returns a conversation with its participants.
+func (s *ConversationStorage) GetConversation(conversationID string) (*types.Conversation, error) {
+	query := `
+		SELECT id, course_id, COALESCE(created_by::text, ''), is_group, created_at
+		FROM conversations
+		WHERE id = $1
+	`
+
+	var conversation types.Conversation
+	err := s.DB.QueryRow(query, conversationID).Scan(
+		&conversation.ID,
+		&conversation.CourseID,
+		&conversation.CreatedBy,
+		&conversation.IsGroup,
+		&conversation.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Conversation not found"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversation %s: %v", conversationID, err)
+	}
+
+	participants, err := s.getParticipants([]string{conversation.ID})
+	if err != nil {
+		return nil, err
+	}
+	conversation.Participants = participants[conversation.ID]
+
+	return &conversation, nil
+}
+
+// GetConversationsForUser lists the conversations of a user, most recently
+// active first, with the last message and the unread count.
+func (s *ConversationStorage) GetConversationsForUser(userID string) ([]types.Conversation, error) {
+	query := `
+		SELECT c.id, c.course_id, COALESCE(c.created_by::text, ''), c.is_group, c.created_at,
+		       lm.id, lm.content, lm.created_at, lm.from_id, lm.deleted_at,
+		       (
+		           SELECT COUNT(*) FROM messages m
+		           WHERE m.conversation_id = c.id
+		           AND m.deleted_at IS NULL
+		           AND m.from_id IS DISTINCT FROM cp.user_id
+		           AND (cp.last_read_at IS NULL OR m.created_at > cp.last_read_at)
+		       ) AS unread
+		FROM conversation_participants cp
+		JOIN conversations c ON c.id = cp.conversation_id
+		LEFT JOIN LATERAL (
+		    SELECT id, content, created_at, from_id, deleted_at
+		    FROM messages
+		    WHERE conversation_id = c.id
+		    ORDER BY created_at DESC
+		    LIMIT 1
+		) lm ON TRUE
+		WHERE cp.user_id = $1
+		ORDER BY COALESCE(lm.created_at, c.created_at) DESC
+	`
+
+	rows, err := s.DB.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversations for user %s: %v", userID, err)
+	}
+	defer rows.Close()
+
+	conversations := []types.Conversation{}
+	var conversationIDs []string
+	for rows.Next() {
+		var (
+			conversation              types.Conversation
+			lmID, lmContent, lmFromID sql.NullString
+			lmCreatedAt, lmDeletedAt  sql.NullTime
+		)
+
+		err := rows.Scan(
+			&conversation.ID, &conversation.CourseID, &conversation.CreatedBy, &conversation.IsGroup, &conversation.CreatedAt,
+			&lmID, &lmContent, &lmCreatedAt, &lmFromID, &lmDeletedAt,
+			&conversation.Unread,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning conversation: %v", err)
+		}
+
+		if lmID.Valid {
+			conversation.LastMessage = &types.ChatMessage{
+				ID:             lmID.String,
+				ConversationID: conversation.ID,
+				Content:        lmContent.String,
+				Timestamp:      lmCreatedAt.Time,
+				FromID:         lmFromID.String,
+				Deleted:        lmDeletedAt.Valid,
+			}
+			if lmDeletedAt.Valid {
+				conversation.LastMessage.Content = ""
+			}
+		}
+
+		conversations = append(conversations, conversation)
+		conversationIDs = append(conversationIDs, conversation.ID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over conversation rows: %v", err)
+	}
+
+	if len(conversationIDs) == 0 {
+		return conversations, nil
+	}
+
+	participants, err := s.getParticipants(conversationIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range conversations {
+		conversations[i].Participants = participants[conversations[i].ID]
+	}
+
+	return conversations, nil
+}
+
+// getParticipants returns the participants of each conversation keyed by
+// conversation ID.
+func (s *ConversationStorage) getParticipants(conversationIDs []string) (map[string][]types.User, error) {
+	query := `
+		SELECT cp.conversation_id, u.id, u.username, u.first_name, u.last_name, u.avatar
+		FROM conversation_participants cp
+		JOIN users u ON u.id = cp.user_id
+		WHERE cp.conversation_id = ANY($1::uuid[])
+		ORDER BY cp.joined_at ASC
+	`
+
+	rows, err := s.DB.Query(query, pq.Array(conversationIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversation participants: %v", err)
+	}
+	defer rows.Close()
+
+	participants := make(map[string][]types.User)
+	for rows.Next() {
+		var conversationID string
+		var user types.User
+		if err := rows.Scan(&conversationID, &user.ID, &user.Username, &user.FirstName, &user.LastName, &user.Avatar); err != nil {
+			return nil, fmt.Errorf("error scanning conversation participant: %v", err)
+		}
+		user.Avatar = utils.NormalizeMedia(user.Avatar)
+		participants[conversationID] = append(participants[conversationID], user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over participant rows: %v", err)
+	}
+
+	return participants, nil
+}
@@ -195,7 +195,9 @@ func (s *CourseStorage) CoursePreview(joinCode, userID string, showRole bool) (*
 	return &preview, nil
 }
 
-func (s *CourseStorage) LeaveCourse(courseID, userID string) error {
+// LeaveCourse removes the user from the course. kickedBy is the user who
+// removed them, or empty when they left.
+func (s *CourseStorage) LeaveCourse(courseID, userID, kickedBy string) error {
 	// First check if the user is the admin of the course
 	adminQuery := `
 		SELECT EXISTS (
@@ -244,6 +246,18 @@ func (s *CourseStorage) LeaveCourse(courseID, userID string) error {
 		}
 	}
 
+	if kickedBy != "" {
+		err = AppendOutboxEvent(tx, types.EventMemberKicked, courseID, types.NotifKickedResponse{
+			ClassID: courseID,
+			AdminID: kickedBy,
+			UserID:  userID,
+		})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
 	if err := tx.Commit(); err != nil {
 		tx.Rollback()
 		return err
@@ -376,30 +390,74 @@ func (s *CourseStorage) GetCourseByUserID(userID string, archieved bool) ([]*typ
 	return courses, nil
 }
 
-func (s *CourseStorage) JoinCourse(joinCode, userID string) error {
+// JoinCourse adds the user to the course with the join code and returns the
+// course ID.
+func (s *CourseStorage) JoinCourse(joinCode, userID string) (string, error) {
 	// Check if course exists
 	courseID, err := s.CheckCourseExists(joinCode)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// Check if user is already a member
 	isMember, err := s.CheckCourseMembership(courseID, userID)
 	if err != nil {
-		return err
+		return "", err
 	}
 	if isMember {
-		return &utils.ApiError{Code: http.StatusConflict, Message: "User is already a member of this course"}
+		return "", &utils.ApiError{Code: http.StatusConflict, Message: "User is already a member of this course"}
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %v", err)
 	}
+	defer tx.Rollback()
 
 	// Add user as a member
-	err = s.AddCourseMember(courseID, userID, 0) // 0 for member
+	_, err = tx.Exec(`INSERT INTO course_members (course_id, user_id, role) VALUES ($1, $2, 0)`, courseID, userID) // 0 for member
 	if err != nil {
-		return err
+		return "", fmt.Errorf("Error inserting course member: %v", err)
+	}
+
+	err = AppendOutboxEvent(tx, types.EventMemberJoined, courseID, types.NotifMemberJoinedResponse{
+		ClassID: courseID,
+		UserID:  userID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %v", err)
 	}
 
 	log.Printf("User %s successfully joined course %s", userID, courseID)
-	return nil
+	return courseID, nil
+}
+
+// GetCourseMemberIDs returns the IDs of every member of the course.
+func (s *CourseStorage) GetCourseMemberIDs(courseID string) ([]string, error) {
+	rows, err := s.DB.Query(`SELECT user_id FROM course_members WHERE course_id = $1`, courseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query members of course %s: %v", courseID, err)
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("error scanning member ID: %v", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over member rows: %v", err)
+	}
+
+	return userIDs, nil
 }
 
 func (s *CourseStorage) GetCoursesByInstructor(userID string) ([]*types.CourseListResponse, error) {
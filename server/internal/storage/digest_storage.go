@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"course-flow/internal/types"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+type DigestStorage struct {
+	DB *sql.DB
+}
+
+func NewDigestStorage(db *sql.DB) *DigestStorage {
+	return &DigestStorage{
+		DB: db,
+	}
+}
+
+func (s *DigestStorage) GetSettings(userID string) (*types.DigestSettings, error) {
+	settings := types.DigestSettings{Frequency: types.DigestOff}
+	var lastSentAt sql.NullTime
+	err := s.DB.QueryRow(
+		`SELECT frequency, last_sent_at FROM digest_settings WHERE user_id = $1`,
+		userID,
+	).Scan(&settings.Frequency, &lastSentAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to query digest settings for user %s: %v", userID, err)
+	}
+	if lastSentAt.Valid {
+		settings.LastSentAt = &lastSentAt.Time
+	}
+	return &settings, nil
+}
+
+func (s *DigestStorage) SetFrequency(userID, frequency string) error {
+	query := `
+		INSERT INTO digest_settings (user_id, frequency, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET frequency = EXCLUDED.frequency,
+		    updated_at = EXCLUDED.updated_at
+	`
+	if _, err := s.DB.Exec(query, userID, frequency, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to save digest frequency for user %s: %v", userID, err)
+	}
+
+	log.Printf("Successfully set digest frequency to %s for user %s", frequency, userID)
+	return nil
+}
+
+// GetDueRecipients returns the users whose daily or weekly digest is due and
+// who have unread notifications they were not emailed about yet. Digests are
+// opt-in, users without settings get none.
+func (s *DigestStorage) GetDueRecipients(dailyCutoff, weeklyCutoff time.Time) ([]types.DigestRecipient, error) {
+	query := `
+		WITH due AS (
+			SELECT u.id, u.email, COALESCE(u.first_name, '') AS first_name,
+				d.frequency,
+				d.last_sent_at,
+				CASE WHEN d.frequency = 'weekly' THEN $2::timestamp ELSE $1::timestamp END AS cutoff
+			FROM users u
+			JOIN digest_settings d ON d.user_id = u.id
+			WHERE d.frequency <> 'off'
+		)
+		SELECT id, email, first_name, frequency, last_sent_at
+		FROM due
+		WHERE (last_sent_at IS NULL OR last_sent_at < cutoff)
+		AND EXISTS (
+			SELECT 1 FROM notifications n
+			WHERE n.recipient_id = due.id AND n.is_read = FALSE
+			AND n.timestamp > COALESCE(due.last_sent_at, due.cutoff)
+		)
+	`
+
+	rows, err := s.DB.Query(query, dailyCutoff, weeklyCutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query digest recipients: %v", err)
+	}
+	defer rows.Close()
+
+	var recipients []types.DigestRecipient
+	for rows.Next() {
+		var recipient types.DigestRecipient
+		var lastSentAt sql.NullTime
+		if err := rows.Scan(&recipient.UserID, &recipient.Email, &recipient.FirstName, &recipient.Frequency, &lastSentAt); err != nil {
+			return nil, fmt.Errorf("error scanning digest recipient: %v", err)
+		}
+		if lastSentAt.Valid {
+			recipient.LastSentAt = &lastSentAt.Time
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over digest recipient rows: %v", err)
+	}
+
+	return recipients, nil
+}
+
+// ClaimDigest marks the digest of the user as sent at now, unless another
+// instance already did since cutoff. Only the instance that claimed it sends.
+func (s *DigestStorage) ClaimDigest(userID string, now, cutoff time.Time) (bool, error) {
+	query := `
+		INSERT INTO digest_settings (user_id, last_sent_at, updated_at)
+		VALUES ($1, $2, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET last_sent_at = EXCLUDED.last_sent_at
+		WHERE digest_settings.last_sent_at IS NULL OR digest_settings.last_sent_at < $3
+		RETURNING user_id
+	`
+
+	var claimed string
+	err := s.DB.QueryRow(query, userID, now, cutoff).Scan(&claimed)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim digest for user %s: %v", userID, err)
+	}
+	return true, nil
+}
+
+// ReleaseDigest restores the previous send time after a failed send, so the
+// digest is retried.
+func (s *DigestStorage) ReleaseDigest(userID string, lastSentAt *time.Time) error {
+	if _, err := s.DB.Exec(`UPDATE digest_settings SET last_sent_at = $2 WHERE user_id = $1`, userID, lastSentAt); err != nil {
+		return fmt.Errorf("failed to release digest for user %s: %v", userID, err)
+	}
+	return nil
+}
+
+// GetUnreadByCourse returns the unread notifications the user received since
+// the given time, grouped by course and newest first.
+func (s *DigestStorage) GetUnreadByCourse(userID string, since time.Time) ([]types.DigestCourse, error) {
+	query := `
+		SELECT n.id, n.type, COALESCE(n.class_id::text, ''), COALESCE(c.name, ''), n.message, n.data, n.timestamp, n.count
+		FROM notifications n
+		LEFT JOIN courses c ON c.id = n.class_id
+		WHERE n.recipient_id = $1 AND n.is_read = FALSE AND n.timestamp > $2
+		ORDER BY c.name NULLS LAST, n.timestamp DESC
+	`
+
+	rows, err := s.DB.Query(query, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unread notifications for user %s: %v", userID, err)
+	}
+	defer rows.Close()
+
+	var courses []types.DigestCourse
+	index := make(map[string]int)
+	for rows.Next() {
+		var ntf types.Notification
+		var courseName string
+		var dataJSON []byte
+		if err := rows.Scan(&ntf.ID, &ntf.Type, &ntf.ClassID, &courseName, &ntf.Message, &dataJSON, &ntf.Timestamp, &ntf.Count); err != nil {
+			return nil, fmt.Errorf("error scanning unread notification: %v", err)
+		}
+		if len(dataJSON) > 0 {
+			if err := json.Unmarshal(dataJSON, &ntf.Data); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal notification data: %v", err)
+			}
+		}
+
+		i, ok := index[ntf.ClassID]
+		if !ok {
+			i = len(courses)
+			index[ntf.ClassID] = i
+			courses = append(courses, types.DigestCourse{CourseID: ntf.ClassID, CourseName: courseName})
+		}
+		courses[i].Notifications = append(courses[i].Notifications, ntf)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over unread notification rows: %v", err)
+	}
+
+	return courses, nil
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 )
 
 type DocumentStorage struct {
@@ -22,10 +23,10 @@ func NewDocumentStorage(db *sql.DB) *DocumentStorage {
 // stores a document in the database
 func (s *DocumentStorage) SaveDocument(doc *types.Document) error {
 	query := `
-		INSERT INTO documents (user_id, file_name, file_path, file_type, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id
+		INSERT INTO documents (user_id, file_name, file_path, file_type, file_size, thumbnail_path, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8) RETURNING id
 	`
-	err := s.DB.QueryRow(query, doc.UserID, doc.FileName, doc.FilePath, doc.FileType, doc.CreatedAt, doc.UpdatedAt).Scan(&doc.ID)
+	err := s.DB.QueryRow(query, doc.UserID, doc.FileName, doc.FilePath, doc.FileType, doc.FileSize, doc.ThumbnailPath, doc.CreatedAt, doc.UpdatedAt).Scan(&doc.ID)
 	if err != nil {
 		return fmt.Errorf("failed to save document: %w", err)
 	}
@@ -34,11 +35,54 @@ func (s *DocumentStorage) SaveDocument(doc *types.Document) error {
 	return nil
 }
 
+// SaveUpload stores a document like SaveDocument and, when thumbnail is set,
+// enqueues the job generating its preview in the same transaction.
+func (s *DocumentStorage) SaveUpload(doc *types.Document, thumbnail *types.JobRequest) error {
+	if thumbnail == nil {
+		return s.SaveDocument(doc)
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO documents (user_id, file_name, file_path, file_type, file_size, thumbnail_path, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8) RETURNING id
+	`, doc.UserID, doc.FileName, doc.FilePath, doc.FileType, doc.FileSize, doc.ThumbnailPath, doc.CreatedAt, doc.UpdatedAt).Scan(&doc.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save document: %w", err)
+	}
+
+	thumbnail.Payload = types.DocumentThumbnailJob{DocumentID: doc.ID}
+	if err := EnqueueJob(tx, *thumbnail); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	log.Printf("Successfully saved document with id %s", doc.ID)
+	return nil
+}
+
+// SetThumbnail records the generated preview of a document.
+func (s *DocumentStorage) SetThumbnail(id, thumbnailPath string) error {
+	_, err := s.DB.Exec(`UPDATE documents SET thumbnail_path = $2, updated_at = $3 WHERE id = $1`, id, thumbnailPath, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to set thumbnail of document %s: %v", id, err)
+	}
+	return nil
+}
+
 // GetDocument retrieves a document by its ID
 func (s *DocumentStorage) GetDocument(id string) (*types.Document, error) {
 	var doc types.Document
-	query := `SELECT id, user_id, file_name, file_path, file_type, created_at, updated_at FROM documents WHERE id = $1`
-	err := s.DB.QueryRow(query, id).Scan(&doc.ID, &doc.UserID, &doc.FileName, &doc.FilePath, &doc.FileType, &doc.CreatedAt, &doc.UpdatedAt)
+	query := `SELECT id, user_id, file_name, file_path, file_type, file_size, COALESCE(thumbnail_path, ''), created_at, updated_at FROM documents WHERE id = $1`
+	err := s.DB.QueryRow(query, id).Scan(&doc.ID, &doc.UserID, &doc.FileName, &doc.FilePath, &doc.FileType, &doc.FileSize, &doc.ThumbnailPath, &doc.CreatedAt, &doc.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve document with id %s: %w", id, err)
 	}
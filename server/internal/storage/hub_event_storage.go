@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"course-flow/internal/types"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type HubEventStorage struct {
+	DB *sql.DB
+}
+
+func NewHubEventStorage(db *sql.DB) *HubEventStorage {
+	return &HubEventStorage{
+		DB: db,
+	}
+}
+
+// AppendEvent stores an outbound frame and assigns its event ID.
+func (s *HubEventStorage) AppendEvent(event *types.HubEvent) error {
+	query := `
+		INSERT INTO hub_events (kind, course_id, recipient_ids, sender_id, payload, created_at)
+		VALUES ($1, NULLIF($2, '')::uuid, $3::uuid[], NULLIF($4, '')::uuid, $5, $6)
+		RETURNING id
+	`
+	event.CreatedAt = time.Now().UTC()
+
+	var recipients interface{}
+	if len(event.RecipientIDs) > 0 {
+		recipients = pq.Array(event.RecipientIDs)
+	}
+
+	err := s.DB.QueryRow(
+		query,
+		event.Kind,
+		event.CourseID,
+		recipients,
+		event.SenderID,
+		string(event.Payload),
+		event.CreatedAt,
+	).Scan(&event.ID)
+	if err != nil {
+		return fmt.Errorf("failed to store hub event: %v", err)
+	}
+	return nil
+}
+
+// GetEventsSince returns the events after afterID addressed to the user, either
+// directly or through one of the given courses, oldest first.
+func (s *HubEventStorage) GetEventsSince(userID string, courseIDs []string, afterID int64, limit int) ([]types.HubEvent, error) {
+	query := `
+		SELECT id, kind, COALESCE(course_id::text, ''), COALESCE(sender_id::text, ''), payload, created_at
+		FROM hub_events
+		WHERE id > $1
+		AND (course_id = ANY($2::uuid[]) OR $3 = ANY(recipient_ids))
+		AND sender_id IS DISTINCT FROM $3
+		ORDER BY id ASC
+		LIMIT $4
+	`
+
+	rows, err := s.DB.Query(query, afterID, pq.Array(courseIDs), userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query hub events for user %s: %v", userID, err)
+	}
+	defer rows.Close()
+
+	var events []types.HubEvent
+	for rows.Next() {
+		var event types.HubEvent
+		var payload string
+		if err := rows.Scan(&event.ID, &event.Kind, &event.CourseID, &event.SenderID, &payload, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning hub event: %v", err)
+		}
+		event.Payload = []byte(payload)
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over hub event rows: %v", err)
+	}
+
+	return events, nil
+}
+
+// AckEvents moves the user's acknowledged event watermark forward.
+func (s *HubEventStorage) AckEvents(userID string, eventID int64) error {
+	query := `
+		INSERT INTO hub_event_acks (user_id, last_event_id, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET last_event_id = EXCLUDED.last_event_id,
+		    updated_at = EXCLUDED.updated_at
+		WHERE hub_event_acks.last_event_id < EXCLUDED.last_event_id
+	`
+	if _, err := s.DB.Exec(query, userID, eventID, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to acknowledge events for user %s: %v", userID, err)
+	}
+	return nil
+}
+
+// GetLastAckedEvent returns the user's acknowledged watermark, or 0 when the
+// user never acknowledged an event.
+func (s *HubEventStorage) GetLastAckedEvent(userID string) (int64, error) {
+	var eventID int64
+	err := s.DB.QueryRow(`SELECT last_event_id FROM hub_event_acks WHERE user_id = $1`, userID).Scan(&eventID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to query acknowledged events for user %s: %v", userID, err)
+	}
+	return eventID, nil
+}
+
+// PruneEvents removes events older than the retention period.
+func (s *HubEventStorage) PruneEvents(before time.Time) error {
+	result, err := s.DB.Exec(`DELETE FROM hub_events WHERE created_at < $1`, before)
+	if err != nil {
+		return fmt.Errorf("failed to prune hub events: %v", err)
+	}
+
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		log.Printf("Successfully pruned %d hub events", rows)
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package storage
+
+import (
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// JobChannel is notified when a job is enqueued or retried.
+const JobChannel = "jobs"
+
+const jobColumns = `id, type, payload, status, attempts, last_error, run_at, locked_until, finished_at, created_at, updated_at`
+
+type JobStorage struct {
+	DB *sql.DB
+}
+
+func NewJobStorage(db *sql.DB) *JobStorage {
+	return &JobStorage{
+		DB: db,
+	}
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// EnqueueJob adds a job in the caller's transaction, so it only runs if the
+// transaction commits.
+func EnqueueJob(tx *sql.Tx, req types.JobRequest) error {
+	return enqueueJob(tx, req)
+}
+
+func (s *JobStorage) Enqueue(req types.JobRequest) error {
+	return enqueueJob(s.DB, req)
+}
+
+func enqueueJob(db execer, req types.JobRequest) error {
+	payload := []byte("{}")
+	if req.Payload != nil {
+		var err error
+		if payload, err = json.Marshal(req.Payload); err != nil {
+			return fmt.Errorf("failed to encode %s job: %v", req.Type, err)
+		}
+	}
+
+	now := time.Now().UTC()
+	runAt := req.RunAt.UTC()
+	if runAt.Before(now) {
+		runAt = now
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO jobs (type, payload, run_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $4)
+	`, req.Type, string(payload), runAt, now)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue %s job: %v", req.Type, err)
+	}
+
+	if _, err := db.Exec(`SELECT pg_notify($1, $2)`, JobChannel, req.Type); err != nil {
+		return fmt.Errorf("failed to signal %s job: %v", req.Type, err)
+	}
+	return nil
+}
+
+// ClaimJobs takes up to limit due jobs of a type, oldest first, and marks
+// them running until lockedUntil. Running jobs whose lock expired, because
+// their worker died, are claimed again.
+func (s *JobStorage) ClaimJobs(jobType string, now, lockedUntil time.Time, limit int) ([]types.Job, error) {
+	rows, err := s.DB.Query(`
+		UPDATE jobs j
+		SET status = 'running', attempts = j.attempts + 1, locked_until = $3, updated_at = $2
+		WHERE j.id IN (
+			SELECT id FROM jobs
+			WHERE type = $1
+			  AND ((status = 'pending' AND run_at <= $2) OR (status = 'running' AND locked_until <= $2))
+			ORDER BY run_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns, jobType, now, lockedUntil, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim %s jobs: %v", jobType, err)
+	}
+	defer rows.Close()
+
+	var jobs []types.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over job rows: %v", err)
+	}
+
+	return jobs, nil
+}
+
+// The updates below only apply to the attempt that was claimed, so a worker
+// whose lock expired cannot overwrite the outcome of the next attempt.
+
+func (s *JobStorage) CompleteJob(id string, attempt int) error {
+	now := time.Now().UTC()
+	_, err := s.DB.Exec(`
+		UPDATE jobs
+		SET status = 'succeeded', locked_until = NULL, finished_at = $3, updated_at = $3
+		WHERE id = $1 AND attempts = $2 AND status = 'running'
+	`, id, attempt, now)
+	if err != nil {
+		return fmt.Errorf("failed to complete job %s: %v", id, err)
+	}
+	return nil
+}
+
+// RescheduleJob records a failed attempt and makes the job due again at runAt.
+func (s *JobStorage) RescheduleJob(id string, attempt int, lastError string, runAt time.Time) error {
+	_, err := s.DB.Exec(`
+		UPDATE jobs
+		SET status = 'pending', last_error = $3, run_at = $4, locked_until = NULL, updated_at = $5
+		WHERE id = $1 AND attempts = $2 AND status = 'running'
+	`, id, attempt, lastError, runAt, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to reschedule job %s: %v", id, err)
+	}
+	return nil
+}
+
+// KillJob records the last failed attempt and moves the job to the dead
+// letter state.
+func (s *JobStorage) KillJob(id string, attempt int, lastError string) error {
+	now := time.Now().UTC()
+	_, err := s.DB.Exec(`
+		UPDATE jobs
+		SET status = 'dead', last_error = $3, locked_until = NULL, finished_at = $4, updated_at = $4
+		WHERE id = $1 AND attempts = $2 AND status = 'running'
+	`, id, attempt, lastError, now)
+	if err != nil {
+		return fmt.Errorf("failed to mark job %s dead: %v", id, err)
+	}
+	return nil
+}
+
+// SaveSchedule registers a recurring job. The next run is only reset when
+// the spec changed, so restarts do not skip or repeat runs.
+func (s *JobStorage) SaveSchedule(name, spec string, nextRunAt time.Time) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO job_schedules (name, spec, next_run_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE
+		SET spec = EXCLUDED.spec, next_run_at = EXCLUDED.next_run_at
+		WHERE job_schedules.spec <> EXCLUDED.spec
+	`, name, spec, nextRunAt)
+	if err != nil {
+		return fmt.Errorf("failed to save job schedule %s: %v", name, err)
+	}
+	return nil
+}
+
+// ClaimSchedule enqueues the run of a recurring job if it is due, and moves
+// its next run to nextRunAt. Only one worker wins a given run.
+func (s *JobStorage) ClaimSchedule(name string, now, nextRunAt time.Time, req types.JobRequest) (bool, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE job_schedules
+		SET next_run_at = $3, last_run_at = $2
+		WHERE name = $1 AND next_run_at <= $2
+	`, name, now, nextRunAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim job schedule %s: %v", name, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	if err := EnqueueJob(tx, req); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return true, nil
+}
+
+// GetJobs lists jobs newest first.
+func (s *JobStorage) GetJobs(page types.JobPage) ([]types.Job, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+jobColumns+`
+		FROM jobs
+		WHERE ($1::uuid IS NULL OR (created_at, id) < (SELECT created_at, id FROM jobs WHERE id = $1::uuid))
+		  AND ($2 = '' OR type = $2)
+		  AND ($3 = '' OR status = $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`, sql.NullString{String: page.Before, Valid: page.Before != ""}, page.Type, page.Status, page.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %v", err)
+	}
+	defer rows.Close()
+
+	jobs := []types.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over job rows: %v", err)
+	}
+
+	return jobs, nil
+}
+
+func (s *JobStorage) GetJob(id string) (*types.Job, error) {
+	job, err := scanJob(s.DB.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Job not found"}
+	}
+	return job, err
+}
+
+// GetJobStats counts jobs by type and state.
+func (s *JobStorage) GetJobStats() ([]types.JobStats, error) {
+	rows, err := s.DB.Query(`
+		SELECT type, status, COUNT(*)
+		FROM jobs
+		GROUP BY type, status
+		ORDER BY type, status
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job stats: %v", err)
+	}
+	defer rows.Close()
+
+	stats := []types.JobStats{}
+	for rows.Next() {
+		var stat types.JobStats
+		if err := rows.Scan(&stat.Type, &stat.Status, &stat.Count); err != nil {
+			return nil, fmt.Errorf("error scanning job stats: %v", err)
+		}
+		stats = append(stats, stat)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over job stats rows: %v", err)
+	}
+
+	return stats, nil
+}
+
+// RetryJob runs a dead or pending job again right away, with a fresh set of
+// attempts.
+func (s *JobStorage) RetryJob(id string) (*types.Job, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	job, err := scanJob(tx.QueryRow(`
+		UPDATE jobs
+		SET status = 'pending', attempts = 0, run_at = $2, finished_at = NULL, updated_at = $2
+		WHERE id = $1 AND status IN ('dead', 'pending')
+		RETURNING `+jobColumns, id, now))
+	if err == sql.ErrNoRows {
+		var status string
+		err := tx.QueryRow(`SELECT status FROM jobs WHERE id = $1`, id).Scan(&status)
+		if err == sql.ErrNoRows {
+			return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Job not found"}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get job %s: %v", id, err)
+		}
+		return nil, &utils.ApiError{Code: http.StatusConflict, Message: "Only dead or pending jobs can be retried"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`SELECT pg_notify($1, $2)`, JobChannel, job.Type); err != nil {
+		return nil, fmt.Errorf("failed to signal %s job: %v", job.Type, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	log.Printf("Successfully queued job %s (%s) for retry", id, job.Type)
+	return job, nil
+}
+
+// DeleteFinishedJobs removes the jobs that succeeded before the given time.
+// Dead jobs are kept until an admin retries them.
+func (s *JobStorage) DeleteFinishedJobs(before time.Time) (int64, error) {
+	result, err := s.DB.Exec(`DELETE FROM jobs WHERE status = 'succeeded' AND finished_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete finished jobs: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+func scanJob(row rowScanner) (*types.Job, error) {
+	var job types.Job
+	var payload []byte
+	var lockedUntil, finishedAt sql.NullTime
+	err := row.Scan(&job.ID, &job.Type, &payload, &job.Status, &job.Attempts, &job.LastError,
+		&job.RunAt, &lockedUntil, &finishedAt, &job.CreatedAt, &job.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error scanning job: %v", err)
+	}
+
+	job.Payload = payload
+	if lockedUntil.Valid {
+		job.LockedUntil = &lockedUntil.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
@@ -0,0 +1,617 @@
+package storage
+
+import (
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const courseModuleColumns = `
+	m.id, m.course_id, m.title, m.description, m.position, m.release_at,
+	ARRAY(
+		SELECT prerequisite_id::text FROM course_module_prerequisites
+		WHERE module_id = m.id ORDER BY prerequisite_id
+	),
+	COALESCE(m.created_by::text, ''), m.created_at, m.updated_at`
+
+// moduleItemColumns reads an item joined with its module as m and its
+// document as d.
+const moduleItemColumns = `
+	i.id, i.module_id, m.course_id, i.kind, i.title, i.body, i.url, i.due_at, i.points,
+	COALESCE(i.rubric_id::text, ''), i.position, i.release_at, COALESCE(i.created_by::text, ''), i.created_at, i.updated_at,
+	COALESCE(d.id::text, ''), COALESCE(d.file_name, ''), COALESCE(d.file_path, ''),
+	COALESCE(d.file_type, ''), COALESCE(d.file_size, 0), COALESCE(d.thumbnail_path, '')`
+
+const moduleItemTables = `
+	module_items i
+	JOIN course_modules m ON m.id = i.module_id
+	LEFT JOIN documents d ON d.id = i.document_id`
+
+type ModuleStorage struct {
+	DB *sql.DB
+}
+
+func NewModuleStorage(db *sql.DB) *ModuleStorage {
+	return &ModuleStorage{
+		DB: db,
+	}
+}
+
+func (s *ModuleStorage) CheckCourseMember(courseID, userID string) error {
+	var isMember bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM course_members WHERE course_id = $1 AND user_id = $2
+		) OR EXISTS (
+			SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2
+		)
+	`, courseID, userID).Scan(&isMember)
+	if err != nil {
+		return fmt.Errorf("failed to check membership of course %s: %v", courseID, err)
+	}
+	if !isMember {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "You are not a member of this course"}
+	}
+	return nil
+}
+
+// IsCourseStaff reports whether the user is the course admin or a member with
+// the moderator or instructor role.
+func (s *ModuleStorage) IsCourseStaff(courseID, userID string) (bool, error) {
+	var isStaff bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2
+		) OR EXISTS (
+			SELECT 1 FROM course_members
+			WHERE course_id = $1 AND user_id = $2 AND role >= 2
+		)
+	`, courseID, userID).Scan(&isStaff)
+	if err != nil {
+		return false, fmt.Errorf("failed to check staff permission in course %s: %v", courseID, err)
+	}
+	return isStaff, nil
+}
+
+func (s *ModuleStorage) CheckCourseStaff(courseID, userID string) error {
+	isStaff, err := s.IsCourseStaff(courseID, userID)
+	if err != nil {
+		return err
+	}
+	if !isStaff {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "Only course staff can manage modules"}
+	}
+	return nil
+}
+
+// GetStudents returns the members of the course with the member role.
+func (s *ModuleStorage) GetStudents(courseID string) ([]types.User, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+userSummaryColumns+`
+		FROM course_members cm
+		JOIN users u ON u.id = cm.user_id
+		WHERE cm.course_id = $1 AND cm.role = 1
+		ORDER BY u.last_name, u.first_name, u.id
+	`, courseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query students of course %s: %v", courseID, err)
+	}
+	defer rows.Close()
+
+	students := []types.User{}
+	for rows.Next() {
+		var user types.User
+		if err := rows.Scan(&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName, &user.Avatar); err != nil {
+			return nil, fmt.Errorf("error scanning student: %v", err)
+		}
+		user.Avatar = utils.NormalizeMedia(user.Avatar)
+		students = append(students, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over student rows: %v", err)
+	}
+
+	return students, nil
+}
+
+// CreateModule adds the module after the last module of the course.
+func (s *ModuleStorage) CreateModule(module *types.CourseModule) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO course_modules (course_id, title, description, position, release_at, created_by, created_at, updated_at)
+		VALUES (
+			$1, $2, $3,
+			(SELECT COALESCE(MAX(position), 0) + 1 FROM course_modules WHERE course_id = $1),
+			$4, $5, $6, $6
+		)
+		RETURNING id, position, created_at, updated_at
+	`,
+		module.CourseID,
+		module.Title,
+		module.Description,
+		module.ReleaseAt,
+		module.CreatedBy,
+		time.Now().UTC(),
+	).Scan(&module.ID, &module.Position, &module.CreatedAt, &module.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create module in course %s: %v", module.CourseID, err)
+	}
+
+	if err := setPrerequisites(tx, module); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit module: %v", err)
+	}
+
+	log.Printf("Successfully created module %s in course %s by user %s", module.ID, module.CourseID, module.CreatedBy)
+	return nil
+}
+
+// setPrerequisites replaces the prerequisites of a module. They have to be
+// modules of the same course.
+func setPrerequisites(tx *sql.Tx, module *types.CourseModule) error {
+	if _, err := tx.Exec(`DELETE FROM course_module_prerequisites WHERE module_id = $1`, module.ID); err != nil {
+		return fmt.Errorf("failed to clear prerequisites of module %s: %v", module.ID, err)
+	}
+	if len(module.PrerequisiteIDs) == 0 {
+		return nil
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO course_module_prerequisites (module_id, prerequisite_id)
+		SELECT $1::uuid, id FROM course_modules
+		WHERE course_id = $2 AND id = ANY($3::uuid[]) AND id <> $1::uuid
+	`, module.ID, module.CourseID, pq.Array(module.PrerequisiteIDs))
+	if err != nil {
+		return fmt.Errorf("failed to set prerequisites of module %s: %v", module.ID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected != int64(len(module.PrerequisiteIDs)) {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "prerequisite_ids must be other modules of the course"}
+	}
+	return nil
+}
+
+func (s *ModuleStorage) GetModule(moduleID string) (*types.CourseModule, error) {
+	module, err := scanCourseModule(s.DB.QueryRow(`
+		SELECT `+courseModuleColumns+` FROM course_modules m WHERE m.id = $1
+	`, moduleID))
+	if err == sql.ErrNoRows {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Module not found"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get module %s: %v", moduleID, err)
+	}
+	return module, nil
+}
+
+// GetModules returns the modules of a course in order, without their items.
+func (s *ModuleStorage) GetModules(courseID string) ([]*types.CourseModule, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+courseModuleColumns+`
+		FROM course_modules m
+		WHERE m.course_id = $1
+		ORDER BY m.position, m.created_at, m.id
+	`, courseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query modules of course %s: %v", courseID, err)
+	}
+	defer rows.Close()
+
+	modules := []*types.CourseModule{}
+	for rows.Next() {
+		module, err := scanCourseModule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning module: %v", err)
+		}
+		modules = append(modules, module)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over module rows: %v", err)
+	}
+
+	return modules, nil
+}
+
+func (s *ModuleStorage) UpdateModule(module *types.CourseModule) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE course_modules
+		SET title = $2, description = $3, release_at = $4, updated_at = $5
+		WHERE id = $1
+	`, module.ID, module.Title, module.Description, module.ReleaseAt, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to update module %s: %v", module.ID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Module not found"}
+	}
+
+	if err := setPrerequisites(tx, module); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit module: %v", err)
+	}
+
+	log.Printf("Successfully updated module %s", module.ID)
+	return nil
+}
+
+// DeleteModule removes a module with its items. Modules requiring it no
+// longer do.
+func (s *ModuleStorage) DeleteModule(moduleID string) error {
+	result, err := s.DB.Exec(`DELETE FROM course_modules WHERE id = $1`, moduleID)
+	if err != nil {
+		return fmt.Errorf("failed to delete module %s: %v", moduleID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Module not found"}
+	}
+
+	log.Printf("Successfully deleted module %s", moduleID)
+	return nil
+}
+
+// ReorderModules puts the modules of a course in the order of ids, which has
+// to list each of them once.
+func (s *ModuleStorage) ReorderModules(courseID string, ids []string) error {
+	err := s.reorder("course_modules", "course_id", courseID, ids)
+	if err == errIncompleteOrder {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "ids must list every module of the course once"}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reorder modules of course %s: %v", courseID, err)
+	}
+
+	log.Printf("Successfully reordered modules of course %s", courseID)
+	return nil
+}
+
+// ReorderItems puts the items of a module in the order of ids, which has to
+// list each of them once.
+func (s *ModuleStorage) ReorderItems(moduleID string, ids []string) error {
+	err := s.reorder("module_items", "module_id", moduleID, ids)
+	if err == errIncompleteOrder {
+		return &utils.ApiError{Code: http.StatusBadRequest, Message: "ids must list every item of the module once"}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reorder items of module %s: %v", moduleID, err)
+	}
+
+	log.Printf("Successfully reordered items of module %s", moduleID)
+	return nil
+}
+
+var errIncompleteOrder = errors.New("order does not list every row once")
+
+// reorder numbers the rows of table belonging to parentID in the order of
+// ids. table and parentColumn are never user input.
+func (s *ModuleStorage) reorder(table, parentColumn, parentID string, ids []string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s = $1`, table, parentColumn), parentID).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(fmt.Sprintf(`
+		UPDATE %s t SET position = o.n
+		FROM unnest($2::uuid[]) WITH ORDINALITY AS o(id, n)
+		WHERE t.id = o.id AND t.%s = $1
+	`, table, parentColumn), parentID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count != len(ids) || rowsAffected != int64(len(ids)) {
+		return errIncompleteOrder
+	}
+
+	return tx.Commit()
+}
+
+// CreateItem adds the item after the last item of its module.
+func (s *ModuleStorage) CreateItem(item *types.ModuleItem) error {
+	var documentID sql.NullString
+	if item.Document != nil {
+		documentID = sql.NullString{String: item.Document.ID, Valid: true}
+	}
+
+	err := s.DB.QueryRow(`
+		INSERT INTO module_items (
+			module_id, kind, title, body, url, document_id, due_at, points,
+			position, release_at, created_by, created_at, updated_at
+		)
+		VALUES (
+			$1, $2, $3, $4, $5, $6::uuid, $7, $8,
+			(SELECT COALESCE(MAX(position), 0) + 1 FROM module_items WHERE module_id = $1),
+			$9, $10, $11, $11
+		)
+		RETURNING id, position, created_at, updated_at
+	`,
+		item.ModuleID,
+		item.Kind,
+		item.Title,
+		item.Body,
+		item.URL,
+		documentID,
+		item.DueAt,
+		item.Points,
+		item.ReleaseAt,
+		item.CreatedBy,
+		time.Now().UTC(),
+	).Scan(&item.ID, &item.Position, &item.CreatedAt, &item.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create item in module %s: %v", item.ModuleID, err)
+	}
+
+	log.Printf("Successfully created %s item %s in module %s by user %s", item.Kind, item.ID, item.ModuleID, item.CreatedBy)
+	return nil
+}
+
+func (s *ModuleStorage) GetItem(itemID string) (*types.ModuleItem, error) {
+	item, err := scanModuleItem(s.DB.QueryRow(`
+		SELECT `+moduleItemColumns+` FROM `+moduleItemTables+` WHERE i.id = $1
+	`, itemID))
+	if err == sql.ErrNoRows {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Item not found"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get module item %s: %v", itemID, err)
+	}
+	return item, nil
+}
+
+// GetItems returns the items of all modules of a course in course order.
+func (s *ModuleStorage) GetItems(courseID string) ([]types.ModuleItem, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+moduleItemColumns+`
+		FROM `+moduleItemTables+`
+		WHERE m.course_id = $1
+		ORDER BY m.position, m.created_at, m.id, i.position, i.created_at, i.id
+	`, courseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query module items of course %s: %v", courseID, err)
+	}
+	defer rows.Close()
+
+	items := []types.ModuleItem{}
+	for rows.Next() {
+		item, err := scanModuleItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning module item: %v", err)
+		}
+		items = append(items, *item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over module item rows: %v", err)
+	}
+
+	return items, nil
+}
+
+// UpdateItem changes the content of an item. Its kind and file stay the same.
+func (s *ModuleStorage) UpdateItem(item *types.ModuleItem) error {
+	result, err := s.DB.Exec(`
+		UPDATE module_items
+		SET title = $2, body = $3, url = $4, due_at = $5, points = $6, release_at = $7, updated_at = $8
+		WHERE id = $1
+	`, item.ID, item.Title, item.Body, item.URL, item.DueAt, item.Points, item.ReleaseAt, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to update module item %s: %v", item.ID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Item not found"}
+	}
+
+	log.Printf("Successfully updated module item %s", item.ID)
+	return nil
+}
+
+func (s *ModuleStorage) DeleteItem(itemID string) error {
+	result, err := s.DB.Exec(`DELETE FROM module_items WHERE id = $1`, itemID)
+	if err != nil {
+		return fmt.Errorf("failed to delete module item %s: %v", itemID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Item not found"}
+	}
+
+	log.Printf("Successfully deleted module item %s", itemID)
+	return nil
+}
+
+// CompleteItem marks an item complete for the user. Completing it again
+// keeps the first completion time.
+func (s *ModuleStorage) CompleteItem(itemID, userID string) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO module_item_completions (item_id, user_id, completed_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (item_id, user_id) DO NOTHING
+	`, itemID, userID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to complete module item %s for user %s: %v", itemID, userID, err)
+	}
+
+	log.Printf("Successfully completed module item %s for user %s", itemID, userID)
+	return nil
+}
+
+func (s *ModuleStorage) UncompleteItem(itemID, userID string) error {
+	_, err := s.DB.Exec(`
+		DELETE FROM module_item_completions WHERE item_id = $1 AND user_id = $2
+	`, itemID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to uncomplete module item %s for user %s: %v", itemID, userID, err)
+	}
+
+	log.Printf("Successfully uncompleted module item %s for user %s", itemID, userID)
+	return nil
+}
+
+// GetCompletions returns the completed items of a course, of one user or of
+// everyone when userID is empty.
+func (s *ModuleStorage) GetCompletions(courseID, userID string) ([]types.ItemCompletion, error) {
+	rows, err := s.DB.Query(`
+		SELECT c.item_id, c.user_id, c.completed_at
+		FROM module_item_completions c
+		JOIN module_items i ON i.id = c.item_id
+		JOIN course_modules m ON m.id = i.module_id
+		WHERE m.course_id = $1 AND ($2::uuid IS NULL OR c.user_id = $2::uuid)
+	`, courseID, sql.NullString{String: userID, Valid: userID != ""})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query completions of course %s: %v", courseID, err)
+	}
+	defer rows.Close()
+
+	completions := []types.ItemCompletion{}
+	for rows.Next() {
+		var completion types.ItemCompletion
+		if err := rows.Scan(&completion.ItemID, &completion.UserID, &completion.CompletedAt); err != nil {
+			return nil, fmt.Errorf("error scanning completion: %v", err)
+		}
+		completions = append(completions, completion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over completion rows: %v", err)
+	}
+
+	return completions, nil
+}
+
+func scanCourseModule(row rowScanner) (*types.CourseModule, error) {
+	var module types.CourseModule
+	var releaseAt sql.NullTime
+	err := row.Scan(
+		&module.ID,
+		&module.CourseID,
+		&module.Title,
+		&module.Description,
+		&module.Position,
+		&releaseAt,
+		pq.Array(&module.PrerequisiteIDs),
+		&module.CreatedBy,
+		&module.CreatedAt,
+		&module.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if releaseAt.Valid {
+		module.ReleaseAt = &releaseAt.Time
+	}
+	if module.PrerequisiteIDs == nil {
+		module.PrerequisiteIDs = []string{}
+	}
+	module.Items = []types.ModuleItem{}
+	return &module, nil
+}
+
+func scanModuleItem(row rowScanner) (*types.ModuleItem, error) {
+	var item types.ModuleItem
+	var dueAt, releaseAt sql.NullTime
+	var points sql.NullInt64
+	var document types.Document
+	err := row.Scan(
+		&item.ID,
+		&item.ModuleID,
+		&item.CourseID,
+		&item.Kind,
+		&item.Title,
+		&item.Body,
+		&item.URL,
+		&dueAt,
+		&points,
+		&item.RubricID,
+		&item.Position,
+		&releaseAt,
+		&item.CreatedBy,
+		&item.CreatedAt,
+		&item.UpdatedAt,
+		&document.ID,
+		&document.FileName,
+		&document.FilePath,
+		&document.FileType,
+		&document.FileSize,
+		&document.ThumbnailPath,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if dueAt.Valid {
+		item.DueAt = &dueAt.Time
+	}
+	if points.Valid {
+		p := int(points.Int64)
+		item.Points = &p
+	}
+	if releaseAt.Valid {
+		item.ReleaseAt = &releaseAt.Time
+	}
+	if document.ID != "" {
+		document.FilePath = utils.NormalizeMedia(document.FilePath)
+		document.ThumbnailPath = utils.NormalizeMedia(document.ThumbnailPath)
+		item.Document = &document
+	}
+	return &item, nil
+}
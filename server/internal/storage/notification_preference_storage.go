@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type NotificationPreferenceStorage struct {
+	DB *sql.DB
+}
+
+func NewNotificationPreferenceStorage(db *sql.DB) *NotificationPreferenceStorage {
+	return &NotificationPreferenceStorage{
+		DB: db,
+	}
+}
+
+// GetChannels resolves the channel of a notification for each user. A muted
+// course turns it off, otherwise a preference for the course wins over one
+// for all courses, and users without a preference get it in-app.
+func (s *NotificationPreferenceStorage) GetChannels(userIDs []string, notifType types.NotificationType, courseID string) (map[string]string, error) {
+	query := `
+		SELECT u.id,
+			CASE WHEN m.user_id IS NOT NULL THEN 'off'
+			     ELSE COALESCE(pc.channel, pg.channel, 'in_app')
+			END
+		FROM unnest($1::uuid[]) AS u(id)
+		LEFT JOIN notification_course_mutes m
+			ON m.user_id = u.id AND m.course_id = $3::uuid
+			AND (m.muted_until IS NULL OR m.muted_until > $4)
+		LEFT JOIN notification_preferences pc
+			ON pc.user_id = u.id AND pc.type = $2 AND pc.course_id = $3::uuid
+		LEFT JOIN notification_preferences pg
+			ON pg.user_id = u.id AND pg.type = $2 AND pg.course_id IS NULL
+	`
+
+	rows, err := s.DB.Query(query, pq.Array(userIDs), string(notifType), sql.NullString{String: courseID, Valid: courseID != ""}, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notification preferences: %v", err)
+	}
+	defer rows.Close()
+
+	channels := make(map[string]string, len(userIDs))
+	for rows.Next() {
+		var userID, channel string
+		if err := rows.Scan(&userID, &channel); err != nil {
+			return nil, fmt.Errorf("error scanning notification preference: %v", err)
+		}
+		channels[userID] = channel
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over notification preference rows: %v", err)
+	}
+
+	return channels, nil
+}
+
+func (s *NotificationPreferenceStorage) GetPreferences(userID string) ([]types.NotificationPreference, error) {
+	rows, err := s.DB.Query(`
+		SELECT type, COALESCE(course_id::text, ''), channel
+		FROM notification_preferences
+		WHERE user_id = $1
+		ORDER BY course_id NULLS FIRST, type
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notification preferences for user %s: %v", userID, err)
+	}
+	defer rows.Close()
+
+	preferences := []types.NotificationPreference{}
+	for rows.Next() {
+		var preference types.NotificationPreference
+		if err := rows.Scan(&preference.Type, &preference.CourseID, &preference.Channel); err != nil {
+			return nil, fmt.Errorf("error scanning notification preference: %v", err)
+		}
+		preferences = append(preferences, preference)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over notification preference rows: %v", err)
+	}
+
+	return preferences, nil
+}
+
+// SetPreference saves the channel of a notification type, for one course when
+// the preference has a course ID. The user must be a member of that course.
+func (s *NotificationPreferenceStorage) SetPreference(userID string, preference *types.NotificationPreference) error {
+	now := time.Now().UTC()
+
+	if preference.CourseID == "" {
+		query := `
+			INSERT INTO notification_preferences (user_id, type, course_id, channel, updated_at)
+			VALUES ($1, $2, NULL, $3, $4)
+			ON CONFLICT (user_id, type) WHERE course_id IS NULL DO UPDATE
+			SET channel = EXCLUDED.channel,
+			    updated_at = EXCLUDED.updated_at
+		`
+		if _, err := s.DB.Exec(query, userID, string(preference.Type), preference.Channel, now); err != nil {
+			return fmt.Errorf("failed to save notification preference for user %s: %v", userID, err)
+		}
+	} else {
+		if err := s.checkCourseMember(preference.CourseID, userID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO notification_preferences (user_id, type, course_id, channel, updated_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (user_id, type, course_id) WHERE course_id IS NOT NULL DO UPDATE
+			SET channel = EXCLUDED.channel,
+			    updated_at = EXCLUDED.updated_at
+		`
+		if _, err := s.DB.Exec(query, userID, string(preference.Type), preference.CourseID, preference.Channel, now); err != nil {
+			return fmt.Errorf("failed to save notification preference for user %s: %v", userID, err)
+		}
+	}
+
+	log.Printf("Successfully set %s notifications to %s for user %s", preference.Type, preference.Channel, userID)
+	return nil
+}
+
+// GetCourseMutes returns the courses the user currently has muted.
+func (s *NotificationPreferenceStorage) GetCourseMutes(userID string) ([]types.NotificationCourseMute, error) {
+	rows, err := s.DB.Query(`
+		SELECT course_id, muted_until
+		FROM notification_course_mutes
+		WHERE user_id = $1 AND (muted_until IS NULL OR muted_until > $2)
+		ORDER BY created_at
+	`, userID, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query muted courses for user %s: %v", userID, err)
+	}
+	defer rows.Close()
+
+	mutes := []types.NotificationCourseMute{}
+	for rows.Next() {
+		var mute types.NotificationCourseMute
+		var mutedUntil sql.NullTime
+		if err := rows.Scan(&mute.CourseID, &mutedUntil); err != nil {
+			return nil, fmt.Errorf("error scanning muted course: %v", err)
+		}
+		if mutedUntil.Valid {
+			mute.MutedUntil = &mutedUntil.Time
+		}
+		mutes = append(mutes, mute)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over muted course rows: %v", err)
+	}
+
+	return mutes, nil
+}
+
+// MuteCourse silences the course for the user until mutedUntil, or
+// indefinitely when it is nil.
+func (s *NotificationPreferenceStorage) MuteCourse(userID, courseID string, mutedUntil *time.Time) error {
+	if err := s.checkCourseMember(courseID, userID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO notification_course_mutes (user_id, course_id, muted_until, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, course_id) DO UPDATE
+		SET muted_until = EXCLUDED.muted_until
+	`
+	if _, err := s.DB.Exec(query, userID, courseID, mutedUntil, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to mute course %s for user %s: %v", courseID, userID, err)
+	}
+
+	log.Printf("Successfully muted notifications of course %s for user %s", courseID, userID)
+	return nil
+}
+
+func (s *NotificationPreferenceStorage) UnmuteCourse(userID, courseID string) error {
+	result, err := s.DB.Exec(`DELETE FROM notification_course_mutes WHERE user_id = $1 AND course_id = $2`, userID, courseID)
+	if err != nil {
+		return fmt.Errorf("failed to unmute course %s for user %s: %v", courseID, userID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Course is not muted"}
+	}
+
+	log.Printf("Successfully unmuted notifications of course %s for user %s", courseID, userID)
+	return nil
+}
+
+func (s *NotificationPreferenceStorage) checkCourseMember(courseID, userID string) error {
+	var isMember bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM course_members WHERE course_id = $1 AND user_id = $2
+		) OR EXISTS (
+			SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2
+		)
+	`, courseID, userID).Scan(&isMember)
+	if err != nil {
+		return fmt.Errorf("failed to check membership of course %s: %v", courseID, err)
+	}
+	if !isMember {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "You are not a member of this course"}
+	}
+	return nil
+}
@@ -6,8 +6,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"slices"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type NotificationStorage struct {
@@ -32,9 +35,12 @@ func (s *NotificationStorage) CreateNotifications(notifications []types.Notifica
 		}
 	}()
 
+	// Notifications of an outbox event are created once per recipient, even
+	// when the event is delivered again
 	stmt, err := tx.Prepare(`
-        INSERT INTO notifications (id, type, class_id, recipient_id, message, data, timestamp, is_read)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        INSERT INTO notifications (id, type, class_id, recipient_id, message, data, timestamp, is_read, delivery, event_id)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10::uuid)
+        ON CONFLICT (event_id, recipient_id) DO NOTHING
         RETURNING id
     `)
 	if err != nil {
@@ -44,6 +50,10 @@ func (s *NotificationStorage) CreateNotifications(notifications []types.Notifica
 
 	var createdNotifications []types.Notification
 	for i, notif := range notifications {
+		if notif.Delivery == "" {
+			notif.Delivery = types.ChannelInApp
+		}
+
 		dataJSON, err := json.Marshal(notif.Data)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal data for notification %d: %w", i, err)
@@ -62,7 +72,13 @@ func (s *NotificationStorage) CreateNotifications(notifications []types.Notifica
 				dataJSON,
 				notif.Timestamp,
 				notif.Read,
+				notif.Delivery,
+				sql.NullString{String: notif.OutboxEventID, Valid: notif.OutboxEventID != ""},
 			).Scan(&insertedID)
+			if err == sql.ErrNoRows {
+				log.Printf("Skipped notification of event %s for recipient %s, it already exists", notif.OutboxEventID, recipientID)
+				continue
+			}
 			if err != nil {
 				return nil, fmt.Errorf("failed to execute insert for notification %d, recipient %d: %w", i, j, err)
 			}
@@ -80,6 +96,8 @@ func (s *NotificationStorage) CreateNotifications(notifications []types.Notifica
 				Data:         notif.Data,
 				Timestamp:    notif.Timestamp,
 				Read:         notif.Read,
+				Delivery:     notif.Delivery,
+				Count:        1,
 			})
 		}
 	}
@@ -91,11 +109,122 @@ func (s *NotificationStorage) CreateNotifications(notifications []types.Notifica
 	return createdNotifications, nil
 }
 
+// CoalesceNotifications groups a notification into the open group of each
+// recipient: the unread notification of the same type, course and delivery
+// they received since cutoff. Grouped notifications get the latest data and
+// timestamp, a higher count and their message from groupFormat, where %s is
+// the count. Recipients without one get a new notification opening a group.
+// A recipient has at most one open group, so concurrent sends count into the
+// same notification.
+func (s *NotificationStorage) CoalesceNotifications(notif types.Notification, cutoff time.Time, groupFormat string) ([]types.Notification, error) {
+	if notif.Delivery == "" {
+		notif.Delivery = types.ChannelInApp
+	}
+
+	dataJSON, err := json.Marshal(notif.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notification data: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction for coalescing notifications: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Groups that went quiet stay unread but no longer take new events. Rows
+	// are locked in recipient order by every send so they cannot deadlock.
+	_, err = tx.Exec(`
+        UPDATE notifications
+        SET open_group = FALSE
+        WHERE id IN (
+            SELECT id FROM notifications
+            WHERE recipient_id = ANY($1::uuid[])
+            AND type = $2 AND class_id = $3 AND delivery = $4
+            AND is_read = FALSE AND open_group AND timestamp <= $5
+            ORDER BY recipient_id
+            FOR UPDATE
+        )
+    `, pq.Array(notif.RecipientIDs), notif.Type, notif.ClassID, notif.Delivery, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to close notification groups: %w", err)
+	}
+
+	recipientIDs := slices.Clone(notif.RecipientIDs)
+	slices.Sort(recipientIDs)
+
+	var notifications []types.Notification
+	grouped := 0
+	for _, recipientID := range recipientIDs {
+		ntf := types.Notification{
+			Type:         notif.Type,
+			ClassID:      notif.ClassID,
+			RecipientIDs: []string{recipientID},
+			Data:         notif.Data,
+			Timestamp:    notif.Timestamp,
+			Delivery:     notif.Delivery,
+		}
+		err = tx.QueryRow(`
+            INSERT INTO notifications (id, type, class_id, recipient_id, message, data, timestamp, is_read, delivery, open_group)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, FALSE, $8, TRUE)
+            ON CONFLICT (recipient_id, type, class_id, delivery) WHERE is_read = FALSE AND open_group
+            DO UPDATE SET count = notifications.count + 1,
+                message = format($9, notifications.count + 1),
+                data = EXCLUDED.data,
+                timestamp = EXCLUDED.timestamp
+            RETURNING id, message, count
+        `, uuid.New().String(), notif.Type, notif.ClassID, recipientID, notif.Message, dataJSON, notif.Timestamp, notif.Delivery, groupFormat).Scan(&ntf.ID, &ntf.Message, &ntf.Count)
+		if err != nil {
+			return nil, fmt.Errorf("failed to group notification for recipient %s: %w", recipientID, err)
+		}
+		if ntf.Count > 1 {
+			grouped++
+		}
+		notifications = append(notifications, ntf)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction for coalescing notifications: %w", err)
+	}
+	log.Printf("Successfully delivered %s notification to %d recipients, %d grouped", notif.Type, len(notif.RecipientIDs), grouped)
+	return notifications, nil
+}
+
+// GetUnreadCounts returns the number of unread in-app notifications of each
+// user.
+func (s *NotificationStorage) GetUnreadCounts(userIDs []string) (map[string]int, error) {
+	rows, err := s.db.Query(`
+        SELECT recipient_id, COUNT(*)
+        FROM notifications
+        WHERE recipient_id = ANY($1::uuid[]) AND is_read = FALSE AND delivery = 'in_app'
+        GROUP BY recipient_id
+    `, pq.Array(userIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int, len(userIDs))
+	for rows.Next() {
+		var userID string
+		var count int
+		if err := rows.Scan(&userID, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan unread notification count: %w", err)
+		}
+		counts[userID] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating unread notification counts: %w", err)
+	}
+	return counts, nil
+}
+
 func (s *NotificationStorage) GetUserNotifications(userID string) ([]types.Notification, error) {
 	rows, err := s.db.Query(`
-        SELECT id, type, class_id, message, data, timestamp, is_read
+        SELECT id, type, class_id, message, data, timestamp, is_read, count
         FROM notifications
-        WHERE recipient_id = $1
+        WHERE recipient_id = $1 AND delivery = 'in_app'
         ORDER BY timestamp DESC
     `, userID)
 	if err != nil {
@@ -108,7 +237,7 @@ func (s *NotificationStorage) GetUserNotifications(userID string) ([]types.Notif
 		var ntf types.Notification
 		var dataJSON []byte
 
-		err = rows.Scan(&ntf.ID, &ntf.Type, &ntf.ClassID, &ntf.Message, &dataJSON, &ntf.Timestamp, &ntf.Read)
+		err = rows.Scan(&ntf.ID, &ntf.Type, &ntf.ClassID, &ntf.Message, &dataJSON, &ntf.Timestamp, &ntf.Read, &ntf.Count)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan notification row %d for user %s: %w", i, userID, err)
 		}
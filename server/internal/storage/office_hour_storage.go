@@ -0,0 +1,730 @@
+package storage
+
+import (
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const officeHourColumns = `
+	o.id, o.course_id, COALESCE(o.event_id::text, ''), o.title, o.location, o.mode,
+	o.starts_at, o.ends_at, o.slot_minutes, o.capacity, o.created_at, o.updated_at,
+	` + userSummaryColumns
+
+const officeHourBookingColumns = `
+	b.id, b.office_hour_id, o.course_id, o.title, o.location, b.starts_at, b.ends_at,
+	b.note, b.created_at, ` + userSummaryColumns
+
+type OfficeHourStorage struct {
+	DB *sql.DB
+}
+
+func NewOfficeHourStorage(db *sql.DB) *OfficeHourStorage {
+	return &OfficeHourStorage{
+		DB: db,
+	}
+}
+
+func (s *OfficeHourStorage) CheckCourseMember(courseID, userID string) error {
+	var isMember bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM course_members WHERE course_id = $1 AND user_id = $2
+		) OR EXISTS (
+			SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2
+		)
+	`, courseID, userID).Scan(&isMember)
+	if err != nil {
+		return fmt.Errorf("failed to check membership of course %s: %v", courseID, err)
+	}
+	if !isMember {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "You are not a member of this course"}
+	}
+	return nil
+}
+
+// IsCourseStaff reports whether the user is the course admin or a member with
+// the moderator or instructor role.
+func (s *OfficeHourStorage) IsCourseStaff(courseID, userID string) (bool, error) {
+	var isStaff bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2
+		) OR EXISTS (
+			SELECT 1 FROM course_members
+			WHERE course_id = $1 AND user_id = $2 AND role >= 2
+		)
+	`, courseID, userID).Scan(&isStaff)
+	if err != nil {
+		return false, fmt.Errorf("failed to check staff permission in course %s: %v", courseID, err)
+	}
+	return isStaff, nil
+}
+
+func (s *OfficeHourStorage) CheckCourseStaff(courseID, userID string) error {
+	isStaff, err := s.IsCourseStaff(courseID, userID)
+	if err != nil {
+		return err
+	}
+	if !isStaff {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "Only course staff can manage office hours"}
+	}
+	return nil
+}
+
+// GetStaffIDs returns the course admin and the members with the moderator or
+// instructor role.
+func (s *OfficeHourStorage) GetStaffIDs(courseID string) ([]string, error) {
+	var staffIDs []string
+	err := s.DB.QueryRow(`
+		SELECT ARRAY(
+			SELECT admin_id::text FROM courses WHERE id = $1 AND admin_id IS NOT NULL
+			UNION
+			SELECT user_id::text FROM course_members WHERE course_id = $1 AND role >= 2
+		)
+	`, courseID).Scan(pq.Array(&staffIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get staff of course %s: %v", courseID, err)
+	}
+	return staffIDs, nil
+}
+
+// CreateOfficeHour saves the window together with its course calendar event.
+// Hosts cannot hold overlapping office hours.
+func (s *OfficeHourStorage) CreateOfficeHour(officeHour *types.OfficeHour) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkHostAvailable(tx, officeHour); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	err = tx.QueryRow(`
+		INSERT INTO office_hours (
+			course_id, host_id, title, location, mode, starts_at, ends_at,
+			slot_minutes, capacity, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10)
+		RETURNING id
+	`,
+		officeHour.CourseID,
+		officeHour.Host.ID,
+		officeHour.Title,
+		officeHour.Location,
+		officeHour.Mode,
+		officeHour.StartsAt,
+		officeHour.EndsAt,
+		officeHour.SlotMinutes,
+		officeHour.Capacity,
+		now,
+	).Scan(&officeHour.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create office hours in course %s: %v", officeHour.CourseID, err)
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO course_events (
+			course_id, uid, title, location, kind, starts_at, ends_at, last_ends_at,
+			created_by, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $8, $9, $9)
+		RETURNING id
+	`,
+		officeHour.CourseID,
+		"office-hours-"+officeHour.ID+"@course-flow",
+		officeHour.Title,
+		officeHour.Location,
+		types.CalendarOfficeHours,
+		officeHour.StartsAt,
+		officeHour.EndsAt,
+		officeHour.Host.ID,
+		now,
+	).Scan(&officeHour.EventID)
+	if err != nil {
+		return fmt.Errorf("failed to add office hours %s to the calendar: %v", officeHour.ID, err)
+	}
+
+	if _, err := tx.Exec(`UPDATE office_hours SET event_id = $2 WHERE id = $1`, officeHour.ID, officeHour.EventID); err != nil {
+		return fmt.Errorf("failed to link office hours %s to the calendar: %v", officeHour.ID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	log.Printf("Successfully created office hours %s in course %s by user %s", officeHour.ID, officeHour.CourseID, officeHour.Host.ID)
+	return nil
+}
+
+// checkHostAvailable locks the host and makes sure the window does not
+// overlap other office hours of the host.
+func checkHostAvailable(tx *sql.Tx, officeHour *types.OfficeHour) error {
+	if _, err := tx.Exec(`SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, officeHour.Host.ID); err != nil {
+		return fmt.Errorf("failed to lock user %s: %v", officeHour.Host.ID, err)
+	}
+
+	var overlaps bool
+	err := tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM office_hours
+			WHERE host_id = $1 AND starts_at < $3 AND ends_at > $2
+			  AND ($4::uuid IS NULL OR id <> $4::uuid)
+		)
+	`, officeHour.Host.ID, officeHour.StartsAt, officeHour.EndsAt, sql.NullString{String: officeHour.ID, Valid: officeHour.ID != ""}).Scan(&overlaps)
+	if err != nil {
+		return fmt.Errorf("failed to check office hours of user %s: %v", officeHour.Host.ID, err)
+	}
+	if overlaps {
+		return &utils.ApiError{Code: http.StatusConflict, Message: "You already hold office hours at this time"}
+	}
+	return nil
+}
+
+func (s *OfficeHourStorage) GetOfficeHour(officeHourID string) (*types.OfficeHour, error) {
+	row := s.DB.QueryRow(`
+		SELECT `+officeHourColumns+`
+		FROM office_hours o
+		JOIN users u ON u.id = o.host_id
+		WHERE o.id = $1
+	`, officeHourID)
+	officeHour, err := scanOfficeHour(row)
+	if err == sql.ErrNoRows {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Office hours not found"}
+	}
+	return officeHour, err
+}
+
+// GetOfficeHours returns the office hours of a course that have not ended by
+// from, soonest first.
+func (s *OfficeHourStorage) GetOfficeHours(courseID string, from time.Time) ([]*types.OfficeHour, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+officeHourColumns+`
+		FROM office_hours o
+		JOIN users u ON u.id = o.host_id
+		WHERE o.course_id = $1 AND o.ends_at > $2
+		ORDER BY o.starts_at, o.id
+	`, courseID, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query office hours of course %s: %v", courseID, err)
+	}
+	defer rows.Close()
+
+	officeHours := []*types.OfficeHour{}
+	for rows.Next() {
+		officeHour, err := scanOfficeHour(rows)
+		if err != nil {
+			return nil, err
+		}
+		officeHours = append(officeHours, officeHour)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over office hour rows: %v", err)
+	}
+	return officeHours, nil
+}
+
+// UpdateOfficeHour changes the window and its calendar event. Its times and
+// slots can only change while nobody booked it.
+func (s *OfficeHourStorage) UpdateOfficeHour(officeHour *types.OfficeHour, slotsChanged bool) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if slotsChanged {
+		if err := checkHostAvailable(tx, officeHour); err != nil {
+			return err
+		}
+
+		var booked bool
+		err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM office_hour_bookings WHERE office_hour_id = $1)
+		`, officeHour.ID).Scan(&booked)
+		if err != nil {
+			return fmt.Errorf("failed to check bookings of office hours %s: %v", officeHour.ID, err)
+		}
+		if booked {
+			return &utils.ApiError{Code: http.StatusConflict, Message: "The times of booked office hours cannot change"}
+		}
+	}
+
+	now := time.Now().UTC()
+	err = tx.QueryRow(`
+		UPDATE office_hours
+		SET title = $2, location = $3, starts_at = $4, ends_at = $5, slot_minutes = $6,
+		    capacity = $7, updated_at = $8
+		WHERE id = $1
+		RETURNING updated_at
+	`,
+		officeHour.ID,
+		officeHour.Title,
+		officeHour.Location,
+		officeHour.StartsAt,
+		officeHour.EndsAt,
+		officeHour.SlotMinutes,
+		officeHour.Capacity,
+		now,
+	).Scan(&officeHour.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Office hours not found"}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update office hours %s: %v", officeHour.ID, err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE course_events
+		SET title = $2, location = $3, starts_at = $4, ends_at = $5, last_ends_at = $5, updated_at = $6
+		WHERE id = (SELECT event_id FROM office_hours WHERE id = $1)
+	`, officeHour.ID, officeHour.Title, officeHour.Location, officeHour.StartsAt, officeHour.EndsAt, now)
+	if err != nil {
+		return fmt.Errorf("failed to update calendar event of office hours %s: %v", officeHour.ID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	log.Printf("Successfully updated office hours %s", officeHour.ID)
+	return nil
+}
+
+// DeleteOfficeHour removes the window with its bookings, queue and calendar
+// event.
+func (s *OfficeHourStorage) DeleteOfficeHour(officeHourID string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var eventID sql.NullString
+	err = tx.QueryRow(`DELETE FROM office_hours WHERE id = $1 RETURNING event_id`, officeHourID).Scan(&eventID)
+	if err == sql.ErrNoRows {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Office hours not found"}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete office hours %s: %v", officeHourID, err)
+	}
+
+	if eventID.Valid {
+		if _, err := tx.Exec(`DELETE FROM course_events WHERE id = $1`, eventID.String); err != nil {
+			return fmt.Errorf("failed to delete calendar event of office hours %s: %v", officeHourID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	log.Printf("Successfully deleted office hours %s", officeHourID)
+	return nil
+}
+
+// CreateBooking books a slot for the user. The slot must have room and the
+// user can neither book the window twice nor hold overlapping bookings. The
+// reminder job is enqueued with the booking when it is due in the future.
+func (s *OfficeHourStorage) CreateBooking(booking *types.OfficeHourBooking, capacity int, reminder *types.JobRequest) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Bookings of a window are serialized so capacity holds
+	if _, err := tx.Exec(`SELECT 1 FROM office_hours WHERE id = $1 FOR UPDATE`, booking.OfficeHourID); err != nil {
+		return fmt.Errorf("failed to lock office hours %s: %v", booking.OfficeHourID, err)
+	}
+
+	var alreadyBooked, overlaps bool
+	var booked int
+	err = tx.QueryRow(`
+		SELECT
+			EXISTS (SELECT 1 FROM office_hour_bookings WHERE office_hour_id = $1 AND user_id = $2),
+			EXISTS (SELECT 1 FROM office_hour_bookings WHERE user_id = $2 AND starts_at < $4 AND ends_at > $3),
+			(SELECT COUNT(*) FROM office_hour_bookings WHERE office_hour_id = $1 AND starts_at = $3)
+	`, booking.OfficeHourID, booking.User.ID, booking.StartsAt, booking.EndsAt).Scan(&alreadyBooked, &overlaps, &booked)
+	if err != nil {
+		return fmt.Errorf("failed to check bookings of office hours %s: %v", booking.OfficeHourID, err)
+	}
+	if alreadyBooked {
+		return &utils.ApiError{Code: http.StatusConflict, Message: "You already booked a slot of these office hours"}
+	}
+	if overlaps {
+		return &utils.ApiError{Code: http.StatusConflict, Message: "You have another booking at this time"}
+	}
+	if booked >= capacity {
+		return &utils.ApiError{Code: http.StatusConflict, Message: "This slot is full"}
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO office_hour_bookings (office_hour_id, user_id, starts_at, ends_at, note, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, booking.OfficeHourID, booking.User.ID, booking.StartsAt, booking.EndsAt, booking.Note, time.Now().UTC()).Scan(&booking.ID, &booking.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to book office hours %s: %v", booking.OfficeHourID, err)
+	}
+
+	if reminder != nil {
+		reminder.Payload = types.OfficeHourReminderJob{BookingID: booking.ID}
+		if err := EnqueueJob(tx, *reminder); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	log.Printf("Successfully booked office hours %s at %s for user %s", booking.OfficeHourID, booking.StartsAt.Format(time.RFC3339), booking.User.ID)
+	return nil
+}
+
+// GetBookings returns the bookings of a window, in slot order.
+func (s *OfficeHourStorage) GetBookings(officeHourID string) ([]types.OfficeHourBooking, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+officeHourBookingColumns+`
+		FROM office_hour_bookings b
+		JOIN office_hours o ON o.id = b.office_hour_id
+		JOIN users u ON u.id = b.user_id
+		WHERE b.office_hour_id = $1
+		ORDER BY b.starts_at, b.created_at
+	`, officeHourID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bookings of office hours %s: %v", officeHourID, err)
+	}
+	defer rows.Close()
+
+	return scanOfficeHourBookings(rows)
+}
+
+// GetUserBookings returns the bookings of the user that have not ended by
+// from, soonest first.
+func (s *OfficeHourStorage) GetUserBookings(userID string, from time.Time) ([]types.OfficeHourBooking, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+officeHourBookingColumns+`
+		FROM office_hour_bookings b
+		JOIN office_hours o ON o.id = b.office_hour_id
+		JOIN users u ON u.id = b.user_id
+		WHERE b.user_id = $1 AND b.ends_at > $2
+		ORDER BY b.starts_at, b.id
+	`, userID, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bookings of user %s: %v", userID, err)
+	}
+	defer rows.Close()
+
+	return scanOfficeHourBookings(rows)
+}
+
+func (s *OfficeHourStorage) GetBooking(bookingID string) (*types.OfficeHourBooking, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+officeHourBookingColumns+`
+		FROM office_hour_bookings b
+		JOIN office_hours o ON o.id = b.office_hour_id
+		JOIN users u ON u.id = b.user_id
+		WHERE b.id = $1
+	`, bookingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get booking %s: %v", bookingID, err)
+	}
+	defer rows.Close()
+
+	bookings, err := scanOfficeHourBookings(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(bookings) == 0 {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Booking not found"}
+	}
+	return &bookings[0], nil
+}
+
+func (s *OfficeHourStorage) DeleteBooking(bookingID string) error {
+	result, err := s.DB.Exec(`DELETE FROM office_hour_bookings WHERE id = $1`, bookingID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel booking %s: %v", bookingID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Booking not found"}
+	}
+
+	log.Printf("Successfully cancelled booking %s", bookingID)
+	return nil
+}
+
+// QueueReminder writes the reminder of a booking to the outbox, once. Nothing
+// happens when the booking was cancelled or already reminded of.
+func (s *OfficeHourStorage) QueueReminder(bookingID string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var reminder types.OfficeHourReminder
+	err = tx.QueryRow(`
+		SELECT b.id, o.course_id, b.user_id, o.title, o.location, b.starts_at
+		FROM office_hour_bookings b
+		JOIN office_hours o ON o.id = b.office_hour_id
+		WHERE b.id = $1 AND b.reminded_at IS NULL
+		FOR UPDATE OF b
+	`, bookingID).Scan(
+		&reminder.BookingID,
+		&reminder.CourseID,
+		&reminder.UserID,
+		&reminder.Title,
+		&reminder.Location,
+		&reminder.StartsAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get booking %s: %v", bookingID, err)
+	}
+
+	if err := AppendOutboxEvent(tx, types.EventOfficeHourReminder, reminder.CourseID, reminder); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE office_hour_bookings SET reminded_at = $2 WHERE id = $1`, bookingID, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to mark booking %s as reminded: %v", bookingID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// JoinQueue adds the user to the end of the queue.
+func (s *OfficeHourStorage) JoinQueue(officeHourID, userID, note string) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO office_hour_queue (office_hour_id, user_id, status, note, joined_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, officeHourID, userID, types.QueueWaiting, note, time.Now().UTC())
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return &utils.ApiError{Code: http.StatusConflict, Message: "You are already in the queue"}
+		}
+		return fmt.Errorf("failed to join queue of office hours %s: %v", officeHourID, err)
+	}
+
+	log.Printf("Successfully added user %s to the queue of office hours %s", userID, officeHourID)
+	return nil
+}
+
+// LeaveQueue takes the user out of the queue, whether waiting or being
+// served.
+func (s *OfficeHourStorage) LeaveQueue(officeHourID, userID string) error {
+	result, err := s.DB.Exec(`
+		UPDATE office_hour_queue
+		SET status = $3, finished_at = $4
+		WHERE office_hour_id = $1 AND user_id = $2 AND status IN ('waiting', 'serving')
+	`, officeHourID, userID, types.QueueLeft, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to leave queue of office hours %s: %v", officeHourID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "You are not in the queue"}
+	}
+
+	log.Printf("Successfully removed user %s from the queue of office hours %s", userID, officeHourID)
+	return nil
+}
+
+// NextInQueue finishes the students being served and starts serving the one
+// who waited longest. It returns the users whose entries were finished.
+func (s *OfficeHourStorage) NextInQueue(officeHourID string) ([]string, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Staff calling next at the same time must not skip a student
+	if _, err := tx.Exec(`SELECT 1 FROM office_hours WHERE id = $1 FOR UPDATE`, officeHourID); err != nil {
+		return nil, fmt.Errorf("failed to lock office hours %s: %v", officeHourID, err)
+	}
+
+	now := time.Now().UTC()
+	rows, err := tx.Query(`
+		UPDATE office_hour_queue
+		SET status = $2, finished_at = $3
+		WHERE office_hour_id = $1 AND status = 'serving'
+		RETURNING user_id
+	`, officeHourID, types.QueueDone, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to finish queue entries of office hours %s: %v", officeHourID, err)
+	}
+	var finished []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning finished queue entry: %v", err)
+		}
+		finished = append(finished, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over finished queue entries: %v", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE office_hour_queue
+		SET status = $2, started_at = $3
+		WHERE id = (
+			SELECT id FROM office_hour_queue
+			WHERE office_hour_id = $1 AND status = 'waiting'
+			ORDER BY joined_at, id
+			LIMIT 1
+		)
+	`, officeHourID, types.QueueServing, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to advance queue of office hours %s: %v", officeHourID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	log.Printf("Successfully advanced the queue of office hours %s", officeHourID)
+	return finished, nil
+}
+
+// GetQueue returns the students being served, then those waiting in the
+// order they joined.
+func (s *OfficeHourStorage) GetQueue(officeHourID string) ([]types.QueueEntry, error) {
+	rows, err := s.DB.Query(`
+		SELECT q.id, q.status, q.note, q.joined_at, q.started_at, `+userSummaryColumns+`
+		FROM office_hour_queue q
+		JOIN users u ON u.id = q.user_id
+		WHERE q.office_hour_id = $1 AND q.status IN ('waiting', 'serving')
+		ORDER BY q.status = 'waiting', q.joined_at, q.id
+	`, officeHourID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query queue of office hours %s: %v", officeHourID, err)
+	}
+	defer rows.Close()
+
+	entries := []types.QueueEntry{}
+	for rows.Next() {
+		var entry types.QueueEntry
+		var startedAt sql.NullTime
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.Status,
+			&entry.Note,
+			&entry.JoinedAt,
+			&startedAt,
+			&entry.User.ID,
+			&entry.User.Email,
+			&entry.User.Username,
+			&entry.User.FirstName,
+			&entry.User.LastName,
+			&entry.User.Avatar,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning queue entry: %v", err)
+		}
+		entry.User.Avatar = utils.NormalizeMedia(entry.User.Avatar)
+		if startedAt.Valid {
+			entry.StartedAt = &startedAt.Time
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over queue rows: %v", err)
+	}
+	return entries, nil
+}
+
+func scanOfficeHour(row rowScanner) (*types.OfficeHour, error) {
+	var officeHour types.OfficeHour
+	err := row.Scan(
+		&officeHour.ID,
+		&officeHour.CourseID,
+		&officeHour.EventID,
+		&officeHour.Title,
+		&officeHour.Location,
+		&officeHour.Mode,
+		&officeHour.StartsAt,
+		&officeHour.EndsAt,
+		&officeHour.SlotMinutes,
+		&officeHour.Capacity,
+		&officeHour.CreatedAt,
+		&officeHour.UpdatedAt,
+		&officeHour.Host.ID,
+		&officeHour.Host.Email,
+		&officeHour.Host.Username,
+		&officeHour.Host.FirstName,
+		&officeHour.Host.LastName,
+		&officeHour.Host.Avatar,
+	)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error scanning office hours: %v", err)
+	}
+
+	officeHour.Host.Avatar = utils.NormalizeMedia(officeHour.Host.Avatar)
+	return &officeHour, nil
+}
+
+func scanOfficeHourBookings(rows *sql.Rows) ([]types.OfficeHourBooking, error) {
+	bookings := []types.OfficeHourBooking{}
+	for rows.Next() {
+		var booking types.OfficeHourBooking
+		if err := rows.Scan(
+			&booking.ID,
+			&booking.OfficeHourID,
+			&booking.CourseID,
+			&booking.Title,
+			&booking.Location,
+			&booking.StartsAt,
+			&booking.EndsAt,
+			&booking.Note,
+			&booking.CreatedAt,
+			&booking.User.ID,
+			&booking.User.Email,
+			&booking.User.Username,
+			&booking.User.FirstName,
+			&booking.User.LastName,
+			&booking.User.Avatar,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning booking: %v", err)
+		}
+		booking.User.Avatar = utils.NormalizeMedia(booking.User.Avatar)
+		bookings = append(bookings, booking)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over booking rows: %v", err)
+	}
+	return bookings, nil
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"course-flow/internal/types"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// OutboxChannel is notified when an outbox event is committed.
+const OutboxChannel = "outbox_events"
+
+type OutboxStorage struct {
+	DB *sql.DB
+}
+
+func NewOutboxStorage(db *sql.DB) *OutboxStorage {
+	return &OutboxStorage{
+		DB: db,
+	}
+}
+
+// AppendOutboxEvent writes a domain event in the caller's transaction, so it
+// is stored if and only if the change that caused it is. The dispatcher is
+// woken up when the transaction commits.
+func AppendOutboxEvent(tx *sql.Tx, eventType, courseID string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %v", eventType, err)
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.Exec(`
+		INSERT INTO outbox_events (type, course_id, payload, available_at, created_at)
+		VALUES ($1, NULLIF($2, '')::uuid, $3, $4, $4)
+	`, eventType, courseID, string(data), now)
+	if err != nil {
+		return fmt.Errorf("failed to write %s event to the outbox: %v", eventType, err)
+	}
+
+	if _, err := tx.Exec(`SELECT pg_notify($1, '')`, OutboxChannel); err != nil {
+		return fmt.Errorf("failed to signal outbox event: %v", err)
+	}
+	return nil
+}
+
+// ClaimEvents takes up to limit due events, oldest first, counts the attempt
+// and hides them from other instances for lease.
+func (s *OutboxStorage) ClaimEvents(now time.Time, lease time.Duration, limit int) ([]types.OutboxEvent, error) {
+	rows, err := s.DB.Query(`
+		UPDATE outbox_events e
+		SET available_at = $2, attempts = e.attempts + 1
+		WHERE e.id IN (
+			SELECT id FROM outbox_events
+			WHERE status = 'pending' AND available_at <= $1
+			ORDER BY created_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING e.id, e.type, COALESCE(e.course_id::text, ''), e.payload, e.attempts, e.created_at,
+			ARRAY(SELECT consumer FROM outbox_consumers c WHERE c.event_id = e.id)
+	`, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []types.OutboxEvent
+	for rows.Next() {
+		var event types.OutboxEvent
+		var payload []byte
+		if err := rows.Scan(&event.ID, &event.Type, &event.CourseID, &payload, &event.Attempts, &event.CreatedAt, pq.Array(&event.Consumed)); err != nil {
+			return nil, fmt.Errorf("error scanning outbox event: %v", err)
+		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over outbox event rows: %v", err)
+	}
+
+	// RETURNING does not keep the order of the claim
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+
+	return events, nil
+}
+
+// MarkConsumed records that a consumer handled an event.
+func (s *OutboxStorage) MarkConsumed(eventID, consumer string) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO outbox_consumers (event_id, consumer, consumed_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, eventID, consumer, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record consumer %s of outbox event %s: %v", consumer, eventID, err)
+	}
+	return nil
+}
+
+func (s *OutboxStorage) MarkDispatched(eventID string) error {
+	_, err := s.DB.Exec(`
+		UPDATE outbox_events SET status = 'dispatched', dispatched_at = $2, last_error = '' WHERE id = $1
+	`, eventID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox event %s dispatched: %v", eventID, err)
+	}
+	return nil
+}
+
+// RetryEvent schedules another attempt at an event, or marks it failed when
+// nextAttemptAt is nil.
+func (s *OutboxStorage) RetryEvent(eventID, lastError string, nextAttemptAt *time.Time) error {
+	var err error
+	if nextAttemptAt == nil {
+		_, err = s.DB.Exec(`UPDATE outbox_events SET status = 'failed', last_error = $2 WHERE id = $1`, eventID, lastError)
+	} else {
+		_, err = s.DB.Exec(`UPDATE outbox_events SET available_at = $2, last_error = $3 WHERE id = $1`, eventID, *nextAttemptAt, lastError)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reschedule outbox event %s: %v", eventID, err)
+	}
+	return nil
+}
+
+// DeleteDispatched removes events dispatched before the given time.
+func (s *OutboxStorage) DeleteDispatched(before time.Time) (int64, error) {
+	result, err := s.DB.Exec(`DELETE FROM outbox_events WHERE status = 'dispatched' AND dispatched_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete dispatched outbox events: %v", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,449 @@
+package storage
+
+import (
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// peerReviewPhaseColumns reads a phase joined as p with its item as i and
+// the item's module as m. $2 limits the review counts to one reviewer.
+const peerReviewPhaseColumns = `
+	p.item_id, i.title, m.course_id, p.rubric_id, p.reviewers_per_submission, p.anonymous,
+	p.due_at, COALESCE(p.opened_by::text, ''), p.opened_at, p.closed_at,
+	(SELECT COUNT(*) FROM peer_reviews r
+	 WHERE r.item_id = p.item_id AND ($2::uuid IS NULL OR r.reviewer_id = $2::uuid)),
+	(SELECT COUNT(*) FROM peer_reviews r
+	 WHERE r.item_id = p.item_id AND ($2::uuid IS NULL OR r.reviewer_id = $2::uuid)
+	   AND r.submitted_at IS NOT NULL)`
+
+// peerReviewColumns reads a review with its submission's author as u and
+// its reviewer as v.
+const peerReviewColumns = `
+	r.id, r.item_id, i.title, m.course_id, r.submission_id,
+	` + userSummaryColumns + `,
+	v.id, v.email, COALESCE(v.username, ''), COALESCE(v.first_name, ''),
+	COALESCE(v.last_name, ''), COALESCE(v.avatar, ''),
+	r.score, r.max_score, r.comment, r.assigned_at, r.submitted_at`
+
+const peerReviewTables = `
+	peer_reviews r
+	JOIN module_items i ON i.id = r.item_id
+	JOIN course_modules m ON m.id = i.module_id
+	JOIN submissions s ON s.id = r.submission_id
+	JOIN users u ON u.id = s.user_id
+	JOIN users v ON v.id = r.reviewer_id`
+
+type PeerReviewStorage struct {
+	DB *sql.DB
+}
+
+func NewPeerReviewStorage(db *sql.DB) *PeerReviewStorage {
+	return &PeerReviewStorage{
+		DB: db,
+	}
+}
+
+// IsCourseStaff reports whether the user is the course admin or a member with
+// the moderator or instructor role.
+func (s *PeerReviewStorage) IsCourseStaff(courseID, userID string) (bool, error) {
+	var isStaff bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2
+		) OR EXISTS (
+			SELECT 1 FROM course_members
+			WHERE course_id = $1 AND user_id = $2 AND role >= 2
+		)
+	`, courseID, userID).Scan(&isStaff)
+	if err != nil {
+		return false, fmt.Errorf("failed to check staff permission in course %s: %v", courseID, err)
+	}
+	return isStaff, nil
+}
+
+// CheckCourseInstructor allows the course admin and members with the
+// instructor role.
+func (s *PeerReviewStorage) CheckCourseInstructor(courseID, userID string) error {
+	var isInstructor bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2
+		) OR EXISTS (
+			SELECT 1 FROM course_members
+			WHERE course_id = $1 AND user_id = $2 AND role = 3
+		)
+	`, courseID, userID).Scan(&isInstructor)
+	if err != nil {
+		return fmt.Errorf("failed to check instructor permission in course %s: %v", courseID, err)
+	}
+	if !isInstructor {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "Only course instructors can manage peer review"}
+	}
+	return nil
+}
+
+// GetSubmissionAuthors returns the submissions for an item whose authors
+// are still students of the course, oldest first.
+func (s *PeerReviewStorage) GetSubmissionAuthors(itemID string) ([]types.SubmissionAuthor, error) {
+	rows, err := s.DB.Query(`
+		SELECT s.id, s.user_id
+		FROM submissions s
+		JOIN module_items i ON i.id = s.item_id
+		JOIN course_modules m ON m.id = i.module_id
+		JOIN course_members cm ON cm.course_id = m.course_id AND cm.user_id = s.user_id AND cm.role = 1
+		WHERE s.item_id = $1
+		ORDER BY s.submitted_at, s.id
+	`, itemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query submission authors for item %s: %v", itemID, err)
+	}
+	defer rows.Close()
+
+	authors := []types.SubmissionAuthor{}
+	for rows.Next() {
+		var author types.SubmissionAuthor
+		if err := rows.Scan(&author.SubmissionID, &author.UserID); err != nil {
+			return nil, fmt.Errorf("error scanning submission author: %v", err)
+		}
+		authors = append(authors, author)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over submission author rows: %v", err)
+	}
+	return authors, nil
+}
+
+// OpenPhase starts peer review of an item and hands out its reviews.
+func (s *PeerReviewStorage) OpenPhase(phase *types.PeerReviewPhase, assignments []types.ReviewAssignment) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Keep the rubric from changing while it is used
+	var rubricID string
+	err = tx.QueryRow(`SELECT id FROM rubrics WHERE id = $1 FOR SHARE`, phase.RubricID).Scan(&rubricID)
+	if err == sql.ErrNoRows {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Rubric not found"}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock rubric %s: %v", phase.RubricID, err)
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO peer_review_phases (item_id, rubric_id, reviewers_per_submission, anonymous, due_at, opened_by, opened_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (item_id) DO NOTHING
+		RETURNING opened_at
+	`,
+		phase.ItemID,
+		phase.RubricID,
+		phase.ReviewersPerSubmission,
+		phase.Anonymous,
+		phase.DueAt,
+		phase.OpenedBy,
+		time.Now().UTC(),
+	).Scan(&phase.OpenedAt)
+	if err == sql.ErrNoRows {
+		return &utils.ApiError{Code: http.StatusConflict, Message: "Peer review was already opened for this assignment"}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open peer review of item %s: %v", phase.ItemID, err)
+	}
+
+	submissionIDs := make([]string, 0, len(assignments))
+	reviewerIDs := make([]string, 0, len(assignments))
+	for _, assignment := range assignments {
+		submissionIDs = append(submissionIDs, assignment.SubmissionID)
+		reviewerIDs = append(reviewerIDs, assignment.ReviewerID)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO peer_reviews (item_id, submission_id, reviewer_id, assigned_at)
+		SELECT $1::uuid, unnest($2::uuid[]), unnest($3::uuid[]), $4
+	`, phase.ItemID, pq.Array(submissionIDs), pq.Array(reviewerIDs), phase.OpenedAt)
+	if err != nil {
+		return fmt.Errorf("failed to assign peer reviews of item %s: %v", phase.ItemID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit peer review phase: %v", err)
+	}
+
+	log.Printf("Successfully opened peer review of item %s with %d reviews by user %s", phase.ItemID, len(assignments), phase.OpenedBy)
+	return nil
+}
+
+// GetPhase returns the peer review of an item. The review counts are those
+// of one reviewer, or of everyone when reviewerID is empty.
+func (s *PeerReviewStorage) GetPhase(itemID, reviewerID string) (*types.PeerReviewPhase, error) {
+	var phase types.PeerReviewPhase
+	var dueAt, closedAt sql.NullTime
+	err := s.DB.QueryRow(`
+		SELECT `+peerReviewPhaseColumns+`
+		FROM peer_review_phases p
+		JOIN module_items i ON i.id = p.item_id
+		JOIN course_modules m ON m.id = i.module_id
+		WHERE p.item_id = $1
+	`, itemID, sql.NullString{String: reviewerID, Valid: reviewerID != ""}).Scan(
+		&phase.ItemID,
+		&phase.ItemTitle,
+		&phase.CourseID,
+		&phase.RubricID,
+		&phase.ReviewersPerSubmission,
+		&phase.Anonymous,
+		&dueAt,
+		&phase.OpenedBy,
+		&phase.OpenedAt,
+		&closedAt,
+		&phase.Reviews,
+		&phase.CompletedReviews,
+	)
+	if err == sql.ErrNoRows {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Peer review has not been opened for this assignment"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get peer review of item %s: %v", itemID, err)
+	}
+
+	if dueAt.Valid {
+		phase.DueAt = &dueAt.Time
+	}
+	if closedAt.Valid {
+		phase.ClosedAt = &closedAt.Time
+	}
+	phase.Open = !closedAt.Valid && (!dueAt.Valid || time.Now().UTC().Before(dueAt.Time))
+	return &phase, nil
+}
+
+// ClosePhase stops reviews from being written.
+func (s *PeerReviewStorage) ClosePhase(itemID string, closedAt time.Time) error {
+	result, err := s.DB.Exec(`
+		UPDATE peer_review_phases SET closed_at = $2 WHERE item_id = $1 AND closed_at IS NULL
+	`, itemID, closedAt)
+	if err != nil {
+		return fmt.Errorf("failed to close peer review of item %s: %v", itemID, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return &utils.ApiError{Code: http.StatusConflict, Message: "Peer review is already closed"}
+	}
+
+	log.Printf("Successfully closed peer review of item %s", itemID)
+	return nil
+}
+
+// GetReview returns a review with its criterion scores.
+func (s *PeerReviewStorage) GetReview(reviewID string) (*types.PeerReview, error) {
+	review, err := scanPeerReview(s.DB.QueryRow(`
+		SELECT `+peerReviewColumns+` FROM `+peerReviewTables+` WHERE r.id = $1
+	`, reviewID))
+	if err == sql.ErrNoRows {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Review not found"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get peer review %s: %v", reviewID, err)
+	}
+
+	if err := s.fillReviewCriteria([]*types.PeerReview{review}); err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// GetReviews returns the reviews of an item, limited to one reviewer or to
+// the submission of one author when their IDs are given.
+func (s *PeerReviewStorage) GetReviews(itemID, reviewerID, authorID string) ([]*types.PeerReview, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+peerReviewColumns+`
+		FROM `+peerReviewTables+`
+		WHERE r.item_id = $1
+		  AND ($2::uuid IS NULL OR r.reviewer_id = $2::uuid)
+		  AND ($3::uuid IS NULL OR s.user_id = $3::uuid)
+		ORDER BY u.last_name, u.first_name, u.id, v.last_name, v.first_name, v.id
+	`,
+		itemID,
+		sql.NullString{String: reviewerID, Valid: reviewerID != ""},
+		sql.NullString{String: authorID, Valid: authorID != ""},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query peer reviews of item %s: %v", itemID, err)
+	}
+	defer rows.Close()
+
+	reviews := []*types.PeerReview{}
+	for rows.Next() {
+		review, err := scanPeerReview(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning peer review: %v", err)
+		}
+		reviews = append(reviews, review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over peer review rows: %v", err)
+	}
+
+	if err := s.fillReviewCriteria(reviews); err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+func (s *PeerReviewStorage) fillReviewCriteria(reviews []*types.PeerReview) error {
+	if len(reviews) == 0 {
+		return nil
+	}
+
+	byID := map[string]*types.PeerReview{}
+	ids := make([]string, 0, len(reviews))
+	for _, review := range reviews {
+		byID[review.ID] = review
+		ids = append(ids, review.ID)
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT rc.review_id, rc.criterion_id, COALESCE(rc.level_id::text, ''), rc.points, rc.comment
+		FROM peer_review_criteria rc
+		JOIN rubric_criteria c ON c.id = rc.criterion_id
+		WHERE rc.review_id = ANY($1::uuid[])
+		ORDER BY rc.review_id, c.position
+	`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to query peer review criteria: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reviewID string
+		var score types.CriterionScore
+		if err := rows.Scan(&reviewID, &score.CriterionID, &score.LevelID, &score.Points, &score.Comment); err != nil {
+			return fmt.Errorf("error scanning peer review criterion: %v", err)
+		}
+		byID[reviewID].Criteria = append(byID[reviewID].Criteria, score)
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over peer review criterion rows: %v", err)
+	}
+	return nil
+}
+
+// SaveReview stores a review with its criterion scores while the peer review
+// is open. Reviews can be revised until it closes.
+func (s *PeerReviewStorage) SaveReview(review *types.PeerReview) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var open bool
+	err = tx.QueryRow(`
+		SELECT p.closed_at IS NULL AND (p.due_at IS NULL OR p.due_at > $2)
+		FROM peer_reviews r
+		JOIN peer_review_phases p ON p.item_id = r.item_id
+		WHERE r.id = $1
+		FOR UPDATE OF r
+	`, review.ID, now).Scan(&open)
+	if err == sql.ErrNoRows {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Review not found"}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock peer review %s: %v", review.ID, err)
+	}
+	if !open {
+		return &utils.ApiError{Code: http.StatusConflict, Message: "Peer review is closed"}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE peer_reviews SET score = $2, max_score = $3, comment = $4, submitted_at = $5 WHERE id = $1
+	`, review.ID, review.Score, review.MaxScore, review.Comment, now)
+	if err != nil {
+		return fmt.Errorf("failed to save peer review %s: %v", review.ID, err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM peer_review_criteria WHERE review_id = $1`, review.ID); err != nil {
+		return fmt.Errorf("failed to clear criteria of peer review %s: %v", review.ID, err)
+	}
+	for _, score := range review.Criteria {
+		_, err := tx.Exec(`
+			INSERT INTO peer_review_criteria (review_id, criterion_id, level_id, points, comment)
+			VALUES ($1, $2, $3::uuid, $4, $5)
+		`,
+			review.ID,
+			score.CriterionID,
+			sql.NullString{String: score.LevelID, Valid: score.LevelID != ""},
+			score.Points,
+			score.Comment,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save criterion score of peer review %s: %v", review.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit peer review: %v", err)
+	}
+
+	log.Printf("Successfully saved peer review %s", review.ID)
+	return nil
+}
+
+func scanPeerReview(row rowScanner) (*types.PeerReview, error) {
+	review := types.PeerReview{
+		Author:   &types.User{},
+		Reviewer: &types.User{},
+	}
+	var score, maxScore sql.NullFloat64
+	var submittedAt sql.NullTime
+	err := row.Scan(
+		&review.ID,
+		&review.ItemID,
+		&review.ItemTitle,
+		&review.CourseID,
+		&review.SubmissionID,
+		&review.Author.ID,
+		&review.Author.Email,
+		&review.Author.Username,
+		&review.Author.FirstName,
+		&review.Author.LastName,
+		&review.Author.Avatar,
+		&review.Reviewer.ID,
+		&review.Reviewer.Email,
+		&review.Reviewer.Username,
+		&review.Reviewer.FirstName,
+		&review.Reviewer.LastName,
+		&review.Reviewer.Avatar,
+		&score,
+		&maxScore,
+		&review.Comment,
+		&review.AssignedAt,
+		&submittedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	review.Author.Avatar = utils.NormalizeMedia(review.Author.Avatar)
+	review.Reviewer.Avatar = utils.NormalizeMedia(review.Reviewer.Avatar)
+	if score.Valid {
+		review.Score = &score.Float64
+	}
+	if maxScore.Valid {
+		review.MaxScore = &maxScore.Float64
+	}
+	if submittedAt.Valid {
+		review.Completed = true
+		review.SubmittedAt = &submittedAt.Time
+	}
+	review.Criteria = []types.CriterionScore{}
+	return &review, nil
+}
@@ -109,6 +109,24 @@ func (s *PostStorage) GetAllCommentedUserForPost(postID, commentID string) (*typ
 }
 
 func (s *PostStorage) GetAllCommentsForPost(postID string) ([]types.Comment, error) {
+	return s.queryComments("c.post_id = $1", postID)
+}
+
+// GetComment returns a single comment with its author.
+func (s *PostStorage) GetComment(commentID string) (*types.Comment, error) {
+	comments, err := s.queryComments("c.id = $1", commentID)
+	if err != nil {
+		return nil, err
+	}
+	if len(comments) == 0 {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Comment not found"}
+	}
+	return &comments[0], nil
+}
+
+// queryComments loads the comments matching the condition with their authors,
+// oldest first.
+func (s *PostStorage) queryComments(condition string, arg string) ([]types.Comment, error) {
 	query := `
 		SELECT 
 			c.id AS comment_id,
@@ -124,13 +142,13 @@ func (s *PostStorage) GetAllCommentsForPost(postID string) ([]types.Comment, err
 			u.avatar
 		FROM comments c
 		LEFT JOIN users u ON c.user_id = u.id
-		WHERE c.post_id = $1
+		WHERE ` + condition + `
 		ORDER BY c.created_at ASC
 	`
 
-	rows, err := s.DB.Query(query, postID)
+	rows, err := s.DB.Query(query, arg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query comments for post %s: %v", postID, err)
+		return nil, fmt.Errorf("failed to query comments: %v", err)
 	}
 	defer rows.Close()
 
@@ -190,70 +208,68 @@ func (s *PostStorage) GetAllCommentsForPost(postID string) ([]types.Comment, err
 	return comments, nil
 }
 
-func (s *PostStorage) DeleteComment(commentID, userID, postID string) error {
+// DeleteComment deletes a comment of a post and returns the post and course
+// it belonged to. Comments of other posts are not found.
+func (s *PostStorage) DeleteComment(commentID, userID, postID string) (string, string, error) {
 	tx, err := s.DB.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
+		return "", "", fmt.Errorf("failed to begin transaction: %v", err)
 	}
 	defer tx.Rollback()
 
 	adminQuery := `
-		SELECT c.admin_id 
+		SELECT c.id, c.admin_id 
 		FROM courses c
 		JOIN posts p
 		ON c.id = p.course_id
 		WHERE p.id = $1
 	`
 
-	var adminID string
-	err = tx.QueryRow(adminQuery, postID).Scan(&adminID)
+	var courseID, adminID string
+	err = tx.QueryRow(adminQuery, postID).Scan(&courseID, &adminID)
 	if err == sql.ErrNoRows {
-		return &utils.ApiError{Code: http.StatusNotFound, Message: "Post not found"}
+		return "", "", &utils.ApiError{Code: http.StatusNotFound, Message: "Post not found"}
 	}
 	if err != nil {
-		return fmt.Errorf("failed to fetch course admin: %v", err)
+		return "", "", fmt.Errorf("failed to fetch course admin: %v", err)
 	}
 
 	if adminID != userID {
 		var whoCommented string
-		err := tx.QueryRow("SELECT user_id FROM comments WHERE id = $1", commentID).Scan(&whoCommented)
+		err := tx.QueryRow("SELECT user_id FROM comments WHERE id = $1 AND post_id = $2", commentID, postID).Scan(&whoCommented)
 		if err == sql.ErrNoRows {
-			return &utils.ApiError{Code: http.StatusNotFound, Message: "Comment not found"}
+			return "", "", &utils.ApiError{Code: http.StatusNotFound, Message: "Comment not found"}
 		}
 		if err != nil {
-			return fmt.Errorf("Error scanning user id from comment: %v", err)
+			return "", "", fmt.Errorf("Error scanning user id from comment: %v", err)
 		}
 
 		if whoCommented != userID {
-			return &utils.ApiError{Code: http.StatusUnauthorized, Message: "You are not authorized to delete this comment"}
+			return "", "", &utils.ApiError{Code: http.StatusUnauthorized, Message: "You are not authorized to delete this comment"}
 		}
 	}
 
 	query := `
 		DELETE FROM comments
-		WHERE id = $1
+		WHERE id = $1 AND post_id = $2
+		RETURNING post_id
 	`
 
-	result, err := tx.Exec(query, commentID)
-	if err != nil {
-		return fmt.Errorf("failed to delete comment: %v", err)
+	var deletedPostID string
+	err = tx.QueryRow(query, commentID, postID).Scan(&deletedPostID)
+	if err == sql.ErrNoRows {
+		return "", "", &utils.ApiError{Code: http.StatusNotFound, Message: "Comment not found"}
 	}
-
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
-	}
-
-	if rowsAffected == 0 {
-		return &utils.ApiError{Code: http.StatusUnauthorized, Message: "Comment not found or you are not authorized"}
+		return "", "", fmt.Errorf("failed to delete comment: %v", err)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
+		return "", "", fmt.Errorf("failed to commit transaction: %v", err)
 	}
 
 	log.Printf("Successfully deleted comment with id %v by user %v\n", commentID, userID)
-	return nil
+	return deletedPostID, courseID, nil
 }
 
 func (s *PostStorage) EditComment(commentID, comment, userID string) error {
@@ -336,18 +352,23 @@ func (s *PostStorage) AddComment(postID, comment, userID string) (*types.NotifCo
 		return nil, fmt.Errorf("failed to retrieve class id for post: %v", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %v", err)
-	}
-
-	log.Printf("Successfully added comment with id %s to post %s by user %s", commentID, postID, userID)
-	return &types.NotifCommentCreatedResponse{
+	payload := &types.NotifCommentCreatedResponse{
 		UserID:    userID,
 		PostID:    postID,
 		ClassID:   classID,
 		CommentID: commentID,
 		Data:      map[string]interface{}{"postID": postID, "commentID": commentID, "content": comment},
-	}, nil
+	}
+	if err := AppendOutboxEvent(tx, types.EventCommentAdded, classID, payload); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	log.Printf("Successfully added comment with id %s to post %s by user %s", commentID, postID, userID)
+	return payload, nil
 }
 
 func (s *PostStorage) EditPost(postID, userID, content string) error {
@@ -411,6 +432,36 @@ func (s *PostStorage) EditPost(postID, userID, content string) error {
 }
 
 func (s *PostStorage) GetAllPost(courseID string) ([]types.PostResponse, error) {
+	return s.queryPosts("p.course_id = $1", courseID)
+}
+
+// GetPost returns a single post with its author and attachments.
+func (s *PostStorage) GetPost(postID string) (*types.PostResponse, error) {
+	posts, err := s.queryPosts("p.id = $1", postID)
+	if err != nil {
+		return nil, err
+	}
+	if len(posts) == 0 {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Post not found"}
+	}
+	return &posts[0], nil
+}
+
+func (s *PostStorage) GetPostCourseID(postID string) (string, error) {
+	var courseID string
+	err := s.DB.QueryRow("SELECT course_id FROM posts WHERE id = $1", postID).Scan(&courseID)
+	if err == sql.ErrNoRows {
+		return "", &utils.ApiError{Code: http.StatusNotFound, Message: "Post not found"}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query course of post %s: %v", postID, err)
+	}
+	return courseID, nil
+}
+
+// queryPosts loads the posts matching the condition with their authors and
+// attachments.
+func (s *PostStorage) queryPosts(condition string, arg string) ([]types.PostResponse, error) {
 	query := `
 	SELECT 
 	    p.id, p.course_id, p.user_id, p.content, p.created_at, p.updated_at,
@@ -421,13 +472,13 @@ func (s *PostStorage) GetAllPost(courseID string) ([]types.PostResponse, error)
 	LEFT JOIN users u ON p.user_id = u.id
 	LEFT JOIN attachments a ON p.id = a.post_id
 	LEFT JOIN documents d ON a.document_id = d.id
-	WHERE p.course_id = $1
+	WHERE ` + condition + `
 	ORDER BY p.created_at DESC;
 	`
 
-	rows, err := s.DB.Query(query, courseID)
+	rows, err := s.DB.Query(query, arg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query posts for course %s: %v", courseID, err)
+		return nil, fmt.Errorf("failed to query posts: %v", err)
 	}
 	defer rows.Close()
 
@@ -468,6 +519,7 @@ func (s *PostStorage) GetAllPost(courseID string) ([]types.PostResponse, error)
 			post = &types.PostResponse{
 				Post: types.Post{
 					ID:        pID,
+					CourseID:  pCourseID,
 					UserID:    pUserID,
 					Content:   pContent,
 					CreatedAt: pCreatedAt,
@@ -640,13 +692,19 @@ func (s *PostStorage) CreatePost(courseID, userID, content string) (string, erro
 		}
 	}
 
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
 	query := `
 		INSERT INTO posts (course_id, user_id, content, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5) RETURNING id
 	`
 	var postID string
 	now := time.Now().UTC() // Use UTC for consistency
-	err = s.DB.QueryRow(query, courseID, userID, content, now, now).Scan(&postID)
+	err = tx.QueryRow(query, courseID, userID, content, now, now).Scan(&postID)
 	if err != nil {
 		return "", fmt.Errorf("failed to create post in course %s for user %s: %v", courseID, userID, err)
 	}
@@ -658,6 +716,20 @@ func (s *PostStorage) CreatePost(courseID, userID, content string) (string, erro
 		}
 	}
 
+	err = AppendOutboxEvent(tx, types.EventPostCreated, courseID, types.NotifCreatedResponse{
+		ClassID: courseID,
+		UserID:  userID,
+		PostID:  postID,
+		Data:    map[string]interface{}{"content": content},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
 	log.Printf("Successfully created post with id %s in course %s by user %s", postID, courseID, userID)
 	return postID, nil
 }
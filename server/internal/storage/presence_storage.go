@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type PresenceStorage struct {
+	DB *sql.DB
+}
+
+func NewPresenceStorage(db *sql.DB) *PresenceStorage {
+	return &PresenceStorage{
+		DB: db,
+	}
+}
+
+// GetAppearOffline reports whether the user chose to appear offline.
+func (s *PresenceStorage) GetAppearOffline(userID string) (bool, error) {
+	var appearOffline bool
+	err := s.DB.QueryRow(`SELECT appear_offline FROM presence_settings WHERE user_id = $1`, userID).Scan(&appearOffline)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to query presence settings for user %s: %v", userID, err)
+	}
+	return appearOffline, nil
+}
+
+func (s *PresenceStorage) SetAppearOffline(userID string, appearOffline bool) error {
+	query := `
+		INSERT INTO presence_settings (user_id, appear_offline, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET appear_offline = EXCLUDED.appear_offline,
+		    updated_at = EXCLUDED.updated_at
+	`
+	if _, err := s.DB.Exec(query, userID, appearOffline, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to save presence settings for user %s: %v", userID, err)
+	}
+
+	log.Printf("Successfully set appear offline to %t for user %s", appearOffline, userID)
+	return nil
+}
+
+// GetCourseMembersByIDs returns the users among userIDs that are members of
+// the course.
+func (s *PresenceStorage) GetCourseMembersByIDs(courseID string, userIDs []string) ([]types.User, error) {
+	query := `
+		SELECT u.id, u.username, u.first_name, u.last_name, u.avatar
+		FROM course_members cm
+		JOIN users u ON u.id = cm.user_id
+		WHERE cm.course_id = $1 AND cm.user_id = ANY($2::uuid[])
+		ORDER BY u.first_name, u.last_name
+	`
+
+	rows, err := s.DB.Query(query, courseID, pq.Array(userIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query online members of course %s: %v", courseID, err)
+	}
+	defer rows.Close()
+
+	users := []types.User{}
+	for rows.Next() {
+		var user types.User
+		if err := rows.Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.Avatar); err != nil {
+			return nil, fmt.Errorf("error scanning online member: %v", err)
+		}
+		user.Avatar = utils.NormalizeMedia(user.Avatar)
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over online member rows: %v", err)
+	}
+
+	return users, nil
+}
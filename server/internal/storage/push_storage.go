@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type PushStorage struct {
+	DB *sql.DB
+}
+
+func NewPushStorage(db *sql.DB) *PushStorage {
+	return &PushStorage{
+		DB: db,
+	}
+}
+
+// GetVAPIDKeys returns the stored private and public key, or empty strings
+// when none were generated yet.
+func (s *PushStorage) GetVAPIDKeys() (string, string, error) {
+	var privateKey, publicKey string
+	err := s.DB.QueryRow(`SELECT private_key, public_key FROM vapid_keys WHERE id = 1`).Scan(&privateKey, &publicKey)
+	if err == sql.ErrNoRows {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get VAPID keys: %v", err)
+	}
+	return privateKey, publicKey, nil
+}
+
+// CreateVAPIDKeys stores a key pair unless another instance stored one first,
+// and returns the pair that is stored.
+func (s *PushStorage) CreateVAPIDKeys(privateKey, publicKey string) (string, string, error) {
+	query := `
+		INSERT INTO vapid_keys (id, private_key, public_key, created_at)
+		VALUES (1, $1, $2, $3)
+		ON CONFLICT (id) DO NOTHING
+	`
+	if _, err := s.DB.Exec(query, privateKey, publicKey, time.Now().UTC()); err != nil {
+		return "", "", fmt.Errorf("failed to store VAPID keys: %v", err)
+	}
+	return s.GetVAPIDKeys()
+}
+
+// SaveSubscription stores a subscription. An endpoint belongs to one browser,
+// so registering it again moves it to the current user and refreshes its keys.
+func (s *PushStorage) SaveSubscription(sub *types.PushSubscription) error {
+	query := `
+		INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (endpoint) DO UPDATE
+		SET user_id = EXCLUDED.user_id,
+		    p256dh = EXCLUDED.p256dh,
+		    auth = EXCLUDED.auth,
+		    user_agent = EXCLUDED.user_agent
+		RETURNING id, created_at
+	`
+	err := s.DB.QueryRow(query, sub.UserID, sub.Endpoint, sub.Keys.P256dh, sub.Keys.Auth, sub.UserAgent, time.Now().UTC()).
+		Scan(&sub.ID, &sub.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save push subscription for user %s: %v", sub.UserID, err)
+	}
+
+	log.Printf("Successfully saved push subscription %s for user %s", sub.ID, sub.UserID)
+	return nil
+}
+
+// GetSubscriptions returns the subscriptions of the given users.
+func (s *PushStorage) GetSubscriptions(userIDs []string) ([]types.PushSubscription, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, user_id, endpoint, p256dh, auth, user_agent, created_at
+		FROM push_subscriptions
+		WHERE user_id = ANY($1::uuid[])
+	`, pq.Array(userIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query push subscriptions: %v", err)
+	}
+	defer rows.Close()
+
+	subscriptions := []types.PushSubscription{}
+	for rows.Next() {
+		var sub types.PushSubscription
+		if err := rows.Scan(&sub.ID, &sub.UserID, &sub.Endpoint, &sub.Keys.P256dh, &sub.Keys.Auth, &sub.UserAgent, &sub.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning push subscription: %v", err)
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over push subscription rows: %v", err)
+	}
+
+	return subscriptions, nil
+}
+
+// DeleteSubscription removes one of the user's subscriptions.
+func (s *PushStorage) DeleteSubscription(userID, endpoint string) error {
+	result, err := s.DB.Exec(`DELETE FROM push_subscriptions WHERE user_id = $1 AND endpoint = $2`, userID, endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to delete push subscription for user %s: %v", userID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Push subscription not found"}
+	}
+
+	log.Printf("Successfully deleted push subscription for user %s", userID)
+	return nil
+}
+
+// PruneSubscription removes a subscription the push service reported as
+// expired or unknown.
+func (s *PushStorage) PruneSubscription(id string) error {
+	if _, err := s.DB.Exec(`DELETE FROM push_subscriptions WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to prune push subscription %s: %v", id, err)
+	}
+
+	log.Printf("Successfully pruned expired push subscription %s", id)
+	return nil
+}
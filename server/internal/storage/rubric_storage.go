@@ -0,0 +1,361 @@
+package storage
+
+import (
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const rubricColumns = `
+	r.id, r.course_id, r.title, r.description,
+	EXISTS (SELECT 1 FROM submission_grades g WHERE g.rubric_id = r.id)
+		OR EXISTS (SELECT 1 FROM peer_review_phases p WHERE p.rubric_id = r.id),
+	COALESCE(r.created_by::text, ''), r.created_at, r.updated_at`
+
+type RubricStorage struct {
+	DB *sql.DB
+}
+
+func NewRubricStorage(db *sql.DB) *RubricStorage {
+	return &RubricStorage{
+		DB: db,
+	}
+}
+
+func (s *RubricStorage) CheckCourseMember(courseID, userID string) error {
+	var isMember bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM course_members WHERE course_id = $1 AND user_id = $2
+		) OR EXISTS (
+			SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2
+		)
+	`, courseID, userID).Scan(&isMember)
+	if err != nil {
+		return fmt.Errorf("failed to check membership of course %s: %v", courseID, err)
+	}
+	if !isMember {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "You are not a member of this course"}
+	}
+	return nil
+}
+
+// CheckCourseInstructor allows the course admin and members with the
+// instructor role.
+func (s *RubricStorage) CheckCourseInstructor(courseID, userID string) error {
+	var isInstructor bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2
+		) OR EXISTS (
+			SELECT 1 FROM course_members
+			WHERE course_id = $1 AND user_id = $2 AND role = 3
+		)
+	`, courseID, userID).Scan(&isInstructor)
+	if err != nil {
+		return fmt.Errorf("failed to check instructor permission in course %s: %v", courseID, err)
+	}
+	if !isInstructor {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "Only course instructors can manage rubrics"}
+	}
+	return nil
+}
+
+func (s *RubricStorage) CreateRubric(rubric *types.Rubric) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO rubrics (course_id, title, description, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		RETURNING id, created_at, updated_at
+	`,
+		rubric.CourseID,
+		rubric.Title,
+		rubric.Description,
+		rubric.CreatedBy,
+		time.Now().UTC(),
+	).Scan(&rubric.ID, &rubric.CreatedAt, &rubric.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create rubric in course %s: %v", rubric.CourseID, err)
+	}
+
+	if err := insertCriteria(tx, rubric); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit rubric: %v", err)
+	}
+
+	log.Printf("Successfully created rubric %s in course %s by user %s", rubric.ID, rubric.CourseID, rubric.CreatedBy)
+	return nil
+}
+
+// insertCriteria saves the criteria of a rubric and their levels in order.
+func insertCriteria(tx *sql.Tx, rubric *types.Rubric) error {
+	for i := range rubric.Criteria {
+		criterion := &rubric.Criteria[i]
+		err := tx.QueryRow(`
+			INSERT INTO rubric_criteria (rubric_id, title, description, position)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id
+		`, rubric.ID, criterion.Title, criterion.Description, i+1).Scan(&criterion.ID)
+		if err != nil {
+			return fmt.Errorf("failed to save criterion of rubric %s: %v", rubric.ID, err)
+		}
+
+		for j := range criterion.Levels {
+			level := &criterion.Levels[j]
+			err := tx.QueryRow(`
+				INSERT INTO rubric_levels (criterion_id, title, description, points, position)
+				VALUES ($1, $2, $3, $4, $5)
+				RETURNING id
+			`, criterion.ID, level.Title, level.Description, level.Points, j+1).Scan(&level.ID)
+			if err != nil {
+				return fmt.Errorf("failed to save level of criterion %s: %v", criterion.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *RubricStorage) GetRubric(rubricID string) (*types.Rubric, error) {
+	rubric, err := scanRubric(s.DB.QueryRow(`
+		SELECT `+rubricColumns+` FROM rubrics r WHERE r.id = $1
+	`, rubricID))
+	if err == sql.ErrNoRows {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Rubric not found"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rubric %s: %v", rubricID, err)
+	}
+
+	if err := s.fillCriteria([]*types.Rubric{rubric}); err != nil {
+		return nil, err
+	}
+	return rubric, nil
+}
+
+func (s *RubricStorage) GetRubrics(courseID string) ([]*types.Rubric, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+rubricColumns+`
+		FROM rubrics r
+		WHERE r.course_id = $1
+		ORDER BY r.title, r.created_at, r.id
+	`, courseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rubrics of course %s: %v", courseID, err)
+	}
+	defer rows.Close()
+
+	rubrics := []*types.Rubric{}
+	for rows.Next() {
+		rubric, err := scanRubric(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning rubric: %v", err)
+		}
+		rubrics = append(rubrics, rubric)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rubric rows: %v", err)
+	}
+
+	if err := s.fillCriteria(rubrics); err != nil {
+		return nil, err
+	}
+	return rubrics, nil
+}
+
+// fillCriteria loads the criteria and levels of the rubrics and adds up
+// their points.
+func (s *RubricStorage) fillCriteria(rubrics []*types.Rubric) error {
+	if len(rubrics) == 0 {
+		return nil
+	}
+
+	byID := map[string]*types.Rubric{}
+	ids := make([]string, 0, len(rubrics))
+	for _, rubric := range rubrics {
+		byID[rubric.ID] = rubric
+		ids = append(ids, rubric.ID)
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT c.rubric_id, c.id, c.title, c.description,
+		       COALESCE(l.id::text, ''), COALESCE(l.title, ''), COALESCE(l.description, ''), COALESCE(l.points, 0)
+		FROM rubric_criteria c
+		LEFT JOIN rubric_levels l ON l.criterion_id = c.id
+		WHERE c.rubric_id = ANY($1::uuid[])
+		ORDER BY c.rubric_id, c.position, l.position
+	`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to query rubric criteria: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rubricID string
+		var criterion types.RubricCriterion
+		var level types.RubricLevel
+		if err := rows.Scan(
+			&rubricID,
+			&criterion.ID,
+			&criterion.Title,
+			&criterion.Description,
+			&level.ID,
+			&level.Title,
+			&level.Description,
+			&level.Points,
+		); err != nil {
+			return fmt.Errorf("error scanning rubric criterion: %v", err)
+		}
+
+		rubric := byID[rubricID]
+		if n := len(rubric.Criteria); n == 0 || rubric.Criteria[n-1].ID != criterion.ID {
+			criterion.Levels = []types.RubricLevel{}
+			rubric.Criteria = append(rubric.Criteria, criterion)
+		}
+		if level.ID != "" {
+			last := &rubric.Criteria[len(rubric.Criteria)-1]
+			last.Levels = append(last.Levels, level)
+			last.MaxPoints = max(last.MaxPoints, level.Points)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over rubric criterion rows: %v", err)
+	}
+
+	for _, rubric := range rubrics {
+		for _, criterion := range rubric.Criteria {
+			rubric.MaxPoints += criterion.MaxPoints
+		}
+	}
+	return nil
+}
+
+// UpdateRubric replaces a rubric with its criteria. Rubrics used for grading
+// cannot change.
+func (s *RubricStorage) UpdateRubric(rubric *types.Rubric) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkRubricUnused(tx, rubric.ID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE rubrics SET title = $2, description = $3, updated_at = $4 WHERE id = $1
+	`, rubric.ID, rubric.Title, rubric.Description, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to update rubric %s: %v", rubric.ID, err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM rubric_criteria WHERE rubric_id = $1`, rubric.ID); err != nil {
+		return fmt.Errorf("failed to clear criteria of rubric %s: %v", rubric.ID, err)
+	}
+	if err := insertCriteria(tx, rubric); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit rubric: %v", err)
+	}
+
+	log.Printf("Successfully updated rubric %s", rubric.ID)
+	return nil
+}
+
+// DeleteRubric removes a rubric that was not used for grading. Assignments
+// graded with it are left without a rubric.
+func (s *RubricStorage) DeleteRubric(rubricID string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkRubricUnused(tx, rubricID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM rubrics WHERE id = $1`, rubricID); err != nil {
+		return fmt.Errorf("failed to delete rubric %s: %v", rubricID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit rubric deletion: %v", err)
+	}
+
+	log.Printf("Successfully deleted rubric %s", rubricID)
+	return nil
+}
+
+// checkRubricUnused locks a rubric against grading and fails if it was used
+// for grading or peer review already.
+func checkRubricUnused(tx *sql.Tx, rubricID string) error {
+	var inUse bool
+	err := tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM submission_grades WHERE rubric_id = r.id)
+		       OR EXISTS (SELECT 1 FROM peer_review_phases WHERE rubric_id = r.id)
+		FROM rubrics r WHERE r.id = $1
+		FOR UPDATE
+	`, rubricID).Scan(&inUse)
+	if err == sql.ErrNoRows {
+		return &utils.ApiError{Code: http.StatusNotFound, Message: "Rubric not found"}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock rubric %s: %v", rubricID, err)
+	}
+	if inUse {
+		return &utils.ApiError{Code: http.StatusConflict, Message: "This rubric was used for grading and cannot change, copy it instead"}
+	}
+	return nil
+}
+
+// SetItemRubric attaches a rubric to an assignment, or detaches it when
+// rubricID is empty.
+func (s *RubricStorage) SetItemRubric(itemID, rubricID string) error {
+	_, err := s.DB.Exec(`
+		UPDATE module_items SET rubric_id = $2::uuid, updated_at = $3 WHERE id = $1
+	`, itemID, sql.NullString{String: rubricID, Valid: rubricID != ""}, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to set rubric of module item %s: %v", itemID, err)
+	}
+
+	log.Printf("Successfully set rubric of module item %s to %q", itemID, rubricID)
+	return nil
+}
+
+func scanRubric(row rowScanner) (*types.Rubric, error) {
+	var rubric types.Rubric
+	err := row.Scan(
+		&rubric.ID,
+		&rubric.CourseID,
+		&rubric.Title,
+		&rubric.Description,
+		&rubric.InUse,
+		&rubric.CreatedBy,
+		&rubric.CreatedAt,
+		&rubric.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	rubric.Criteria = []types.RubricCriterion{}
+	return &rubric, nil
+}
@@ -0,0 +1,441 @@
+package storage
+
+import (
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// submissionColumns reads a submission joined with its item as i, the
+// item's module as m and its author as u.
+const submissionColumns = `
+	s.id, s.item_id, i.title, m.course_id, s.body, s.submitted_at,
+	i.due_at IS NOT NULL AND s.submitted_at > i.due_at,
+	` + userSummaryColumns
+
+const submissionTables = `
+	submissions s
+	JOIN module_items i ON i.id = s.item_id
+	JOIN course_modules m ON m.id = i.module_id
+	JOIN users u ON u.id = s.user_id`
+
+type SubmissionStorage struct {
+	DB *sql.DB
+}
+
+func NewSubmissionStorage(db *sql.DB) *SubmissionStorage {
+	return &SubmissionStorage{
+		DB: db,
+	}
+}
+
+// IsCourseStaff reports whether the user is the course admin or a member with
+// the moderator or instructor role.
+func (s *SubmissionStorage) IsCourseStaff(courseID, userID string) (bool, error) {
+	var isStaff bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2
+		) OR EXISTS (
+			SELECT 1 FROM course_members
+			WHERE course_id = $1 AND user_id = $2 AND role >= 2
+		)
+	`, courseID, userID).Scan(&isStaff)
+	if err != nil {
+		return false, fmt.Errorf("failed to check staff permission in course %s: %v", courseID, err)
+	}
+	return isStaff, nil
+}
+
+func (s *SubmissionStorage) CheckCourseStaff(courseID, userID string) error {
+	isStaff, err := s.IsCourseStaff(courseID, userID)
+	if err != nil {
+		return err
+	}
+	if !isStaff {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "Only course staff can grade submissions"}
+	}
+	return nil
+}
+
+// SaveSubmission creates the user's submission for an item or replaces it,
+// together with its files. Graded submissions cannot be replaced, and no
+// submission can once peer review started.
+func (s *SubmissionStorage) SaveSubmission(itemID, userID, body string, documentIDs []string) (string, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var inReview bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM peer_review_phases WHERE item_id = $1)
+	`, itemID).Scan(&inReview)
+	if err != nil {
+		return "", fmt.Errorf("failed to check peer review of item %s: %v", itemID, err)
+	}
+	if inReview {
+		return "", &utils.ApiError{Code: http.StatusConflict, Message: "Peer review has started, submissions are closed"}
+	}
+
+	var submissionID string
+	err = tx.QueryRow(`
+		INSERT INTO submissions (item_id, user_id, body, submitted_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (item_id, user_id) DO UPDATE
+		SET body = EXCLUDED.body, submitted_at = EXCLUDED.submitted_at
+		WHERE NOT EXISTS (SELECT 1 FROM submission_grades g WHERE g.submission_id = submissions.id)
+		RETURNING id
+	`, itemID, userID, body, time.Now().UTC()).Scan(&submissionID)
+	if err == sql.ErrNoRows {
+		return "", &utils.ApiError{Code: http.StatusConflict, Message: "Your submission was already graded"}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to save submission of user %s for item %s: %v", userID, itemID, err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM submission_files WHERE submission_id = $1`, submissionID); err != nil {
+		return "", fmt.Errorf("failed to clear files of submission %s: %v", submissionID, err)
+	}
+	if len(documentIDs) > 0 {
+		_, err := tx.Exec(`
+			INSERT INTO submission_files (submission_id, document_id)
+			SELECT $1::uuid, unnest($2::uuid[])
+		`, submissionID, pq.Array(documentIDs))
+		if err != nil {
+			return "", fmt.Errorf("failed to save files of submission %s: %v", submissionID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit submission: %v", err)
+	}
+
+	log.Printf("Successfully saved submission %s of user %s for item %s", submissionID, userID, itemID)
+	return submissionID, nil
+}
+
+// GetSubmission returns a submission with its files and grade.
+func (s *SubmissionStorage) GetSubmission(submissionID string) (*types.Submission, error) {
+	submission, err := scanSubmission(s.DB.QueryRow(`
+		SELECT `+submissionColumns+` FROM `+submissionTables+` WHERE s.id = $1
+	`, submissionID))
+	if err == sql.ErrNoRows {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Submission not found"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get submission %s: %v", submissionID, err)
+	}
+
+	if err := s.fillSubmissions([]*types.Submission{submission}); err != nil {
+		return nil, err
+	}
+	return submission, nil
+}
+
+// GetSubmissions returns the submissions for an item with their files and
+// grades, of one user or of everyone when userID is empty.
+func (s *SubmissionStorage) GetSubmissions(itemID, userID string) ([]*types.Submission, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+submissionColumns+`
+		FROM `+submissionTables+`
+		WHERE s.item_id = $1 AND ($2::uuid IS NULL OR s.user_id = $2::uuid)
+		ORDER BY u.last_name, u.first_name, u.id
+	`, itemID, sql.NullString{String: userID, Valid: userID != ""})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query submissions for item %s: %v", itemID, err)
+	}
+	defer rows.Close()
+
+	submissions := []*types.Submission{}
+	for rows.Next() {
+		submission, err := scanSubmission(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning submission: %v", err)
+		}
+		submissions = append(submissions, submission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over submission rows: %v", err)
+	}
+
+	if err := s.fillSubmissions(submissions); err != nil {
+		return nil, err
+	}
+	return submissions, nil
+}
+
+// fillSubmissions loads the files and grades of the submissions. Grades come
+// without their rubric.
+func (s *SubmissionStorage) fillSubmissions(submissions []*types.Submission) error {
+	if len(submissions) == 0 {
+		return nil
+	}
+
+	byID := map[string]*types.Submission{}
+	ids := make([]string, 0, len(submissions))
+	for _, submission := range submissions {
+		byID[submission.ID] = submission
+		ids = append(ids, submission.ID)
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT f.submission_id, d.id, d.file_name, d.file_path, d.file_type, d.file_size,
+		       COALESCE(d.thumbnail_path, ''), d.created_at
+		FROM submission_files f
+		JOIN documents d ON d.id = f.document_id
+		WHERE f.submission_id = ANY($1::uuid[])
+		ORDER BY d.created_at, d.file_name
+	`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to query submission files: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var submissionID string
+		var doc types.Document
+		if err := rows.Scan(
+			&submissionID,
+			&doc.ID,
+			&doc.FileName,
+			&doc.FilePath,
+			&doc.FileType,
+			&doc.FileSize,
+			&doc.ThumbnailPath,
+			&doc.CreatedAt,
+		); err != nil {
+			return fmt.Errorf("error scanning submission file: %v", err)
+		}
+		doc.FilePath = utils.NormalizeMedia(doc.FilePath)
+		doc.ThumbnailPath = utils.NormalizeMedia(doc.ThumbnailPath)
+		byID[submissionID].Files = append(byID[submissionID].Files, doc)
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over submission file rows: %v", err)
+	}
+
+	grades, err := s.getGrades(ids)
+	if err != nil {
+		return err
+	}
+	for _, grade := range grades {
+		byID[grade.SubmissionID].Grade = grade
+	}
+	return nil
+}
+
+func (s *SubmissionStorage) getGrades(submissionIDs []string) ([]*types.SubmissionGrade, error) {
+	rows, err := s.DB.Query(`
+		SELECT submission_id, rubric_id, COALESCE(grader_id::text, ''), score, max_score,
+		       comment, returned_at, updated_at
+		FROM submission_grades
+		WHERE submission_id = ANY($1::uuid[])
+	`, pq.Array(submissionIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query grades: %v", err)
+	}
+	defer rows.Close()
+
+	grades := []*types.SubmissionGrade{}
+	byID := map[string]*types.SubmissionGrade{}
+	for rows.Next() {
+		var grade types.SubmissionGrade
+		var returnedAt sql.NullTime
+		if err := rows.Scan(
+			&grade.SubmissionID,
+			&grade.RubricID,
+			&grade.GraderID,
+			&grade.Score,
+			&grade.MaxScore,
+			&grade.Comment,
+			&returnedAt,
+			&grade.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning grade: %v", err)
+		}
+		if returnedAt.Valid {
+			grade.Returned = true
+			grade.ReturnedAt = &returnedAt.Time
+		}
+		grade.Criteria = []types.CriterionScore{}
+		grades = append(grades, &grade)
+		byID[grade.SubmissionID] = &grade
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over grade rows: %v", err)
+	}
+	if len(grades) == 0 {
+		return grades, nil
+	}
+
+	rows, err = s.DB.Query(`
+		SELECT gc.submission_id, gc.criterion_id, COALESCE(gc.level_id::text, ''), gc.points, gc.comment
+		FROM submission_grade_criteria gc
+		JOIN rubric_criteria c ON c.id = gc.criterion_id
+		WHERE gc.submission_id = ANY($1::uuid[])
+		ORDER BY gc.submission_id, c.position
+	`, pq.Array(submissionIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query grade criteria: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var submissionID string
+		var score types.CriterionScore
+		if err := rows.Scan(&submissionID, &score.CriterionID, &score.LevelID, &score.Points, &score.Comment); err != nil {
+			return nil, fmt.Errorf("error scanning grade criterion: %v", err)
+		}
+		if grade, ok := byID[submissionID]; ok {
+			grade.Criteria = append(grade.Criteria, score)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over grade criterion rows: %v", err)
+	}
+
+	return grades, nil
+}
+
+// SaveGrade stores the grade of a submission with its criterion scores. A
+// returned grade stays returned.
+func (s *SubmissionStorage) SaveGrade(grade *types.SubmissionGrade) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Keep the rubric from changing while it is used
+	var rubricID string
+	err = tx.QueryRow(`SELECT id FROM rubrics WHERE id = $1 FOR SHARE`, grade.RubricID).Scan(&rubricID)
+	if err == sql.ErrNoRows {
+		return &utils.ApiError{Code: http.StatusConflict, Message: "The rubric of this assignment was deleted"}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock rubric %s: %v", grade.RubricID, err)
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO submission_grades (submission_id, rubric_id, grader_id, score, max_score, comment, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (submission_id) DO UPDATE
+		SET rubric_id = EXCLUDED.rubric_id, grader_id = EXCLUDED.grader_id, score = EXCLUDED.score,
+		    max_score = EXCLUDED.max_score, comment = EXCLUDED.comment, updated_at = EXCLUDED.updated_at
+		RETURNING updated_at
+	`,
+		grade.SubmissionID,
+		grade.RubricID,
+		grade.GraderID,
+		grade.Score,
+		grade.MaxScore,
+		grade.Comment,
+		time.Now().UTC(),
+	).Scan(&grade.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save grade of submission %s: %v", grade.SubmissionID, err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM submission_grade_criteria WHERE submission_id = $1`, grade.SubmissionID); err != nil {
+		return fmt.Errorf("failed to clear criteria of grade %s: %v", grade.SubmissionID, err)
+	}
+	for _, score := range grade.Criteria {
+		_, err := tx.Exec(`
+			INSERT INTO submission_grade_criteria (submission_id, criterion_id, level_id, points, comment)
+			VALUES ($1, $2, $3::uuid, $4, $5)
+		`,
+			grade.SubmissionID,
+			score.CriterionID,
+			sql.NullString{String: score.LevelID, Valid: score.LevelID != ""},
+			score.Points,
+			score.Comment,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save criterion score of grade %s: %v", grade.SubmissionID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit grade: %v", err)
+	}
+
+	log.Printf("Successfully graded submission %s by user %s", grade.SubmissionID, grade.GraderID)
+	return nil
+}
+
+// ReturnGrade shows the grade of a submission to its author and records a
+// grade.returned event.
+func (s *SubmissionStorage) ReturnGrade(event *types.GradeReturned) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var alreadyReturned bool
+	err = tx.QueryRow(`
+		SELECT returned_at IS NOT NULL FROM submission_grades WHERE submission_id = $1 FOR UPDATE
+	`, event.SubmissionID).Scan(&alreadyReturned)
+	if err == sql.ErrNoRows {
+		return &utils.ApiError{Code: http.StatusConflict, Message: "This submission has not been graded"}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock grade of submission %s: %v", event.SubmissionID, err)
+	}
+	if alreadyReturned {
+		return &utils.ApiError{Code: http.StatusConflict, Message: "This grade was already returned"}
+	}
+
+	err = tx.QueryRow(`
+		UPDATE submission_grades SET returned_at = $2 WHERE submission_id = $1
+		RETURNING score, max_score
+	`, event.SubmissionID, event.ReturnedAt).Scan(&event.Score, &event.MaxScore)
+	if err != nil {
+		return fmt.Errorf("failed to return grade of submission %s: %v", event.SubmissionID, err)
+	}
+
+	if err := AppendOutboxEvent(tx, types.EventGradeReturned, event.CourseID, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit returned grade: %v", err)
+	}
+
+	log.Printf("Successfully returned grade of submission %s", event.SubmissionID)
+	return nil
+}
+
+func scanSubmission(row rowScanner) (*types.Submission, error) {
+	var submission types.Submission
+	err := row.Scan(
+		&submission.ID,
+		&submission.ItemID,
+		&submission.ItemTitle,
+		&submission.CourseID,
+		&submission.Body,
+		&submission.SubmittedAt,
+		&submission.Late,
+		&submission.User.ID,
+		&submission.User.Email,
+		&submission.User.Username,
+		&submission.User.FirstName,
+		&submission.User.LastName,
+		&submission.User.Avatar,
+	)
+	if err != nil {
+		return nil, err
+	}
+	submission.User.Avatar = utils.NormalizeMedia(submission.User.Avatar)
+	submission.Files = []types.Document{}
+	return &submission, nil
+}
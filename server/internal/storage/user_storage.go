@@ -208,3 +208,14 @@ func (s *UserStorage) CheckForUsernameOrEmail(user *types.User) error {
 
 	return nil
 }
+
+// IsAdmin reports whether the user operates the instance. Admins are granted
+// by setting users.is_admin in the database.
+func (s *UserStorage) IsAdmin(userID string) (bool, error) {
+	var isAdmin bool
+	err := s.DB.QueryRow(`SELECT is_admin FROM users WHERE id = $1`, userID).Scan(&isAdmin)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("error checking admin rights of user %s: %w", userID, err)
+	}
+	return isAdmin, nil
+}
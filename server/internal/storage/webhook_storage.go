@@ -0,0 +1,371 @@
+package storage
+
+import (
+	"course-flow/internal/types"
+	"course-flow/internal/utils"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type WebhookStorage struct {
+	DB *sql.DB
+}
+
+func NewWebhookStorage(db *sql.DB) *WebhookStorage {
+	return &WebhookStorage{
+		DB: db,
+	}
+}
+
+// CheckCourseAdmin makes sure the user is the admin of the course, who is the
+// only one allowed to manage its webhooks.
+func (s *WebhookStorage) CheckCourseAdmin(courseID, userID string) error {
+	var isAdmin bool
+	err := s.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM courses WHERE id = $1 AND admin_id = $2)`, courseID, userID).Scan(&isAdmin)
+	if err != nil {
+		return fmt.Errorf("failed to check admin of course %s: %v", courseID, err)
+	}
+	if !isAdmin {
+		return &utils.ApiError{Code: http.StatusForbidden, Message: "Only the course admin can manage webhooks"}
+	}
+	return nil
+}
+
+func (s *WebhookStorage) CreateWebhook(webhook *types.Webhook) error {
+	now := time.Now().UTC()
+	query := `
+		INSERT INTO webhooks (course_id, url, secret, event_types, active, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		RETURNING id, created_at, updated_at
+	`
+	err := s.DB.QueryRow(query, webhook.CourseID, webhook.URL, webhook.Secret, pq.Array(webhook.EventTypes), webhook.Active, webhook.CreatedBy, now).
+		Scan(&webhook.ID, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook for course %s: %v", webhook.CourseID, err)
+	}
+
+	log.Printf("Successfully created webhook %s for course %s", webhook.ID, webhook.CourseID)
+	return nil
+}
+
+func (s *WebhookStorage) GetWebhooks(courseID string) ([]types.Webhook, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, course_id, url, event_types, active, COALESCE(created_by::text, ''), created_at, updated_at
+		FROM webhooks
+		WHERE course_id = $1
+		ORDER BY created_at
+	`, courseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks of course %s: %v", courseID, err)
+	}
+	defer rows.Close()
+
+	webhooks := []types.Webhook{}
+	for rows.Next() {
+		var webhook types.Webhook
+		if err := rows.Scan(&webhook.ID, &webhook.CourseID, &webhook.URL, pq.Array(&webhook.EventTypes), &webhook.Active, &webhook.CreatedBy, &webhook.CreatedAt, &webhook.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning webhook: %v", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over webhook rows: %v", err)
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhook returns a webhook of a course the user is the admin of.
+func (s *WebhookStorage) GetWebhook(webhookID, userID string) (*types.Webhook, error) {
+	var webhook types.Webhook
+	err := s.DB.QueryRow(`
+		SELECT w.id, w.course_id, w.url, w.event_types, w.active, COALESCE(w.created_by::text, ''), w.created_at, w.updated_at
+		FROM webhooks w
+		JOIN courses c ON c.id = w.course_id
+		WHERE w.id = $1 AND c.admin_id = $2
+	`, webhookID, userID).Scan(&webhook.ID, &webhook.CourseID, &webhook.URL, pq.Array(&webhook.EventTypes), &webhook.Active, &webhook.CreatedBy, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Webhook not found"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook %s: %v", webhookID, err)
+	}
+	return &webhook, nil
+}
+
+func (s *WebhookStorage) UpdateWebhook(webhook *types.Webhook) error {
+	webhook.UpdatedAt = time.Now().UTC()
+	query := `
+		UPDATE webhooks
+		SET url = $2, event_types = $3, active = $4, updated_at = $5
+		WHERE id = $1
+	`
+	if _, err := s.DB.Exec(query, webhook.ID, webhook.URL, pq.Array(webhook.EventTypes), webhook.Active, webhook.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to update webhook %s: %v", webhook.ID, err)
+	}
+
+	log.Printf("Successfully updated webhook %s", webhook.ID)
+	return nil
+}
+
+func (s *WebhookStorage) SetSecret(webhookID, secret string) error {
+	if _, err := s.DB.Exec(`UPDATE webhooks SET secret = $2, updated_at = $3 WHERE id = $1`, webhookID, secret, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to rotate secret of webhook %s: %v", webhookID, err)
+	}
+
+	log.Printf("Successfully rotated secret of webhook %s", webhookID)
+	return nil
+}
+
+func (s *WebhookStorage) DeleteWebhook(webhookID string) error {
+	if _, err := s.DB.Exec(`DELETE FROM webhooks WHERE id = $1`, webhookID); err != nil {
+		return fmt.Errorf("failed to delete webhook %s: %v", webhookID, err)
+	}
+
+	log.Printf("Successfully deleted webhook %s", webhookID)
+	return nil
+}
+
+// CreateDeliveries queues an event for every active webhook of the course
+// subscribed to its type and returns how many were queued. Webhooks that
+// already have the event are skipped.
+func (s *WebhookStorage) CreateDeliveries(courseID, eventType, eventID string, payload []byte) (int64, error) {
+	now := time.Now().UTC()
+	result, err := s.DB.Exec(`
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+		SELECT id, $3::uuid, $2::text, $4::jsonb, 'pending', $5::timestamp, $5::timestamp
+		FROM webhooks
+		WHERE course_id = $1 AND active AND $2 = ANY(event_types)
+		ON CONFLICT (webhook_id, event_id) WHERE replay_of IS NULL DO NOTHING
+	`, courseID, eventType, eventID, string(payload), now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue %s webhooks for course %s: %v", eventType, courseID, err)
+	}
+
+	queued, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	return queued, nil
+}
+
+// ClaimDeliveries takes up to limit due deliveries of active webhooks and
+// pushes their next attempt back by lease, so other instances leave them
+// alone while they are sent.
+func (s *WebhookStorage) ClaimDeliveries(now time.Time, lease time.Duration, limit int) ([]types.WebhookJob, error) {
+	rows, err := s.DB.Query(`
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = $2
+		FROM webhooks w
+		WHERE w.id = d.webhook_id
+		  AND d.id IN (
+			SELECT dd.id
+			FROM webhook_deliveries dd
+			JOIN webhooks ww ON ww.id = dd.webhook_id
+			WHERE dd.status = 'pending' AND dd.next_attempt_at <= $1 AND ww.active
+			ORDER BY dd.next_attempt_at
+			LIMIT $3
+			FOR UPDATE OF dd SKIP LOCKED
+		  )
+		RETURNING d.id, d.webhook_id, d.event_type, d.payload, d.attempts, w.url, w.secret
+	`, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	var jobs []types.WebhookJob
+	for rows.Next() {
+		var job types.WebhookJob
+		if err := rows.Scan(&job.DeliveryID, &job.WebhookID, &job.EventType, &job.Payload, &job.Attempts, &job.URL, &job.Secret); err != nil {
+			return nil, fmt.Errorf("error scanning webhook delivery: %v", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over webhook delivery rows: %v", err)
+	}
+
+	return jobs, nil
+}
+
+// RecordAttempt logs an attempt and moves the delivery to status, to be
+// retried at nextAttemptAt while it is pending.
+func (s *WebhookStorage) RecordAttempt(deliveryID string, attempt types.WebhookDeliveryAttempt, status string, nextAttemptAt *time.Time) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO webhook_delivery_attempts (delivery_id, attempt, response_status, error, duration_ms, attempted_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, deliveryID, attempt.Attempt, attempt.ResponseStatus, attempt.Error, attempt.DurationMs, attempt.AttemptedAt)
+	if err != nil {
+		return fmt.Errorf("failed to log attempt of webhook delivery %s: %v", deliveryID, err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, response_status = $4, next_attempt_at = $5
+		WHERE id = $1
+	`, deliveryID, status, attempt.Attempt, attempt.ResponseStatus, nextAttemptAt)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery %s: %v", deliveryID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// GetDeliveries returns the deliveries of a webhook, newest first.
+func (s *WebhookStorage) GetDeliveries(webhookID string, page types.WebhookDeliveryPage) ([]types.WebhookDelivery, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, webhook_id, event_id, event_type, status, attempts, response_status, next_attempt_at, COALESCE(replay_of::text, ''), created_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		  AND ($2::uuid IS NULL OR (created_at, id) < (SELECT created_at, id FROM webhook_deliveries WHERE id = $2::uuid))
+		  AND ($3 = '' OR status = $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`, webhookID, sql.NullString{String: page.Before, Valid: page.Before != ""}, page.Status, page.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deliveries of webhook %s: %v", webhookID, err)
+	}
+	defer rows.Close()
+
+	deliveries := []types.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over webhook delivery rows: %v", err)
+	}
+
+	return deliveries, nil
+}
+
+// GetDelivery returns a delivery of the webhook with its payload and every
+// attempt made.
+func (s *WebhookStorage) GetDelivery(webhookID, deliveryID string) (*types.WebhookDelivery, error) {
+	row := s.DB.QueryRow(`
+		SELECT id, webhook_id, event_id, event_type, status, attempts, response_status, next_attempt_at, COALESCE(replay_of::text, ''), created_at, payload
+		FROM webhook_deliveries
+		WHERE id = $1 AND webhook_id = $2
+	`, deliveryID, webhookID)
+	delivery, err := scanDelivery(row, true)
+	if err == sql.ErrNoRows {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Delivery not found"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT attempt, response_status, error, duration_ms, attempted_at
+		FROM webhook_delivery_attempts
+		WHERE delivery_id = $1
+		ORDER BY attempt
+	`, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attempts of webhook delivery %s: %v", deliveryID, err)
+	}
+	defer rows.Close()
+
+	delivery.AttemptLog = []types.WebhookDeliveryAttempt{}
+	for rows.Next() {
+		var attempt types.WebhookDeliveryAttempt
+		var responseStatus sql.NullInt64
+		if err := rows.Scan(&attempt.Attempt, &responseStatus, &attempt.Error, &attempt.DurationMs, &attempt.AttemptedAt); err != nil {
+			return nil, fmt.Errorf("error scanning webhook delivery attempt: %v", err)
+		}
+		if responseStatus.Valid {
+			status := int(responseStatus.Int64)
+			attempt.ResponseStatus = &status
+		}
+		delivery.AttemptLog = append(delivery.AttemptLog, attempt)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over webhook delivery attempt rows: %v", err)
+	}
+
+	return delivery, nil
+}
+
+// ReplayDelivery queues the event of a past delivery again as a new delivery.
+func (s *WebhookStorage) ReplayDelivery(webhookID, deliveryID string) (*types.WebhookDelivery, error) {
+	now := time.Now().UTC()
+	row := s.DB.QueryRow(`
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, status, next_attempt_at, replay_of, created_at)
+		SELECT webhook_id, event_id, event_type, payload, 'pending', $3::timestamp, id, $3::timestamp
+		FROM webhook_deliveries
+		WHERE id = $1 AND webhook_id = $2
+		RETURNING id, webhook_id, event_id, event_type, status, attempts, response_status, next_attempt_at, COALESCE(replay_of::text, ''), created_at
+	`, deliveryID, webhookID, now)
+	delivery, err := scanDelivery(row, false)
+	if err == sql.ErrNoRows {
+		return nil, &utils.ApiError{Code: http.StatusNotFound, Message: "Delivery not found"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Successfully queued replay %s of webhook delivery %s", delivery.ID, deliveryID)
+	return delivery, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanDelivery scans the delivery columns, followed by the payload when
+// withPayload is set.
+func scanDelivery(row rowScanner, withPayload bool) (*types.WebhookDelivery, error) {
+	var delivery types.WebhookDelivery
+	var responseStatus sql.NullInt64
+	var nextAttemptAt sql.NullTime
+	var payload []byte
+
+	dest := []any{
+		&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &delivery.Status,
+		&delivery.Attempts, &responseStatus, &nextAttemptAt, &delivery.ReplayOf, &delivery.CreatedAt,
+	}
+	if withPayload {
+		dest = append(dest, &payload)
+	}
+
+	if err := row.Scan(dest...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error scanning webhook delivery: %v", err)
+	}
+
+	if responseStatus.Valid {
+		status := int(responseStatus.Int64)
+		delivery.ResponseStatus = &status
+	}
+	if nextAttemptAt.Valid {
+		delivery.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if withPayload {
+		delivery.Payload = payload
+	}
+	return &delivery, nil
+}
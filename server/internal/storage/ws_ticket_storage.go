@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"course-flow/internal/utils"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type WSTicketStorage struct {
+	DB *sql.DB
+}
+
+func NewWSTicketStorage(db *sql.DB) *WSTicketStorage {
+	return &WSTicketStorage{
+		DB: db,
+	}
+}
+
+// CreateTicket stores the hash of a ticket together with the expiry of the
+// access token it was issued for. Expired tickets are removed on the way.
+func (s *WSTicketStorage) CreateTicket(ticketHash, userID string, tokenExpiresAt, expiresAt time.Time) error {
+	now := time.Now().UTC()
+
+	if _, err := s.DB.Exec(`DELETE FROM ws_tickets WHERE expires_at < $1`, now); err != nil {
+		return fmt.Errorf("failed to remove expired websocket tickets: %v", err)
+	}
+
+	query := `
+		INSERT INTO ws_tickets (ticket_hash, user_id, token_expires_at, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	if _, err := s.DB.Exec(query, ticketHash, userID, tokenExpiresAt.UTC(), expiresAt.UTC(), now); err != nil {
+		return fmt.Errorf("failed to create websocket ticket for user %s: %v", userID, err)
+	}
+	return nil
+}
+
+// RedeemTicket consumes a ticket and returns its user and the expiry of the
+// access token it was issued for. A ticket can only be redeemed once.
+func (s *WSTicketStorage) RedeemTicket(ticketHash string) (string, time.Time, error) {
+	var userID string
+	var tokenExpiresAt, expiresAt time.Time
+	err := s.DB.QueryRow(
+		`DELETE FROM ws_tickets WHERE ticket_hash = $1 RETURNING user_id, token_expires_at, expires_at`,
+		ticketHash,
+	).Scan(&userID, &tokenExpiresAt, &expiresAt)
+	if err == sql.ErrNoRows {
+		return "", time.Time{}, &utils.ApiError{Code: http.StatusUnauthorized, Message: "Invalid or already used ticket"}
+	}
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to redeem websocket ticket: %v", err)
+	}
+
+	if time.Now().UTC().After(expiresAt) {
+		return "", time.Time{}, &utils.ApiError{Code: http.StatusUnauthorized, Message: "Ticket has expired"}
+	}
+	return userID, tokenExpiresAt, nil
+}
@@ -0,0 +1,125 @@
+package types
+
+import "time"
+
+// Attendance statuses
+const (
+	AttendancePresent = "present"
+	AttendanceLate    = "late"
+	AttendanceExcused = "excused"
+	AttendanceAbsent  = "absent"
+)
+
+// AttendanceStatuses lists the statuses staff can set.
+var AttendanceStatuses = []string{
+	AttendancePresent,
+	AttendanceLate,
+	AttendanceExcused,
+	AttendanceAbsent,
+}
+
+// FrameCheckInCode is the type of the WebSocket frame carrying the current
+// check-in code of a session to the course staff.
+const FrameCheckInCode = "attendance.code"
+
+// ClassSession is a meeting of a course that attendance is taken for.
+// Students checking in after LateAfter are late.
+type ClassSession struct {
+	ID              string         `json:"id"`
+	CourseID        string         `json:"course_id"`
+	Title           string         `json:"title"`
+	StartsAt        time.Time      `json:"starts_at"`
+	LateAfter       time.Time      `json:"late_after"`
+	CheckInOpen     bool           `json:"check_in_open"`
+	CheckInClosesAt *time.Time     `json:"check_in_closes_at,omitempty"`
+	Counts          map[string]int `json:"counts"` // Students per status, unmarked students count as absent
+	CreatedBy       string         `json:"created_by,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+}
+
+type ClassSessionRequest struct {
+	Title            string `json:"title"`
+	StartsAt         string `json:"starts_at"`          // RFC 3339
+	LateAfterMinutes *int   `json:"late_after_minutes"` // Defaults to 10
+}
+
+type OpenCheckInRequest struct {
+	DurationMinutes int `json:"duration_minutes"` // Defaults to 15
+}
+
+// CheckInRequest is what students submit, typed in or scanned from the QR
+// code. Without a session the code is matched against the open sessions of
+// the student's courses.
+type CheckInRequest struct {
+	SessionID string `json:"session_id,omitempty"`
+	Code      string `json:"code"`
+}
+
+// CheckInResult is the outcome of a check-in. Students who already have a
+// record keep it, e.g. when staff excused them.
+type CheckInResult struct {
+	SessionID       string `json:"session_id"`
+	CourseID        string `json:"course_id"`
+	Status          string `json:"status"`
+	AlreadyRecorded bool   `json:"already_recorded"`
+}
+
+// CheckInCode is the current check-in code of a session. QRPayload is the
+// CheckInRequest to submit when the QR code is scanned.
+type CheckInCode struct {
+	Type      string    `json:"type"`
+	SessionID string    `json:"session_id"`
+	CourseID  string    `json:"course_id"`
+	Code      string    `json:"code"`
+	QRPayload string    `json:"qr_payload"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CheckedIn int       `json:"checked_in"`
+}
+
+// OpenCheckIn is a session accepting check-ins, with what is needed to send
+// its codes to the staff of the course.
+type OpenCheckIn struct {
+	SessionID string
+	CourseID  string
+	Secret    string
+	LateAfter time.Time
+	CheckedIn int
+	StaffIDs  []string
+}
+
+type AttendanceRecordRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+// AttendanceRecord is the attendance of a student at a session. MarkedBy is
+// set when staff set the status by hand.
+type AttendanceRecord struct {
+	SessionID    string     `json:"session_id"`
+	SessionTitle string     `json:"session_title,omitempty"`
+	StartsAt     *time.Time `json:"starts_at,omitempty"`
+	User         User       `json:"user"`
+	Status       string     `json:"status"`
+	Recorded     bool       `json:"recorded"` // False for students without a record, reported as absent
+	CheckedInAt  *time.Time `json:"checked_in_at,omitempty"`
+	MarkedBy     string     `json:"marked_by,omitempty"`
+	Note         string     `json:"note"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+}
+
+// SessionAttendance is the attendance report of a session.
+type SessionAttendance struct {
+	Session *ClassSession      `json:"session"`
+	Records []AttendanceRecord `json:"records"`
+}
+
+// StudentAttendance is the attendance report of a student in a course. Rate
+// is the share of sessions the student attended, counting late as attended
+// and leaving excused sessions out.
+type StudentAttendance struct {
+	User    User               `json:"user"`
+	Counts  map[string]int     `json:"counts"`
+	Rate    float64            `json:"rate"`
+	Records []AttendanceRecord `json:"records,omitempty"`
+}
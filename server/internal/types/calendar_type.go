@@ -0,0 +1,94 @@
+package types
+
+import "time"
+
+// Kinds of course events
+const (
+	CalendarLecture     = "lecture"
+	CalendarExam        = "exam"
+	CalendarOfficeHours = "office_hours"
+	CalendarDueDate     = "due_date"
+	CalendarOther       = "other"
+)
+
+// CalendarEventKinds lists the kinds a course event can have.
+var CalendarEventKinds = []string{
+	CalendarLecture,
+	CalendarExam,
+	CalendarOfficeHours,
+	CalendarDueDate,
+	CalendarOther,
+}
+
+// CourseEvent is a dated event of a course. Times are stored in UTC; a
+// recurring event repeats at the same wall clock time in its time zone.
+type CourseEvent struct {
+	ID          string      `json:"id"`
+	CourseID    string      `json:"course_id"`
+	CourseName  string      `json:"course_name,omitempty"`
+	UID         string      `json:"uid"` // iCalendar UID, kept stable across imports
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Location    string      `json:"location"`
+	Kind        string      `json:"kind"`
+	StartsAt    time.Time   `json:"starts_at"`
+	EndsAt      time.Time   `json:"ends_at"`
+	AllDay      bool        `json:"all_day"`
+	Timezone    string      `json:"timezone"`
+	RRule       string      `json:"rrule"`
+	ExDates     []time.Time `json:"exdates"` // Starts of the occurrences that were cancelled
+	LastEndsAt  *time.Time  `json:"-"`       // End of the last occurrence, nil when it repeats forever
+	CreatedBy   string      `json:"created_by"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// CourseEventRequest creates or replaces a course event. Times are RFC 3339,
+// or dates (2006-01-02) for all-day events. ends_at defaults to starts_at, or
+// the next day for all-day events.
+type CourseEventRequest struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Location    string   `json:"location"`
+	Kind        string   `json:"kind"`
+	StartsAt    string   `json:"starts_at"`
+	EndsAt      string   `json:"ends_at"`
+	AllDay      bool     `json:"all_day"`
+	Timezone    string   `json:"timezone"`
+	RRule       string   `json:"rrule"`
+	ExDates     []string `json:"exdates"`
+}
+
+// EventOccurrence is one occurrence of a course event in a calendar view.
+type EventOccurrence struct {
+	EventID    string    `json:"event_id"`
+	CourseID   string    `json:"course_id"`
+	CourseName string    `json:"course_name,omitempty"`
+	Title      string    `json:"title"`
+	Location   string    `json:"location"`
+	Kind       string    `json:"kind"`
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+	AllDay     bool      `json:"all_day"`
+	Timezone   string    `json:"timezone"`
+	Recurring  bool      `json:"recurring"`
+}
+
+// CalendarFeed is the private iCalendar subscription URL of a user.
+type CalendarFeed struct {
+	URL string `json:"url"`
+}
+
+// CalendarImportResult reports what an ICS import did.
+type CalendarImportResult struct {
+	Created int                  `json:"created"`
+	Updated int                  `json:"updated"`
+	Skipped []CalendarImportSkip `json:"skipped"`
+}
+
+// CalendarImportSkip is an event of an ICS file that was not imported.
+type CalendarImportSkip struct {
+	UID     string `json:"uid"`
+	Summary string `json:"summary"`
+	Reason  string `json:"reason"`
+}
@@ -2,12 +2,85 @@ package types
 
 import "time"
 
+// Frame types understood by the chat WebSocket
+const (
+	ChatTypeMessage = "chat_message"
+	ChatTypeEdit    = "chat_edit"
+	ChatTypeDelete  = "chat_delete"
+	ChatTypeRead    = "chat_read"
+	ChatTypeTyping  = "typing"
+	ChatTypeError   = "error"  // Sent back to the sender when a frame is rejected
+	ChatTypeAck     = "ack"    // Client acknowledges frames up to event_id
+	ChatTypeReauth  = "reauth" // Client extends the connection with a new access token
+)
+
+// Blocked word handling modes of a course chat
+const (
+	ChatFilterReject = "reject"
+	ChatFilterMask   = "mask"
+)
+
 type ChatMessage struct {
-	ID        string    `json:"id"`
-	CourseID  string    `json:"course_id"`
-	Sender    User      `json:"sender"`
-	Content   string    `json:"text"`
-	Timestamp time.Time `json:"timestamp"`
-	FromID    string    `json:"from_id"`
-	Type      string    `json:"type"`
+	ID             string       `json:"id"`
+	CourseID       string       `json:"course_id"`
+	ConversationID string       `json:"conversation_id,omitempty"` // Set instead of CourseID for direct messages
+	Sender         User         `json:"sender"`
+	Content        string       `json:"text"`
+	Timestamp      time.Time    `json:"timestamp"`
+	FromID         string       `json:"from_id"`
+	Type           string       `json:"type"`
+	ParentID       string       `json:"parent_id,omitempty"`
+	Parent         *ChatMessage `json:"parent,omitempty"` // Quoted message when this is a reply
+	EditedAt       *time.Time   `json:"edited_at,omitempty"`
+	Deleted        bool         `json:"deleted,omitempty"`
+	AttachmentIDs  []string     `json:"attachment_ids,omitempty"` // Uploaded documents to attach when sending
+	Attachments    []Document   `json:"attachments,omitempty"`
+	RecipientIDs   []string     `json:"-"`                  // Conversation participants to deliver to
+	EventID        int64        `json:"event_id,omitempty"` // Hub event ID, also used by ack frames
+}
+
+// ChatPage selects a page of messages. Before is a message ID; when Limit is
+// zero every message is returned.
+type ChatPage struct {
+	Before string
+	Limit  int
+}
+
+type ChatSettings struct {
+	CourseID        string    `json:"course_id"`
+	AllowStudentDMs bool      `json:"allow_student_dms"`
+	SlowModeSeconds int       `json:"slow_mode_seconds"`
+	StaffOnly       bool      `json:"staff_only"`
+	BlockedWords    []string  `json:"blocked_words"`
+	FilterMode      string    `json:"filter_mode"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type ChatMute struct {
+	CourseID   string    `json:"course_id"`
+	UserID     string    `json:"user_id"`
+	MutedBy    string    `json:"muted_by"`
+	MutedUntil time.Time `json:"muted_until"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type ChatMuteRequest struct {
+	UserID          string `json:"user_id"`
+	DurationMinutes int    `json:"duration_minutes"`
+}
+
+// ChatErrorFrame reports a rejected frame back to its sender.
+type ChatErrorFrame struct {
+	Type           string `json:"type"`
+	Code           int    `json:"code"`
+	Message        string `json:"message"`
+	FrameType      string `json:"frame_type"`
+	CourseID       string `json:"course_id,omitempty"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	MessageID      string `json:"message_id,omitempty"`
+}
+
+type ChatUnreadCount struct {
+	CourseID string `json:"course_id"`
+	Unread   int    `json:"unread"`
 }
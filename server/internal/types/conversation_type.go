@@ -0,0 +1,19 @@
+package types
+
+import "time"
+
+type Conversation struct {
+	ID           string       `json:"id"`
+	CourseID     string       `json:"course_id"`
+	CreatedBy    string       `json:"created_by"`
+	IsGroup      bool         `json:"is_group"`
+	Participants []User       `json:"participants"`
+	LastMessage  *ChatMessage `json:"last_message,omitempty"`
+	Unread       int          `json:"unread"`
+	CreatedAt    time.Time    `json:"created_at"`
+}
+
+type ConversationRequest struct {
+	CourseID       string   `json:"course_id"`
+	ParticipantIDs []string `json:"participant_ids"` // Other participants, the creator is added automatically
+}
@@ -0,0 +1,32 @@
+package types
+
+import "time"
+
+// Email digest frequencies
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+	DigestOff    = "off"
+)
+
+type DigestSettings struct {
+	Frequency  string     `json:"frequency"`
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+}
+
+// DigestRecipient is a user due for a digest.
+type DigestRecipient struct {
+	UserID     string
+	Email      string
+	FirstName  string
+	Frequency  string
+	LastSentAt *time.Time
+}
+
+// DigestCourse groups the unread notifications of one course in a digest.
+type DigestCourse struct {
+	CourseID      string
+	CourseName    string
+	Notifications []Notification
+	MuteURL       string
+}
@@ -3,11 +3,19 @@ package types
 import "time"
 
 type Document struct {
-	ID        string    `json:"id,omitempty"`
-	UserID    string    `json:"user_id,omitempty"` // Owner of the document
-	FileName  string    `json:"file_name,omitempty"`
-	FilePath  string    `json:"file_path,omitempty"` // Now allows longer paths
-	FileType  string    `json:"file_type,omitempty"`
-	CreatedAt time.Time `json:"created_at,omitempty"`
-	UpdatedAt time.Time `json:"updated_at,omitempty"`
+	ID            string    `json:"id,omitempty"`
+	UserID        string    `json:"user_id,omitempty"` // Owner of the document
+	FileName      string    `json:"file_name,omitempty"`
+	FilePath      string    `json:"file_path,omitempty"` // Now allows longer paths
+	FileType      string    `json:"file_type,omitempty"`
+	FileSize      int64     `json:"file_size,omitempty"`
+	ThumbnailPath string    `json:"thumbnail_path,omitempty"` // Preview generated for images
+	CreatedAt     time.Time `json:"created_at,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at,omitempty"`
+}
+
+// DocumentThumbnailJob is the payload of the job generating the preview of
+// an uploaded image.
+type DocumentThumbnailJob struct {
+	DocumentID string `json:"document_id"`
 }
@@ -0,0 +1,16 @@
+package types
+
+import "time"
+
+// HubEvent is a WebSocket frame kept so clients can replay what they missed
+// while disconnected. It is addressed to the members of CourseID or to
+// RecipientIDs.
+type HubEvent struct {
+	ID           int64
+	Kind         string
+	CourseID     string
+	RecipientIDs []string
+	SenderID     string // Never replayed to the sender
+	Payload      []byte
+	CreatedAt    time.Time
+}
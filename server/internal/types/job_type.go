@@ -0,0 +1,61 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Job states
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead" // Failed every attempt, waits for an admin to retry it
+)
+
+// Job types
+const (
+	JobSendDigests        = "digests.send"
+	JobPruneJobs          = "jobs.prune"
+	JobOfficeHourReminder = "office_hours.remind"
+	JobDocumentThumbnail  = "documents.thumbnail"
+)
+
+// Job is a unit of background work, run by a worker of its type.
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error"`
+	RunAt       time.Time       `json:"run_at"`
+	LockedUntil *time.Time      `json:"locked_until"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// JobRequest enqueues a job. It runs as soon as a worker is free, or at
+// RunAt when set.
+type JobRequest struct {
+	Type    string
+	Payload interface{}
+	RunAt   time.Time
+}
+
+// JobPage filters the jobs listed to admins. Before is the ID of the last job
+// of the previous page.
+type JobPage struct {
+	Type   string
+	Status string
+	Before string
+	Limit  int
+}
+
+// JobStats counts the jobs of a type in a state.
+type JobStats struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Count  int    `json:"count"`
+}
@@ -0,0 +1,136 @@
+package types
+
+import "time"
+
+// Kinds of module items
+const (
+	ModuleItemPage       = "page"
+	ModuleItemAttachment = "attachment"
+	ModuleItemLink       = "link"
+	ModuleItemAssignment = "assignment"
+	ModuleItemQuiz       = "quiz"
+)
+
+// ModuleItemKinds lists the kinds of items a module can hold.
+var ModuleItemKinds = []string{
+	ModuleItemPage,
+	ModuleItemAttachment,
+	ModuleItemLink,
+	ModuleItemAssignment,
+	ModuleItemQuiz,
+}
+
+// Reasons a module or item is locked for a student
+const (
+	LockNotReleased   = "not_released"
+	LockPrerequisites = "prerequisites"
+)
+
+// CourseModule is an ordered unit of course material. Locked, Completed and
+// CompletedItems are filled in for the user asking; staff never see modules
+// locked.
+type CourseModule struct {
+	ID              string       `json:"id"`
+	CourseID        string       `json:"course_id"`
+	Title           string       `json:"title"`
+	Description     string       `json:"description"`
+	Position        int          `json:"position"`
+	ReleaseAt       *time.Time   `json:"release_at,omitempty"`
+	PrerequisiteIDs []string     `json:"prerequisite_ids"`
+	Items           []ModuleItem `json:"items"`
+	Locked          bool         `json:"locked"`
+	LockReason      string       `json:"lock_reason,omitempty"`
+	CompletedItems  int          `json:"completed_items"`
+	Completed       bool         `json:"completed"`
+	CreatedBy       string       `json:"created_by,omitempty"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+}
+
+// CourseModuleRequest creates or replaces a module. release_at is RFC 3339;
+// without it the module is available right away.
+type CourseModuleRequest struct {
+	Title           string   `json:"title"`
+	Description     string   `json:"description"`
+	ReleaseAt       string   `json:"release_at"`
+	PrerequisiteIDs []string `json:"prerequisite_ids"`
+}
+
+// ModuleItem is an entry of a module. Which fields are used depends on the
+// kind: pages have a Body, links a URL, attachments a Document, and
+// assignments and quizzes have instructions in Body, a due date and points.
+// The content of locked items is left out for students.
+type ModuleItem struct {
+	ID          string     `json:"id"`
+	ModuleID    string     `json:"module_id"`
+	CourseID    string     `json:"course_id"`
+	Kind        string     `json:"kind"`
+	Title       string     `json:"title"`
+	Body        string     `json:"body,omitempty"`
+	URL         string     `json:"url,omitempty"`
+	Document    *Document  `json:"document,omitempty"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	Points      *int       `json:"points,omitempty"`
+	RubricID    string     `json:"rubric_id,omitempty"` // Rubric assignments are graded with
+	Position    int        `json:"position"`
+	ReleaseAt   *time.Time `json:"release_at,omitempty"`
+	Locked      bool       `json:"locked"`
+	LockReason  string     `json:"lock_reason,omitempty"`
+	Completed   bool       `json:"completed"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// ModuleItemRequest creates or replaces a module item. Times are RFC 3339.
+// Attachment items are created by uploading their files instead, and only
+// their title and release date can change.
+type ModuleItemRequest struct {
+	Kind      string `json:"kind"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	URL       string `json:"url"`
+	DueAt     string `json:"due_at"`
+	Points    *int   `json:"points"`
+	ReleaseAt string `json:"release_at"`
+}
+
+// ReorderRequest lists every module of a course, or every item of a module,
+// in their new order.
+type ReorderRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// ItemCompletion records that a user completed a module item.
+type ItemCompletion struct {
+	ItemID      string
+	UserID      string
+	CompletedAt time.Time
+}
+
+// ProgressItem is a column of the progress matrix of a course.
+type ProgressItem struct {
+	ID          string `json:"id"`
+	ModuleID    string `json:"module_id"`
+	ModuleTitle string `json:"module_title"`
+	Kind        string `json:"kind"`
+	Title       string `json:"title"`
+}
+
+// StudentProgress is a row of the progress matrix: the items and modules a
+// student completed. Rate is the share of all items completed.
+type StudentProgress struct {
+	User               User                 `json:"user"`
+	Completed          map[string]time.Time `json:"completed"` // Completion time by item ID
+	CompletedModuleIDs []string             `json:"completed_module_ids"`
+	CompletedItems     int                  `json:"completed_items"`
+	Rate               float64              `json:"rate"`
+}
+
+// CourseProgress is the progress matrix of a course, with the items in
+// course order and a row per student.
+type CourseProgress struct {
+	Items    []ProgressItem    `json:"items"`
+	Students []StudentProgress `json:"students"`
+}
@@ -13,8 +13,29 @@ const (
 	TypeMessageSent  NotificationType = "message_sent"
 	TypeRoleChanged  NotificationType = "role_changed"
 	TypeUserKicked   NotificationType = "user_kicked"
+
+	TypeOfficeHourReminder NotificationType = "office_hour_reminder"
+	TypeGradeReturned      NotificationType = "grade_returned"
 )
 
+// Notification channels a user can choose per type and course
+const (
+	ChannelInApp = "in_app" // Stored and pushed over the hub
+	ChannelEmail = "email"  // Stored for the email digest only
+	ChannelOff   = "off"
+)
+
+// NotificationTypes lists the types users can set preferences for.
+var NotificationTypes = []NotificationType{
+	TypePostCreated,
+	TypeCommentAdded,
+	TypeMessageSent,
+	TypeRoleChanged,
+	TypeUserKicked,
+	TypeOfficeHourReminder,
+	TypeGradeReturned,
+}
+
 type NotifMessageSentResponse struct {
 	ClassID   string                 `json:"class_id"`
 	UserID    string                 `json:"user_id"`
@@ -24,36 +45,76 @@ type NotifMessageSentResponse struct {
 }
 
 type NotifKickedResponse struct {
-	ClassID string
-	AdminID string
-	UserID  string
-	Data    map[string]interface{}
+	ClassID string                 `json:"class_id"`
+	AdminID string                 `json:"admin_id"`
+	UserID  string                 `json:"user_id"`
+	Data    map[string]interface{} `json:"data,omitempty"`
 }
 
 type NotifCreatedResponse struct {
-	ClassID string
-	UserID  string
-	PostID  string
-	Data    map[string]interface{}
+	ClassID string                 `json:"class_id"`
+	UserID  string                 `json:"user_id"`
+	PostID  string                 `json:"post_id"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+type NotifMemberJoinedResponse struct {
+	ClassID string `json:"class_id"`
+	UserID  string `json:"user_id"`
+}
+
+type NotifRoleChangedResponse struct {
+	ClassID string `json:"class_id"`
+	UserID  string `json:"user_id"`
+	Role    int    `json:"role"`
 }
 
 type NotifCommentCreatedResponse struct {
-	ClassID   string
-	UserID    string
-	PostID    string
-	CommentID string
-	Data      map[string]interface{}
+	ClassID   string                 `json:"class_id"`
+	UserID    string                 `json:"user_id"`
+	PostID    string                 `json:"post_id"`
+	CommentID string                 `json:"comment_id"`
+	Data      map[string]interface{} `json:"data,omitempty"`
 }
 
 type Notification struct {
-	ID           string           `json:"id"`
-	Type         NotificationType `json:"type"`
-	ClassID      string           `json:"classId"`
-	RecipientIDs []string         `json:"-"` // Users to notify
-	Message      string           `json:"message"`
-	Data         interface{}      `json:"data"` // Additional data (e.g., post content, user info)
-	Timestamp    time.Time        `json:"timestamp"`
-	Read         bool             `json:"read"`
+	ID            string           `json:"id"`
+	Type          NotificationType `json:"type"`
+	ClassID       string           `json:"classId"`
+	RecipientIDs  []string         `json:"-"` // Users to notify
+	Message       string           `json:"message"`
+	Data          interface{}      `json:"data"` // Additional data (e.g., post content, user info)
+	Timestamp     time.Time        `json:"timestamp"`
+	Read          bool             `json:"read"`
+	EventID       int64            `json:"event_id,omitempty"`     // Hub event ID for replay
+	OutboxEventID string           `json:"-"`                      // Outbox event that caused it, to create it only once
+	Delivery      string           `json:"-"`                      // Channel the recipients chose
+	Count         int              `json:"count"`                  // Events grouped into this notification
+	UnreadCount   int              `json:"unread_count,omitempty"` // Unread notifications of the recipient, set when pushed
+}
+
+// NotificationPreference sets the channel of a notification type, for all
+// courses or, with a course ID, for one course.
+type NotificationPreference struct {
+	Type     NotificationType `json:"type"`
+	CourseID string           `json:"course_id,omitempty"`
+	Channel  string           `json:"channel"`
+}
+
+// NotificationCourseMute silences every notification of a course, until
+// MutedUntil or indefinitely when it is nil.
+type NotificationCourseMute struct {
+	CourseID   string     `json:"course_id"`
+	MutedUntil *time.Time `json:"muted_until"`
+}
+
+type NotificationCourseMuteRequest struct {
+	DurationMinutes int `json:"duration_minutes"` // 0 mutes until unmuted
+}
+
+type NotificationPreferences struct {
+	Preferences  []NotificationPreference `json:"preferences"`
+	MutedCourses []NotificationCourseMute `json:"muted_courses"`
 }
 
 func (n *Notification) ToJSON() ([]byte, error) {
@@ -0,0 +1,141 @@
+package types
+
+import "time"
+
+// Office hour modes. Booking windows are split into slots students book in
+// advance; queue windows take drop-ins in the order they join.
+const (
+	OfficeHourModeBooking = "booking"
+	OfficeHourModeQueue   = "queue"
+)
+
+// Statuses of queue entries
+const (
+	QueueWaiting = "waiting"
+	QueueServing = "serving"
+	QueueDone    = "done"
+	QueueLeft    = "left"
+)
+
+// FrameOfficeHourQueue is the type of the WebSocket frame sent when an
+// office hour queue moves.
+const FrameOfficeHourQueue = "office_hours.queue"
+
+// OfficeHour is a window a staff member holds office hours in. Each one is
+// also shown in the course calendar.
+type OfficeHour struct {
+	ID          string              `json:"id"`
+	CourseID    string              `json:"course_id"`
+	Host        User                `json:"host"`
+	EventID     string              `json:"event_id,omitempty"` // Course calendar event
+	Title       string              `json:"title"`
+	Location    string              `json:"location"`
+	Mode        string              `json:"mode"`
+	StartsAt    time.Time           `json:"starts_at"`
+	EndsAt      time.Time           `json:"ends_at"`
+	SlotMinutes int                 `json:"slot_minutes,omitempty"`
+	Capacity    int                 `json:"capacity,omitempty"` // Students per slot
+	Slots       []OfficeHourSlot    `json:"slots,omitempty"`
+	Bookings    []OfficeHourBooking `json:"bookings,omitempty"` // Only shown to staff
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+type OfficeHourRequest struct {
+	Title       string `json:"title"`
+	Location    string `json:"location"`
+	Mode        string `json:"mode"`      // Defaults to booking
+	StartsAt    string `json:"starts_at"` // RFC 3339
+	EndsAt      string `json:"ends_at"`   // RFC 3339
+	SlotMinutes int    `json:"slot_minutes"`
+	Capacity    int    `json:"capacity"`
+}
+
+// OfficeHourSlot is a bookable part of a booking window.
+type OfficeHourSlot struct {
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+	Booked     int       `json:"booked"`
+	Available  int       `json:"available"`
+	BookedByMe bool      `json:"booked_by_me"`
+}
+
+type OfficeHourBookingRequest struct {
+	StartsAt string `json:"starts_at"` // Start of the slot, RFC 3339
+	Note     string `json:"note"`
+}
+
+type OfficeHourBooking struct {
+	ID           string    `json:"id"`
+	OfficeHourID string    `json:"office_hour_id"`
+	CourseID     string    `json:"course_id,omitempty"`
+	Title        string    `json:"title,omitempty"`
+	Location     string    `json:"location,omitempty"`
+	User         User      `json:"user"`
+	StartsAt     time.Time `json:"starts_at"`
+	EndsAt       time.Time `json:"ends_at"`
+	Note         string    `json:"note"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// OfficeHourReminderJob is the payload of the job reminding a student of a
+// booking.
+type OfficeHourReminderJob struct {
+	BookingID string `json:"booking_id"`
+}
+
+// OfficeHourReminder is the payload of the outbox event reminding a student
+// of a booking.
+type OfficeHourReminder struct {
+	BookingID string    `json:"booking_id"`
+	CourseID  string    `json:"course_id"`
+	UserID    string    `json:"user_id"`
+	Title     string    `json:"title"`
+	Location  string    `json:"location"`
+	StartsAt  time.Time `json:"starts_at"`
+}
+
+type QueueJoinRequest struct {
+	Note string `json:"note"`
+}
+
+// QueueEntry is a student in an office hour queue. Position counts from 1
+// for the student who is next and is 0 once the student is no longer
+// waiting.
+type QueueEntry struct {
+	ID        string     `json:"id"`
+	User      User       `json:"user"`
+	Status    string     `json:"status"`
+	Position  int        `json:"position"`
+	Note      string     `json:"note"`
+	JoinedAt  time.Time  `json:"joined_at"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+}
+
+// OfficeHourQueue is the state of a queue. Staff see every active entry,
+// students only their own.
+type OfficeHourQueue struct {
+	OfficeHourID string       `json:"office_hour_id"`
+	CourseID     string       `json:"course_id"`
+	Waiting      int          `json:"waiting"`
+	Entries      []QueueEntry `json:"entries"`
+}
+
+// QueueUpdate is a frame about an office hour queue to send to some users.
+type QueueUpdate struct {
+	UserIDs []string
+	Frame   OfficeHourQueueFrame
+}
+
+// OfficeHourQueueFrame tells a student where they stand, or the staff how
+// the queue looks.
+type OfficeHourQueueFrame struct {
+	Type         string       `json:"type"`
+	OfficeHourID string       `json:"office_hour_id"`
+	CourseID     string       `json:"course_id"`
+	Waiting      int          `json:"waiting"`
+	Status       string       `json:"status,omitempty"`
+	Position     int          `json:"position,omitempty"`
+	Message      string       `json:"message,omitempty"`
+	Entries      []QueueEntry `json:"entries,omitempty"`
+}
@@ -0,0 +1,40 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Domain events written to the outbox. Their payloads are the notifier
+// payloads, e.g. NotifCreatedResponse for post.created.
+const (
+	EventPostCreated  = "post.created"
+	EventCommentAdded = "comment.added"
+	EventRoleChanged  = "role.changed"
+	EventMemberJoined = "member.joined"
+	EventMemberKicked = "member.kicked"
+
+	// EventOfficeHourReminder carries an OfficeHourReminder
+	EventOfficeHourReminder = "office_hours.reminder"
+	// EventGradeReturned carries a GradeReturned
+	EventGradeReturned = WebhookGradeReturned
+)
+
+// Outbox event states
+const (
+	OutboxPending    = "pending"
+	OutboxDispatched = "dispatched"
+	OutboxFailed     = "failed" // Gave up after the last retry
+)
+
+// OutboxEvent is a claimed domain event with the consumers that already
+// handled it.
+type OutboxEvent struct {
+	ID        string
+	Type      string
+	CourseID  string
+	Payload   json.RawMessage
+	Attempts  int
+	Consumed  []string
+	CreatedAt time.Time
+}
@@ -0,0 +1,66 @@
+package types
+
+import "time"
+
+// PeerReviewPhase is the peer review of the submissions for an assignment.
+// Reviews and CompletedReviews count every review for staff and the user's
+// own reviews to write for students.
+type PeerReviewPhase struct {
+	ItemID                 string     `json:"item_id"`
+	ItemTitle              string     `json:"item_title"`
+	CourseID               string     `json:"course_id"`
+	RubricID               string     `json:"rubric_id"`
+	Rubric                 *Rubric    `json:"rubric,omitempty"`
+	ReviewersPerSubmission int        `json:"reviewers_per_submission"`
+	Anonymous              bool       `json:"anonymous"`
+	DueAt                  *time.Time `json:"due_at,omitempty"`
+	OpenedBy               string     `json:"opened_by,omitempty"`
+	OpenedAt               time.Time  `json:"opened_at"`
+	ClosedAt               *time.Time `json:"closed_at,omitempty"`
+	Open                   bool       `json:"open"` // Reviews can be written
+	Reviews                int        `json:"reviews"`
+	CompletedReviews       int        `json:"completed_reviews"`
+}
+
+// PeerReviewPhaseRequest opens peer review. RubricID defaults to the rubric
+// of the assignment.
+type PeerReviewPhaseRequest struct {
+	RubricID               string `json:"rubric_id"`
+	ReviewersPerSubmission int    `json:"reviewers_per_submission"`
+	Anonymous              bool   `json:"anonymous"`
+	DueAt                  string `json:"due_at"`
+}
+
+// PeerReview is the review of a submission by another student. Author and
+// Reviewer are left out where the phase is anonymous, and the submitted work
+// is only filled in for a single review.
+type PeerReview struct {
+	ID              string           `json:"id"`
+	ItemID          string           `json:"item_id"`
+	ItemTitle       string           `json:"item_title"`
+	CourseID        string           `json:"course_id"`
+	SubmissionID    string           `json:"submission_id"`
+	Author          *User            `json:"author,omitempty"`
+	Reviewer        *User            `json:"reviewer,omitempty"`
+	SubmissionBody  string           `json:"submission_body,omitempty"`
+	SubmissionFiles []Document       `json:"submission_files,omitempty"`
+	Criteria        []CriterionScore `json:"criteria"`
+	Score           *float64         `json:"score,omitempty"`
+	MaxScore        *float64         `json:"max_score,omitempty"`
+	Comment         string           `json:"comment"`
+	Completed       bool             `json:"completed"`
+	AssignedAt      time.Time        `json:"assigned_at"`
+	SubmittedAt     *time.Time       `json:"submitted_at,omitempty"`
+}
+
+// ReviewAssignment hands a submission to a reviewer.
+type ReviewAssignment struct {
+	SubmissionID string
+	ReviewerID   string
+}
+
+// SubmissionAuthor is who handed in a submission.
+type SubmissionAuthor struct {
+	SubmissionID string
+	UserID       string
+}
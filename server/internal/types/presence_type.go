@@ -0,0 +1,5 @@
+package types
+
+type PresenceSettings struct {
+	AppearOffline bool `json:"appear_offline"`
+}
@@ -0,0 +1,33 @@
+package types
+
+import "time"
+
+// PushKeys are the keys a browser generates for a Web Push subscription.
+type PushKeys struct {
+	P256dh string `json:"p256dh"` // base64url P-256 public key
+	Auth   string `json:"auth"`   // base64url authentication secret
+}
+
+// PushSubscription is a browser's Web Push subscription.
+type PushSubscription struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"-"`
+	Endpoint  string    `json:"endpoint"`
+	Keys      PushKeys  `json:"keys"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PushSubscriptionRequest is the JSON of a browser PushSubscription.
+type PushSubscriptionRequest struct {
+	Endpoint string   `json:"endpoint"`
+	Keys     PushKeys `json:"keys"`
+}
+
+type PushUnsubscribeRequest struct {
+	Endpoint string `json:"endpoint"`
+}
+
+type VAPIDPublicKey struct {
+	PublicKey string `json:"public_key"`
+}
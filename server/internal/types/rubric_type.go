@@ -0,0 +1,64 @@
+package types
+
+import "time"
+
+// Rubric is a reusable grading scheme of a course. Each criterion is scored
+// by picking one of its performance levels; MaxPoints is the sum of the best
+// level of every criterion.
+type Rubric struct {
+	ID          string            `json:"id"`
+	CourseID    string            `json:"course_id"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Criteria    []RubricCriterion `json:"criteria"`
+	MaxPoints   float64           `json:"max_points"`
+	InUse       bool              `json:"in_use"` // Used for grading, so it cannot change
+	CreatedBy   string            `json:"created_by,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+type RubricCriterion struct {
+	ID          string        `json:"id"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Levels      []RubricLevel `json:"levels"`
+	MaxPoints   float64       `json:"max_points"`
+}
+
+type RubricLevel struct {
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Points      float64 `json:"points"`
+}
+
+// RubricRequest creates or replaces a rubric with its criteria and levels in
+// order.
+type RubricRequest struct {
+	Title       string                   `json:"title"`
+	Description string                   `json:"description"`
+	Criteria    []RubricCriterionRequest `json:"criteria"`
+}
+
+type RubricCriterionRequest struct {
+	Title       string               `json:"title"`
+	Description string               `json:"description"`
+	Levels      []RubricLevelRequest `json:"levels"`
+}
+
+type RubricLevelRequest struct {
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Points      float64 `json:"points"`
+}
+
+// CopyRubricRequest names the course a rubric is copied to.
+type CopyRubricRequest struct {
+	CourseID string `json:"course_id"`
+}
+
+// ItemRubricRequest attaches a rubric to an assignment or quiz.
+type ItemRubricRequest struct {
+	RubricID string `json:"rubric_id"`
+}
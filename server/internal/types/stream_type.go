@@ -0,0 +1,25 @@
+package types
+
+// Course stream event types, sent to the members of a course when its posts
+// or comments change
+const (
+	StreamPostCreated    = "post.created"
+	StreamPostUpdated    = "post.updated"
+	StreamPostDeleted    = "post.deleted"
+	StreamCommentCreated = "comment.created"
+	StreamCommentUpdated = "comment.updated"
+	StreamCommentDeleted = "comment.deleted"
+)
+
+// StreamEvent carries the rendered post or comment so open clients can update
+// without refetching. Deletions only carry the IDs.
+type StreamEvent struct {
+	Type      string        `json:"type"`
+	EventID   int64         `json:"event_id,omitempty"`
+	CourseID  string        `json:"course_id"`
+	PostID    string        `json:"post_id,omitempty"`
+	CommentID string        `json:"comment_id,omitempty"`
+	ActorID   string        `json:"actor_id"`
+	Post      *PostResponse `json:"post,omitempty"`
+	Comment   *Comment      `json:"comment,omitempty"`
+}
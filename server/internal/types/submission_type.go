@@ -0,0 +1,69 @@
+package types
+
+import "time"
+
+// Submission is the work a student handed in for an assignment. Grade is
+// shown to the student once it is returned.
+type Submission struct {
+	ID          string           `json:"id"`
+	ItemID      string           `json:"item_id"`
+	ItemTitle   string           `json:"item_title"`
+	CourseID    string           `json:"course_id"`
+	User        User             `json:"user"`
+	Body        string           `json:"body"`
+	Files       []Document       `json:"files"`
+	SubmittedAt time.Time        `json:"submitted_at"`
+	Late        bool             `json:"late"` // Submitted after the due date
+	Grade       *SubmissionGrade `json:"grade,omitempty"`
+}
+
+// SubmissionGrade is the filled-in rubric of a submission. Score is the sum
+// of the points of the criteria.
+type SubmissionGrade struct {
+	SubmissionID string           `json:"submission_id"`
+	RubricID     string           `json:"rubric_id"`
+	Rubric       *Rubric          `json:"rubric,omitempty"`
+	GraderID     string           `json:"grader_id,omitempty"`
+	Criteria     []CriterionScore `json:"criteria"`
+	Score        float64          `json:"score"`
+	MaxScore     float64          `json:"max_score"`
+	Comment      string           `json:"comment"`
+	Returned     bool             `json:"returned"`
+	ReturnedAt   *time.Time       `json:"returned_at,omitempty"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+}
+
+// CriterionScore is the score of a submission on one rubric criterion.
+type CriterionScore struct {
+	CriterionID string  `json:"criterion_id"`
+	LevelID     string  `json:"level_id,omitempty"`
+	Points      float64 `json:"points"`
+	Comment     string  `json:"comment"`
+}
+
+// GradeRequest scores a submission on every criterion of the rubric of its
+// assignment. A criterion is scored with a level_id, and points can be set
+// by hand between zero and the criterion's best level.
+type GradeRequest struct {
+	Criteria []CriterionScoreRequest `json:"criteria"`
+	Comment  string                  `json:"comment"`
+}
+
+type CriterionScoreRequest struct {
+	CriterionID string   `json:"criterion_id"`
+	LevelID     string   `json:"level_id"`
+	Points      *float64 `json:"points"`
+	Comment     string   `json:"comment"`
+}
+
+// GradeReturned is the payload of grade.returned events.
+type GradeReturned struct {
+	SubmissionID string    `json:"submission_id"`
+	ItemID       string    `json:"item_id"`
+	ItemTitle    string    `json:"item_title"`
+	CourseID     string    `json:"course_id"`
+	UserID       string    `json:"user_id"`
+	Score        float64   `json:"score"`
+	MaxScore     float64   `json:"max_score"`
+	ReturnedAt   time.Time `json:"returned_at"`
+}
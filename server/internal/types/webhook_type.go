@@ -0,0 +1,103 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Course events webhooks can subscribe to
+const (
+	WebhookPostCreated   = "post.created"
+	WebhookMemberJoined  = "member.joined"
+	WebhookRoleChanged   = "role.changed"
+	WebhookGradeReturned = "grade.returned"
+)
+
+// WebhookEventTypes lists the events webhooks can subscribe to.
+var WebhookEventTypes = []string{
+	WebhookPostCreated,
+	WebhookMemberJoined,
+	WebhookRoleChanged,
+	WebhookGradeReturned,
+}
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed" // Gave up after the last retry
+)
+
+// Webhook is an endpoint a course admin registered for some course events.
+// The secret is only returned when the webhook is created or rotated.
+type Webhook struct {
+	ID         string    `json:"id"`
+	CourseID   string    `json:"course_id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Active     bool      `json:"active"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type WebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Active     *bool    `json:"active"` // Defaults to true on create
+}
+
+// WebhookEvent is the JSON body posted to webhooks. Data is the payload the
+// notifier built for the event.
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CourseID  string      `json:"course_id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookDelivery is one event sent to one webhook, with its retries.
+type WebhookDelivery struct {
+	ID             string                   `json:"id"`
+	WebhookID      string                   `json:"webhook_id"`
+	EventID        string                   `json:"event_id"`
+	EventType      string                   `json:"event_type"`
+	Status         string                   `json:"status"`
+	Attempts       int                      `json:"attempts"`
+	ResponseStatus *int                     `json:"response_status"` // Of the last attempt
+	NextAttemptAt  *time.Time               `json:"next_attempt_at,omitempty"`
+	ReplayOf       string                   `json:"replay_of,omitempty"`
+	CreatedAt      time.Time                `json:"created_at"`
+	Payload        json.RawMessage          `json:"payload,omitempty"`
+	AttemptLog     []WebhookDeliveryAttempt `json:"attempt_log,omitempty"`
+}
+
+// WebhookDeliveryAttempt records one HTTP request of a delivery.
+type WebhookDeliveryAttempt struct {
+	Attempt        int       `json:"attempt"`
+	ResponseStatus *int      `json:"response_status"`
+	Error          string    `json:"error,omitempty"`
+	DurationMs     int64     `json:"duration_ms"`
+	AttemptedAt    time.Time `json:"attempted_at"`
+}
+
+// WebhookDeliveryPage selects deliveries older than the Before delivery,
+// optionally with one status.
+type WebhookDeliveryPage struct {
+	Before string
+	Limit  int
+	Status string
+}
+
+// WebhookJob is a claimed delivery ready to be sent.
+type WebhookJob struct {
+	DeliveryID string
+	WebhookID  string
+	EventType  string
+	Payload    []byte
+	Attempts   int
+	URL        string
+	Secret     string
+}
@@ -0,0 +1,9 @@
+package types
+
+import "time"
+
+// WSTicket authenticates a single WebSocket or event stream connection.
+type WSTicket struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -43,37 +44,70 @@ func GenerateStateOauthCookie(w http.ResponseWriter) string {
 }
 
 func ExtractUserIDFromToken(r *http.Request) (string, error) {
-	secret_key := GetEnv("SECRET_KEY")
-
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
 		return "", &ApiError{Code: http.StatusNotFound, Message: "Missing access token"}
 	}
 
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	userID, _, err := ParseAccessToken(strings.TrimPrefix(authHeader, "Bearer "))
+	return userID, err
+}
+
+// ParseAccessToken validates an access token and returns its user ID and
+// expiry.
+func ParseAccessToken(tokenString string) (string, time.Time, error) {
+	secret_key := GetEnv("SECRET_KEY")
 
 	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
 		return []byte(secret_key), nil
 	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
 
 	if err != nil {
-		if err == jwt.ErrTokenExpired {
-			return "", &ApiError{Code: http.StatusUnauthorized, Message: "token has expired"}
+		switch {
+		case errors.Is(err, jwt.ErrTokenExpired):
+			return "", time.Time{}, &ApiError{Code: http.StatusUnauthorized, Message: "Authentication token has expired"}
+		case errors.Is(err, jwt.ErrTokenMalformed):
+			return "", time.Time{}, &ApiError{Code: http.StatusUnauthorized, Message: "Malformed authentication token"}
+		case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+			return "", time.Time{}, &ApiError{Code: http.StatusUnauthorized, Message: "Invalid token signature"}
+		default:
+			return "", time.Time{}, &ApiError{Code: http.StatusUnauthorized, Message: "Token validation failed"}
 		}
-		return "", &ApiError{Code: http.StatusUnauthorized, Message: "invalid token: " + err.Error()}
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return "", &ApiError{Code: http.StatusUnauthorized, Message: "invalid token claims"}
+		return "", time.Time{}, &ApiError{Code: http.StatusUnauthorized, Message: "Invalid token claims"}
 	}
 
 	userID, ok := claims["sub"].(string)
-	if !ok {
-		return "", &ApiError{Code: http.StatusUnauthorized, Message: "user id not found in the token"}
+	if !ok || userID == "" {
+		return "", time.Time{}, &ApiError{Code: http.StatusUnauthorized, Message: "User ID not found in token"}
 	}
 
-	return userID, nil
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return "", time.Time{}, &ApiError{Code: http.StatusUnauthorized, Message: "Token has no expiry"}
+	}
+
+	return userID, exp.Time, nil
+}
+
+// AllowedOrigins returns the browser origins allowed to call the API and open
+// WebSocket connections, from the comma separated ALLOWED_ORIGINS.
+func AllowedOrigins() []string {
+	value := os.Getenv("ALLOWED_ORIGINS")
+	if value == "" {
+		return []string{"http://localhost:5173"}
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
 }
 
 // SetUserIDInContext stores the user ID in request context
@@ -0,0 +1,52 @@
+package websocket
+
+import (
+	"course-flow/internal/attendance"
+	"course-flow/internal/storage"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// RunCheckInCodes sends the current code of every open check-in to the
+// course staff connected to this instance each time the codes rotate. Codes
+// follow from the session secret and the clock, so every instance serves its
+// own connections and nothing goes through the broker.
+func (h *Hub) RunCheckInCodes(sessions *storage.AttendanceStorage) {
+	for {
+		next := attendance.ExpiresAt(time.Now())
+		time.Sleep(time.Until(next))
+		h.sendCheckInCodes(sessions, next)
+	}
+}
+
+func (h *Hub) sendCheckInCodes(sessions *storage.AttendanceStorage, now time.Time) {
+	h.mu.Lock()
+	connected := len(h.clients) > 0
+	h.mu.Unlock()
+	if !connected {
+		return
+	}
+
+	checkIns, err := sessions.GetOpenCheckIns(now)
+	if err != nil {
+		log.Printf("Failed to load open check-ins: %v", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, checkIn := range checkIns {
+		data, err := json.Marshal(attendance.CurrentCode(checkIn, now))
+		if err != nil {
+			log.Println("Failed to marshal check-in code:", err)
+			continue
+		}
+
+		for client := range h.clients {
+			if contains(checkIn.StaffIDs, client.userID) {
+				h.enqueue(client, 0, data)
+			}
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package websocket
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Broker fans hub events out to every API instance. Each instance subscribes
+// once and receives every published payload, including its own.
+type Broker interface {
+	Publish(payload []byte) error
+	Subscribe(handler func(payload []byte)) error
+	Close() error
+}
+
+// NewBrokerFromEnv picks the broker selected by HUB_BROKER. "postgres" uses
+// LISTEN/NOTIFY on the application database so several instances can run
+// behind a load balancer; anything else keeps delivery in-process.
+func NewBrokerFromEnv(db *sql.DB) (Broker, error) {
+	switch os.Getenv("HUB_BROKER") {
+	case "postgres":
+		return NewPostgresBroker(db, os.Getenv("DATABASE_URL"))
+	default:
+		return NewLocalBroker(), nil
+	}
+}
+
+// LocalBroker delivers payloads to subscribers of the same process, in the
+// order they were published.
+type LocalBroker struct {
+	mu       sync.Mutex
+	handlers []func(payload []byte)
+	queue    chan []byte
+	done     chan struct{}
+	once     sync.Once
+}
+
+func NewLocalBroker() *LocalBroker {
+	b := &LocalBroker{
+		queue: make(chan []byte, 1024),
+		done:  make(chan struct{}),
+	}
+	go b.dispatch()
+	return b
+}
+
+func (b *LocalBroker) Publish(payload []byte) error {
+	select {
+	case b.queue <- payload:
+		return nil
+	case <-b.done:
+		return fmt.Errorf("broker is closed")
+	}
+}
+
+func (b *LocalBroker) Subscribe(handler func(payload []byte)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+	return nil
+}
+
+func (b *LocalBroker) Close() error {
+	b.once.Do(func() { close(b.done) })
+	return nil
+}
+
+func (b *LocalBroker) dispatch() {
+	for {
+		select {
+		case payload := <-b.queue:
+			b.mu.Lock()
+			handlers := append([]func([]byte){}, b.handlers...)
+			b.mu.Unlock()
+			for _, handler := range handlers {
+				handler(payload)
+			}
+		case <-b.done:
+			return
+		}
+	}
+}
+
+const (
+	// brokerChannel is the Postgres notification channel shared by all nodes.
+	brokerChannel = "hub_events"
+	// maxNotifyPayload stays below the 8000 byte NOTIFY limit. Larger payloads
+	// are stored in hub_broker_payloads and only their ID is sent.
+	maxNotifyPayload = 7000
+	// brokerPayloadTTL is how long spilled payloads are kept for slow nodes.
+	brokerPayloadTTL = 5 * time.Minute
+
+	inlinePrefix = "m:"
+	refPrefix    = "r:"
+)
+
+// PostgresBroker publishes with pg_notify and receives through a dedicated
+// LISTEN connection.
+type PostgresBroker struct {
+	db       *sql.DB
+	listener *pq.Listener
+	done     chan struct{}
+	once     sync.Once
+}
+
+func NewPostgresBroker(db *sql.DB, connStr string) (*PostgresBroker, error) {
+	if connStr == "" {
+		return nil, fmt.Errorf("DATABASE_URL is required for the postgres hub broker")
+	}
+
+	listener := pq.NewListener(connStr, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Hub broker listener event %d: %v", event, err)
+		}
+	})
+	if err := listener.Listen(brokerChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %v", brokerChannel, err)
+	}
+
+	return &PostgresBroker{
+		db:       db,
+		listener: listener,
+		done:     make(chan struct{}),
+	}, nil
+}
+
+func (b *PostgresBroker) Publish(payload []byte) error {
+	message := inlinePrefix + string(payload)
+
+	if len(message) > maxNotifyPayload {
+		var id int64
+		err := b.db.QueryRow(
+			`INSERT INTO hub_broker_payloads (payload) VALUES ($1) RETURNING id`,
+			string(payload),
+		).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to store broker payload: %v", err)
+		}
+		message = refPrefix + strconv.FormatInt(id, 10)
+	}
+
+	if _, err := b.db.Exec(`SELECT pg_notify($1, $2)`, brokerChannel, message); err != nil {
+		return fmt.Errorf("failed to publish to %s: %v", brokerChannel, err)
+	}
+	return nil
+}
+
+func (b *PostgresBroker) Subscribe(handler func(payload []byte)) error {
+	go func() {
+		pruneTicker := time.NewTicker(time.Minute)
+		defer pruneTicker.Stop()
+
+		for {
+			select {
+			case notification := <-b.listener.Notify:
+				// A nil notification means the connection was re-established
+				// and notifications sent in between may have been missed
+				if notification == nil {
+					log.Println("Hub broker listener reconnected")
+					continue
+				}
+
+				payload, err := b.resolve(notification.Extra)
+				if err != nil {
+					log.Printf("Failed to read broker payload: %v", err)
+					continue
+				}
+				handler(payload)
+
+			case <-time.After(90 * time.Second):
+				if err := b.listener.Ping(); err != nil {
+					log.Printf("Hub broker listener ping failed: %v", err)
+				}
+
+			case <-pruneTicker.C:
+				b.prune()
+
+			case <-b.done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (b *PostgresBroker) Close() error {
+	b.once.Do(func() { close(b.done) })
+	return b.listener.Close()
+}
+
+// resolve returns the payload of a notification, loading it from
+// hub_broker_payloads when it was too large to send inline.
+func (b *PostgresBroker) resolve(message string) ([]byte, error) {
+	if strings.HasPrefix(message, inlinePrefix) {
+		return []byte(strings.TrimPrefix(message, inlinePrefix)), nil
+	}
+	if !strings.HasPrefix(message, refPrefix) {
+		return nil, fmt.Errorf("unknown broker message format")
+	}
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(message, refPrefix), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker payload reference: %v", err)
+	}
+
+	var payload string
+	err = b.db.QueryRow(`SELECT payload FROM hub_broker_payloads WHERE id = $1`, id).Scan(&payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load broker payload %d: %v", id, err)
+	}
+	return []byte(payload), nil
+}
+
+// prune removes spilled payloads every node has had time to read.
+func (b *PostgresBroker) prune() {
+	_, err := b.db.Exec(
+		`DELETE FROM hub_broker_payloads WHERE created_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'`,
+		int(brokerPayloadTTL.Seconds()),
+	)
+	if err != nil {
+		log.Printf("Failed to prune broker payloads: %v", err)
+	}
+}
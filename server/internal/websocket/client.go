@@ -0,0 +1,194 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// sendQueueSize bounds the frames waiting to be written to one client.
+	sendQueueSize = 256
+	// writeWait is the time allowed to write a single frame.
+	writeWait = 10 * time.Second
+	// pongWait is the time allowed to read the next pong from the client.
+	pongWait = 60 * time.Second
+	// pingPeriod must be shorter than pongWait.
+	pingPeriod = 30 * time.Second
+)
+
+const (
+	// reauthWarning is how long before the access token of a connection
+	// expires that the client is asked to re-authenticate.
+	reauthWarning = 2 * time.Minute
+	// closeTokenExpired is the close code sent once the access token expired.
+	closeTokenExpired = 4001
+)
+
+// Frames about the expiry of the connection
+const (
+	frameReauthRequired  = "reauth_required"
+	frameReauthenticated = "reauthenticated"
+)
+
+// reauthFrame tells the client when its connection expires.
+type reauthFrame struct {
+	Type      string    `json:"type"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Slow consumer policies, selected with WS_SLOW_CONSUMER_POLICY
+const (
+	// PolicyDisconnect closes the connection of a client whose queue is full.
+	// The client reconnects and reloads what it missed over REST.
+	PolicyDisconnect = "disconnect"
+	// PolicyDrop discards frames for a client whose queue is full.
+	PolicyDrop = "drop"
+)
+
+// clientConn is the part of *websocket.Conn the writer needs.
+type clientConn interface {
+	WriteMessage(messageType int, data []byte) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// Client represents a connected user
+type Client struct {
+	conn     clientConn
+	userID   string
+	mu       sync.RWMutex    // Guards classIDs and the expiry, which change while connected
+	classIDs map[string]bool // Classes the user belongs to
+	send     chan []byte     // Outbound frames, written by writePump
+
+	expiresAt   time.Time // Expiry of the access token, zero if it never expires
+	reauthAsked bool      // A reauth_required frame was sent for expiresAt
+
+	// Until the replay of missed events is done, frames are held in backlog.
+	// These are guarded by the hub's mutex.
+	ready   bool
+	backlog []queuedFrame
+	hidden  bool // The user appears offline
+}
+
+func newClient(conn clientConn, userID string, classIDs map[string]bool) *Client {
+	return &Client{
+		conn:     conn,
+		userID:   userID,
+		classIDs: classIDs,
+		send:     make(chan []byte, sendQueueSize),
+	}
+}
+
+func (c *Client) inCourse(courseID string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.classIDs[courseID]
+}
+
+func (c *Client) addCourse(courseID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.classIDs[courseID] = true
+}
+
+// removeCourse reports whether the client was subscribed to the course.
+func (c *Client) removeCourse(courseID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.classIDs[courseID] {
+		return false
+	}
+	delete(c.classIDs, courseID)
+	return true
+}
+
+// setExpiry moves the end of the connection to the expiry of a new access
+// token.
+func (c *Client) setExpiry(expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expiresAt = expiresAt
+	c.reauthAsked = false
+}
+
+// checkExpiry reports whether the access token expired, and whether the
+// client should now be asked to re-authenticate, which it is only once.
+func (c *Client) checkExpiry(now time.Time) (expired bool, askReauth bool, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.expiresAt.IsZero() {
+		return false, false, c.expiresAt
+	}
+	if now.After(c.expiresAt) {
+		return true, false, c.expiresAt
+	}
+	if !c.reauthAsked && now.Add(reauthWarning).After(c.expiresAt) {
+		c.reauthAsked = true
+		return false, true, c.expiresAt
+	}
+	return false, false, c.expiresAt
+}
+
+// writePump is the only goroutine writing to the connection. It drains the
+// send queue, keeps the connection alive with pings and ends it when the
+// access token expires. It returns once the hub closes the queue or a write
+// fails.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// The hub closed the queue
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Printf("Write error for user %s: %v", c.userID, err)
+				return
+			}
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+
+			expired, askReauth, expiresAt := c.checkExpiry(time.Now())
+			if expired {
+				log.Printf("Access token expired for user %s, closing connection", c.userID)
+				c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeTokenExpired, "access token expired"))
+				return
+			}
+			if askReauth {
+				data, _ := json.Marshal(reauthFrame{Type: frameReauthRequired, ExpiresAt: expiresAt})
+				if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+					log.Printf("Write error for user %s: %v", c.userID, err)
+					return
+				}
+			}
+
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				log.Printf("Ping error for user %s: %v", c.userID, err)
+				return
+			}
+		}
+	}
+}
+
+// slowConsumerPolicy returns the configured policy, disconnecting by default.
+func slowConsumerPolicy() string {
+	if os.Getenv("WS_SLOW_CONSUMER_POLICY") == PolicyDrop {
+		return PolicyDrop
+	}
+	return PolicyDisconnect
+}
@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"course-flow/internal/types"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// benchConn stands in for a client connection and reports every delivered
+// frame to the benchmark.
+type benchConn struct {
+	delivered *sync.WaitGroup
+	stall     chan struct{} // When set, writes block until it is closed
+}
+
+func (c *benchConn) WriteMessage(messageType int, data []byte) error {
+	if c.stall != nil {
+		<-c.stall
+		return fmt.Errorf("connection closed")
+	}
+	if messageType == websocket.TextMessage {
+		c.delivered.Done()
+	}
+	return nil
+}
+
+func (c *benchConn) SetWriteDeadline(time.Time) error { return nil }
+
+func (c *benchConn) Close() error { return nil }
+
+// BenchmarkHubFanOut measures the time from a chat message entering the hub
+// until every member of the course has had it written to its connection.
+func BenchmarkHubFanOut(b *testing.B) {
+	for _, clients := range []int{1000, 5000, 10000} {
+		b.Run(fmt.Sprintf("clients=%d", clients), func(b *testing.B) {
+			benchmarkFanOut(b, clients, false)
+		})
+	}
+
+	// A stalled client must not hold up delivery to everyone else
+	b.Run("clients=5000/stalled", func(b *testing.B) {
+		benchmarkFanOut(b, 5000, true)
+	})
+}
+
+func benchmarkFanOut(b *testing.B, clients int, withStalled bool) {
+	hub := NewHub(NewLocalBroker(), nil)
+	hub.slowPolicy = PolicyDisconnect
+	go hub.Run()
+
+	// Clients appear offline so registering them sends no presence frames,
+	// which benchConn would count as chat messages
+	classIDs := map[string]bool{"course": true}
+	var delivered sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		client := newClient(&benchConn{delivered: &delivered}, fmt.Sprintf("user-%d", i), classIDs)
+		client.hidden = true
+		hub.register <- client
+		hub.markReady(client, 0)
+		go client.writePump()
+	}
+
+	if withStalled {
+		stall := make(chan struct{})
+		defer close(stall)
+		client := newClient(&benchConn{stall: stall}, "stalled", classIDs)
+		client.hidden = true
+		hub.register <- client
+		hub.markReady(client, 0)
+		go client.writePump()
+	}
+
+	chatMsg := types.ChatMessage{
+		CourseID: "course",
+		FromID:   "sender",
+		Type:     types.ChatTypeMessage,
+		Content:  "Does anyone have the notes from today's lecture?",
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		delivered.Add(clients)
+		hub.chat <- chatMsg
+		delivered.Wait()
+	}
+}
@@ -0,0 +1,227 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// presenceInterval is how often each instance announces its users.
+	presenceInterval = 15 * time.Second
+	// presenceTTL is how long an instance's users count as online without a
+	// new announcement, so users of a crashed instance eventually go offline.
+	presenceTTL = 3 * presenceInterval
+)
+
+// Presence statuses sent in presence frames
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
+const framePresence = "presence"
+
+type presenceFrame struct {
+	Type   string `json:"type"`
+	UserID string `json:"user_id"`
+	Status string `json:"status"`
+}
+
+// presenceChange is a user coming online or going offline anywhere in the
+// cluster, together with the courses whose members should hear about it.
+type presenceChange struct {
+	userID    string
+	online    bool
+	courseIDs map[string]bool
+}
+
+type nodePresence struct {
+	users    map[string][]string // User ID to the courses of its connections
+	lastSeen time.Time
+}
+
+// presenceTracker keeps the visible users connected to every instance, as
+// announced through the broker. Users appearing offline are never announced.
+type presenceTracker struct {
+	mu    sync.RWMutex
+	nodes map[string]nodePresence
+}
+
+func newPresenceTracker() *presenceTracker {
+	return &presenceTracker{nodes: make(map[string]nodePresence)}
+}
+
+// update replaces the users of a node and returns who came online or went
+// offline across the cluster as a result.
+func (p *presenceTracker) update(nodeID string, users map[string][]string) []presenceChange {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	before := p.merged()
+
+	p.nodes[nodeID] = nodePresence{users: users, lastSeen: time.Now()}
+	for id, node := range p.nodes {
+		if time.Since(node.lastSeen) > presenceTTL {
+			delete(p.nodes, id)
+		}
+	}
+
+	after := p.merged()
+
+	var changes []presenceChange
+	for userID, courseIDs := range after {
+		if _, ok := before[userID]; !ok {
+			changes = append(changes, presenceChange{userID: userID, online: true, courseIDs: courseIDs})
+		}
+	}
+	for userID, courseIDs := range before {
+		if _, ok := after[userID]; !ok {
+			changes = append(changes, presenceChange{userID: userID, online: false, courseIDs: courseIDs})
+		}
+	}
+	return changes
+}
+
+// merged returns every online user with the union of its courses. Callers
+// must hold p.mu.
+func (p *presenceTracker) merged() map[string]map[string]bool {
+	users := make(map[string]map[string]bool)
+	for _, node := range p.nodes {
+		if time.Since(node.lastSeen) > presenceTTL {
+			continue
+		}
+		for userID, courseIDs := range node.users {
+			if users[userID] == nil {
+				users[userID] = make(map[string]bool)
+			}
+			for _, courseID := range courseIDs {
+				users[userID][courseID] = true
+			}
+		}
+	}
+	return users
+}
+
+func (p *presenceTracker) isOnline(userID string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	_, ok := p.merged()[userID]
+	return ok
+}
+
+func (p *presenceTracker) onlineUserIDs(courseID string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var userIDs []string
+	for userID, courseIDs := range p.merged() {
+		if courseID == "" || courseIDs[courseID] {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Strings(userIDs)
+	return userIDs
+}
+
+// publishPresence announces the visible users connected to this instance and
+// the courses of their connections. Several tabs of a user count once.
+func (h *Hub) publishPresence() {
+	h.mu.Lock()
+	users := make(map[string][]string)
+	for client := range h.clients {
+		if client.hidden {
+			continue
+		}
+		client.mu.RLock()
+		for courseID := range client.classIDs {
+			users[client.userID] = append(users[client.userID], courseID)
+		}
+		client.mu.RUnlock()
+		if _, ok := users[client.userID]; !ok {
+			users[client.userID] = []string{}
+		}
+	}
+	h.mu.Unlock()
+
+	h.publish(envelope{Kind: eventPresence, Presence: users})
+}
+
+// broadcastPresence sends presence frames to the local connections sharing a
+// course with the users that changed. Callers must hold h.mu.
+func (h *Hub) broadcastPresence(changes []presenceChange) {
+	for _, change := range changes {
+		status := StatusOffline
+		if change.online {
+			status = StatusOnline
+		}
+		data, err := json.Marshal(presenceFrame{Type: framePresence, UserID: change.userID, Status: status})
+		if err != nil {
+			log.Println("Failed to marshal presence frame:", err)
+			continue
+		}
+
+		for client := range h.clients {
+			if client.userID == change.userID {
+				continue
+			}
+			for courseID := range change.courseIDs {
+				if client.inCourse(courseID) {
+					h.enqueue(client, 0, data)
+					break
+				}
+			}
+		}
+	}
+}
+
+// SetAppearOffline hides or shows the user in presence on every instance.
+func (h *Hub) SetAppearOffline(userID string, hidden bool) {
+	h.publish(envelope{Kind: eventVisibility, UserIDs: []string{userID}, Hidden: hidden})
+}
+
+// applyVisibility updates the local connections of the users and announces
+// the new presence. Callers must hold h.mu.
+func (h *Hub) applyVisibility(userIDs []string, hidden bool) {
+	changed := false
+	for client := range h.clients {
+		if contains(userIDs, client.userID) && client.hidden != hidden {
+			client.hidden = hidden
+			changed = true
+		}
+	}
+	if changed {
+		go h.publishPresence()
+	}
+}
+
+// IsOnline reports whether the user is visibly connected to any instance.
+func (h *Hub) IsOnline(userID string) bool {
+	return h.presence.isOnline(userID)
+}
+
+// IsConnected reports whether the user receives hub events, visibly on any
+// instance or appearing offline on this one.
+func (h *Hub) IsConnected(userID string) bool {
+	if h.presence.isOnline(userID) {
+		return true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		if client.userID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// OnlineUserIDs returns the visible users connected to any instance with a
+// connection subscribed to the course, or all of them when courseID is empty.
+func (h *Hub) OnlineUserIDs(courseID string) []string {
+	return h.presence.onlineUserIDs(courseID)
+}
@@ -0,0 +1,177 @@
+package websocket
+
+import (
+	"course-flow/internal/types"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// maxReplayEvents bounds a replay. Clients further behind get a
+	// resync_required frame and reload over REST.
+	maxReplayEvents = 500
+	// eventRetention is how long events are kept for replay.
+	eventRetention = 7 * 24 * time.Hour
+	// eventPruneInterval is how often expired events are removed.
+	eventPruneInterval = time.Hour
+)
+
+const frameResyncRequired = "resync_required"
+
+// queuedFrame is a frame held for a client until its replay finished.
+type queuedFrame struct {
+	eventID int64
+	data    []byte
+}
+
+// recordChat stores a chat frame for replay and sets its event ID. Typing
+// indicators are transient and not stored.
+func (h *Hub) recordChat(chatMsg *types.ChatMessage) {
+	if h.events == nil || chatMsg.Type == types.ChatTypeTyping {
+		return
+	}
+
+	payload, err := json.Marshal(chatMsg)
+	if err != nil {
+		log.Println("Failed to marshal chat event:", err)
+		return
+	}
+
+	event := types.HubEvent{
+		Kind:     eventChat,
+		CourseID: chatMsg.CourseID,
+		SenderID: chatMsg.FromID,
+		Payload:  payload,
+	}
+	if chatMsg.ConversationID != "" {
+		event.RecipientIDs = chatMsg.RecipientIDs
+	}
+	if err := h.events.AppendEvent(&event); err != nil {
+		log.Printf("Failed to record chat event: %v", err)
+		return
+	}
+	chatMsg.EventID = event.ID
+}
+
+// recordNotification stores a notification for replay and sets its event ID.
+func (h *Hub) recordNotification(notif *types.Notification) {
+	if h.events == nil {
+		return
+	}
+
+	payload, err := notif.ToJSON()
+	if err != nil {
+		log.Println("Failed to marshal notification event:", err)
+		return
+	}
+
+	event := types.HubEvent{
+		Kind:         eventNotification,
+		RecipientIDs: notif.RecipientIDs,
+		Payload:      payload,
+	}
+	if err := h.events.AppendEvent(&event); err != nil {
+		log.Printf("Failed to record notification event: %v", err)
+		return
+	}
+	notif.EventID = event.ID
+}
+
+// replay writes the events the client missed after afterID straight to the
+// connection, before its writer starts, and returns the last replayed ID.
+func (h *Hub) replay(client *Client, conn clientConn, afterID int64) int64 {
+	client.mu.RLock()
+	courseIDs := make([]string, 0, len(client.classIDs))
+	for id := range client.classIDs {
+		courseIDs = append(courseIDs, id)
+	}
+	client.mu.RUnlock()
+
+	events, err := h.events.GetEventsSince(client.userID, courseIDs, afterID, maxReplayEvents)
+	if err != nil {
+		log.Printf("Failed to load missed events for user %s: %v", client.userID, err)
+		return afterID
+	}
+
+	lastID := afterID
+	for _, event := range events {
+		data, err := withEventID(event)
+		if err != nil {
+			log.Printf("Failed to prepare event %d for replay: %v", event.ID, err)
+			continue
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			log.Printf("Replay error for user %s: %v", client.userID, err)
+			return lastID
+		}
+		lastID = event.ID
+	}
+
+	if len(events) == maxReplayEvents {
+		data, _ := json.Marshal(map[string]interface{}{"type": frameResyncRequired, "event_id": lastID})
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		conn.WriteMessage(websocket.TextMessage, data)
+	}
+
+	return lastID
+}
+
+// withEventID adds the event ID to a stored frame.
+func withEventID(event types.HubEvent) ([]byte, error) {
+	switch event.Kind {
+	case eventNotification:
+		var notif types.Notification
+		if err := json.Unmarshal(event.Payload, &notif); err != nil {
+			return nil, err
+		}
+		notif.EventID = event.ID
+		return notif.ToJSON()
+
+	case eventStream:
+		var streamEvent types.StreamEvent
+		if err := json.Unmarshal(event.Payload, &streamEvent); err != nil {
+			return nil, err
+		}
+		streamEvent.EventID = event.ID
+		return json.Marshal(streamEvent)
+
+	default:
+		var chatMsg types.ChatMessage
+		if err := json.Unmarshal(event.Payload, &chatMsg); err != nil {
+			return nil, err
+		}
+		chatMsg.EventID = event.ID
+		return json.Marshal(chatMsg)
+	}
+}
+
+// markReady hands the client over to its writer. Frames that arrived during
+// the replay are queued unless they were already replayed.
+func (h *Hub) markReady(client *Client, lastReplayed int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	client.ready = true
+	backlog := client.backlog
+	client.backlog = nil
+	for _, frame := range backlog {
+		if frame.eventID != 0 && frame.eventID <= lastReplayed {
+			continue
+		}
+		h.enqueue(client, frame.eventID, frame.data)
+	}
+}
+
+func (h *Hub) pruneEvents() {
+	if h.events == nil {
+		return
+	}
+	if err := h.events.PruneEvents(time.Now().UTC().Add(-eventRetention)); err != nil {
+		log.Println(err)
+	}
+}
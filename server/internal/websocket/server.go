@@ -1,25 +1,25 @@
 package websocket
 
 import (
+	"course-flow/internal/middleware"
 	"course-flow/internal/services"
+	"course-flow/internal/storage"
 	"course-flow/internal/types"
+	"course-flow/internal/utils"
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-// Client represents a connected user
-type Client struct {
-	conn     *websocket.Conn
-	userID   string
-	classIDs map[string]bool // Classes the user belongs to
-}
-
-// Hub manages all WebSocket clients
+// Hub manages the WebSocket clients of this instance. Notifications and chat
+// are published through the broker so every instance delivers them to its own
+// clients.
 type Hub struct {
 	clients    map[*Client]bool
 	register   chan *Client
@@ -27,102 +27,285 @@ type Hub struct {
 	notify     chan types.Notification
 	mu         sync.Mutex
 	chat       chan types.ChatMessage
+	subscribe  chan subscription
+	presenceCh chan []presenceChange
+	visibility chan envelope
+	stream     chan types.StreamEvent
+	frames     chan envelope
+
+	broker     Broker
+	nodeID     string
+	presence   *presenceTracker
+	slowPolicy string
+	events     *storage.HubEventStorage // Durable log for replay, optional
+
+	allowedOrigins []string // Browser origins allowed to connect, shared with CORS
+	upgrader       websocket.Upgrader
 }
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin:     func(r *http.Request) bool { return true },
+// Session is an authenticated user opening a connection.
+type Session struct {
+	UserID        string
+	ClassIDs      map[string]bool // Courses the user belongs to
+	AppearOffline bool
+	ExpiresAt     time.Time // Expiry of the access token, zero if it never expires
 }
 
-func NewHub() *Hub {
-	return &Hub{
+// Kinds of events exchanged between instances
+const (
+	eventNotification = "notification"
+	eventChat         = "chat"
+	eventPresence     = "presence"
+	eventSubscription = "subscription"
+	eventVisibility   = "visibility"
+	eventStream       = "stream"
+	eventFrame        = "frame"
+)
+
+// envelope is the broker payload. Recipients are carried separately because
+// they are never serialized to clients.
+type envelope struct {
+	Kind         string              `json:"kind"`
+	Node         string              `json:"node"`
+	RecipientIDs []string            `json:"recipient_ids,omitempty"`
+	Notification *types.Notification `json:"notification,omitempty"`
+	Chat         *types.ChatMessage  `json:"chat,omitempty"`
+	Presence     map[string][]string `json:"presence,omitempty"` // Visible users connected to Node and their courses
+	Subscription *subscription       `json:"subscription,omitempty"`
+	Stream       *types.StreamEvent  `json:"stream,omitempty"`
+	Frame        json.RawMessage     `json:"frame,omitempty"`
+	UserIDs      []string            `json:"user_ids,omitempty"`
+	Hidden       bool                `json:"hidden,omitempty"`
+}
+
+func NewHub(broker Broker, events *storage.HubEventStorage) *Hub {
+	h := &Hub{
 		clients:    make(map[*Client]bool),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		notify:     make(chan types.Notification, 256),
 		chat:       make(chan types.ChatMessage, 256),
+		subscribe:  make(chan subscription, 256),
+		presenceCh: make(chan []presenceChange, 256),
+		visibility: make(chan envelope, 256),
+		stream:     make(chan types.StreamEvent, 256),
+		frames:     make(chan envelope, 256),
+		broker:     broker,
+		nodeID:     uuid.NewString(),
+		presence:   newPresenceTracker(),
+		slowPolicy: slowConsumerPolicy(),
+		events:     events,
+
+		allowedOrigins: utils.AllowedOrigins(),
 	}
+	h.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     h.checkOrigin,
+	}
+	return h
+}
+
+// checkOrigin only lets browsers connect from the allowed origins. Other
+// clients send no Origin header.
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if !middleware.OriginAllowed(h.allowedOrigins, origin) {
+		log.Printf("Rejected connection from origin %s", origin)
+		return false
+	}
+	return true
 }
 
 func (h *Hub) Run() {
+	if err := h.broker.Subscribe(h.receive); err != nil {
+		log.Fatalf("Failed to subscribe to hub broker: %v", err)
+	}
+
+	heartbeat := time.NewTicker(presenceInterval)
+	defer heartbeat.Stop()
+
+	prune := time.NewTicker(eventPruneInterval)
+	defer prune.Stop()
+
 	for {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
 			h.clients[client] = true
 			h.mu.Unlock()
+			go h.publishPresence()
 
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				client.conn.Close()
-			}
+			h.removeClient(client)
 			h.mu.Unlock()
+			go h.publishPresence()
+
+		case <-heartbeat.C:
+			go h.publishPresence()
+
+		case <-prune.C:
+			go h.pruneEvents()
 
 		case notif := <-h.notify:
+			data, err := notif.ToJSON()
+			if err != nil {
+				log.Println("Failed to marshal notification:", err)
+				continue
+			}
+
 			h.mu.Lock()
-			// fmt.Println("notif", notif)
 			for client := range h.clients {
-				// Check if the client is in the class and is a recipient
 				if contains(notif.RecipientIDs, client.userID) {
-					data, err := notif.ToJSON()
-					if err != nil {
-						log.Println("Failed to marshal notification:", err)
-						continue
-					}
-
-					err = client.conn.WriteMessage(websocket.TextMessage, data)
-					if err != nil {
-						go func(c *Client) { h.unregister <- c }(client)
-					}
+					h.enqueue(client, notif.EventID, data)
 				}
 			}
 			h.mu.Unlock()
 
 		case chatMsg := <-h.chat:
+			data, err := json.Marshal(chatMsg)
+			if err != nil {
+				log.Println("Failed to marshal chat message:", err)
+				continue
+			}
+
 			h.mu.Lock()
 			for client := range h.clients {
-				if _, ok := client.classIDs[chatMsg.CourseID]; ok && chatMsg.FromID != client.userID {
-					data, err := json.Marshal(chatMsg)
-					if err != nil {
-						log.Println("Failed to marshal chat message:", err)
-						continue
-					}
+				if chatMsg.FromID == client.userID {
+					continue
+				}
 
-					err = client.conn.WriteMessage(websocket.TextMessage, data)
-					if err != nil {
-						go func(c *Client) { h.unregister <- c }(client)
-					}
+				// Direct messages only go to the conversation participants
+				var ok bool
+				if chatMsg.ConversationID != "" {
+					ok = contains(chatMsg.RecipientIDs, client.userID)
+				} else {
+					ok = client.inCourse(chatMsg.CourseID)
+				}
+
+				if ok {
+					h.enqueue(client, chatMsg.EventID, data)
 				}
 			}
+			h.mu.Unlock()
 
+		case sub := <-h.subscribe:
+			h.mu.Lock()
+			h.applySubscription(sub)
 			h.mu.Unlock()
+			go h.publishPresence()
+
+		case changes := <-h.presenceCh:
+			h.mu.Lock()
+			h.broadcastPresence(changes)
+			h.mu.Unlock()
+
+		case event := <-h.visibility:
+			h.mu.Lock()
+			h.applyVisibility(event.UserIDs, event.Hidden)
+			h.mu.Unlock()
+
+		case event := <-h.stream:
+			h.mu.Lock()
+			h.broadcastStream(event)
+			h.mu.Unlock()
+
+		case event := <-h.frames:
+			h.mu.Lock()
+			for client := range h.clients {
+				if contains(event.RecipientIDs, client.userID) {
+					h.enqueue(client, 0, event.Frame)
+				}
+			}
+			h.mu.Unlock()
+		}
+	}
+}
+
+// enqueue queues a frame for a client without blocking. When the client's
+// queue is full the slow consumer policy decides whether the frame is dropped
+// or the client disconnected. Frames for clients still replaying are held
+// back. Callers must hold h.mu.
+func (h *Hub) enqueue(client *Client, eventID int64, data []byte) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+
+	if !client.ready {
+		if len(client.backlog) < sendQueueSize {
+			client.backlog = append(client.backlog, queuedFrame{eventID: eventID, data: data})
+			return
+		}
+		if h.slowPolicy == PolicyDrop {
+			log.Printf("Backlog full for user %s, dropping frame", client.userID)
+			return
+		}
+		log.Printf("Backlog full for user %s, disconnecting", client.userID)
+		h.removeClient(client)
+		return
+	}
+
+	select {
+	case client.send <- data:
+	default:
+		if h.slowPolicy == PolicyDrop {
+			log.Printf("Send queue full for user %s, dropping frame", client.userID)
+			return
 		}
+		log.Printf("Send queue full for user %s, disconnecting", client.userID)
+		h.removeClient(client)
+	}
+}
+
+// removeClient forgets a client and closes its queue, which makes its writer
+// close the connection. Callers must hold h.mu.
+func (h *Hub) removeClient(client *Client) {
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.send)
 	}
 }
 
-func (h *Hub) Handler(userID string, classIDs map[string]bool, chatService *services.ChatService, notifier types.Notifier) http.HandlerFunc {
+func (h *Hub) Handler(session Session, chatService *services.ChatService, notifier types.Notifier) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		conn, err := upgrader.Upgrade(w, r, nil)
+		conn, err := h.upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			log.Println("Upgrade error:", err)
 			return
 		}
 
-		client := &Client{
-			conn:     conn,
-			userID:   userID,
-			classIDs: classIDs,
-		}
+		userID := session.UserID
+		client := newClient(conn, userID, session.ClassIDs)
+		client.hidden = session.AppearOffline
+		client.expiresAt = session.ExpiresAt
 		h.register <- client
 
-		// Set up ping/pong
-		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		// Replay what the client missed, from the last_event_id it resumes
+		// from or else the last event it acknowledged
+		var lastReplayed int64
+		if h.events != nil {
+			afterID, err := strconv.ParseInt(r.URL.Query().Get("last_event_id"), 10, 64)
+			if err != nil {
+				afterID, err = h.events.GetLastAckedEvent(userID)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+			if afterID > 0 {
+				lastReplayed = h.replay(client, conn, afterID)
+			}
+		}
+		h.markReady(client, lastReplayed)
+		go client.writePump()
+
+		// Set up ping/pong, pings are sent by the writer
+		conn.SetReadDeadline(time.Now().Add(pongWait))
 		conn.SetPongHandler(func(string) error {
-			log.Printf("Pong received from user %s", userID)
-			conn.SetReadDeadline(time.Now().Add(60 * time.Second)) // Reset deadline on pong
+			conn.SetReadDeadline(time.Now().Add(pongWait)) // Reset deadline on pong
 			return nil
 		})
 
@@ -131,25 +314,6 @@ func (h *Hub) Handler(userID string, classIDs map[string]bool, chatService *serv
 			conn.Close()
 		}()
 
-		// Send pings periodically
-		go func() {
-			ticker := time.NewTicker(30 * time.Second)
-			defer ticker.Stop()
-			for {
-				select {
-				case <-ticker.C:
-					h.mu.Lock()
-					if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-						log.Printf("Ping error for user %s: %v", userID, err)
-						h.unregister <- client
-						h.mu.Unlock()
-						return
-					}
-					h.mu.Unlock()
-				}
-			}
-		}()
-
 		for {
 			_, msg, err := conn.ReadMessage()
 			if err != nil {
@@ -167,39 +331,255 @@ func (h *Hub) Handler(userID string, classIDs map[string]bool, chatService *serv
 			var chatMsg types.ChatMessage
 			if err := json.Unmarshal(msg, &chatMsg); err != nil {
 				log.Println("Unmarshal error:", err)
+				h.sendError(client, &chatMsg, &utils.ApiError{Code: http.StatusBadRequest, Message: "Invalid frame"})
 				continue
 			}
 
-			if chatMsg.Type != "chat_message" {
+			if chatMsg.Type == types.ChatTypeReauth {
+				h.reauthenticate(client, msg)
 				continue
 			}
 
-			if _, ok := client.classIDs[chatMsg.CourseID]; !ok {
-				log.Printf("User %s is not a member of course %s", userID, chatMsg.CourseID)
+			if chatMsg.Type == types.ChatTypeAck {
+				if h.events != nil && chatMsg.EventID > 0 {
+					if err := h.events.AckEvents(userID, chatMsg.EventID); err != nil {
+						log.Println(err)
+					}
+				}
 				continue
 			}
 
-			if err := chatService.ProcessChatMessage(&chatMsg); err != nil {
-				log.Printf("Error processing chat message: %v", err)
+			// Conversation membership is checked by the chat service
+			if !client.inCourse(chatMsg.CourseID) && chatMsg.ConversationID == "" {
+				log.Printf("User %s is not a member of course %s", userID, chatMsg.CourseID)
+				h.sendError(client, &chatMsg, &utils.ApiError{Code: http.StatusForbidden, Message: "You are not a member of this course"})
 				continue
 			}
 
-			h.chat <- chatMsg
+			// Never trust the sender the client claims to be
+			chatMsg.FromID = userID
 
-			payload := types.NotifMessageSentResponse{
-				ClassID: chatMsg.CourseID,
-				UserID:  chatMsg.FromID,
-				Content: chatMsg.Content,
-			}
-			if err := notifier.Notify(payload); err != nil {
-				log.Printf("Error notifying message sent: %v", err)
+			if err := h.handleChatFrame(&chatMsg, chatService, notifier); err != nil {
+				log.Printf("Error processing %s frame: %v", chatMsg.Type, err)
+				h.sendError(client, &chatMsg, err)
+				continue
 			}
 		}
 	}
 }
 
+// handleChatFrame processes a single client frame and broadcasts the result to
+// the members of the course or the participants of the conversation.
+func (h *Hub) handleChatFrame(chatMsg *types.ChatMessage, chatService *services.ChatService, notifier types.Notifier) error {
+	switch chatMsg.Type {
+	case types.ChatTypeMessage:
+		if err := chatService.ProcessChatMessage(chatMsg); err != nil {
+			return err
+		}
+
+		h.publishChat(chatMsg)
+
+		if chatMsg.ConversationID != "" {
+			return nil
+		}
+
+		payload := types.NotifMessageSentResponse{
+			ClassID: chatMsg.CourseID,
+			UserID:  chatMsg.FromID,
+			Content: chatMsg.Content,
+		}
+		if err := notifier.Notify(payload); err != nil {
+			log.Printf("Error notifying message sent: %v", err)
+		}
+		return nil
+
+	case types.ChatTypeEdit:
+		if err := chatService.EditChatMessage(chatMsg); err != nil {
+			return err
+		}
+
+	case types.ChatTypeDelete:
+		if err := chatService.DeleteChatMessage(chatMsg); err != nil {
+			return err
+		}
+
+	case types.ChatTypeRead:
+		if err := chatService.MarkRead(chatMsg); err != nil {
+			return err
+		}
+
+	case types.ChatTypeTyping:
+		if err := chatService.ProcessTyping(chatMsg); err != nil {
+			return err
+		}
+
+	default:
+		return nil
+	}
+
+	h.publishChat(chatMsg)
+	return nil
+}
+
+// reauthenticate extends the connection with a fresh access token of the
+// same user, sent in a reauth frame.
+func (h *Hub) reauthenticate(client *Client, msg []byte) {
+	var frame struct {
+		Type  string `json:"type"`
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(msg, &frame); err != nil || frame.Token == "" {
+		h.sendError(client, &types.ChatMessage{Type: types.ChatTypeReauth}, &utils.ApiError{Code: http.StatusBadRequest, Message: "Missing access token"})
+		return
+	}
+
+	userID, expiresAt, err := utils.ParseAccessToken(frame.Token)
+	if err == nil && userID != client.userID {
+		err = &utils.ApiError{Code: http.StatusForbidden, Message: "Token belongs to another user"}
+	}
+	if err != nil {
+		h.sendError(client, &types.ChatMessage{Type: types.ChatTypeReauth}, err)
+		return
+	}
+
+	client.setExpiry(expiresAt)
+
+	data, err := json.Marshal(reauthFrame{Type: frameReauthenticated, ExpiresAt: expiresAt})
+	if err != nil {
+		log.Println("Failed to marshal reauth frame:", err)
+		return
+	}
+	h.mu.Lock()
+	h.enqueue(client, 0, data)
+	h.mu.Unlock()
+}
+
+// sendError reports a rejected frame back to the client that sent it. Internal
+// errors are not exposed.
+func (h *Hub) sendError(client *Client, chatMsg *types.ChatMessage, err error) {
+	frame := types.ChatErrorFrame{
+		Type:           types.ChatTypeError,
+		Code:           http.StatusInternalServerError,
+		Message:        "Failed to process message",
+		FrameType:      chatMsg.Type,
+		CourseID:       chatMsg.CourseID,
+		ConversationID: chatMsg.ConversationID,
+		MessageID:      chatMsg.ID,
+	}
+	if apiErr, ok := err.(*utils.ApiError); ok {
+		frame.Code = apiErr.Code
+		frame.Message = apiErr.Message
+	}
+
+	data, err := json.Marshal(frame)
+	if err != nil {
+		log.Println("Failed to marshal error frame:", err)
+		return
+	}
+
+	h.mu.Lock()
+	h.enqueue(client, 0, data)
+	h.mu.Unlock()
+}
+
+// Notify delivers a notification to its recipients on every instance.
 func (h *Hub) Notify(notif types.Notification) {
-	h.notify <- notif
+	h.recordNotification(&notif)
+	h.publish(envelope{
+		Kind:         eventNotification,
+		RecipientIDs: notif.RecipientIDs,
+		Notification: &notif,
+	})
+}
+
+func (h *Hub) publishChat(chatMsg *types.ChatMessage) {
+	h.recordChat(chatMsg)
+	h.publish(envelope{
+		Kind:         eventChat,
+		RecipientIDs: chatMsg.RecipientIDs,
+		Chat:         chatMsg,
+	})
+}
+
+// SendFrame sends a transient frame to the connections of the users on every
+// instance. Unlike notifications it is neither stored nor replayed, so
+// clients reload the state it describes after reconnecting.
+func (h *Hub) SendFrame(userIDs []string, frame interface{}) {
+	if len(userIDs) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(frame)
+	if err != nil {
+		log.Println("Failed to marshal frame:", err)
+		return
+	}
+	h.publish(envelope{Kind: eventFrame, RecipientIDs: userIDs, Frame: data})
+}
+
+func (h *Hub) publish(event envelope) {
+	event.Node = h.nodeID
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to marshal %s event: %v", event.Kind, err)
+		return
+	}
+	if err := h.broker.Publish(data); err != nil {
+		log.Printf("Failed to publish %s event: %v", event.Kind, err)
+	}
+}
+
+// receive handles an event from the broker and hands it to Run for delivery to
+// the clients connected to this instance.
+func (h *Hub) receive(payload []byte) {
+	var event envelope
+	if err := json.Unmarshal(payload, &event); err != nil {
+		log.Printf("Failed to unmarshal hub event: %v", err)
+		return
+	}
+
+	switch event.Kind {
+	case eventNotification:
+		if event.Notification == nil {
+			return
+		}
+		event.Notification.RecipientIDs = event.RecipientIDs
+		h.notify <- *event.Notification
+
+	case eventChat:
+		if event.Chat == nil {
+			return
+		}
+		event.Chat.RecipientIDs = event.RecipientIDs
+		h.chat <- *event.Chat
+
+	case eventPresence:
+		if changes := h.presence.update(event.Node, event.Presence); len(changes) > 0 {
+			h.presenceCh <- changes
+		}
+
+	case eventVisibility:
+		h.visibility <- event
+
+	case eventSubscription:
+		if event.Subscription == nil {
+			return
+		}
+		h.subscribe <- *event.Subscription
+
+	case eventStream:
+		if event.Stream == nil {
+			return
+		}
+		h.stream <- *event.Stream
+
+	case eventFrame:
+		if len(event.Frame) == 0 {
+			return
+		}
+		h.frames <- event
+	}
 }
 
 func contains(slice []string, item string) bool {
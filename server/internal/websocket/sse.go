@@ -0,0 +1,146 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// sseRetry is the reconnection delay suggested to EventSource clients.
+const sseRetry = 3 * time.Second
+
+// sseConn lets a Server-Sent Events response act as a client connection.
+// Text frames become events with their event ID, pings become heartbeat
+// comments. It is only written to by the client's writer.
+type sseConn struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	flusher http.Flusher
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func newSSEConn(w http.ResponseWriter, flusher http.Flusher) *sseConn {
+	return &sseConn{
+		w:       w,
+		rc:      http.NewResponseController(w),
+		flusher: flusher,
+		closed:  make(chan struct{}),
+	}
+}
+
+func (c *sseConn) WriteMessage(messageType int, data []byte) error {
+	var err error
+	switch messageType {
+	case websocket.TextMessage:
+		if id := frameEventID(data); id > 0 {
+			_, err = fmt.Fprintf(c.w, "id: %d\n", id)
+		}
+		if err == nil {
+			_, err = fmt.Fprintf(c.w, "data: %s\n\n", data)
+		}
+	case websocket.PingMessage:
+		_, err = fmt.Fprint(c.w, ": heartbeat\n\n")
+	default:
+		// There is no close frame, the stream simply ends
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.flusher.Flush()
+	return nil
+}
+
+func (c *sseConn) SetWriteDeadline(t time.Time) error {
+	return c.rc.SetWriteDeadline(t)
+}
+
+func (c *sseConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+// frameEventID reads the event_id of a frame, or 0 when it has none.
+func frameEventID(data []byte) int64 {
+	var frame struct {
+		EventID int64 `json:"event_id"`
+	}
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return 0
+	}
+	return frame.EventID
+}
+
+// SSEHandler streams the same events as the WebSocket handler over
+// Server-Sent Events, for networks that block WebSocket upgrades. The stream
+// is receive only. Clients resume with the Last-Event-ID header EventSource
+// sends on reconnect, or with the last_event_id query param. The stream ends
+// when the access token expires and is reopened with a new ticket.
+func (h *Hub) SSEHandler(session Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.checkOrigin(r) {
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds())
+		flusher.Flush()
+
+		conn := newSSEConn(w, flusher)
+		userID := session.UserID
+		client := newClient(conn, userID, session.ClassIDs)
+		client.hidden = session.AppearOffline
+		client.expiresAt = session.ExpiresAt
+		h.register <- client
+
+		var lastReplayed int64
+		if h.events != nil {
+			lastEventID := r.Header.Get("Last-Event-ID")
+			if lastEventID == "" {
+				lastEventID = r.URL.Query().Get("last_event_id")
+			}
+			afterID, err := strconv.ParseInt(lastEventID, 10, 64)
+			if err != nil {
+				afterID, err = h.events.GetLastAckedEvent(userID)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+			if afterID > 0 {
+				lastReplayed = h.replay(client, conn, afterID)
+			}
+		}
+		h.markReady(client, lastReplayed)
+		go client.writePump()
+
+		// Wait for the client to go away or the writer to give up
+		select {
+		case <-r.Context().Done():
+			log.Printf("Event stream closed for user %s", userID)
+		case <-conn.closed:
+		}
+
+		// The handler must not return while the writer may still write to
+		// the response
+		h.unregister <- client
+		<-conn.closed
+	}
+}
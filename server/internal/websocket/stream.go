@@ -0,0 +1,59 @@
+package websocket
+
+import (
+	"course-flow/internal/types"
+	"encoding/json"
+	"log"
+)
+
+// PublishStream sends a course stream event to the other members connected to
+// the course, on every instance. Like chat, the actor already has the result
+// of its request and is skipped.
+func (h *Hub) PublishStream(event types.StreamEvent) {
+	h.recordStream(&event)
+	h.publish(envelope{
+		Kind:   eventStream,
+		Stream: &event,
+	})
+}
+
+// recordStream stores a stream event for replay and sets its event ID.
+func (h *Hub) recordStream(event *types.StreamEvent) {
+	if h.events == nil {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Failed to marshal stream event:", err)
+		return
+	}
+
+	hubEvent := types.HubEvent{
+		Kind:     eventStream,
+		CourseID: event.CourseID,
+		SenderID: event.ActorID,
+		Payload:  payload,
+	}
+	if err := h.events.AppendEvent(&hubEvent); err != nil {
+		log.Printf("Failed to record stream event: %v", err)
+		return
+	}
+	event.EventID = hubEvent.ID
+}
+
+// broadcastStream queues a stream event for the local connections of the
+// course. Callers must hold h.mu.
+func (h *Hub) broadcastStream(event types.StreamEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Failed to marshal stream event:", err)
+		return
+	}
+
+	for client := range h.clients {
+		if client.userID != event.ActorID && client.inCourse(event.CourseID) {
+			h.enqueue(client, event.EventID, data)
+		}
+	}
+}
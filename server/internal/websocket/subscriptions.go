@@ -0,0 +1,98 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// Reasons sent with a course_removed frame
+const (
+	RemovedLeft     = "left"
+	RemovedKicked   = "kicked"
+	RemovedArchived = "archived"
+	RemovedDeleted  = "deleted"
+)
+
+// frameCourseRemoved tells a client it no longer receives a course's events.
+const frameCourseRemoved = "course_removed"
+
+type courseRemovedFrame struct {
+	Type     string `json:"type"`
+	CourseID string `json:"course_id"`
+	Reason   string `json:"reason"`
+}
+
+// subscription changes which courses live connections receive events for.
+// An empty UserIDs list targets every connection subscribed to the course.
+type subscription struct {
+	CourseID string   `json:"course_id"`
+	UserIDs  []string `json:"user_ids,omitempty"`
+	Remove   bool     `json:"remove"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+// Subscribe starts delivering a course's events to the live connections of the
+// given users, e.g. after they joined the course.
+func (h *Hub) Subscribe(courseID string, userIDs ...string) {
+	if len(userIDs) == 0 {
+		return
+	}
+	h.publish(envelope{
+		Kind:         eventSubscription,
+		Subscription: &subscription{CourseID: courseID, UserIDs: userIDs},
+	})
+}
+
+// Unsubscribe stops delivering a course's events to the live connections of
+// the given users and sends them a course_removed frame.
+func (h *Hub) Unsubscribe(courseID, reason string, userIDs ...string) {
+	if len(userIDs) == 0 {
+		return
+	}
+	h.publish(envelope{
+		Kind:         eventSubscription,
+		Subscription: &subscription{CourseID: courseID, UserIDs: userIDs, Remove: true, Reason: reason},
+	})
+}
+
+// RemoveCourse unsubscribes every live connection from a course, e.g. when it
+// is archived or deleted.
+func (h *Hub) RemoveCourse(courseID, reason string) {
+	h.publish(envelope{
+		Kind:         eventSubscription,
+		Subscription: &subscription{CourseID: courseID, Remove: true, Reason: reason},
+	})
+}
+
+// applySubscription updates the connections of this instance. Callers must
+// hold h.mu.
+func (h *Hub) applySubscription(sub subscription) {
+	var removedFrame []byte
+	if sub.Remove {
+		data, err := json.Marshal(courseRemovedFrame{
+			Type:     frameCourseRemoved,
+			CourseID: sub.CourseID,
+			Reason:   sub.Reason,
+		})
+		if err != nil {
+			log.Println("Failed to marshal course removed frame:", err)
+			return
+		}
+		removedFrame = data
+	}
+
+	for client := range h.clients {
+		if len(sub.UserIDs) > 0 && !contains(sub.UserIDs, client.userID) {
+			continue
+		}
+
+		if !sub.Remove {
+			client.addCourse(sub.CourseID)
+			continue
+		}
+
+		if client.removeCourse(sub.CourseID) {
+			h.enqueue(client, 0, removedFrame)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"course-flow/internal/middleware"
 	"course-flow/internal/router"
+	"course-flow/internal/utils"
 	"course-flow/pkg/database"
 	"fmt"
 	"log"
@@ -17,7 +18,7 @@ func main() {
 	defer db.Close()
 
 	router := router.NewRouter(db)
-	appRouter := middleware.CORSMiddleware([]string{"http://localhost:5173"})(router.Setup())
+	appRouter := middleware.CORSMiddleware(utils.AllowedOrigins())(router.Setup())
 
 	// Start the server
 	port := ":8080"